@@ -0,0 +1,469 @@
+package chessEngine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultServeAddress           = ":8080"
+	DefaultServeSearchers         = 1
+	DefaultServeHashMB            = 16
+	DefaultServeMoveTime          = 1000
+	DefaultServeMaximumMoveTime   = 30000
+	DefaultServeMaximumDepth      = 30
+	DefaultServeMaximumMultiPV    = 8
+	DefaultServeMaximumPerftDepth = 5
+	DefaultServeMaximumMoves      = 512
+	DefaultServeSearcherWait      = 10 * time.Second
+	MaximumServeRequestBodySize   = 1 << 20
+)
+
+type AnalysisServerSettings struct {
+	Address                string
+	Searchers              int
+	TranspositionTableSize uint64
+	DefaultMoveTime        int64
+	MaximumMoveTime        int64
+	MaximumDepth           int
+	MaximumMultiPV         int
+	MaximumPerftDepth      int
+	MaximumMoves           int
+	SearcherWait           time.Duration
+}
+
+func DefaultAnalysisServerSettings() AnalysisServerSettings {
+	return AnalysisServerSettings{
+		Address:                DefaultServeAddress,
+		Searchers:              DefaultServeSearchers,
+		TranspositionTableSize: DefaultServeHashMB,
+		DefaultMoveTime:        DefaultServeMoveTime,
+		MaximumMoveTime:        DefaultServeMaximumMoveTime,
+		MaximumDepth:           DefaultServeMaximumDepth,
+		MaximumMultiPV:         DefaultServeMaximumMultiPV,
+		MaximumPerftDepth:      DefaultServeMaximumPerftDepth,
+		MaximumMoves:           DefaultServeMaximumMoves,
+		SearcherWait:           DefaultServeSearcherWait,
+	}
+}
+
+// ParseAnalysisServerSettings reads "<name> <value>" pairs, e.g. "address :9000 searchers 4 maxMoveTime 10000".
+func ParseAnalysisServerSettings(command string) (AnalysisServerSettings, error) {
+	settings := DefaultAnalysisServerSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 0 {
+		return settings, errors.New("expected <name> <value> pairs")
+	}
+
+	for index := 0; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "address":
+			settings.Address = value
+		case "searchers":
+			settings.Searchers, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		case "moveTime":
+			settings.DefaultMoveTime, err = strconv.ParseInt(value, 10, 64)
+		case "maxMoveTime":
+			settings.MaximumMoveTime, err = strconv.ParseInt(value, 10, 64)
+		case "maxDepth":
+			settings.MaximumDepth, err = strconv.Atoi(value)
+		case "maxMultiPV":
+			settings.MaximumMultiPV, err = strconv.Atoi(value)
+		case "maxPerftDepth":
+			settings.MaximumPerftDepth, err = strconv.Atoi(value)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.Searchers < 1 || settings.TranspositionTableSize < 1 || settings.DefaultMoveTime < 1 || settings.MaximumMoveTime < settings.DefaultMoveTime {
+		return settings, errors.New("searchers, hash and moveTime must be positive, and maxMoveTime at least moveTime")
+	}
+
+	if settings.MaximumDepth < 1 || settings.MaximumDepth > MaxDepth || settings.MaximumMultiPV < 1 || settings.MaximumPerftDepth < 1 {
+		return settings, fmt.Errorf("maxDepth must be between 1 and %d, maxMultiPV and maxPerftDepth positive", MaxDepth)
+	}
+
+	return settings, nil
+}
+
+// AnalysisRequest is read from the JSON body of POST requests, or from the query parameters of GET requests,
+// where the moves are separated by spaces or commas.
+type AnalysisRequest struct {
+	FEN      string   `json:"fen"`
+	Moves    []string `json:"moves"`
+	Depth    int      `json:"depth"`
+	MoveTime int64    `json:"movetime"`
+	MultiPV  int      `json:"multipv"`
+}
+
+type AnalysisResponse struct {
+	BestMove string       `json:"bestmove"`
+	Lines    []SearchInfo `json:"lines"`
+}
+
+type analysisEngine struct {
+	gameSearcher GameSearcher
+	evaluator    Evaluator
+}
+
+type analysisError struct {
+	statusCode int
+	message    string
+}
+
+func (err analysisError) Error() string {
+	return err.message
+}
+
+func badRequest(format string, arguments ...any) error {
+	return analysisError{statusCode: http.StatusBadRequest, message: fmt.Sprintf(format, arguments...)}
+}
+
+// AnalysisServer answers analysis requests over HTTP with a pool of game searchers, each request holding one of
+// the searchers until it's answered.
+type AnalysisServer struct {
+	settings AnalysisServerSettings
+	engines  chan *analysisEngine
+}
+
+func NewAnalysisServer(settings AnalysisServerSettings, engines []GameSearcher, evaluators []Evaluator) (*AnalysisServer, error) {
+	if len(engines) == 0 || len(engines) != len(evaluators) {
+		return nil, errors.New("expected a positive number of game searchers, each with an evaluator")
+	}
+
+	server := &AnalysisServer{settings: settings, engines: make(chan *analysisEngine, len(engines))}
+	for index := range engines {
+		engines[index].Reset(evaluators[index])
+		if defaultSearcher, ok := engines[index].(*DefaultSearcher); ok {
+			defaultSearcher.SetTranspositionTable(NewDefaultTranspositionTable(settings.TranspositionTableSize * 1024 * 1024))
+		}
+		server.engines <- &analysisEngine{gameSearcher: engines[index], evaluator: evaluators[index]}
+	}
+	return server, nil
+}
+
+func (server *AnalysisServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/analyse", server.handleAnalyse)
+	mux.HandleFunc("/moves", server.handleMoves)
+	mux.HandleFunc("/perft", server.handlePerft)
+	mux.HandleFunc("/evaluate", server.handleEvaluate)
+	mux.HandleFunc("/apply", server.handleApply)
+	return mux
+}
+
+func (server *AnalysisServer) ListenAndServe() error {
+	fmt.Printf("Serving analysis requests on %s\n", server.settings.Address)
+	return http.ListenAndServe(server.settings.Address, server.Handler())
+}
+
+func (server *AnalysisServer) acquireEngine(ctx context.Context) (*analysisEngine, error) {
+	waitContext, cancel := context.WithTimeout(ctx, server.settings.SearcherWait)
+	defer cancel()
+
+	select {
+	case engine := <-server.engines:
+		return engine, nil
+	case <-waitContext.Done():
+		return nil, analysisError{statusCode: http.StatusServiceUnavailable, message: "all searchers are busy"}
+	}
+}
+
+func (server *AnalysisServer) releaseEngine(engine *analysisEngine) {
+	server.engines <- engine
+}
+
+func readAnalysisRequest(request *http.Request) (AnalysisRequest, error) {
+	analysisRequest := AnalysisRequest{}
+
+	switch request.Method {
+	case http.MethodPost:
+		decoder := json.NewDecoder(http.MaxBytesReader(nil, request.Body, MaximumServeRequestBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&analysisRequest); err != nil {
+			return analysisRequest, badRequest("invalid request body: %v", err)
+		}
+	case http.MethodGet:
+		query := request.URL.Query()
+		analysisRequest.FEN = query.Get("fen")
+		analysisRequest.Moves = strings.FieldsFunc(query.Get("moves"), func(char rune) bool { return char == ' ' || char == ',' })
+
+		for name, field := range map[string]*int{"depth": &analysisRequest.Depth, "multipv": &analysisRequest.MultiPV} {
+			if value := query.Get(name); value != "" {
+				number, err := strconv.Atoi(value)
+				if err != nil {
+					return analysisRequest, badRequest("invalid %s %q", name, value)
+				}
+				*field = number
+			}
+		}
+
+		if value := query.Get("movetime"); value != "" {
+			moveTime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return analysisRequest, badRequest("invalid movetime %q", value)
+			}
+			analysisRequest.MoveTime = moveTime
+		}
+	default:
+		return analysisRequest, analysisError{statusCode: http.StatusMethodNotAllowed, message: "only GET and POST are allowed"}
+	}
+
+	if analysisRequest.FEN == "" || analysisRequest.FEN == "startpos" {
+		analysisRequest.FEN = FENStartPosition
+	}
+	return analysisRequest, nil
+}
+
+// setUpPosition loads the requested position into the searcher of the engine and plays the requested moves.
+func (server *AnalysisServer) setUpPosition(engine *analysisEngine, analysisRequest AnalysisRequest) error {
+	if err := ValidateFEN(analysisRequest.FEN); err != nil {
+		return badRequest("invalid FEN: %v", err)
+	}
+
+	if len(analysisRequest.Moves) > server.settings.MaximumMoves {
+		return badRequest("at most %d moves are allowed", server.settings.MaximumMoves)
+	}
+
+	engine.gameSearcher.InitializeSearchInfo(analysisRequest.FEN, engine.evaluator)
+	position := engine.gameSearcher.Position()
+
+	position.DoNullMove()
+	opponentInCheck := position.IsCurrentSideInCheck()
+	position.unDoPreviousNullMove()
+	if opponentInCheck {
+		return badRequest("invalid FEN: the side which isn't to move is in check")
+	}
+
+	for _, uciMove := range analysisRequest.Moves {
+		move, found := findLegalUciMove(position, uciMove, engine.evaluator)
+		if !found {
+			return badRequest("illegal move %s", uciMove)
+		}
+		applyGameMove(engine.gameSearcher, move, engine.evaluator)
+	}
+	return nil
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeAnalysisError(writer http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+	var requestError analysisError
+	if errors.As(err, &requestError) {
+		statusCode = requestError.statusCode
+	}
+	writeJSON(writer, statusCode, map[string]string{"error": err.Error()})
+}
+
+// withPosition reads the request, sets up its position on a pooled engine, and passes them to the handler.
+func (server *AnalysisServer) withPosition(writer http.ResponseWriter, request *http.Request, handle func(engine *analysisEngine, analysisRequest AnalysisRequest) error) {
+	analysisRequest, err := readAnalysisRequest(request)
+	if err != nil {
+		writeAnalysisError(writer, err)
+		return
+	}
+
+	engine, err := server.acquireEngine(request.Context())
+	if err != nil {
+		writeAnalysisError(writer, err)
+		return
+	}
+	defer server.releaseEngine(engine)
+
+	if err := server.setUpPosition(engine, analysisRequest); err != nil {
+		writeAnalysisError(writer, err)
+		return
+	}
+
+	if err := handle(engine, analysisRequest); err != nil {
+		writeAnalysisError(writer, err)
+	}
+}
+
+// getSearchLimits checks the requested limits against the server limits. Searches without a move time are
+// bounded by the maximum move time, so that every search ends.
+func (server *AnalysisServer) getSearchLimits(analysisRequest AnalysisRequest) (uint8, int64, int, error) {
+	depth, moveTime, multiPV := analysisRequest.Depth, analysisRequest.MoveTime, max(1, analysisRequest.MultiPV)
+
+	if depth < 0 || depth > server.settings.MaximumDepth {
+		return 0, 0, 0, badRequest("depth must be at most %d", server.settings.MaximumDepth)
+	}
+	if moveTime < 0 || moveTime > server.settings.MaximumMoveTime {
+		return 0, 0, 0, badRequest("movetime must be at most %d", server.settings.MaximumMoveTime)
+	}
+	if multiPV > server.settings.MaximumMultiPV {
+		return 0, 0, 0, badRequest("multipv must be at most %d", server.settings.MaximumMultiPV)
+	}
+
+	if depth == 0 && moveTime == 0 {
+		moveTime = server.settings.DefaultMoveTime
+	} else if moveTime == 0 {
+		moveTime = server.settings.MaximumMoveTime
+	}
+	if depth == 0 {
+		depth = server.settings.MaximumDepth
+	}
+
+	return uint8(depth), moveTime, multiPV, nil
+}
+
+// searchInfoWriter passes each complete line written to it to the callback.
+type searchInfoWriter struct {
+	pendingLine []byte
+	onLine      func(line string)
+}
+
+func (writer *searchInfoWriter) Write(data []byte) (int, error) {
+	writer.pendingLine = append(writer.pendingLine, data...)
+	for {
+		lineEnd := strings.IndexByte(string(writer.pendingLine), '\n')
+		if lineEnd < 0 {
+			return len(data), nil
+		}
+		writer.onLine(string(writer.pendingLine[:lineEnd]))
+		writer.pendingLine = writer.pendingLine[lineEnd+1:]
+	}
+}
+
+// handleAnalyse searches the position, and answers with the best move and the latest line of each principal
+// variation. Clients accepting "text/event-stream" receive each info line as an "info" event while the search
+// progresses, followed by the answer as a "bestmove" event.
+func (server *AnalysisServer) handleAnalyse(writer http.ResponseWriter, request *http.Request) {
+	server.withPosition(writer, request, func(engine *analysisEngine, analysisRequest AnalysisRequest) error {
+		depth, moveTime, multiPV, err := server.getSearchLimits(analysisRequest)
+		if err != nil {
+			return err
+		}
+
+		if multiPVOption, ok := engine.gameSearcher.GetOptions()["MultiPV"]; ok {
+			if err := multiPVOption.Set(strconv.Itoa(multiPV)); err != nil {
+				return badRequest("invalid multipv: %v", err)
+			}
+		}
+
+		flusher, streaming := writer.(http.Flusher)
+		streaming = streaming && strings.Contains(request.Header.Get("Accept"), "text/event-stream")
+		if streaming {
+			writer.Header().Set("Content-Type", "text/event-stream")
+			writer.Header().Set("Cache-Control", "no-cache")
+			writer.WriteHeader(http.StatusOK)
+		}
+
+		latestLines := map[int]SearchInfo{}
+		if infoOutputSearcher, ok := engine.gameSearcher.(interface{ SetInfoOutput(io.Writer) }); ok {
+			infoOutputSearcher.SetInfoOutput(&searchInfoWriter{onLine: func(line string) {
+				searchInfo, ok := ParseSearchInfo(line)
+				if !ok {
+					return
+				}
+
+				latestLines[searchInfo.MultiPV] = searchInfo
+				if streaming {
+					writeServerSentEvent(writer, "info", searchInfo)
+					flusher.Flush()
+				}
+			}})
+			defer infoOutputSearcher.SetInfoOutput(io.Discard)
+		}
+
+		searchDone := make(chan struct{})
+		defer close(searchDone)
+		go func() {
+			select {
+			case <-request.Context().Done():
+				engine.gameSearcher.StopSearch()
+			case <-searchDone:
+			}
+		}()
+
+		engine.gameSearcher.InitializeTimeManager(InfiniteTime, NoValue, moveTime, NoValue, depth, math.MaxUint64)
+		bestMove := engine.gameSearcher.StartSearch(engine.evaluator)
+
+		analysisResponse := AnalysisResponse{BestMove: bestMove.String(), Lines: []SearchInfo{}}
+		for lineNumber := 1; lineNumber <= multiPV; lineNumber++ {
+			if searchInfo, found := latestLines[lineNumber]; found {
+				analysisResponse.Lines = append(analysisResponse.Lines, searchInfo)
+			}
+		}
+
+		if streaming {
+			writeServerSentEvent(writer, "bestmove", analysisResponse)
+			flusher.Flush()
+		} else {
+			writeJSON(writer, http.StatusOK, analysisResponse)
+		}
+		return nil
+	})
+}
+
+func writeServerSentEvent(writer io.Writer, event string, value any) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func (server *AnalysisServer) handleMoves(writer http.ResponseWriter, request *http.Request) {
+	server.withPosition(writer, request, func(engine *analysisEngine, _ AnalysisRequest) error {
+		position := engine.gameSearcher.Position()
+		legalMoves := GenerateLegalMoves(position, engine.evaluator)
+
+		moves := make([]string, 0, legalMoves.Size)
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			moves = append(moves, legalMoves.Moves[moveIndex].String())
+		}
+
+		writeJSON(writer, http.StatusOK, map[string]any{"fen": position.GenFEN(), "moves": moves, "inCheck": position.IsCurrentSideInCheck()})
+		return nil
+	})
+}
+
+func (server *AnalysisServer) handlePerft(writer http.ResponseWriter, request *http.Request) {
+	server.withPosition(writer, request, func(engine *analysisEngine, analysisRequest AnalysisRequest) error {
+		if analysisRequest.Depth < 1 || analysisRequest.Depth > server.settings.MaximumPerftDepth {
+			return badRequest("depth must be between 1 and %d", server.settings.MaximumPerftDepth)
+		}
+
+		nodes := Perft(engine.gameSearcher.Position(), uint8(analysisRequest.Depth), engine.evaluator)
+		writeJSON(writer, http.StatusOK, map[string]any{"depth": analysisRequest.Depth, "nodes": nodes})
+		return nil
+	})
+}
+
+// handleEvaluate answers with the static evaluation of the position, from the point of view of the side to move.
+func (server *AnalysisServer) handleEvaluate(writer http.ResponseWriter, request *http.Request) {
+	server.withPosition(writer, request, func(engine *analysisEngine, _ AnalysisRequest) error {
+		position := engine.gameSearcher.Position()
+		writeJSON(writer, http.StatusOK, map[string]any{"fen": position.GenFEN(), "score": engine.evaluator.EvaluatePosition(position)})
+		return nil
+	})
+}
+
+func (server *AnalysisServer) handleApply(writer http.ResponseWriter, request *http.Request) {
+	server.withPosition(writer, request, func(engine *analysisEngine, _ AnalysisRequest) error {
+		writeJSON(writer, http.StatusOK, map[string]any{"fen": engine.gameSearcher.Position().GenFEN()})
+		return nil
+	})
+}
@@ -0,0 +1,234 @@
+package chessEngine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestAnalysisServer(t *testing.T, modifySettings func(settings *AnalysisServerSettings)) *httptest.Server {
+	settings := DefaultAnalysisServerSettings()
+	settings.TranspositionTableSize = 1
+	if modifySettings != nil {
+		modifySettings(&settings)
+	}
+
+	analysisServer, err := NewAnalysisServer(settings, []GameSearcher{NewDefaultSearcher()}, []Evaluator{&DefaultEvaluator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(analysisServer.Handler())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// getAnalysisJSON sends a GET request with the query parameters and decodes the JSON answer, returning its status.
+func getAnalysisJSON(t *testing.T, httpServer *httptest.Server, path string, query url.Values, answer any) int {
+	response, err := http.Get(httpServer.URL + path + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(response.Body).Decode(answer); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return response.StatusCode
+}
+
+func TestAnalysisServerEndpoints(t *testing.T) {
+	httpServer := startTestAnalysisServer(t, nil)
+
+	moves := struct {
+		FEN     string   `json:"fen"`
+		Moves   []string `json:"moves"`
+		InCheck bool     `json:"inCheck"`
+	}{}
+	if status := getAnalysisJSON(t, httpServer, "/moves", url.Values{"moves": {"e2e4,d7d5 f1b5"}}, &moves); status != http.StatusOK || !moves.InCheck || len(moves.Moves) != 5 {
+		t.Errorf("/moves answered %d with %+v", status, moves)
+	}
+
+	applied := struct {
+		FEN string `json:"fen"`
+	}{}
+	getAnalysisJSON(t, httpServer, "/apply", url.Values{"fen": {"startpos"}, "moves": {"e2e4"}}, &applied)
+	if strings.Join(strings.Fields(applied.FEN)[:4], " ") != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq -" {
+		t.Errorf("/apply answered %s", applied.FEN)
+	}
+
+	perft := struct {
+		Depth int    `json:"depth"`
+		Nodes uint64 `json:"nodes"`
+	}{}
+	if status := getAnalysisJSON(t, httpServer, "/perft", url.Values{"depth": {"3"}}, &perft); status != http.StatusOK || perft.Nodes != 8902 {
+		t.Errorf("/perft answered %d with %+v", status, perft)
+	}
+
+	evaluation := map[string]any{}
+	if status := getAnalysisJSON(t, httpServer, "/evaluate", url.Values{"fen": {"4k3/8/8/8/8/8/8/3QK3 w - - 0 1"}}, &evaluation); status != http.StatusOK || evaluation["score"].(float64) < 500 {
+		t.Errorf("/evaluate answered %d with %v", status, evaluation)
+	}
+
+	analysis := AnalysisResponse{}
+	if status := getAnalysisJSON(t, httpServer, "/analyse", url.Values{"fen": {"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1"}, "depth": {"4"}}, &analysis); status != http.StatusOK {
+		t.Fatalf("/analyse answered %d", status)
+	}
+	if analysis.BestMove != "a1a8" || len(analysis.Lines) != 1 || analysis.Lines[0].ScoreType != MateScoreType || analysis.Lines[0].Score != 1 {
+		t.Errorf("/analyse answered %+v", analysis)
+	}
+
+	// The JSON body of POST requests may ask for several principal variations
+	response, err := http.Post(httpServer.URL+"/analyse", "application/json", strings.NewReader(`{"fen": "startpos", "moves": ["e2e4"], "depth": 3, "multipv": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	analysis = AnalysisResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&analysis); err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /analyse answered %d: %v", response.StatusCode, err)
+	}
+	if len(analysis.Lines) != 3 || analysis.Lines[0].MultiPV != 1 || analysis.Lines[2].MultiPV != 3 || analysis.Lines[0].PV[0] != analysis.BestMove {
+		t.Errorf("POST /analyse answered %+v", analysis)
+	}
+}
+
+func TestAnalysisServerRejectsRequests(t *testing.T) {
+	httpServer := startTestAnalysisServer(t, func(settings *AnalysisServerSettings) {
+		settings.MaximumMoves = 2
+	})
+
+	testCases := []struct {
+		path           string
+		query          url.Values
+		expectedStatus int
+	}{
+		{"/analyse", url.Values{"depth": {"31"}}, http.StatusBadRequest},
+		{"/analyse", url.Values{"depth": {"-1"}}, http.StatusBadRequest},
+		{"/analyse", url.Values{"depth": {"deep"}}, http.StatusBadRequest},
+		{"/analyse", url.Values{"movetime": {"30001"}}, http.StatusBadRequest},
+		{"/analyse", url.Values{"multipv": {"9"}}, http.StatusBadRequest},
+		{"/perft", url.Values{"depth": {"6"}}, http.StatusBadRequest},
+		{"/perft", url.Values{}, http.StatusBadRequest},
+		{"/apply", url.Values{"moves": {"e2e4 e7e5 g1f3"}}, http.StatusBadRequest},
+		{"/apply", url.Values{"moves": {"e2e5"}}, http.StatusBadRequest},
+		{"/moves", url.Values{"fen": {"8/8/8/8/8/8/8/8 w - - 0 1"}}, http.StatusBadRequest},
+		{"/moves", url.Values{"fen": {"not a fen"}}, http.StatusBadRequest},
+		{"/moves", url.Values{"fen": {"4k3/8/8/8/8/8/8/R3K3 w - - 0 1"}}, http.StatusOK},
+		{"/moves", url.Values{"fen": {"4k3/8/8/8/8/8/8/4R1K1 w - - 0 1"}}, http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		answer := map[string]any{}
+		status := getAnalysisJSON(t, httpServer, testCase.path, testCase.query, &answer)
+		if status != testCase.expectedStatus || (status != http.StatusOK && answer["error"] == nil) {
+			t.Errorf("%s?%s answered %d with %v, expected %d", testCase.path, testCase.query.Encode(), status, answer, testCase.expectedStatus)
+		}
+	}
+
+	response, err := http.Post(httpServer.URL+"/moves", "application/json", strings.NewReader(`{"fen": "startpos", "depht": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown field answered %d", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest(http.MethodPut, httpServer.URL+"/moves", nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT answered %d", response.StatusCode)
+	}
+}
+
+func TestAnalysisServerEventStream(t *testing.T) {
+	httpServer := startTestAnalysisServer(t, nil)
+
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/analyse?depth=5", nil)
+	request.Header.Set("Accept", "text/event-stream")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("answered with the content type %s", contentType)
+	}
+
+	// Each event is an event line and a data line, followed by an empty line
+	events, lastDepth := []string{}, 0
+	reader := bufio.NewReader(response.Body)
+	for {
+		eventLine, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		dataLine, _ := reader.ReadString('\n')
+		emptyLine, _ := reader.ReadString('\n')
+
+		event, isEvent := strings.CutPrefix(strings.TrimSuffix(eventLine, "\n"), "event: ")
+		data, isData := strings.CutPrefix(strings.TrimSuffix(dataLine, "\n"), "data: ")
+		if !isEvent || !isData || emptyLine != "\n" {
+			t.Fatalf("invalid event %q %q %q", eventLine, dataLine, emptyLine)
+		}
+		events = append(events, event)
+
+		switch event {
+		case "info":
+			searchInfo := SearchInfo{}
+			if err := json.Unmarshal([]byte(data), &searchInfo); err != nil || searchInfo.Depth < lastDepth {
+				t.Errorf("invalid info event %s", data)
+			}
+			lastDepth = searchInfo.Depth
+		case "bestmove":
+			analysis := AnalysisResponse{}
+			if err := json.Unmarshal([]byte(data), &analysis); err != nil || analysis.BestMove == "" || len(analysis.Lines) != 1 || analysis.Lines[0].Depth != 5 {
+				t.Errorf("invalid bestmove event %s", data)
+			}
+		}
+	}
+
+	if len(events) < 2 || events[0] != "info" || events[len(events)-1] != "bestmove" || lastDepth != 5 {
+		t.Errorf("received the events %v", events)
+	}
+}
+
+func TestAnalysisServerStopsSearchOnDisconnect(t *testing.T) {
+	httpServer := startTestAnalysisServer(t, func(settings *AnalysisServerSettings) {
+		settings.SearcherWait = 5 * time.Second
+	})
+
+	// The single searcher is busy with a long search until the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/analyse?movetime=30000", nil)
+	requestDone := make(chan struct{})
+	go func() {
+		defer close(requestDone)
+		if response, err := http.DefaultClient.Do(request); err == nil {
+			response.Body.Close()
+		}
+	}()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-requestDone
+
+	start := time.Now()
+	moves := map[string]any{}
+	if status := getAnalysisJSON(t, httpServer, "/moves", url.Values{}, &moves); status != http.StatusOK {
+		t.Errorf("the next request answered %d with %v after the client went away", status, moves)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the next request waited %v for the searcher", elapsed)
+	}
+}
@@ -1,5 +1,11 @@
 package chessEngine
 
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
 const (
 	CheckmateScore             int16 = 10000
 	drawScore                  int16 = 0
@@ -8,6 +14,8 @@ const (
 
 type DefaultEvaluator struct {
 	evaluationData EvaluationData
+	pawnHashTable  PawnHashTable
+	infoOutput     io.Writer
 }
 
 type EvaluationData struct {
@@ -17,6 +25,37 @@ type EvaluationData struct {
 	EnemyKingAttackerCount  [2]uint8
 }
 
+func (evaluator *DefaultEvaluator) GetOptions() map[string]EngineOption {
+	options := make(map[string]EngineOption)
+
+	options["Pawn Hash Table Size"] = NewSpinOption(DefaultPawnHashTableSize/(1024*1024), 0, 1024, func(size int) {
+		evaluator.pawnHashTable.ResizeTable(uint64(size)*1024*1024, PawnHashEntrySize)
+	})
+
+	options["Pawn Hash Table Statistics"] = NewButtonOption(func() {
+		probes, hits := evaluator.pawnHashTable.GetStatistics()
+		hitRate := 0.0
+		if probes > 0 {
+			hitRate = 100 * float64(hits) / float64(probes)
+		}
+		fmt.Fprintf(evaluator.getInfoOutput(), "info string pawn hash probes %d hits %d hit rate %.2f%%\n", probes, hits, hitRate)
+	})
+
+	return options
+}
+
+// SetInfoOutput sets where the info strings of the options are written, the standard output by default.
+func (evaluator *DefaultEvaluator) SetInfoOutput(infoOutput io.Writer) {
+	evaluator.infoOutput = infoOutput
+}
+
+func (evaluator *DefaultEvaluator) getInfoOutput() io.Writer {
+	if evaluator.infoOutput == nil {
+		return os.Stdout
+	}
+	return evaluator.infoOutput
+}
+
 func (evaluator *DefaultEvaluator) GetMiddleGamePieceSquareTable() *[6][64]int16 {
 	return &MidGamePieceSquareTables
 }
@@ -45,19 +84,30 @@ func (defaultClassicEvaluator *DefaultEvaluator) EvaluatePosition(position *Posi
 	if isDrawnState(position) {
 		return drawScore
 	}
+
+	endgame, isSpecializedEndgame := probeEndgameRegistry(position)
+	if isSpecializedEndgame && endgame.evaluate != nil {
+		endgameScore := endgame.evaluate(position, endgame.strongSide)
+		if position.SideToMove != endgame.strongSide {
+			return -endgameScore
+		}
+		return endgameScore
+	}
+
 	allBitBoard := position.ColorsBitBoard[position.SideToMove] | position.ColorsBitBoard[position.SideToMove^1]
 	var phaseValue = position.Phase
 	defaultClassicEvaluator.evaluationData = EvaluationData{
 		MidgameScores: position.MidGameScores,
 		EndgameScores: position.EndGameScores,
 	}
+	defaultClassicEvaluator.evaluatePawnStructure(position)
+
+	allBitBoard &= ^(position.PiecesBitBoard[White][Pawn] | position.PiecesBitBoard[Black][Pawn])
 	for allBitBoard != 0 {
 		pieceSquare := allBitBoard.PopMostSignificantBit()
 		pieceType := position.SquareContent[pieceSquare].PieceType
 		pieceColor := position.SquareContent[pieceSquare].Color
 		switch pieceType {
-		case Pawn:
-			defaultClassicEvaluator.evaluatePawnAtSquare(position, pieceColor, pieceSquare)
 		case Knight:
 			defaultClassicEvaluator.evaluateKnightAtSquare(position, pieceColor, pieceSquare)
 		case Bishop:
@@ -87,9 +137,42 @@ func (defaultClassicEvaluator *DefaultEvaluator) EvaluatePosition(position *Posi
 		return currentScore / DrawishPositionScaleFactor
 	}
 
+	strongSide := position.SideToMove
+	if currentScore < 0 {
+		strongSide ^= 1
+	}
+	if scaleFactor := getEndgameScaleFactor(position, strongSide, endgame, isSpecializedEndgame); scaleFactor != NormalEndgameScaleFactor {
+		currentScore = int16(int32(currentScore) * int32(scaleFactor) / int32(NormalEndgameScaleFactor))
+	}
+
 	return currentScore
 }
-func (defaultClassicEvaluator *DefaultEvaluator) evaluatePawnAtSquare(position *Position, color uint8, square uint8) {
+func (defaultClassicEvaluator *DefaultEvaluator) evaluatePawnStructure(position *Position) {
+	pawnHashEntry, found := defaultClassicEvaluator.pawnHashTable.Probe(position.PawnHash)
+
+	if !found {
+		computedEntry := PawnHashEntry{PawnHash: position.PawnHash}
+		for color := Black; color <= White; color++ {
+			pawns := position.PiecesBitBoard[color][Pawn]
+			for pawns != 0 {
+				evaluatePawnAtSquare(position, color, pawns.PopMostSignificantBit(), &computedEntry)
+			}
+		}
+
+		if pawnHashEntry == nil {
+			pawnHashEntry = &computedEntry
+		} else {
+			*pawnHashEntry = computedEntry
+		}
+	}
+
+	for color := Black; color <= White; color++ {
+		defaultClassicEvaluator.evaluationData.MidgameScores[color] += pawnHashEntry.MidgameScores[color]
+		defaultClassicEvaluator.evaluationData.EndgameScores[color] += pawnHashEntry.EndgameScores[color]
+	}
+}
+
+func evaluatePawnAtSquare(position *Position, color uint8, square uint8, pawnHashEntry *PawnHashEntry) {
 	enemyPawns := position.PiecesBitBoard[color^1][Pawn]
 	sideToMovePawn := position.PiecesBitBoard[color][Pawn]
 	fileOfSq := File(square)
@@ -98,16 +181,16 @@ func (defaultClassicEvaluator *DefaultEvaluator) evaluatePawnAtSquare(position *
 	isPassedAndNotBlockedByFriendlyPawn := CheckPassedPawnOnSquareMask[color][square]&enemyPawns == 0 && sideToMovePawn&CheckDoublePawnOnSquareMask[color][square] == 0
 
 	if isIsolated {
-		defaultClassicEvaluator.evaluationData.MidgameScores[color] -= MidGameIsolatedPawnPenalty
-		defaultClassicEvaluator.evaluationData.EndgameScores[color] -= EndGameIsolatedPawnPenalty
+		pawnHashEntry.MidgameScores[color] -= MidGameIsolatedPawnPenalty
+		pawnHashEntry.EndgameScores[color] -= EndGameIsolatedPawnPenalty
 	}
 	if isDoubled {
-		defaultClassicEvaluator.evaluationData.MidgameScores[color] -= MidGameDoubledPawnPenalty
-		defaultClassicEvaluator.evaluationData.EndgameScores[color] -= EndGameDoubledPawnPenalty
+		pawnHashEntry.MidgameScores[color] -= MidGameDoubledPawnPenalty
+		pawnHashEntry.EndgameScores[color] -= EndGameDoubledPawnPenalty
 	}
 	if isPassedAndNotBlockedByFriendlyPawn {
-		defaultClassicEvaluator.evaluationData.MidgameScores[color] += MidGamePassedPawnSquareTables[BoardSquaresNormalAndFlipped[color][square]]
-		defaultClassicEvaluator.evaluationData.EndgameScores[color] += EndGamePassedPawnSquareTables[BoardSquaresNormalAndFlipped[color][square]]
+		pawnHashEntry.MidgameScores[color] += MidGamePassedPawnSquareTables[BoardSquaresNormalAndFlipped[color][square]]
+		pawnHashEntry.EndgameScores[color] += EndGamePassedPawnSquareTables[BoardSquaresNormalAndFlipped[color][square]]
 	}
 }
 func (defaultClassicEvaluator *DefaultEvaluator) evaluateKnightAtSquare(position *Position, color uint8, square uint8) {
@@ -341,6 +424,6 @@ func isDrawishState(pos *Position) bool {
 
 func isSquareLight(square uint8) bool {
 	fileNumber := File(square)
-	rankNumber := File(square)
+	rankNumber := Rank(square)
 	return (fileNumber+rankNumber)%2 != 0
 }
@@ -0,0 +1,321 @@
+package chessEngine
+
+import "strings"
+
+const (
+	EndgameKnownWinScore          int16 = 3000
+	NormalEndgameScaleFactor      int16 = 64
+	MaxSpecializedEndgamePieces         = 5
+	OppositeBishopsScaleFactor    int16 = 16
+	OppositeBishopsWithPawnsScale int16 = 32
+	OppositeBishopsWithPieces     int16 = 44
+)
+
+// EndgameEvaluationFunction returns the exact evaluation of an endgame from the strong side's point of view.
+type EndgameEvaluationFunction func(position *Position, strongSide uint8) int16
+
+// EndgameScalingFunction returns the factor, out of NormalEndgameScaleFactor, by which the regular evaluation
+// of an endgame should be scaled when it favors the strong side.
+type EndgameScalingFunction func(position *Position, strongSide uint8) int16
+
+type endgameEntry struct {
+	strongSide uint8
+	evaluate   EndgameEvaluationFunction
+	scale      EndgameScalingFunction
+}
+
+var endgameRegistry map[uint64]endgameEntry
+
+func InitializeEndgameRegistry() {
+	endgameRegistry = make(map[uint64]endgameEntry)
+
+	RegisterEndgameEvaluation("KQvK", evaluateKXK)
+	RegisterEndgameEvaluation("KRvK", evaluateKXK)
+	RegisterEndgameEvaluation("KBBvK", evaluateKBBK)
+	RegisterEndgameEvaluation("KBNvK", evaluateKBNK)
+	RegisterEndgameEvaluation("KPvK", kpkScore)
+	RegisterEndgameEvaluation("KRvKP", evaluateKRKP)
+	RegisterEndgameEvaluation("KRvKB", evaluateKRKB)
+	RegisterEndgameEvaluation("KRvKN", evaluateKRKN)
+	RegisterEndgameEvaluation("KQvKP", evaluateKQKP)
+	RegisterEndgameEvaluation("KQvKR", evaluateKQKR)
+}
+
+// RegisterEndgameEvaluation registers an evaluation function for a material signature given from the strong side's
+// point of view, such as "KBNvK". The function is registered for both colors being the strong side.
+func RegisterEndgameEvaluation(materialCode string, evaluate EndgameEvaluationFunction) {
+	registerEndgame(materialCode, endgameEntry{evaluate: evaluate})
+}
+
+func RegisterEndgameScaling(materialCode string, scale EndgameScalingFunction) {
+	registerEndgame(materialCode, endgameEntry{scale: scale})
+}
+
+func registerEndgame(materialCode string, entry endgameEntry) {
+	if endgameRegistry == nil {
+		endgameRegistry = make(map[uint64]endgameEntry)
+	}
+
+	for strongSide := Black; strongSide <= White; strongSide++ {
+		entry.strongSide = strongSide
+		endgameRegistry[materialSignatureFromCode(materialCode, strongSide)] = entry
+	}
+}
+
+// MaterialSignature packs the count of each non-king piece type of each color into 4 bits.
+func MaterialSignature(position *Position) uint64 {
+	signature := uint64(0)
+	for color := Black; color <= White; color++ {
+		for pieceType := Pawn; pieceType < King; pieceType++ {
+			signature |= uint64(position.PiecesBitBoard[color][pieceType].CountSetBits()) << materialSignatureShift(color, pieceType)
+		}
+	}
+	return signature
+}
+
+func materialSignatureShift(color uint8, pieceType uint8) uint64 {
+	return uint64(color*5+pieceType) * 4
+}
+
+func materialSignatureFromCode(materialCode string, strongSide uint8) uint64 {
+	sides := strings.Split(strings.ToLower(materialCode), "v")
+	signature := uint64(0)
+
+	for sideIndex, side := range sides {
+		color := strongSide
+		if sideIndex == 1 {
+			color = strongSide ^ 1
+		}
+
+		for _, pieceChar := range side {
+			for pieceType := Pawn; pieceType < King; pieceType++ {
+				if PieceTypeToChar[pieceType] == pieceChar {
+					signature += 1 << materialSignatureShift(color, pieceType)
+				}
+			}
+		}
+	}
+
+	return signature
+}
+
+func probeEndgameRegistry(position *Position) (endgameEntry, bool) {
+	occupancyBitboard := position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]
+	if occupancyBitboard.CountSetBits() > MaxSpecializedEndgamePieces {
+		return endgameEntry{}, false
+	}
+
+	entry, found := endgameRegistry[MaterialSignature(position)]
+	return entry, found
+}
+
+// getEndgameScaleFactor applies the registered scaling function of the endgame if any, and otherwise the generic
+// scaling rules which apply regardless of the exact number of pawns.
+func getEndgameScaleFactor(position *Position, strongSide uint8, entry endgameEntry, found bool) int16 {
+	if found && entry.scale != nil && entry.strongSide == strongSide {
+		return entry.scale(position, strongSide)
+	}
+
+	if isWrongBishopRookPawnDraw(position, strongSide) {
+		return 0
+	}
+
+	return scaleOppositeColoredBishops(position, strongSide)
+}
+
+func evaluateKXK(position *Position, strongSide uint8) int16 {
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	strongKingSquare := position.PiecesBitBoard[strongSide][King].MostSignificantBit()
+
+	score := EndgameKnownWinScore + nonPawnMaterial(position, strongSide)
+	score += 20 * int16(distanceFromCenter(weakKingSquare))
+	score += 10 * int16(7-chebyshevDistance(strongKingSquare, weakKingSquare))
+	return score
+}
+
+func evaluateKBBK(position *Position, strongSide uint8) int16 {
+	bishops := position.PiecesBitBoard[strongSide][Bishop]
+	firstBishopSquare := bishops.PopMostSignificantBit()
+	if isSquareLight(firstBishopSquare) == isSquareLight(bishops.MostSignificantBit()) {
+		return drawScore
+	}
+	return evaluateKXK(position, strongSide)
+}
+
+// The lone king can only be mated in a corner of the same color as the bishop.
+func evaluateKBNK(position *Position, strongSide uint8) int16 {
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	strongKingSquare := position.PiecesBitBoard[strongSide][King].MostSignificantBit()
+	bishopSquare := position.PiecesBitBoard[strongSide][Bishop].MostSignificantBit()
+
+	firstCorner, secondCorner := uint8(A1), uint8(H8)
+	if isSquareLight(bishopSquare) {
+		firstCorner, secondCorner = A8, H1
+	}
+
+	cornerDistance := min(manhattanDistance(weakKingSquare, firstCorner), manhattanDistance(weakKingSquare, secondCorner))
+
+	score := EndgameKnownWinScore + StandardPieceValuesScaled[Bishop] + StandardPieceValuesScaled[Knight]
+	score += 20 * int16(14-cornerDistance)
+	score += 10 * int16(7-chebyshevDistance(strongKingSquare, weakKingSquare))
+	return score
+}
+
+func evaluateKRKP(position *Position, strongSide uint8) int16 {
+	weakSide := strongSide ^ 1
+	strongKingSquare := relativeSquare(weakSide, position.PiecesBitBoard[strongSide][King].MostSignificantBit())
+	weakKingSquare := relativeSquare(weakSide, position.PiecesBitBoard[weakSide][King].MostSignificantBit())
+	rookSquare := relativeSquare(weakSide, position.PiecesBitBoard[strongSide][Rook].MostSignificantBit())
+	pawnSquare := relativeSquare(weakSide, position.PiecesBitBoard[weakSide][Pawn].MostSignificantBit())
+	queeningSquare := File(pawnSquare) + 56
+	rookScore := StandardPieceValuesScaled[Rook]
+
+	strongSideToMove := uint8(0)
+	weakSideToMove := uint8(0)
+	if position.SideToMove == strongSide {
+		strongSideToMove = 1
+	} else {
+		weakSideToMove = 1
+	}
+
+	// The squares are seen from the weak side, whose pawn advances towards the eighth rank
+	if File(strongKingSquare) == File(pawnSquare) && Rank(strongKingSquare) > Rank(pawnSquare) {
+		// The strong king is in front of the pawn
+		return rookScore - int16(chebyshevDistance(strongKingSquare, pawnSquare))
+	}
+
+	if chebyshevDistance(weakKingSquare, pawnSquare) >= 3+weakSideToMove && chebyshevDistance(weakKingSquare, rookSquare) >= 3 {
+		// The weak king is too far from both the pawn and the rook
+		return rookScore - int16(chebyshevDistance(strongKingSquare, pawnSquare))
+	}
+
+	if Rank(weakKingSquare) >= Rank6 && chebyshevDistance(weakKingSquare, pawnSquare) == 1 &&
+		Rank(strongKingSquare) <= Rank5 && chebyshevDistance(strongKingSquare, pawnSquare) > 2+strongSideToMove {
+		// The pawn is far advanced and supported by its king, while the strong king is far
+		return 80 - 8*int16(chebyshevDistance(strongKingSquare, pawnSquare))
+	}
+
+	squareInFrontOfPawn := pawnSquare + 8
+	return 200 - 8*(int16(chebyshevDistance(strongKingSquare, squareInFrontOfPawn))-
+		int16(chebyshevDistance(weakKingSquare, squareInFrontOfPawn))-
+		int16(chebyshevDistance(pawnSquare, queeningSquare)))
+}
+
+func evaluateKRKB(position *Position, strongSide uint8) int16 {
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	return 10 * int16(distanceFromCenter(weakKingSquare))
+}
+
+func evaluateKRKN(position *Position, strongSide uint8) int16 {
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	knightSquare := position.PiecesBitBoard[strongSide^1][Knight].MostSignificantBit()
+	return 10*int16(distanceFromCenter(weakKingSquare)) + 10*int16(chebyshevDistance(weakKingSquare, knightSquare))
+}
+
+// A pawn on the seventh rank of a bishop or rook file supported by its king may draw against the queen.
+func evaluateKQKP(position *Position, strongSide uint8) int16 {
+	weakSide := strongSide ^ 1
+	strongKingSquare := position.PiecesBitBoard[strongSide][King].MostSignificantBit()
+	weakKingSquare := position.PiecesBitBoard[weakSide][King].MostSignificantBit()
+	pawnSquare := relativeSquare(weakSide, position.PiecesBitBoard[weakSide][Pawn].MostSignificantBit())
+
+	score := 10 * int16(7-chebyshevDistance(strongKingSquare, weakKingSquare))
+
+	pawnFile := File(pawnSquare)
+	isDrawingPawnFile := pawnFile == FileA || pawnFile == FileC || pawnFile == FileF || pawnFile == FileH
+	if Rank(pawnSquare) != Rank7 || chebyshevDistance(relativeSquare(weakSide, weakKingSquare), pawnSquare) != 1 || !isDrawingPawnFile {
+		score += StandardPieceValuesScaled[Queen] - StandardPieceValuesScaled[Pawn]
+	}
+
+	return score
+}
+
+func evaluateKQKR(position *Position, strongSide uint8) int16 {
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	strongKingSquare := position.PiecesBitBoard[strongSide][King].MostSignificantBit()
+
+	score := StandardPieceValuesScaled[Queen] - StandardPieceValuesScaled[Rook]
+	score += 20 * int16(distanceFromCenter(weakKingSquare))
+	score += 10 * int16(7-chebyshevDistance(strongKingSquare, weakKingSquare))
+	return score
+}
+
+// With only a bishop and rook pawns, the strong side can't promote if the bishop doesn't control the
+// queening square and the defending king reaches it.
+func isWrongBishopRookPawnDraw(position *Position, strongSide uint8) bool {
+	pawns := position.PiecesBitBoard[strongSide][Pawn]
+	bishops := position.PiecesBitBoard[strongSide][Bishop]
+	otherPieces := position.ColorsBitBoard[strongSide] & ^(pawns | bishops | position.PiecesBitBoard[strongSide][King])
+
+	if pawns == 0 || otherPieces != 0 || bishops.CountSetBits() > 1 ||
+		position.ColorsBitBoard[strongSide^1] != position.PiecesBitBoard[strongSide^1][King] {
+		return false
+	}
+
+	for _, pawnFile := range []uint8{FileA, FileH} {
+		if pawns&^SetFileMasks[pawnFile] != 0 {
+			continue
+		}
+
+		queeningSquare := pawnFile + 56
+		if strongSide == Black {
+			queeningSquare = pawnFile
+		}
+
+		bishopControlsQueeningSquare := bishops != 0 && isSquareLight(bishops.MostSignificantBit()) == isSquareLight(queeningSquare)
+		weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+		return !bishopControlsQueeningSquare && chebyshevDistance(weakKingSquare, queeningSquare) <= 1
+	}
+
+	return false
+}
+
+func scaleOppositeColoredBishops(position *Position, strongSide uint8) int16 {
+	whiteBishops := position.PiecesBitBoard[White][Bishop]
+	blackBishops := position.PiecesBitBoard[Black][Bishop]
+
+	if whiteBishops.CountSetBits() != 1 || blackBishops.CountSetBits() != 1 ||
+		isSquareLight(whiteBishops.MostSignificantBit()) == isSquareLight(blackBishops.MostSignificantBit()) {
+		return NormalEndgameScaleFactor
+	}
+
+	if nonPawnMaterial(position, White) != StandardPieceValuesScaled[Bishop] || nonPawnMaterial(position, Black) != StandardPieceValuesScaled[Bishop] {
+		return OppositeBishopsWithPieces
+	}
+
+	pawnDifference := position.PiecesBitBoard[strongSide][Pawn].CountSetBits() - position.PiecesBitBoard[strongSide^1][Pawn].CountSetBits()
+	if pawnDifference > 1 {
+		return OppositeBishopsWithPawnsScale
+	}
+	return OppositeBishopsScaleFactor
+}
+
+func nonPawnMaterial(position *Position, color uint8) int16 {
+	material := int16(0)
+	for pieceType := Knight; pieceType < King; pieceType++ {
+		material += int16(position.PiecesBitBoard[color][pieceType].CountSetBits()) * StandardPieceValuesScaled[pieceType]
+	}
+	return material
+}
+
+func relativeSquare(color uint8, square uint8) uint8 {
+	if color == Black {
+		return square ^ 56
+	}
+	return square
+}
+
+func chebyshevDistance(firstSquare uint8, secondSquare uint8) uint8 {
+	return uint8(max(abs(int8(File(firstSquare))-int8(File(secondSquare))), abs(int8(Rank(firstSquare))-int8(Rank(secondSquare)))))
+}
+
+func manhattanDistance(firstSquare uint8, secondSquare uint8) uint8 {
+	return uint8(abs(int8(File(firstSquare))-int8(File(secondSquare))) + abs(int8(Rank(firstSquare))-int8(Rank(secondSquare))))
+}
+
+// distanceFromCenter is 0 for the four central squares and 6 for the corners.
+func distanceFromCenter(square uint8) uint8 {
+	fileDistance := max(int8(3)-int8(File(square)), int8(File(square))-4)
+	rankDistance := max(int8(3)-int8(Rank(square)), int8(Rank(square))-4)
+	return uint8(fileDistance + rankDistance)
+}
@@ -0,0 +1,55 @@
+package chessEngine
+
+import "testing"
+
+func TestSpecializedEndgameEvaluations(t *testing.T) {
+	bishopAndKnight := StandardPieceValuesScaled[Bishop] + StandardPieceValuesScaled[Knight]
+	rook := StandardPieceValuesScaled[Rook]
+
+	testCases := []struct {
+		name          string
+		fen           string
+		expectedScore int16
+	}{
+		// The lone king is mated in a corner of the bishop's color
+		{"KBNK right corner", "8/8/8/8/8/2K5/8/k1BN4 w - - 0 1", EndgameKnownWinScore + bishopAndKnight + 20*14 + 10*5},
+		{"KBNK wrong corner", "k7/8/2K5/8/8/8/8/2BN4 w - - 0 1", EndgameKnownWinScore + bishopAndKnight + 20*7 + 10*5},
+		{"KBNK black", "kbn5/8/8/8/8/8/8/5K2 w - - 0 1", -(EndgameKnownWinScore + bishopAndKnight + 20*9 + 10*0)},
+
+		{"KRKP king in front", "k7/8/8/3p4/8/8/3K4/7R w - - 0 1", rook - 3},
+		{"KRKP lone pawn", "7k/8/8/8/8/8/p7/4K1R1 w - - 0 1", rook - 4},
+		{"KRKP advanced pawn", "R6K/8/8/8/8/1k6/2p5/8 w - - 0 1", 80 - 8*6},
+		{"KRKP black rook", "8/1P6/2K5/8/8/8/8/r6k b - - 0 1", 80 - 8*6},
+	}
+
+	evaluator := &DefaultEvaluator{}
+	for _, testCase := range testCases {
+		position := Position{}
+		position.LoadFEN(testCase.fen, evaluator)
+		if score := evaluator.EvaluatePosition(&position); score != testCase.expectedScore {
+			t.Errorf("%s: evaluated as %d, expected %d", testCase.name, score, testCase.expectedScore)
+		}
+	}
+}
+
+func TestOppositeColoredBishopsScaling(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fen           string
+		expectedScale int16
+	}{
+		{"same colored bishops", "4k3/5b2/8/8/8/8/3PPP2/3BK3 w - - 0 1", NormalEndgameScaleFactor},
+		{"single extra pawn", "4k3/4b3/8/8/8/8/4P3/3BK3 w - - 0 1", OppositeBishopsScaleFactor},
+		{"two extra pawns", "4k3/4b3/8/8/8/8/3PP3/3BK3 w - - 0 1", OppositeBishopsWithPawnsScale},
+		{"other pieces", "4k3/4b3/8/8/8/8/3PP3/3BKR2 w - - 0 1", OppositeBishopsWithPieces},
+	}
+
+	evaluator := &DefaultEvaluator{}
+	for _, testCase := range testCases {
+		position := Position{}
+		position.LoadFEN(testCase.fen, evaluator)
+		if scale := scaleOppositeColoredBishops(&position, White); scale != testCase.expectedScale {
+			t.Errorf("%s: scaled by %d, expected %d", testCase.name, scale, testCase.expectedScale)
+		}
+	}
+}
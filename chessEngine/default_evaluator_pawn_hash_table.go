@@ -0,0 +1,66 @@
+package chessEngine
+
+import "unsafe"
+
+const (
+	DefaultPawnHashTableSize = 4 * 1024 * 1024
+	PawnHashEntrySize        = uint64(unsafe.Sizeof(PawnHashEntry{}))
+)
+
+type PawnHashEntry struct {
+	PawnHash      uint64
+	MidgameScores [2]int16
+	EndgameScores [2]int16
+}
+
+type PawnHashTable struct {
+	entries      []PawnHashEntry
+	numOfEntries uint64
+	disabled     bool
+	probes       uint64
+	hits         uint64
+}
+
+func (table *PawnHashTable) ResizeTable(tableSize uint64, entrySize uint64) {
+	table.numOfEntries = tableSize / entrySize
+	table.entries = make([]PawnHashEntry, table.numOfEntries)
+	table.disabled = table.numOfEntries == 0
+	table.ClearStatistics()
+}
+
+func (table *PawnHashTable) ClearEntries() {
+	for i := uint64(0); i < table.numOfEntries; i++ {
+		table.entries[i] = PawnHashEntry{}
+	}
+	table.ClearStatistics()
+}
+
+func (table *PawnHashTable) ClearStatistics() {
+	table.probes = 0
+	table.hits = 0
+}
+
+// Probe returns the entry which holds the pawn structure evaluation of the given pawn hash if available, and
+// otherwise the entry which should be overwritten by the caller. A nil entry is returned if the table is disabled.
+func (table *PawnHashTable) Probe(pawnHash uint64) (entry *PawnHashEntry, found bool) {
+	if table.disabled {
+		return nil, false
+	}
+
+	if table.entries == nil {
+		table.ResizeTable(DefaultPawnHashTableSize, PawnHashEntrySize)
+	}
+
+	table.probes++
+	entry = &table.entries[pawnHash%table.numOfEntries]
+	if entry.PawnHash == pawnHash {
+		table.hits++
+		return entry, true
+	}
+
+	return entry, false
+}
+
+func (table *PawnHashTable) GetStatistics() (probes uint64, hits uint64) {
+	return table.probes, table.hits
+}
@@ -0,0 +1,38 @@
+package chessEngine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPawnHashTableKeepsEvaluations(t *testing.T) {
+	cachingEvaluator, uncachedEvaluator := &DefaultEvaluator{}, &DefaultEvaluator{}
+	uncachedEvaluator.GetOptions()["Pawn Hash Table Size"].Set("0")
+
+	// Positions of random games are evaluated twice, the second time from the pawn hash table
+	random := rand.New(rand.NewSource(1))
+	for game := 0; game < 20; game++ {
+		position := &Position{}
+		position.LoadFEN(FENStartPosition, cachingEvaluator)
+		for ply := 0; ply < 80; ply++ {
+			for pass := 0; pass < 2; pass++ {
+				if cachedScore, score := cachingEvaluator.EvaluatePosition(position), uncachedEvaluator.EvaluatePosition(position); cachedScore != score {
+					t.Fatalf("%s: evaluated as %d with the pawn hash table, expected %d", position.GenFEN(), cachedScore, score)
+				}
+			}
+
+			legalMoves := GenerateLegalMoves(position, cachingEvaluator)
+			if legalMoves.Size == 0 {
+				break
+			}
+			position.DoMove(legalMoves.Moves[random.Intn(int(legalMoves.Size))], cachingEvaluator)
+		}
+	}
+
+	if probes, hits := cachingEvaluator.pawnHashTable.GetStatistics(); hits == 0 || hits >= probes {
+		t.Errorf("the pawn hash table had %d hits out of %d probes", hits, probes)
+	}
+	if probes, _ := uncachedEvaluator.pawnHashTable.GetStatistics(); probes != 0 {
+		t.Errorf("the disabled pawn hash table was probed %d times", probes)
+	}
+}
@@ -0,0 +1,174 @@
+package chessEngine
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	ClusterEntriesCount = 3
+	ClusterSize         = uint64(unsafe.Sizeof(transpositionTableCluster{}))
+
+	clusterKeyBits   = 16
+	clusterAgeCycle  = 4
+	clusterAgeWeight = 8
+)
+
+// clusterEntry is a table entry packed into 8 bytes. The hash is only verified by the 16 bit key of the entry,
+// and the move is stored without its ordering score.
+type clusterEntry struct {
+	move             uint16
+	score            int16
+	staticEvaluation int16
+	depthOfSearch    uint8
+	entryInfo        uint8
+}
+
+// transpositionTableCluster holds three entries and their keys in 32 bytes, so that two clusters fit in a
+// cache line.
+type transpositionTableCluster struct {
+	keys    uint64
+	entries [ClusterEntriesCount]clusterEntry
+}
+
+// ClusteredTranspositionTable stores entries in clusters of three, replacing the entry of the same position, or the
+// entry with the lowest depth and age based worth. The age cycles through four values, so that entries from the
+// last few searches are kept over older ones. Unlike the default table, entries are written field by field, so the
+// table is meant for single threaded searches.
+type ClusteredTranspositionTable struct {
+	clusters      []transpositionTableCluster
+	numOfClusters uint64
+	age           uint8
+}
+
+func NewClusteredTranspositionTable(tableSize uint64) *ClusteredTranspositionTable {
+	table := &ClusteredTranspositionTable{}
+	table.Resize(tableSize)
+	return table
+}
+
+func getClusterKey(hash uint64) uint16 {
+	return uint16(hash >> (64 - clusterKeyBits))
+}
+
+func (cluster *transpositionTableCluster) getKey(entryIndex int) uint16 {
+	return uint16(cluster.keys >> (clusterKeyBits * entryIndex))
+}
+
+func (cluster *transpositionTableCluster) setKey(entryIndex int, key uint16) {
+	shift := clusterKeyBits * entryIndex
+	cluster.keys = cluster.keys&^(0xffff<<shift) | uint64(key)<<shift
+}
+
+func (entry *clusterEntry) isEmpty() bool {
+	return entry.entryInfo&0x03 == 0
+}
+
+// getReplacementWorth returns how much the entry is worth keeping, every search since it was written costing
+// as much as a few plies of depth.
+func (table *ClusteredTranspositionTable) getReplacementWorth(entry *clusterEntry) int {
+	entryAge := (entry.entryInfo & 0x0c) >> 2
+	return int(entry.depthOfSearch) - clusterAgeWeight*int((clusterAgeCycle+table.age-entryAge)%clusterAgeCycle)
+}
+
+func (table *ClusteredTranspositionTable) Probe(hash uint64) (TableEntry, bool) {
+	if table.numOfClusters == 0 {
+		return TableEntry{}, false
+	}
+
+	cluster := &table.clusters[hash%table.numOfClusters]
+	key := getClusterKey(hash)
+	for entryIndex := range cluster.entries {
+		entry := &cluster.entries[entryIndex]
+		if cluster.getKey(entryIndex) == key && !entry.isEmpty() {
+			return TableEntry{
+				HashValue:        hash,
+				BestMove:         Move(uint32(entry.move) << ToSquareOffset),
+				Score:            entry.score,
+				StaticEvaluation: entry.staticEvaluation,
+				DepthOfSearch:    entry.depthOfSearch,
+				EntryInfo:        entry.entryInfo,
+			}, true
+		}
+	}
+	return TableEntry{}, false
+}
+
+func (table *ClusteredTranspositionTable) Store(hash uint64, move Move, score int16, staticEvaluation int16, pliesFromRoot uint8, depth uint8, entryType uint8) {
+	if table.numOfClusters == 0 {
+		return
+	}
+
+	cluster := &table.clusters[hash%table.numOfClusters]
+	key := getClusterKey(hash)
+	replacedIndex := 0
+	for entryIndex := range cluster.entries {
+		entry := &cluster.entries[entryIndex]
+		if entry.isEmpty() || cluster.getKey(entryIndex) == key {
+			replacedIndex = entryIndex
+			break
+		}
+
+		if table.getReplacementWorth(entry) < table.getReplacementWorth(&cluster.entries[replacedIndex]) {
+			replacedIndex = entryIndex
+		}
+	}
+
+	replacedEntry := &cluster.entries[replacedIndex]
+	if move == NullMove && !replacedEntry.isEmpty() && cluster.getKey(replacedIndex) == key {
+		move = Move(uint32(replacedEntry.move) << ToSquareOffset)
+	}
+
+	// The mate scores are adjusted the same way as in the default table
+	var tableEntry TableEntry
+	tableEntry.ModifyTableEntry(move, score, staticEvaluation, hash, pliesFromRoot, depth, entryType, table.age)
+
+	cluster.setKey(replacedIndex, key)
+	*replacedEntry = clusterEntry{
+		move:             uint16(tableEntry.BestMove >> ToSquareOffset),
+		score:            tableEntry.Score,
+		staticEvaluation: tableEntry.StaticEvaluation,
+		depthOfSearch:    tableEntry.DepthOfSearch,
+		entryInfo:        tableEntry.EntryInfo,
+	}
+}
+
+func (table *ClusteredTranspositionTable) Clear() {
+	for i := range table.clusters {
+		table.clusters[i] = transpositionTableCluster{}
+	}
+}
+
+func (table *ClusteredTranspositionTable) Resize(tableSize uint64) {
+	table.numOfClusters = tableSize / ClusterSize
+	table.clusters = make([]transpositionTableCluster, table.numOfClusters)
+}
+
+// Hashfull returns the permill of the sampled entries written by the current search.
+func (table *ClusteredTranspositionTable) Hashfull() int {
+	sampleSize := min(hashfullSampleSize/ClusterEntriesCount, table.numOfClusters)
+	if sampleSize == 0 {
+		return 0
+	}
+
+	usedEntries := uint64(0)
+	for i := uint64(0); i < sampleSize; i++ {
+		for _, entry := range table.clusters[i].entries {
+			if !entry.isEmpty() && (entry.entryInfo&0x0c)>>2 == table.age {
+				usedEntries++
+			}
+		}
+	}
+	return int(usedEntries * 1000 / (sampleSize * ClusterEntriesCount))
+}
+
+// Prefetch touches the cluster of the hash so that it's cached by the time it's probed.
+func (table *ClusteredTranspositionTable) Prefetch(hash uint64) {
+	if table.numOfClusters != 0 {
+		atomic.LoadUint64(&table.clusters[hash%table.numOfClusters].keys)
+	}
+}
+
+func (table *ClusteredTranspositionTable) NewSearch() {
+	table.age = (table.age + 1) % clusterAgeCycle
+}
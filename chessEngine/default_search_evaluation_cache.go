@@ -0,0 +1,77 @@
+package chessEngine
+
+const (
+	DefaultEvaluationCacheSize = 8 * 1024 * 1024
+	EvaluationCacheEntrySize   = 8
+
+	evaluationCacheScoreMask = 0xffff
+)
+
+// EvaluationCache stores static evaluations keyed by the position hash. Each entry packs the upper 48 bits
+// of the hash with the 16 bits of the evaluation into a single word.
+type EvaluationCache struct {
+	entries      []uint64
+	numOfEntries uint64
+	disabled     bool
+}
+
+func (cache *EvaluationCache) ResizeCache(cacheSize uint64, entrySize uint64) {
+	cache.numOfEntries = cacheSize / entrySize
+	cache.entries = make([]uint64, cache.numOfEntries)
+	cache.disabled = cache.numOfEntries == 0
+}
+
+// Size returns the size of the cache in bytes, which is allocated with the default size on the first evaluation
+// unless the cache was disabled by resizing it to zero.
+func (cache *EvaluationCache) Size() uint64 {
+	if cache.entries == nil && !cache.disabled {
+		return DefaultEvaluationCacheSize
+	}
+	return cache.numOfEntries * EvaluationCacheEntrySize
+}
+
+func (cache *EvaluationCache) DeleteEntries() {
+	cache.entries = nil
+	cache.numOfEntries = 0
+}
+
+func (cache *EvaluationCache) ClearEntries() {
+	for i := uint64(0); i < cache.numOfEntries; i++ {
+		cache.entries[i] = 0
+	}
+}
+
+func (cache *EvaluationCache) Probe(hash uint64) (int16, bool) {
+	if cache.numOfEntries == 0 {
+		return 0, false
+	}
+
+	entry := cache.entries[hash%cache.numOfEntries]
+	if entry != 0 && entry&^evaluationCacheScoreMask == hash&^evaluationCacheScoreMask {
+		return int16(uint16(entry & evaluationCacheScoreMask)), true
+	}
+	return 0, false
+}
+
+func (cache *EvaluationCache) Store(hash uint64, evaluation int16) {
+	if cache.numOfEntries == 0 {
+		return
+	}
+
+	cache.entries[hash%cache.numOfEntries] = hash&^evaluationCacheScoreMask | uint64(uint16(evaluation))
+}
+
+// Evaluate returns the cached evaluation of the position if available, and evaluates and caches it otherwise.
+func (cache *EvaluationCache) Evaluate(evaluator Evaluator, position *Position) int16 {
+	if cache.entries == nil && !cache.disabled {
+		cache.ResizeCache(DefaultEvaluationCacheSize, EvaluationCacheEntrySize)
+	}
+
+	if evaluation, found := cache.Probe(position.PositionHash); found {
+		return evaluation
+	}
+
+	evaluation := evaluator.EvaluatePosition(position)
+	cache.Store(position.PositionHash, evaluation)
+	return evaluation
+}
@@ -0,0 +1,63 @@
+package chessEngine
+
+import "fmt"
+
+const MaximumMultiPV = 256
+
+// rootLine is one of the best root moves found by an iteration, with its score and principal variation.
+type rootLine struct {
+	move  Move
+	score int16
+	pv    PV
+}
+
+func (searcher *DefaultSearcher) getRootMoveCount(evaluator Evaluator) int {
+	if searcher.syzygyRootMoves != nil {
+		return len(searcher.syzygyRootMoves)
+	}
+	return int(GenerateLegalMoves(&searcher.position, evaluator).Size)
+}
+
+// searchSecondaryLines searches the root again without the best move and the moves found so far, until the
+// number of lines is reached. The lines are only complete if the searches weren't stopped.
+func (searcher *DefaultSearcher) searchSecondaryLines(evaluator Evaluator, depth uint8, bestMove Move, lineCount int) ([]rootLine, bool) {
+	lines := []rootLine{}
+	searcher.excludedRootMoves = append(searcher.excludedRootMoves[:0], bestMove)
+	defer func() {
+		searcher.excludedRootMoves = searcher.excludedRootMoves[:0]
+	}()
+
+	for len(lines)+1 < lineCount {
+		linePv := PV{}
+		score := searcher.Negamax(evaluator, int8(depth), 0, -CheckmateScore, CheckmateScore, &linePv, true, NullMove, NullMove, false)
+		if searcher.endSearch.Load() || len(linePv.moves) == 0 {
+			return lines, false
+		}
+
+		lines = append(lines, rootLine{move: linePv.GetVariationFirstMove(), score: score, pv: linePv})
+		searcher.excludedRootMoves = append(searcher.excludedRootMoves, linePv.GetVariationFirstMove())
+	}
+	return lines, true
+}
+
+func (searcher *DefaultSearcher) isSearchedRootMove(move Move) bool {
+	if searcher.syzygyRootMoves != nil && !searcher.isSyzygyRootMove(move) {
+		return false
+	}
+
+	for _, excludedMove := range searcher.excludedRootMoves {
+		if excludedMove.IsSameMove(move) {
+			return false
+		}
+	}
+	return true
+}
+
+func (searcher *DefaultSearcher) printSearchInfo(depth uint8, lineNumber int, score int16, pv PV, searchTime int64) {
+	multiPVField := ""
+	if searcher.multiPV > 1 {
+		multiPVField = fmt.Sprintf(" multipv %d", lineNumber)
+	}
+
+	fmt.Fprintf(searcher.getInfoOutput(), "info depth %d%s score %s nodes %d nps %d time %d hashfull %d pv %s\n", depth, multiPVField, getPresentableScore(score), searcher.searchedNodes, uint64(float64(1000*searcher.searchedNodes)/float64(searchTime)), searchTime, searcher.transpositionTable.Hashfull(), pv)
+}
@@ -0,0 +1,94 @@
+package chessEngine
+
+import "math"
+
+const (
+	MaximumSkillLevel                  = 20
+	MinimumUciElo                      = 1000
+	MaximumUciElo                      = 2600
+	SkillMultiPV                       = 4
+	SkillMinimumNodeLimit              = 1000
+	SkillEvaluationNoisePerLevel       = 6
+	SkillScoreGapUpperBound      int16 = 100
+)
+
+// SkillLevelElos holds the Elo of each skill level, UCI_Elo being mapped to a skill level by interpolating between
+// them. The values are uncalibrated: they spread the UCI_Elo range evenly over the levels, 80 Elo apart, until they
+// are replaced by the ratings printed by the calibrate command.
+var SkillLevelElos = [MaximumSkillLevel + 1]int{
+	1000, 1080, 1160, 1240, 1320, 1400, 1480, 1560, 1640, 1720,
+	1800, 1880, 1960, 2040, 2120, 2200, 2280, 2360, 2440, 2520,
+	2600,
+}
+
+// getSkillLevel returns the fractional skill level of the searcher, taken from UCI_Elo when the strength is
+// limited.
+func (searcher *DefaultSearcher) getSkillLevel() float64 {
+	if searcher.limitStrength {
+		return convertEloToSkillLevel(searcher.uciElo)
+	}
+	return float64(searcher.skillLevel)
+}
+
+func convertEloToSkillLevel(elo int) float64 {
+	if elo <= SkillLevelElos[0] {
+		return 0
+	}
+
+	for level := 1; level <= MaximumSkillLevel; level++ {
+		if elo < SkillLevelElos[level] {
+			return float64(level-1) + float64(elo-SkillLevelElos[level-1])/float64(SkillLevelElos[level]-SkillLevelElos[level-1])
+		}
+	}
+	return MaximumSkillLevel
+}
+
+func getSkillDepthLimit(skillLevel float64) uint8 {
+	return uint8(1 + skillLevel)
+}
+
+func getSkillNodeLimit(skillLevel float64) uint64 {
+	return uint64(SkillMinimumNodeLimit * math.Pow(2, skillLevel/2))
+}
+
+func getSkillEvaluationNoise(skillLevel float64) int16 {
+	return int16((MaximumSkillLevel - skillLevel) * SkillEvaluationNoisePerLevel)
+}
+
+// applySkillLimits restricts the search for the skill level.
+func (searcher *DefaultSearcher) applySkillLimits(skillLevel float64) {
+	searcher.skillEvaluationNoise = 0
+	searcher.depthLimit = searcher.timeManager.DepthLimit()
+	if skillLevel >= MaximumSkillLevel {
+		return
+	}
+
+	searcher.skillEvaluationNoise = getSkillEvaluationNoise(skillLevel)
+	searcher.depthLimit = min(searcher.depthLimit, getSkillDepthLimit(skillLevel))
+	searcher.nodeLimit = min(searcher.nodeLimit, getSkillNodeLimit(skillLevel))
+}
+
+// addSkillEvaluationNoise offsets the evaluation by a pseudo random amount derived from the position hash, so that
+// the same position is evaluated consistently during a game.
+func (searcher *DefaultSearcher) addSkillEvaluationNoise(evaluation int16) int16 {
+	noiseHash := (searcher.position.PositionHash ^ searcher.skillNoiseSeed) * 0x9E3779B97F4A7C15
+	noiseHash ^= noiseHash >> 29
+	return evaluation + int16(noiseHash%uint64(2*searcher.skillEvaluationNoise+1)) - searcher.skillEvaluationNoise
+}
+
+// pickSkillMove picks a random candidate, weaker skill levels being more likely to pick the moves scored further
+// below the best one. The randomness is bounded by the score gap between the candidates, up to a pawn.
+func (searcher *DefaultSearcher) pickSkillMove(candidates []rootLine, skillLevel float64) Move {
+	topScore := candidates[0].score
+	scoreGap := max(0, min(topScore-candidates[len(candidates)-1].score, SkillScoreGapUpperBound))
+	weakness := 120 - 2*skillLevel
+
+	pickedMove, pickedScore := candidates[0].move, math.Inf(-1)
+	for _, candidate := range candidates {
+		push := (weakness*float64(topScore-candidate.score) + float64(scoreGap)*float64(searcher.skillRandom.Intn(int(weakness)))) / 128
+		if float64(candidate.score)+push >= pickedScore {
+			pickedMove, pickedScore = candidate.move, float64(candidate.score)+push
+		}
+	}
+	return pickedMove
+}
@@ -3,23 +3,41 @@ package chessEngine
 import "time"
 
 const (
-	MinimumExpectedPliesLeft                 = 10
-	AverageExpectedPliesLeft                 = 40
-	MinimumMoveTimeAllocation                = 100
-	AverageAdjustMoveTime                    = 150
-	MoveAllocatedTimeOfRemainingTimeFraction = 8
+	MinimumExpectedPliesLeft                    = 10
+	AverageExpectedPliesLeft                    = 40
+	MinimumMoveTimeAllocation                   = 100
+	AverageAdjustMoveTime                       = 150
+	MoveAllocatedTimeOfRemainingTimeFraction    = 8
+	DefaultMoveOverhead                         = 10
+	MaximumMoveOverhead                         = 5000
+	HardTimeLimitScale                          = 4
+	AspirationWindowMissTimeExtensionLowerBound = 6
+	AspirationWindowMissTimeScale               = 130
+	TimeScalingDepthLowerBound                  = 4
+	ScoreDropTimeScaleUpperBound                = 100
+	BestMoveNodeFractionTimeScaleOffset         = 150
 )
 
+// BestMoveStabilityTimeScales scale the soft time limit, in percent, by the number of consecutive iterations which
+// returned the same best move.
+var BestMoveStabilityTimeScales = [5]int64{180, 130, 100, 85, 75}
+
 type DefaultTimeManager struct {
-	remainingTime     int64
-	increment         int64
-	moveTime          int64
-	movesToGo         int16
-	depth             uint8
-	nodeCount         uint64
-	endSearch         bool
-	moveAllocatedTime int64
-	searchStopInstant time.Time
+	remainingTime              int64
+	increment                  int64
+	moveTime                   int64
+	movesToGo                  int16
+	depth                      uint8
+	nodeCount                  uint64
+	moveOverhead               int64
+	searchStartInstant         time.Time
+	optimumTime                int64
+	softTimeLimit              int64
+	hardTimeLimit              int64
+	aspirationWindowMissScaled bool
+	previousBestMove           Move
+	bestMoveStability          int
+	previousScore              int16
 }
 
 func (timeManager *DefaultTimeManager) Initialize(remainingTime int64, increment int64, moveTime int64, movesToGo int16, depth uint8, nodeCount uint64) {
@@ -31,12 +49,33 @@ func (timeManager *DefaultTimeManager) Initialize(remainingTime int64, increment
 	timeManager.nodeCount = nodeCount
 }
 
+func (timeManager *DefaultTimeManager) SetMoveOverhead(moveOverhead int64) {
+	timeManager.moveOverhead = max(0, moveOverhead)
+}
+
+func (timeManager *DefaultTimeManager) DepthLimit() uint8 {
+	return timeManager.depth
+}
+
+func (timeManager *DefaultTimeManager) NodeLimit() uint64 {
+	return timeManager.nodeCount
+}
+
+func (timeManager *DefaultTimeManager) isTimeLimited() bool {
+	return timeManager.moveTime != 0 || timeManager.remainingTime >= 0
+}
+
+// StartMoveTimeAllocation sets the optimum time of the move from the remaining time, which is the soft limit the
+// iterations are scaled around, and the hard limit that the search never exceeds.
 func (timeManager *DefaultTimeManager) StartMoveTimeAllocation(plyNumber uint16) {
-	timeManager.endSearch = false
+	timeManager.searchStartInstant = time.Now()
+	timeManager.aspirationWindowMissScaled = false
+	timeManager.previousBestMove = NullMove
+	timeManager.bestMoveStability = 0
 
 	if timeManager.moveTime != 0 {
-		timeManager.remainingTime = 0
-		timeManager.searchStopInstant = time.Now().Add(time.Duration(timeManager.moveTime) * time.Millisecond)
+		moveAllocatedTime := max(1, timeManager.moveTime-timeManager.moveOverhead)
+		timeManager.optimumTime, timeManager.softTimeLimit, timeManager.hardTimeLimit = moveAllocatedTime, moveAllocatedTime, moveAllocatedTime
 		return
 	}
 
@@ -44,50 +83,92 @@ func (timeManager *DefaultTimeManager) StartMoveTimeAllocation(plyNumber uint16)
 		return
 	}
 
+	availableTime := max(0, timeManager.remainingTime-timeManager.moveOverhead)
+
 	moveAllocatedTime := int64(0)
 	if timeManager.movesToGo != 0 {
-		moveAllocatedTime = timeManager.remainingTime / int64(timeManager.movesToGo)
+		moveAllocatedTime = availableTime / int64(timeManager.movesToGo)
 	} else {
 		if timeManager.increment > 0 {
-			moveAllocatedTime = timeManager.remainingTime / max(MinimumExpectedPliesLeft, AverageExpectedPliesLeft-int64(plyNumber))
+			moveAllocatedTime = availableTime / max(MinimumExpectedPliesLeft, AverageExpectedPliesLeft-int64(plyNumber))
 		} else {
-			moveAllocatedTime = timeManager.remainingTime / AverageExpectedPliesLeft
+			moveAllocatedTime = availableTime / AverageExpectedPliesLeft
 		}
 	}
 
 	moveAllocatedTime += (3 * timeManager.increment) / 4
 
-	if moveAllocatedTime >= timeManager.remainingTime {
-		moveAllocatedTime = timeManager.remainingTime - AverageAdjustMoveTime
+	if moveAllocatedTime >= availableTime {
+		moveAllocatedTime = availableTime - AverageAdjustMoveTime
 	}
 
 	if moveAllocatedTime <= 0 {
 		moveAllocatedTime = MinimumMoveTimeAllocation
 	}
 
-	timeManager.searchStopInstant = time.Now().Add(time.Duration(moveAllocatedTime) * time.Millisecond)
-	timeManager.moveAllocatedTime = moveAllocatedTime
+	// The last move before the time control is reached may use all of its allocation, but no more
+	hardTimeLimit := moveAllocatedTime
+	if timeManager.movesToGo != 1 {
+		hardTimeLimit = max(moveAllocatedTime, min(moveAllocatedTime*HardTimeLimitScale, availableTime/MoveAllocatedTimeOfRemainingTimeFraction))
+	}
+
+	timeManager.optimumTime = moveAllocatedTime
+	timeManager.softTimeLimit = moveAllocatedTime
+	timeManager.hardTimeLimit = hardTimeLimit
 }
 
-func (timeManager *DefaultTimeManager) ChangeMoveAllocatedTime(newMoveAllocatedTime int64) {
-	if timeManager.movesToGo != 0 {
-		return
+// IterationCompleted rescales the soft time limit. Time is extended when the best move keeps changing, when the
+// score drops compared to the previous iteration, or when the best move took a small fraction of the searched
+// nodes (the alternatives needed a lot of effort to refute), and cut when the opposite holds.
+func (timeManager *DefaultTimeManager) IterationCompleted(depth uint8, bestMove Move, score int16, bestMoveNodeFraction float64) {
+	if bestMove.IsSameMove(timeManager.previousBestMove) {
+		timeManager.bestMoveStability = min(len(BestMoveStabilityTimeScales)-1, timeManager.bestMoveStability+1)
+	} else {
+		timeManager.bestMoveStability = 0
 	}
 
-	if newMoveAllocatedTime >= timeManager.remainingTime/MoveAllocatedTimeOfRemainingTimeFraction {
-		newMoveAllocatedTime = timeManager.remainingTime / MoveAllocatedTimeOfRemainingTimeFraction
+	scoreDrop := int64(0)
+	if timeManager.previousBestMove != NullMove {
+		scoreDrop = max(0, min(ScoreDropTimeScaleUpperBound, int64(timeManager.previousScore)-int64(score)))
+	}
+	timeManager.previousBestMove, timeManager.previousScore = bestMove, score
+
+	if !timeManager.isTimeLimited() || timeManager.moveTime != 0 || depth < TimeScalingDepthLowerBound {
+		return
 	}
 
-	timeManager.moveAllocatedTime = newMoveAllocatedTime
-	timeManager.searchStopInstant = time.Now().Add(time.Duration(newMoveAllocatedTime) * time.Millisecond)
+	stabilityScale := BestMoveStabilityTimeScales[timeManager.bestMoveStability]
+	scoreDropScale := 100 + scoreDrop/2
+	nodeFractionScale := BestMoveNodeFractionTimeScaleOffset - int64(100*bestMoveNodeFraction)
+
+	softTimeLimit := timeManager.optimumTime * stabilityScale / 100 * scoreDropScale / 100 * nodeFractionScale / 100
+	timeManager.softTimeLimit = max(1, min(timeManager.hardTimeLimit, softTimeLimit))
 }
 
-func (timeManager *DefaultTimeManager) SetMoveTimeIsUp() {
-	if timeManager.remainingTime < 0 || timeManager.endSearch {
+// AspirationWindowMissed extends the optimum time once per move, when a deep iteration fails outside its
+// aspiration window and has to be searched again.
+func (timeManager *DefaultTimeManager) AspirationWindowMissed(depth uint8) {
+	if depth < AspirationWindowMissTimeExtensionLowerBound || timeManager.aspirationWindowMissScaled || timeManager.moveTime != 0 || timeManager.remainingTime < 0 {
 		return
 	}
 
-	if time.Now().After(timeManager.searchStopInstant) {
-		timeManager.endSearch = true
+	timeManager.aspirationWindowMissScaled = true
+	timeManager.optimumTime = min(timeManager.hardTimeLimit, timeManager.optimumTime*AspirationWindowMissTimeScale/100)
+	timeManager.softTimeLimit = min(timeManager.hardTimeLimit, timeManager.softTimeLimit*AspirationWindowMissTimeScale/100)
+}
+
+// SoftLimitReached reports whether a new iteration shouldn't be started.
+func (timeManager *DefaultTimeManager) SoftLimitReached() bool {
+	if !timeManager.isTimeLimited() {
+		return false
+	}
+	return time.Since(timeManager.searchStartInstant).Milliseconds() >= timeManager.softTimeLimit
+}
+
+// HardLimitReached reports whether the search has to be stopped right away.
+func (timeManager *DefaultTimeManager) HardLimitReached() bool {
+	if !timeManager.isTimeLimited() {
+		return false
 	}
+	return time.Since(timeManager.searchStartInstant).Milliseconds() >= timeManager.hardTimeLimit
 }
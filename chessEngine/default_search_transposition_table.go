@@ -1,28 +1,69 @@
 package chessEngine
 
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
 const (
 	DefaultTableSize = 64 * 1024 * 1024
+	MaximumHashMB    = 32000
 	EntriesPerIndex  = 2
-	EntrySize        = 16
+	EntrySize        = uint64(unsafe.Sizeof(tableSlot{}))
 
 	UpperBoundEntryType uint8 = 1
 	LowerBoundEntryType uint8 = 2
 	ExactEntryType      uint8 = 3
 
 	MateThreshold = 9000
+
+	NoStaticEvaluation int16 = -32768
+
+	BucketsTranspositionTableType  = "Buckets"
+	ClustersTranspositionTableType = "Clusters"
+
+	hashfullSampleSize = 1000
 )
 
+// TableEntry is the unpacked form of a transposition table entry, as returned by probes.
 type TableEntry struct {
-	HashValue     uint64
-	BestMove      Move
-	DepthOfSearch uint8
-	Score         int16
-	EntryInfo     uint8
+	HashValue        uint64
+	BestMove         Move
+	Score            int16
+	StaticEvaluation int16
+	DepthOfSearch    uint8
+	EntryInfo        uint8
 }
 
+// tableSlot stores an entry in two atomically written words: the data word, and the key word which is the hash
+// xored with the data. When goroutines race to write a slot, its words may come from different entries, and then
+// the key no longer verifies against the hash of either entry, so the slot is ignored rather than misread.
+type tableSlot struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+// DefaultTranspositionTable stores entries in buckets of two, the first entry being replaced by deeper searches and
+// by the searches after it, and the second entry always being replaced otherwise. Probes and stores are safe for
+// concurrent use, while resizing and clearing the table must not overlap searches.
 type DefaultTranspositionTable struct {
-	entries      []TableEntry
+	entries      []tableSlot
 	numOfEntries uint64
+	age          uint8
+}
+
+// NewTranspositionTable creates a transposition table of the given type and size in bytes, defaulting to buckets.
+func NewTranspositionTable(tableType string, tableSize uint64) TranspositionTable {
+	if tableType == ClustersTranspositionTableType {
+		return NewClusteredTranspositionTable(tableSize)
+	}
+	return NewDefaultTranspositionTable(tableSize)
+}
+
+func NewDefaultTranspositionTable(tableSize uint64) *DefaultTranspositionTable {
+	table := &DefaultTranspositionTable{}
+	table.ResizeTable(tableSize, EntrySize)
+	return table
 }
 
 func (entry TableEntry) GetEntryType() uint8 {
@@ -75,9 +116,17 @@ func (entry *TableEntry) ReadEntryInfo(ttMove *Move, hash uint64, pliesFromRoot
 	return int16(0), false
 }
 
-func (entry *TableEntry) ModifyTableEntry(move Move, searchScore int16, hash uint64, pliesFromRoot uint8, requiredDepth uint8, entryType uint8, entryAge uint8) {
+func (entry *TableEntry) GetStaticEvaluation(hash uint64) (int16, bool) {
+	if entry.HashValue != hash || entry.StaticEvaluation == NoStaticEvaluation {
+		return 0, false
+	}
+	return entry.StaticEvaluation, true
+}
+
+func (entry *TableEntry) ModifyTableEntry(move Move, searchScore int16, staticEvaluation int16, hash uint64, pliesFromRoot uint8, requiredDepth uint8, entryType uint8, entryAge uint8) {
 	entry.HashValue = hash
 	entry.BestMove = move
+	entry.StaticEvaluation = staticEvaluation
 	entry.DepthOfSearch = requiredDepth
 	entry.SetEntryType(entryType)
 	entry.SetEntryAge(entryAge)
@@ -90,9 +139,40 @@ func (entry *TableEntry) ModifyTableEntry(move Move, searchScore int16, hash uin
 	entry.Score = searchScore
 }
 
+// packTableEntryData packs the move without its ordering score, the scores, the depth and the info of the entry.
+func packTableEntryData(entry *TableEntry) uint64 {
+	return uint64(entry.BestMove>>ToSquareOffset)<<48 |
+		uint64(uint16(entry.Score))<<32 |
+		uint64(uint16(entry.StaticEvaluation))<<16 |
+		uint64(entry.DepthOfSearch)<<8 |
+		uint64(entry.EntryInfo)
+}
+
+func unpackTableEntry(key uint64, data uint64) TableEntry {
+	return TableEntry{
+		HashValue:        key ^ data,
+		BestMove:         Move(uint32(data>>48) << ToSquareOffset),
+		Score:            int16(data >> 32),
+		StaticEvaluation: int16(data >> 16),
+		DepthOfSearch:    uint8(data >> 8),
+		EntryInfo:        uint8(data),
+	}
+}
+
+func (slot *tableSlot) load() TableEntry {
+	data := slot.data.Load()
+	return unpackTableEntry(slot.key.Load(), data)
+}
+
+func (slot *tableSlot) store(entry *TableEntry) {
+	data := packTableEntryData(entry)
+	slot.key.Store(entry.HashValue ^ data)
+	slot.data.Store(data)
+}
+
 func (table *DefaultTranspositionTable) ResizeTable(tableSize uint64, entrySize uint64) {
 	table.numOfEntries = tableSize / entrySize
-	table.entries = make([]TableEntry, table.numOfEntries)
+	table.entries = make([]tableSlot, table.numOfEntries)
 }
 
 func (table *DefaultTranspositionTable) DeleteEntries() {
@@ -102,34 +182,80 @@ func (table *DefaultTranspositionTable) DeleteEntries() {
 
 func (table *DefaultTranspositionTable) ClearEntries() {
 	for i := uint64(0); i < table.numOfEntries; i++ {
-		table.entries[i] = *new(TableEntry)
+		table.entries[i].key.Store(0)
+		table.entries[i].data.Store(0)
 	}
 }
 
-func (table *DefaultTranspositionTable) GetEntryToRead(hash uint64) *TableEntry {
+func (table *DefaultTranspositionTable) Probe(hash uint64) (TableEntry, bool) {
+	if table.numOfEntries == 0 {
+		return TableEntry{}, false
+	}
+
 	tableIndex := hash % table.numOfEntries
+	if entry := table.entries[tableIndex].load(); entry.HashValue == hash || tableIndex == table.numOfEntries-1 {
+		return entry, entry.HashValue == hash
+	}
 
-	if tableIndex == table.numOfEntries-1 {
-		return &table.entries[tableIndex]
+	entry := table.entries[tableIndex+1].load()
+	return entry, entry.HashValue == hash
+}
+
+func (table *DefaultTranspositionTable) Store(hash uint64, move Move, score int16, staticEvaluation int16, pliesFromRoot uint8, depth uint8, entryType uint8) {
+	if table.numOfEntries == 0 {
+		return
 	}
 
-	firstEntry := table.entries[tableIndex]
-	if firstEntry.HashValue == hash {
-		return &table.entries[tableIndex]
+	tableIndex := hash % table.numOfEntries
+	if tableIndex != table.numOfEntries-1 {
+		firstEntry := table.entries[tableIndex].load()
+		if firstEntry.GetEntryAge() == table.age && firstEntry.DepthOfSearch > depth {
+			tableIndex++
+		}
 	}
-	return &table.entries[tableIndex+1]
+
+	var entry TableEntry
+	entry.ModifyTableEntry(move, score, staticEvaluation, hash, pliesFromRoot, depth, entryType, table.age)
+	table.entries[tableIndex].store(&entry)
 }
 
-func (table *DefaultTranspositionTable) GetEntryToReplace(hash uint64, requiredDepth uint8, ageState uint8) *TableEntry {
-	tableIndex := hash % table.numOfEntries
+func (table *DefaultTranspositionTable) Clear() {
+	table.ClearEntries()
+}
+
+func (table *DefaultTranspositionTable) Resize(tableSize uint64) {
+	table.ResizeTable(tableSize, EntrySize)
+}
 
-	if tableIndex == table.numOfEntries-1 {
-		return &table.entries[tableIndex]
+func (table *DefaultTranspositionTable) Size() uint64 {
+	return table.numOfEntries * EntrySize
+}
+
+// Hashfull returns the permill of the sampled entries written by the current search.
+func (table *DefaultTranspositionTable) Hashfull() int {
+	sampleSize := min(hashfullSampleSize, table.numOfEntries)
+	if sampleSize == 0 {
+		return 0
 	}
 
-	firstEntry := table.entries[tableIndex]
-	if firstEntry.GetEntryAge() != ageState || firstEntry.DepthOfSearch <= requiredDepth {
-		return &table.entries[tableIndex]
+	usedEntries := uint64(0)
+	for i := uint64(0); i < sampleSize; i++ {
+		entry := table.entries[i].load()
+		if entry.GetEntryType() != 0 && entry.GetEntryAge() == table.age {
+			usedEntries++
+		}
 	}
-	return &table.entries[tableIndex+1]
+	return int(usedEntries * 1000 / sampleSize)
+}
+
+// Prefetch touches the bucket of the hash so that it's cached by the time it's probed. Go has no prefetch
+// instruction, so an atomic load is used, which the compiler can't elide.
+func (table *DefaultTranspositionTable) Prefetch(hash uint64) {
+	if table.numOfEntries != 0 {
+		table.entries[hash%table.numOfEntries].key.Load()
+	}
+}
+
+func (table *DefaultTranspositionTable) NewSearch() {
+	table.age ^= 1
 }
@@ -0,0 +1,156 @@
+package chessEngine
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	TranspositionTableFileMagic       uint32 = 0x54544647
+	TranspositionTableFileVersion     uint32 = 1
+	TranspositionTableFileEntryFormat uint32 = 1
+	DefaultTranspositionTableFile            = "gofish.hash"
+
+	// Entries are stored field by field: the hash, the move, the score, the static evaluation, the depth and the info
+	transpositionTableFileEntrySize = 18
+)
+
+// transpositionTableFileHeader is followed by the deflate compressed entries.
+type transpositionTableFileHeader struct {
+	Magic              uint32
+	Version            uint32
+	EntryFormat        uint32
+	EntrySize          uint32
+	NumOfEntries       uint64
+	ZobristFingerprint uint64
+	Age                uint32
+}
+
+// PersistentTranspositionTable is implemented by transposition tables which can be saved to files and loaded back.
+type PersistentTranspositionTable interface {
+	TranspositionTable
+	Save(filePath string) error
+	Load(filePath string) error
+	// Size returns the size of the table in bytes, which changes when a table is loaded.
+	Size() uint64
+}
+
+func (table *DefaultTranspositionTable) Write(writer io.Writer) error {
+	header := transpositionTableFileHeader{
+		Magic:              TranspositionTableFileMagic,
+		Version:            TranspositionTableFileVersion,
+		EntryFormat:        TranspositionTableFileEntryFormat,
+		EntrySize:          transpositionTableFileEntrySize,
+		NumOfEntries:       table.numOfEntries,
+		ZobristFingerprint: ZobristSingleton.Fingerprint(),
+		Age:                uint32(table.age),
+	}
+	if err := binary.Write(writer, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	compressor, err := flate.NewWriter(writer, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+
+	var entryBytes [transpositionTableFileEntrySize]byte
+	for i := uint64(0); i < table.numOfEntries; i++ {
+		entry := table.entries[i].load()
+		binary.LittleEndian.PutUint64(entryBytes[0:], entry.HashValue)
+		binary.LittleEndian.PutUint32(entryBytes[8:], uint32(entry.BestMove))
+		binary.LittleEndian.PutUint16(entryBytes[12:], uint16(entry.Score))
+		binary.LittleEndian.PutUint16(entryBytes[14:], uint16(entry.StaticEvaluation))
+		entryBytes[16] = entry.DepthOfSearch
+		entryBytes[17] = entry.EntryInfo
+
+		if _, err := compressor.Write(entryBytes[:]); err != nil {
+			return err
+		}
+	}
+	return compressor.Close()
+}
+
+// Read replaces the table with the one written by Write, taking its size. The table is left unchanged on errors.
+func (table *DefaultTranspositionTable) Read(reader io.Reader) error {
+	var header transpositionTableFileHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("reading transposition table header: %w", err)
+	}
+
+	if header.Magic != TranspositionTableFileMagic {
+		return errors.New("not a GoFish transposition table file")
+	}
+	if header.Version != TranspositionTableFileVersion {
+		return fmt.Errorf("unsupported transposition table version %d", header.Version)
+	}
+	if header.EntryFormat != TranspositionTableFileEntryFormat || header.EntrySize != transpositionTableFileEntrySize {
+		return fmt.Errorf("unsupported transposition table entry format %d of size %d", header.EntryFormat, header.EntrySize)
+	}
+	if header.ZobristFingerprint != ZobristSingleton.Fingerprint() {
+		return errors.New("the transposition table was saved with different zobrist hashing numbers")
+	}
+
+	if header.NumOfEntries > MaximumHashMB*1024*1024/EntrySize {
+		return fmt.Errorf("transposition table of %d entries is larger than %d MB", header.NumOfEntries, MaximumHashMB)
+	}
+
+	decompressor := flate.NewReader(reader)
+	defer decompressor.Close()
+
+	// The entries are decoded into a new table, which only replaces this one once all of them are read
+	loadedTable := NewDefaultTranspositionTable(header.NumOfEntries * EntrySize)
+	var entryBytes [transpositionTableFileEntrySize]byte
+	for i := range loadedTable.entries {
+		if _, err := io.ReadFull(decompressor, entryBytes[:]); err != nil {
+			return fmt.Errorf("reading transposition table entries: %w", err)
+		}
+
+		entry := TableEntry{
+			HashValue:        binary.LittleEndian.Uint64(entryBytes[0:]),
+			BestMove:         Move(binary.LittleEndian.Uint32(entryBytes[8:])),
+			Score:            int16(binary.LittleEndian.Uint16(entryBytes[12:])),
+			StaticEvaluation: int16(binary.LittleEndian.Uint16(entryBytes[14:])),
+			DepthOfSearch:    entryBytes[16],
+			EntryInfo:        entryBytes[17],
+		}
+		loadedTable.entries[i].store(&entry)
+	}
+
+	table.entries, table.numOfEntries = loadedTable.entries, loadedTable.numOfEntries
+	table.age = uint8(header.Age)
+	return nil
+}
+
+func (table *DefaultTranspositionTable) Save(filePath string) error {
+	tableFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	fileWriter := bufio.NewWriter(tableFile)
+	if err := table.Write(fileWriter); err != nil {
+		tableFile.Close()
+		return err
+	}
+	if err := fileWriter.Flush(); err != nil {
+		tableFile.Close()
+		return err
+	}
+	return tableFile.Close()
+}
+
+func (table *DefaultTranspositionTable) Load(filePath string) error {
+	tableFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer tableFile.Close()
+
+	return table.Read(bufio.NewReader(tableFile))
+}
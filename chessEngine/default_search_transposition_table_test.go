@@ -0,0 +1,117 @@
+package chessEngine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// getRaceTestEntry derives the fields of the entry stored for the hash from the hash itself, so that a probe
+// returning the fields of another entry is detected.
+func getRaceTestEntry(hash uint64) TableEntry {
+	var entry TableEntry
+	entry.ModifyTableEntry(Move(uint32(uint16(hash>>40))<<ToSquareOffset), int16(hash%2000)-1000, int16(hash>>16%2000)-1000, hash, 0, uint8(hash>>32%64)+1, ExactEntryType, 0)
+	return entry
+}
+
+// TestTranspositionTableConcurrentAccess is meant to be run with the race detector. The table is kept small so that
+// the goroutines keep overwriting the slots read by each other.
+func TestTranspositionTableConcurrentAccess(t *testing.T) {
+	const goroutines, iterations, hashCount = 8, 20000, 512
+
+	table := NewDefaultTranspositionTable(64 * EntrySize)
+	hashRandom := rand.New(rand.NewSource(1))
+	hashes := make([]uint64, hashCount)
+	for i := range hashes {
+		hashes[i] = hashRandom.Uint64()
+	}
+
+	var waitGroup sync.WaitGroup
+	failures := make(chan string, goroutines)
+	for goroutine := 0; goroutine < goroutines; goroutine++ {
+		waitGroup.Add(1)
+		go func(seed int64) {
+			defer waitGroup.Done()
+			random := rand.New(rand.NewSource(seed))
+
+			for i := 0; i < iterations; i++ {
+				hash := hashes[random.Intn(hashCount)]
+				expectedEntry := getRaceTestEntry(hash)
+
+				if random.Intn(2) == 0 {
+					table.Store(hash, expectedEntry.BestMove, expectedEntry.Score, expectedEntry.StaticEvaluation, 0, expectedEntry.DepthOfSearch, ExactEntryType)
+					continue
+				}
+
+				entry, found := table.Probe(hash)
+				if !found {
+					continue
+				}
+				if entry != expectedEntry {
+					failures <- "probe returned the data of another entry"
+					return
+				}
+
+				// Probes return copies, so modifying them mustn't reach the table
+				entry.ModifyTableEntry(NullMove, 0, 0, hash^1, 0, 0, UpperBoundEntryType, 1)
+			}
+		}(int64(goroutine))
+	}
+	waitGroup.Wait()
+	close(failures)
+
+	for failure := range failures {
+		t.Fatal(failure)
+	}
+	for _, hash := range hashes {
+		if entry, found := table.Probe(hash); found && entry != getRaceTestEntry(hash) {
+			t.Fatalf("probe of %x returned the data of another entry", hash)
+		}
+	}
+}
+
+func TestTranspositionTableFile(t *testing.T) {
+	savedTable := NewDefaultTranspositionTable(64 * 1024)
+	for i := range savedTable.entries {
+		entry := getRaceTestEntry(rand.Uint64())
+		savedTable.entries[i].store(&entry)
+	}
+	savedTable.age = 2
+
+	tableFile := bytes.Buffer{}
+	if err := savedTable.Write(&tableFile); err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewDefaultTranspositionTable(1024 * 1024)
+	if err := table.Read(bytes.NewReader(tableFile.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if table.Size() != savedTable.Size() || table.age != savedTable.age {
+		t.Fatalf("read a table of %d bytes with age %d, expected %d bytes with age %d", table.Size(), table.age, savedTable.Size(), savedTable.age)
+	}
+	for i := range table.entries {
+		if table.entries[i].load() != savedTable.entries[i].load() {
+			t.Fatalf("entry %d is %+v, expected %+v", i, table.entries[i].load(), savedTable.entries[i].load())
+		}
+	}
+
+	// A truncated file and an entry count above the maximum hash size leave the table unchanged
+	largeHeader := transpositionTableFileHeader{}
+	binary.Read(bytes.NewReader(tableFile.Bytes()), binary.LittleEndian, &largeHeader)
+	largeHeader.NumOfEntries = MaximumHashMB*1024*1024/EntrySize + 1
+	largeTableFile := bytes.Buffer{}
+	binary.Write(&largeTableFile, binary.LittleEndian, largeHeader)
+
+	for _, invalidFile := range [][]byte{tableFile.Bytes()[:tableFile.Len()/2], largeTableFile.Bytes()} {
+		unchangedTable := NewDefaultTranspositionTable(1024 * 1024)
+		if err := unchangedTable.Read(bytes.NewReader(invalidFile)); err == nil {
+			t.Error("read an invalid table")
+		}
+		if unchangedTable.Size() != 1024*1024/EntrySize*EntrySize || unchangedTable.age != 0 {
+			t.Errorf("the table was changed to %d bytes with age %d by an invalid file", unchangedTable.Size(), unchangedTable.age)
+		}
+	}
+}
@@ -1,36 +1,42 @@
 package chessEngine
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math"
-	"strconv"
+	"math/rand"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	NumOfKillerMoves                                   = 2
-	MaximumNumberOfPlies                               = 1024
-	EssentialMovesOffset                        uint16 = math.MaxUint16 - 256
-	PvMoveScore                                 uint16 = 65
-	KillerMoveFirstSlotScore                    uint16 = 10
-	KillerMoveSecondSlotScore                   uint16 = 20
-	CounterMoveScore                            uint16 = 5
-	HistoryHeuristicScoreUpperBound                    = int32(EssentialMovesOffset - 30)
-	AspirationWindowOffset                      int16  = 35
-	AspirationWindowMissTimeExtensionLowerBound        = 6
-	StaticNullMovePruningPenalty                int16  = 85
-	NullMovePruningDepthLimit                   int8   = 2
-	RazoringDepthUpperBound                     int8   = 2
-	FutilityPruningDepthUpperBound              int8   = 8
-	InternalIterativeDeepeningDepthLowerBound   int8   = 4
-	InternalIterativeDeepeningReductionAmount   int8   = 2
-	LateMovePruningDepthUpperBound              int8   = 5
-	FutilityPruningLegalMovesLowerBound         int    = 1
-	SingularExtensionDepthLowerBound            int8   = 4
-	SingularMoveExtensionPenalty                int16  = 125
-	SignularMoveExtensionAmount                 int8   = 1
-	LateMoveReductionLegalMoveLowerBound        int    = 4
-	LateMoveReductionDepthLowerBound            int8   = 3
+	// MaximumSearchThreads is the only value of the Threads option, as the search runs on a single thread.
+	MaximumSearchThreads = 1
+
+	NumOfKillerMoves                                 = 2
+	MaximumNumberOfPlies                             = 1024
+	EssentialMovesOffset                      uint16 = math.MaxUint16 - 256
+	PvMoveScore                               uint16 = 65
+	KillerMoveFirstSlotScore                  uint16 = 10
+	KillerMoveSecondSlotScore                 uint16 = 20
+	CounterMoveScore                          uint16 = 5
+	HistoryHeuristicScoreUpperBound                  = int32(EssentialMovesOffset - 30)
+	AspirationWindowOffset                    int16  = 35
+	StaticNullMovePruningPenalty              int16  = 85
+	NullMovePruningDepthLimit                 int8   = 2
+	RazoringDepthUpperBound                   int8   = 2
+	FutilityPruningDepthUpperBound            int8   = 8
+	InternalIterativeDeepeningDepthLowerBound int8   = 4
+	InternalIterativeDeepeningReductionAmount int8   = 2
+	LateMovePruningDepthUpperBound            int8   = 5
+	FutilityPruningLegalMovesLowerBound       int    = 1
+	SingularExtensionDepthLowerBound          int8   = 4
+	SingularMoveExtensionPenalty              int16  = 125
+	SignularMoveExtensionAmount               int8   = 1
+	LateMoveReductionLegalMoveLowerBound      int    = 4
+	LateMoveReductionDepthLowerBound          int8   = 3
 )
 
 var FutilityBoosts = [9]int16{0, 100, 160, 220, 280, 340, 400, 460, 520}
@@ -48,17 +54,43 @@ var MvvLvaScores [7][6]uint16 = [7][6]uint16{
 }
 
 type DefaultSearcher struct {
-	timeManager                DefaultTimeManager
+	timeManager                TimeManager
+	moveOverhead               int64
+	endSearch                  atomic.Bool
+	nodeLimit                  uint64
+	depthLimit                 uint8
+	rootMoveNodeCounts         [64][64]uint64
 	position                   Position
-	transpositionTable         DefaultTranspositionTable
+	transpositionTable         TranspositionTable
+	transpositionTableType     string
+	transpositionTableSize     uint64
+	transpositionTableFile     string
+	keepLoadedTable            bool
+	evaluationCache            EvaluationCache
 	searchedNodes              uint64
 	positionHashHistory        [MaximumNumberOfPlies]uint64
 	positionHashHistoryCounter uint16
 	sideToPlay                 uint8
-	ageState                   uint8
 	killerMoves                [MaxDepth + 1][NumOfKillerMoves]Move
 	counterMoves               [2][64][64]Move
 	historyHeuristicStats      [2][64][64]int32
+	lastSearchScore            int16
+	infoOutput                 io.Writer
+	tablebases                 *Tablebases
+	syzygyTablebases           *SyzygyTablebases
+	syzygyProbeDepth           int8
+	syzygyIgnoreRule50         bool
+	syzygyProbingInTree        bool
+	syzygyRootMoves            []Move
+	syzygyRootScore            int16
+	excludedRootMoves          []Move
+	multiPV                    int
+	skillLevel                 int
+	limitStrength              bool
+	uciElo                     int
+	skillRandom                *rand.Rand
+	skillNoiseSeed             uint64
+	skillEvaluationNoise       int16
 }
 
 func InitializeLateMoveReductions() {
@@ -69,57 +101,140 @@ func InitializeLateMoveReductions() {
 	}
 }
 
+// NewDefaultSearcher returns a searcher holding the default value of every setting, which Reset keeps.
+func NewDefaultSearcher() *DefaultSearcher {
+	return &DefaultSearcher{
+		transpositionTableType: BucketsTranspositionTableType,
+		transpositionTableSize: DefaultTableSize,
+		syzygyProbeDepth:       DefaultSyzygyProbeDepth,
+		timeManager:            &DefaultTimeManager{},
+		moveOverhead:           DefaultMoveOverhead,
+		multiPV:                1,
+		skillLevel:             MaximumSkillLevel,
+		uciElo:                 MinimumUciElo,
+		skillRandom:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
 func (searcher *DefaultSearcher) GetOptions() map[string]EngineOption {
 	options := make(map[string]EngineOption)
 
-	options["Transposition Table Size"] = EngineOption{
-		optionType:   "spin",
-		defaultValue: "64",
-		minValue:     "1",
-		maxValue:     "32000",
-		setOption: func(sizeValue string) {
-			size, err := strconv.Atoi(sizeValue)
-			if err != nil {
-				searcher.transpositionTable.DeleteEntries()
-				searcher.transpositionTable.ResizeTable(uint64(size), EntrySize)
-			}
-		},
-	}
+	options["Hash"] = NewSpinOption(searcher.getHashMB(), 1, MaximumHashMB, func(size int) {
+		searcher.transpositionTableSize = uint64(size) * 1024 * 1024
+		searcher.transpositionTable.Resize(searcher.transpositionTableSize)
+	})
 
-	options["Clear Transposition Table"] = EngineOption{
-		optionType: "button",
-		setOption: func(_ string) {
-			searcher.transpositionTable.ClearEntries()
-		},
-	}
+	options["Clear Hash"] = NewButtonOption(func() {
+		searcher.transpositionTable.Clear()
+	})
 
-	options["Clear Killer Moves"] = EngineOption{
-		optionType: "button",
-		setOption: func(_ string) {
-			searcher.ClearKillerMoves()
-		},
-	}
+	options["Threads"] = NewSpinOption(1, 1, MaximumSearchThreads, func(_ int) {})
 
-	options["Clear Counter Moves"] = EngineOption{
-		optionType: "button",
-		setOption: func(_ string) {
-			searcher.ClearCounterMoves()
-		},
-	}
+	options["Transposition Table Type"] = NewComboOption(BucketsTranspositionTableType, []string{BucketsTranspositionTableType, ClustersTranspositionTableType}, func(tableType string) {
+		searcher.transpositionTableType = tableType
+		searcher.SetTranspositionTable(NewTranspositionTable(tableType, searcher.transpositionTableSize))
+	})
 
-	options["Clear History Heuristic Stats"] = EngineOption{
-		optionType: "button",
-		setOption: func(_ string) {
-			searcher.ClearHistoryHeuristicStats()
-		},
-	}
+	options["Hash File"] = NewStringOption(DefaultTranspositionTableFile, func(filePath string) {
+		searcher.transpositionTableFile = filePath
+	})
+
+	options["SaveHash"] = NewButtonOption(func() {
+		if err := searcher.SaveHash(searcher.getTranspositionTableFile()); err != nil {
+			fmt.Fprintf(searcher.getInfoOutput(), "info string failed to save the transposition table: %v\n", err)
+			return
+		}
+		fmt.Fprintf(searcher.getInfoOutput(), "info string saved the transposition table to %s\n", searcher.getTranspositionTableFile())
+	})
+
+	options["LoadHash"] = NewButtonOption(func() {
+		if err := searcher.LoadHash(searcher.getTranspositionTableFile()); err != nil {
+			fmt.Fprintf(searcher.getInfoOutput(), "info string failed to load the transposition table: %v\n", err)
+			return
+		}
+		fmt.Fprintf(searcher.getInfoOutput(), "info string loaded the transposition table from %s, Hash is now %d MB\n", searcher.getTranspositionTableFile(), searcher.getHashMB())
+	})
+
+	options["Evaluation Cache Size"] = NewSpinOption(int(searcher.evaluationCache.Size()/(1024*1024)), 0, 4096, func(size int) {
+		searcher.evaluationCache.ResizeCache(uint64(size)*1024*1024, EvaluationCacheEntrySize)
+	})
+
+	options["Tablebase Path"] = NewStringOption("<empty>", func(directory string) {
+		searcher.SetTablebasePath(directory)
+	})
+
+	options["SyzygyPath"] = NewStringOption("<empty>", func(path string) {
+		searcher.SetSyzygyPath(path)
+	})
+
+	options["SyzygyProbeDepth"] = NewSpinOption(int(searcher.syzygyProbeDepth), 1, MaxDepth, func(depth int) {
+		searcher.syzygyProbeDepth = int8(depth)
+	})
+
+	options["Syzygy50MoveRule"] = NewCheckOption(true, func(enabled bool) {
+		searcher.syzygyIgnoreRule50 = !enabled
+	})
+
+	options["Move Overhead"] = NewSpinOption(DefaultMoveOverhead, 0, MaximumMoveOverhead, func(overhead int) {
+		searcher.moveOverhead = int64(overhead)
+		searcher.timeManager.SetMoveOverhead(searcher.moveOverhead)
+	})
+
+	options["MultiPV"] = NewSpinOption(1, 1, MaximumMultiPV, func(lines int) {
+		searcher.multiPV = lines
+	})
+
+	options["Skill Level"] = NewSpinOption(MaximumSkillLevel, 0, MaximumSkillLevel, func(level int) {
+		searcher.skillLevel = level
+	})
+
+	options["UCI_LimitStrength"] = NewCheckOption(false, func(enabled bool) {
+		searcher.limitStrength = enabled
+	})
+
+	options["UCI_Elo"] = NewSpinOption(MinimumUciElo, MinimumUciElo, MaximumUciElo, func(elo int) {
+		searcher.uciElo = elo
+	})
+
+	options["Clear Killer Moves"] = NewButtonOption(func() {
+		searcher.ClearKillerMoves()
+	})
+
+	options["Clear Counter Moves"] = NewButtonOption(func() {
+		searcher.ClearCounterMoves()
+	})
+
+	options["Clear History Heuristic Stats"] = NewButtonOption(func() {
+		searcher.ClearHistoryHeuristicStats()
+	})
 
 	return options
 }
 
 func (searcher *DefaultSearcher) Reset(evaluator Evaluator) {
-	*searcher = DefaultSearcher{}
-	searcher.transpositionTable.ResizeTable(DefaultTableSize, EntrySize)
+	*searcher = DefaultSearcher{
+		transpositionTableType: searcher.transpositionTableType,
+		transpositionTableSize: searcher.transpositionTableSize,
+		transpositionTableFile: searcher.transpositionTableFile,
+		evaluationCache:        searcher.evaluationCache,
+		infoOutput:             searcher.infoOutput,
+		tablebases:             searcher.tablebases,
+		syzygyTablebases:       searcher.syzygyTablebases,
+		syzygyProbeDepth:       searcher.syzygyProbeDepth,
+		syzygyIgnoreRule50:     searcher.syzygyIgnoreRule50,
+		timeManager:            searcher.timeManager,
+		moveOverhead:           searcher.moveOverhead,
+		multiPV:                searcher.multiPV,
+		skillLevel:             searcher.skillLevel,
+		limitStrength:          searcher.limitStrength,
+		uciElo:                 searcher.uciElo,
+		skillRandom:            searcher.skillRandom,
+	}
+	// The evaluation cache keeps its size, and stays disabled when it was resized to zero
+	searcher.evaluationCache.ClearEntries()
+	searcher.skillNoiseSeed = searcher.skillRandom.Uint64()
+	searcher.timeManager.SetMoveOverhead(searcher.moveOverhead)
+	searcher.transpositionTable = NewTranspositionTable(searcher.transpositionTableType, searcher.transpositionTableSize)
 	searcher.InitializeSearchInfo(FENStartPosition, evaluator)
 }
 
@@ -127,20 +242,124 @@ func (searcher *DefaultSearcher) InitializeSearchInfo(fenString string, evaluato
 	searcher.position.LoadFEN(fenString, evaluator)
 	searcher.positionHashHistoryCounter = 0
 	searcher.positionHashHistory[searcher.positionHashHistoryCounter] = searcher.position.PositionHash
-	searcher.ageState = 0
 }
 
 func (searcher *DefaultSearcher) ResetToNewGame() {
-	searcher.transpositionTable.ClearEntries()
+	searcher.skillNoiseSeed = searcher.skillRandom.Uint64()
+	// GUIs send ucinewgame after the options, so a table just loaded by LoadHash is kept until it has been searched
+	if !searcher.keepLoadedTable {
+		searcher.transpositionTable.Clear()
+	}
+	searcher.keepLoadedTable = false
+	searcher.evaluationCache.ClearEntries()
 	searcher.ClearKillerMoves()
 	searcher.ClearCounterMoves()
 	searcher.ClearHistoryHeuristicStats()
 }
 
+// SetTranspositionTable replaces the transposition table of the searcher, such as with a custom implementation.
+func (searcher *DefaultSearcher) SetTranspositionTable(transpositionTable TranspositionTable) {
+	searcher.transpositionTable = transpositionTable
+}
+
+// SetTimeManager replaces the time manager of the searcher, such as with a custom time allocation strategy.
+func (searcher *DefaultSearcher) SetTimeManager(timeManager TimeManager) {
+	searcher.timeManager = timeManager
+	searcher.timeManager.SetMoveOverhead(searcher.moveOverhead)
+}
+
+func (searcher *DefaultSearcher) getTranspositionTableFile() string {
+	if searcher.transpositionTableFile == "" || searcher.transpositionTableFile == "<empty>" {
+		return DefaultTranspositionTableFile
+	}
+	return searcher.transpositionTableFile
+}
+
+// SaveHash saves the transposition table to the file, so that the analysis can be resumed later on with LoadHash.
+func (searcher *DefaultSearcher) SaveHash(filePath string) error {
+	persistentTable, ok := searcher.transpositionTable.(PersistentTranspositionTable)
+	if !ok {
+		return errors.New("the transposition table type can't be saved")
+	}
+	return persistentTable.Save(filePath)
+}
+
+// LoadHash replaces the transposition table with the one saved to the file, taking its size. The loaded entries are
+// kept by the next ResetToNewGame, unless a search is started before it.
+func (searcher *DefaultSearcher) LoadHash(filePath string) error {
+	persistentTable, ok := searcher.transpositionTable.(PersistentTranspositionTable)
+	if !ok {
+		return errors.New("the transposition table type can't be loaded")
+	}
+	if err := persistentTable.Load(filePath); err != nil {
+		return err
+	}
+
+	searcher.transpositionTableSize = persistentTable.Size()
+	searcher.keepLoadedTable = true
+	return nil
+}
+
+// getHashMB returns the size of the transposition table in megabytes, as set through the Hash option.
+func (searcher *DefaultSearcher) getHashMB() int {
+	return int(max(1, searcher.transpositionTableSize/(1024*1024)))
+}
+
 func (searcher *DefaultSearcher) Position() *Position {
 	return &searcher.position
 }
 
+func (searcher *DefaultSearcher) SetInfoOutput(infoOutput io.Writer) {
+	searcher.infoOutput = infoOutput
+}
+
+func (searcher *DefaultSearcher) getInfoOutput() io.Writer {
+	if searcher.infoOutput == nil {
+		return os.Stdout
+	}
+	return searcher.infoOutput
+}
+
+func (searcher *DefaultSearcher) SetTablebasePath(directory string) {
+	if directory == "" || directory == "<empty>" {
+		searcher.tablebases = nil
+		return
+	}
+
+	tablebases, err := LoadTablebases(directory)
+	if err != nil {
+		fmt.Fprintf(searcher.getInfoOutput(), "info string failed to load tablebases: %v\n", err)
+		return
+	}
+
+	searcher.tablebases = tablebases
+	fmt.Fprintf(searcher.getInfoOutput(), "info string loaded %d tablebases from %s\n", tablebases.Count(), directory)
+}
+
+func (searcher *DefaultSearcher) SetSyzygyPath(path string) {
+	if searcher.syzygyTablebases != nil {
+		searcher.syzygyTablebases.Close()
+		searcher.syzygyTablebases = nil
+	}
+
+	if path == "" || path == "<empty>" {
+		return
+	}
+
+	syzygyTablebases, err := LoadSyzygyTablebases(path)
+	if err != nil {
+		fmt.Fprintf(searcher.getInfoOutput(), "info string failed to load syzygy tablebases: %v\n", err)
+		return
+	}
+
+	searcher.syzygyTablebases = syzygyTablebases
+	fmt.Fprintf(searcher.getInfoOutput(), "info string found %d syzygy tablebases (%d DTZ) up to %d pieces\n", syzygyTablebases.Count(), syzygyTablebases.DTZCount(), syzygyTablebases.MaxPieces())
+}
+
+func (searcher *DefaultSearcher) LastSearchScore() int16 {
+	return searcher.lastSearchScore
+}
+
 func (searcher *DefaultSearcher) RecordPositionHash(positionHash uint64) {
 	searcher.positionHashHistoryCounter++
 	searcher.positionHashHistory[searcher.positionHashHistoryCounter] = positionHash
@@ -229,6 +448,19 @@ func (searcher *DefaultSearcher) isThreeFoldRepetition() bool {
 	return false
 }
 
+// hasRepeatedSinceZeroingMove returns whether any position since the last capture or pawn move occurred twice.
+func (searcher *DefaultSearcher) hasRepeatedSinceZeroingMove() bool {
+	firstPly := int(searcher.positionHashHistoryCounter) - int(searcher.position.Rule50)
+	for ply := max(0, firstPly); ply < int(searcher.positionHashHistoryCounter); ply++ {
+		for laterPly := ply + 1; laterPly <= int(searcher.positionHashHistoryCounter); laterPly++ {
+			if searcher.positionHashHistory[ply] == searcher.positionHashHistory[laterPly] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (searcher *DefaultSearcher) AssignScoresToMoves(moves *MoveList, pvFirstMove Move, depth uint8, previousMove Move) {
 	for moveIndex := uint8(0); moveIndex < moves.Size; moveIndex++ {
 		move := &moves.Moves[moveIndex]
@@ -290,25 +522,45 @@ func getPresentableScore(nodeScore int16) string {
 func (searcher *DefaultSearcher) StartSearch(evaluator Evaluator) Move {
 	bestMove := NullMove
 	pv := PV{}
-	searcher.ageState ^= 1
+	searcher.keepLoadedTable = false
+	searcher.transpositionTable.NewSearch()
 	searcher.sideToPlay = searcher.position.SideToMove
 	searcher.searchedNodes = 0
+	searcher.rootMoveNodeCounts = [64][64]uint64{}
+	searcher.endSearch.Store(false)
+	searcher.nodeLimit = searcher.timeManager.NodeLimit()
 	searchTime := int64(0)
-	aspirationWindowMissTimeExtension := false
 	alpha := -CheckmateScore
 	beta := CheckmateScore
 
+	if tablebaseMove, found := searcher.getTablebaseRootMove(evaluator); found {
+		return tablebaseMove
+	}
+	searcher.rankSyzygyRootMoves(evaluator)
+
+	skillLevel := searcher.getSkillLevel()
+	searcher.applySkillLimits(skillLevel)
+	rootLines := []rootLine{}
+
+	lineCount := max(1, searcher.multiPV)
+	if skillLevel < MaximumSkillLevel {
+		lineCount = max(lineCount, SkillMultiPV)
+	}
+	if lineCount > 1 {
+		lineCount = min(lineCount, searcher.getRootMoveCount(evaluator))
+	}
+
 	searcher.ReduceHistoryHeuristicScores()
 	searcher.timeManager.StartMoveTimeAllocation(searcher.position.CurrentPly)
 
-	for depth := uint8(1); searcher.timeManager.nodeCount > 0 && depth <= MaxDepth && depth <= searcher.timeManager.depth; depth++ {
+	for depth := uint8(1); searcher.nodeLimit > 0 && depth <= MaxDepth && depth <= searcher.depthLimit; depth++ {
 		pv.DeleteVariation()
 
 		searchStartInstant := time.Now()
 		nodeScore := searcher.Negamax(evaluator, int8(depth), 0, alpha, beta, &pv, true, NullMove, NullMove, false)
 		searchDuration := time.Since(searchStartInstant)
 
-		if searcher.timeManager.endSearch {
+		if searcher.endSearch.Load() {
 			if bestMove == NullMove && depth == 1 {
 				bestMove = pv.GetVariationFirstMove()
 			}
@@ -320,10 +572,7 @@ func (searcher *DefaultSearcher) StartSearch(evaluator Evaluator) Move {
 			beta = CheckmateScore
 			depth--
 
-			if depth >= AspirationWindowMissTimeExtensionLowerBound && !aspirationWindowMissTimeExtension {
-				searcher.timeManager.ChangeMoveAllocatedTime(searcher.timeManager.moveAllocatedTime * 13 / 10)
-				aspirationWindowMissTimeExtension = true
-			}
+			searcher.timeManager.AspirationWindowMissed(depth)
 			continue
 		}
 
@@ -332,33 +581,197 @@ func (searcher *DefaultSearcher) StartSearch(evaluator Evaluator) Move {
 
 		searchTime += searchDuration.Milliseconds()
 		bestMove = pv.GetVariationFirstMove()
+		displayedScore := nodeScore
+		if searcher.syzygyRootMoves != nil && abs(nodeScore) <= MateThreshold {
+			displayedScore = searcher.syzygyRootScore
+		}
+		searcher.lastSearchScore = displayedScore
 
-		fmt.Printf("info depth %d score %s nodes %d nps %d time %d pv %s\n", depth, getPresentableScore(nodeScore), searcher.searchedNodes, uint64(float64(1000*searcher.searchedNodes)/float64(searchTime)), searchTime, pv)
+		searcher.printSearchInfo(depth, 1, displayedScore, pv, searchTime)
+
+		if lineCount > 1 {
+			secondaryLines, complete := searcher.searchSecondaryLines(evaluator, depth, bestMove, lineCount)
+			if !complete {
+				break
+			}
+
+			for lineIndex, line := range secondaryLines[:min(len(secondaryLines), searcher.multiPV-1)] {
+				searcher.printSearchInfo(depth, lineIndex+2, line.score, line.pv, searchTime)
+			}
+			rootLines = append([]rootLine{{move: bestMove, score: nodeScore, pv: pv}}, secondaryLines...)
+		}
+
+		searcher.timeManager.IterationCompleted(depth, bestMove, nodeScore, searcher.getBestMoveNodeFraction(bestMove))
+		if searcher.timeManager.SoftLimitReached() {
+			break
+		}
+	}
+
+	if skillLevel < MaximumSkillLevel && len(rootLines) > 1 {
+		bestMove = searcher.pickSkillMove(rootLines[:min(len(rootLines), SkillMultiPV)], skillLevel)
 	}
 
 	return bestMove
 }
 
+// getTablebaseRootMove picks the move with the best distance to mate if the root position is a tablebase win or
+// loss and the positions after every legal move are in the tablebases. Drawn positions are left to the search.
+func (searcher *DefaultSearcher) getTablebaseRootMove(evaluator Evaluator) (Move, bool) {
+	if searcher.tablebases == nil {
+		return NullMove, false
+	}
+
+	if rootScore, found := searcher.tablebases.Probe(&searcher.position); !found || rootScore == drawScore {
+		return NullMove, false
+	}
+
+	bestMove, bestScore := NullMove, int16(-CheckmateScore-1)
+	legalMoves := GenerateLegalMoves(&searcher.position, evaluator)
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		move := legalMoves.Moves[moveIndex]
+		searcher.position.DoMove(move, evaluator)
+		childScore, found := searcher.tablebases.Probe(&searcher.position)
+		searcher.position.UnDoPreviousMove(move, evaluator)
+
+		if !found {
+			return NullMove, false
+		}
+
+		if moveScore := getTablebaseParentScore(childScore); moveScore > bestScore {
+			bestMove, bestScore = move, moveScore
+		}
+	}
+
+	searcher.lastSearchScore = bestScore
+	fmt.Fprintf(searcher.getInfoOutput(), "info depth 1 score %s nodes %d nps 0 time 0 pv %v\n", getPresentableScore(bestScore), legalMoves.Size, bestMove)
+	return bestMove, bestMove != NullMove
+}
+
+// rankSyzygyRootMoves restricts the search to the root moves which preserve the tablebase result, and with the
+// DTZ tables, which make progress toward it. In-tree probing is only kept when the WDL tables alone ranked a won
+// root position, for the search to find the way to convert it.
+func (searcher *DefaultSearcher) rankSyzygyRootMoves(evaluator Evaluator) {
+	searcher.syzygyRootMoves = nil
+	searcher.syzygyProbingInTree = searcher.syzygyTablebases != nil
+	if searcher.syzygyTablebases == nil {
+		return
+	}
+
+	rootMoves, usedDTZ, found := searcher.syzygyTablebases.RankRootMoves(&searcher.position, evaluator, !searcher.syzygyIgnoreRule50, searcher.hasRepeatedSinceZeroingMove())
+	if !found || len(rootMoves) == 0 {
+		return
+	}
+
+	bestRank := rootMoves[0].Rank
+	for _, rootMove := range rootMoves {
+		bestRank = max(bestRank, rootMove.Rank)
+	}
+
+	for _, rootMove := range rootMoves {
+		if rootMove.Rank == bestRank {
+			searcher.syzygyRootMoves = append(searcher.syzygyRootMoves, rootMove.Move)
+			searcher.syzygyRootScore = rootMove.Score
+		}
+	}
+	searcher.syzygyProbingInTree = !usedDTZ && searcher.syzygyRootScore > drawScore
+}
+
+func (searcher *DefaultSearcher) isSyzygyRootMove(move Move) bool {
+	for _, rootMove := range searcher.syzygyRootMoves {
+		if rootMove.IsSameMove(move) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeSyzygyWDL probes the WDL tables right after captures and pawn moves, where the fifty move counter is reset
+// and the tables give the exact result. Wins and losses are only bounds, as their distance to mate is unknown.
+func (searcher *DefaultSearcher) probeSyzygyWDL(evaluator Evaluator, depth int8, ply uint8) (int16, uint8, bool) {
+	if !searcher.syzygyProbingInTree || searcher.position.Rule50 != 0 || !searcher.syzygyTablebases.CanProbe(&searcher.position) {
+		return drawScore, ExactEntryType, false
+	}
+
+	pieceCount := (searcher.position.ColorsBitBoard[White] | searcher.position.ColorsBitBoard[Black]).CountSetBits()
+	if pieceCount == searcher.syzygyTablebases.MaxPieces() && depth < searcher.syzygyProbeDepth {
+		return drawScore, ExactEntryType, false
+	}
+
+	wdl, found := searcher.syzygyTablebases.ProbeWDL(&searcher.position, evaluator)
+	if !found {
+		return drawScore, ExactEntryType, false
+	}
+
+	// Without the fifty move rule, cursed wins and blessed losses are scored as wins and losses
+	drawMargin := 1
+	if searcher.syzygyIgnoreRule50 {
+		drawMargin = 0
+	}
+
+	tablebaseScore, entryType := drawScore+int16(2*wdl*drawMargin), ExactEntryType
+	if wdl < -drawMargin {
+		tablebaseScore, entryType = -SyzygyWinScore+int16(ply), UpperBoundEntryType
+	} else if wdl > drawMargin {
+		tablebaseScore, entryType = SyzygyWinScore-int16(ply), LowerBoundEntryType
+	}
+	return tablebaseScore, entryType, true
+}
+
+// probeTablebases returns the tablebase score of the current node relative to the root.
+func (searcher *DefaultSearcher) probeTablebases(ply uint8) (int16, bool) {
+	if searcher.tablebases == nil {
+		return drawScore, false
+	}
+
+	tablebaseScore, found := searcher.tablebases.Probe(&searcher.position)
+	if !found {
+		return drawScore, false
+	}
+
+	if tablebaseScore > drawScore {
+		return tablebaseScore - int16(ply), true
+	} else if tablebaseScore < drawScore {
+		return tablebaseScore + int16(ply), true
+	}
+	return drawScore, true
+}
+
+func (searcher *DefaultSearcher) evaluatePosition(evaluator Evaluator) int16 {
+	evaluation := searcher.evaluationCache.Evaluate(evaluator, &searcher.position)
+	if searcher.skillEvaluationNoise > 0 {
+		return searcher.addSkillEvaluationNoise(evaluation)
+	}
+	return evaluation
+}
+
+// getBestMoveNodeFraction returns the fraction of the searched nodes which were spent on the subtree of the move.
+func (searcher *DefaultSearcher) getBestMoveNodeFraction(bestMove Move) float64 {
+	if searcher.searchedNodes == 0 {
+		return 0
+	}
+	return float64(searcher.rootMoveNodeCounts[bestMove.GetFromSquare()][bestMove.GetToSquare()]) / float64(searcher.searchedNodes)
+}
+
 func (searcher *DefaultSearcher) StopSearch() {
-	searcher.timeManager.endSearch = true
+	searcher.endSearch.Store(true)
 }
 
 func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply uint8, alpha int16, beta int16, pv *PV, nullMovePruningRequired bool, previousMove Move, singularMoveExtensionMove Move, singularMoveExtendedSearch bool) int16 {
 	searcher.searchedNodes++
 
 	if ply >= MaxDepth {
-		return evaluator.EvaluatePosition(&searcher.position)
+		return searcher.evaluatePosition(evaluator)
 	}
 
-	if searcher.searchedNodes >= searcher.timeManager.nodeCount {
-		searcher.timeManager.endSearch = true
+	if searcher.searchedNodes >= searcher.nodeLimit {
+		searcher.endSearch.Store(true)
 	}
 
-	if searcher.searchedNodes&2047 == 0 {
-		searcher.timeManager.SetMoveTimeIsUp()
+	if searcher.searchedNodes&2047 == 0 && !searcher.endSearch.Load() && searcher.timeManager.HardLimitReached() {
+		searcher.endSearch.Store(true)
 	}
 
-	if searcher.timeManager.endSearch {
+	if searcher.endSearch.Load() {
 		return 0
 	}
 
@@ -367,7 +780,7 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 	isCurrentNodePv := beta-alpha != 1
 	continuationPv := PV{}
 	futilityPruningPossibility := false
-	transpositionTableHashMatch := false
+	syzygyLowerBound, syzygyUpperBound := -CheckmateScore, CheckmateScore
 
 	if inCheck {
 		depth++
@@ -382,17 +795,50 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		return drawScore
 	}
 
+	if kpkStrongSide, isKPKPosition := getKPKStrongSide(&searcher.position); !onTreeRoot && isKPKPosition && !ProbeKPKBitbase(&searcher.position, kpkStrongSide) {
+		return drawScore
+	}
+
+	if !onTreeRoot {
+		if tablebaseScore, found := searcher.probeTablebases(ply); found {
+			return tablebaseScore
+		}
+
+		if tablebaseScore, entryType, found := searcher.probeSyzygyWDL(evaluator, depth, ply); found {
+			if entryType == ExactEntryType || (entryType == LowerBoundEntryType && tablebaseScore >= beta) || (entryType == UpperBoundEntryType && tablebaseScore <= alpha) {
+				storedDepth := uint8(min(MaxDepth-1, int(depth)+6))
+				searcher.transpositionTable.Store(searcher.position.PositionHash, NullMove, tablebaseScore, NoStaticEvaluation, ply, storedDepth, entryType)
+				return tablebaseScore
+			}
+
+			// PV nodes are searched on for the exact score, which the tablebase result bounds
+			if isCurrentNodePv && entryType == LowerBoundEntryType {
+				syzygyLowerBound, alpha = tablebaseScore, max(alpha, tablebaseScore)
+			} else if isCurrentNodePv {
+				syzygyUpperBound = tablebaseScore
+			}
+		}
+	}
+
 	transpostionTableMove := NullMove
-	transpostionTableEntry := searcher.transpositionTable.GetEntryToRead(searcher.position.PositionHash)
+	transpostionTableEntry, transpositionTableHashMatch := searcher.transpositionTable.Probe(searcher.position.PositionHash)
 	transpostionTableScore, transpositionTableScoreValid := transpostionTableEntry.ReadEntryInfo(&transpostionTableMove, searcher.position.PositionHash, ply, uint8(depth), alpha, beta)
-	transpositionTableHashMatch = transpostionTableEntry.HashValue == searcher.position.PositionHash
 
 	if transpositionTableScoreValid && !onTreeRoot && !singularMoveExtensionMove.IsSameMove(transpostionTableMove) {
 		return transpostionTableScore
 	}
 
+	// The static evaluation is only used for pruning decisions at non-PV nodes which aren't in check
+	currentPositionStaticEvaluation := NoStaticEvaluation
+	if !inCheck && !isCurrentNodePv {
+		if staticEvaluation, found := transpostionTableEntry.GetStaticEvaluation(searcher.position.PositionHash); found {
+			currentPositionStaticEvaluation = staticEvaluation
+		} else {
+			currentPositionStaticEvaluation = searcher.evaluatePosition(evaluator)
+		}
+	}
+
 	if abs(beta) < MateThreshold && !inCheck && !isCurrentNodePv {
-		currentPositionStaticEvaluation := evaluator.EvaluatePosition(&searcher.position)
 		penalizedEvaluation := currentPositionStaticEvaluation - StaticNullMovePruningPenalty*int16(depth)
 		if penalizedEvaluation >= beta {
 			return penalizedEvaluation
@@ -409,7 +855,7 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		searcher.position.unDoPreviousNullMove()
 		continuationPv.DeleteVariation()
 
-		if searcher.timeManager.endSearch {
+		if searcher.endSearch.Load() {
 			return 0
 		}
 
@@ -419,7 +865,6 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 	}
 
 	if depth <= RazoringDepthUpperBound && !inCheck && !isCurrentNodePv {
-		currentPositionStaticEvaluation := evaluator.EvaluatePosition(&searcher.position)
 		boostedScore := currentPositionStaticEvaluation + FutilityBoosts[depth]*3
 
 		if boostedScore < alpha {
@@ -431,7 +876,6 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 	}
 
 	if depth <= FutilityPruningDepthUpperBound && alpha < MateThreshold && beta < MateThreshold && !inCheck && !isCurrentNodePv {
-		currentPositionStaticEvaluation := evaluator.EvaluatePosition(&searcher.position)
 		boost := FutilityBoosts[depth]
 		futilityPruningPossibility = currentPositionStaticEvaluation+boost <= alpha
 	}
@@ -449,13 +893,13 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 
 	legalMoveCount := 0
 	transpositionTableEntryType := UpperBoundEntryType
-	highestScore := -CheckmateScore
+	highestScore := syzygyLowerBound
 	bestMove := NullMove
 
 	for i := uint8(0); i < pseudoLegalMoves.Size; i++ {
 		OrderHighestScoredMove(i, &pseudoLegalMoves)
 		currentMove := pseudoLegalMoves.Moves[i]
-		if currentMove.IsSameMove(singularMoveExtensionMove) {
+		if currentMove.IsSameMove(singularMoveExtensionMove) || (onTreeRoot && !searcher.isSearchedRootMove(currentMove)) {
 			continue
 		}
 
@@ -465,6 +909,7 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		}
 
 		legalMoveCount++
+		searcher.transpositionTable.Prefetch(searcher.position.PositionHash)
 
 		if depth <= LateMovePruningDepthUpperBound && legalMoveCount > LateMovePruningLegalMoveLowerBounds[depth] && !inCheck && !isCurrentNodePv {
 			if !(searcher.position.IsCurrentSideInCheck() || currentMove.GetMoveType() == PromotionMoveType) {
@@ -479,6 +924,7 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		}
 
 		searcher.RecordPositionHash(searcher.position.PositionHash)
+		nodesBeforeMove := searcher.searchedNodes
 
 		score := int16(0)
 		if legalMoveCount == 1 {
@@ -525,6 +971,10 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		searcher.position.UnDoPreviousMove(currentMove, evaluator)
 		searcher.EraseLatestPositionHash()
 
+		if onTreeRoot {
+			searcher.rootMoveNodeCounts[currentMove.GetFromSquare()][currentMove.GetToSquare()] += searcher.searchedNodes - nodesBeforeMove
+		}
+
 		if score > highestScore {
 			highestScore = score
 			bestMove = currentMove
@@ -557,10 +1007,10 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 		}
 		return drawScore
 	}
+	highestScore = min(highestScore, syzygyUpperBound)
 
-	if !searcher.timeManager.endSearch {
-		tableEntry := searcher.transpositionTable.GetEntryToReplace(searcher.position.PositionHash, uint8(depth), searcher.ageState)
-		tableEntry.ModifyTableEntry(bestMove, highestScore, searcher.position.PositionHash, ply, uint8(depth), transpositionTableEntryType, searcher.ageState)
+	if !searcher.endSearch.Load() {
+		searcher.transpositionTable.Store(searcher.position.PositionHash, bestMove, highestScore, currentPositionStaticEvaluation, ply, uint8(depth), transpositionTableEntryType)
 	}
 
 	return highestScore
@@ -569,19 +1019,19 @@ func (searcher *DefaultSearcher) Negamax(evaluator Evaluator, depth int8, ply ui
 func (searcher *DefaultSearcher) QuiescenceSearch(evaluator Evaluator, alpha int16, beta int16, maximumAllowablePly uint8, pv *PV, ply uint8) int16 {
 	searcher.searchedNodes++
 	if maximumAllowablePly+ply >= MaxDepth {
-		return evaluator.EvaluatePosition(&searcher.position)
+		return searcher.evaluatePosition(evaluator)
 	}
-	if searcher.searchedNodes >= searcher.timeManager.nodeCount {
-		searcher.timeManager.endSearch = true
+	if searcher.searchedNodes >= searcher.nodeLimit {
+		searcher.endSearch.Store(true)
 	}
-	if searcher.searchedNodes&2047 == 0 {
-		searcher.timeManager.SetMoveTimeIsUp()
+	if searcher.searchedNodes&2047 == 0 && !searcher.endSearch.Load() && searcher.timeManager.HardLimitReached() {
+		searcher.endSearch.Store(true)
 	}
-	if searcher.timeManager.endSearch {
+	if searcher.endSearch.Load() {
 		return 0
 	}
 
-	highestScore := evaluator.EvaluatePosition(&searcher.position)
+	highestScore := searcher.evaluatePosition(evaluator)
 	inCheck := ply <= 2 && searcher.position.IsCurrentSideInCheck()
 
 	if highestScore >= beta && !inCheck {
@@ -639,5 +1089,6 @@ func (searcher *DefaultSearcher) QuiescenceSearch(evaluator Evaluator, alpha int
 }
 
 func (searcher *DefaultSearcher) CleanUp() {
-	searcher.transpositionTable.DeleteEntries()
+	searcher.transpositionTable.Resize(0)
+	searcher.evaluationCache.DeleteEntries()
 }
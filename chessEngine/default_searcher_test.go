@@ -0,0 +1,94 @@
+package chessEngine
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLoadHashKeepsEntriesAcrossNewGame(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	hashFile := filepath.Join(t.TempDir(), DefaultTranspositionTableFile)
+	const storedHash = 0x123456789abcdef
+
+	savingSearcher := NewDefaultSearcher()
+	savingSearcher.Reset(evaluator)
+	savingSearcher.GetOptions()["Hash"].Set("2")
+	savingSearcher.transpositionTable.Store(storedHash, NullMove, 100, 50, 0, 10, ExactEntryType)
+	if err := savingSearcher.SaveHash(hashFile); err != nil {
+		t.Fatal(err)
+	}
+
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+	searcher.SetInfoOutput(io.Discard)
+	searcher.GetOptions()["Hash"].Set("1")
+	if err := searcher.LoadHash(hashFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if searcher.transpositionTableSize != savingSearcher.transpositionTableSize {
+		t.Errorf("table size is %d after loading, expected %d", searcher.transpositionTableSize, savingSearcher.transpositionTableSize)
+	}
+	if hashOption := searcher.GetOptions()["Hash"].DefaultValue(); hashOption != "2" {
+		t.Errorf("Hash option is %s after loading, expected 2", hashOption)
+	}
+
+	searcher.ResetToNewGame()
+	if _, found := searcher.transpositionTable.Probe(storedHash); !found {
+		t.Error("the loaded entry was cleared by the first new game")
+	}
+
+	searcher.ResetToNewGame()
+	if _, found := searcher.transpositionTable.Probe(storedHash); found {
+		t.Error("the loaded entry was kept by the second new game")
+	}
+}
+
+func TestResetKeepsEvaluationCacheSize(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+
+	for _, cacheMB := range []int{0, 1} {
+		searcher.GetOptions()["Evaluation Cache Size"].Set(strconv.Itoa(cacheMB))
+		searcher.Reset(evaluator)
+		searcher.evaluationCache.Evaluate(evaluator, searcher.Position())
+
+		if cacheSize := searcher.evaluationCache.Size(); cacheSize != uint64(cacheMB)*1024*1024 {
+			t.Errorf("the cache has %d bytes after a reset, expected %d MB", cacheSize, cacheMB)
+		}
+		if cacheOption := searcher.GetOptions()["Evaluation Cache Size"].DefaultValue(); cacheOption != strconv.Itoa(cacheMB) {
+			t.Errorf("the cache size is offered as %s MB, expected %d", cacheOption, cacheMB)
+		}
+	}
+
+	if _, found := searcher.evaluationCache.Probe(searcher.Position().PositionHash); !found {
+		t.Error("the evaluation wasn't cached")
+	}
+	searcher.Reset(evaluator)
+	if _, found := searcher.evaluationCache.Probe(searcher.Position().PositionHash); found {
+		t.Error("the cached evaluation was kept by a reset")
+	}
+}
+
+func TestResetKeepsSettings(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	if searcher.getSkillLevel() != MaximumSkillLevel || searcher.multiPV != 1 || searcher.syzygyProbeDepth != DefaultSyzygyProbeDepth || searcher.getHashMB() != DefaultTableSize/(1024*1024) {
+		t.Errorf("a new searcher has the skill level %v, MultiPV %d, probe depth %d and %d MB of hash", searcher.getSkillLevel(), searcher.multiPV, searcher.syzygyProbeDepth, searcher.getHashMB())
+	}
+
+	searcher.Reset(evaluator)
+	options := searcher.GetOptions()
+	for name, value := range map[string]string{"Skill Level": "5", "MultiPV": "3", "Move Overhead": "50", "SyzygyProbeDepth": "4", "UCI_Elo": "1500"} {
+		options[name].Set(value)
+	}
+	searcher.Reset(evaluator)
+
+	if searcher.skillLevel != 5 || searcher.multiPV != 3 || searcher.moveOverhead != 50 || searcher.syzygyProbeDepth != 4 || searcher.uciElo != 1500 {
+		t.Errorf("the reset searcher has the skill level %d, MultiPV %d, move overhead %d, probe depth %d and Elo %d",
+			searcher.skillLevel, searcher.multiPV, searcher.moveOverhead, searcher.syzygyProbeDepth, searcher.uciElo)
+	}
+}
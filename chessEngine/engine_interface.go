@@ -2,7 +2,10 @@ package chessEngine
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -14,17 +17,39 @@ const (
 	mainMenuMessage = `
 Please enter a command:
 - uci : Start the UCI protocol to communicate with the engine
+- replay <logfile>: Feed the commands recorded in a UCI debug log to a new UCI session, as far apart as they were recorded
 - seeBoardState: Display the current board position
 - changePosition <fen>: Change the current position via an FEN string
 - perft <x>: Performance test of the move generation to depth x
 - dividePerft <x>: Divide performance test of the move generation to depth x
 - evaluatePosition: Get the static evaluation of the current position
+- gensfens [<name> <value>]...: Generate self-play training data. Settings: output, positions, threads, depth, nodes, randomPlies, maxPlies, hash (MB), seed
+- gentb <materials> [<directory>]: Generate distance to mate tablebases for comma separated materials such as KQvKR,KRvKP into a directory (default: tablebases)
+- serve [<name> <value>]...: Serve analysis requests over HTTP. Settings: address, searchers, hash (MB), moveTime, maxMoveTime, maxDepth, maxMultiPV, maxPerftDepth
+- wsuci [<name> <value>]...: Bridge UCI over WebSocket, one engine per connection. Settings: address, path, connections, idleTimeout (s), origins, fileOptions, maxHash (MB)
+- lichess [<name> <value>]...: Play as a Lichess bot with the token of the LICHESS_BOT_TOKEN environment variable. Settings: url, games, hash (MB), variants, speeds, minTime, maxTime, minIncrement, maxIncrement (s), rated, casual, bots
+- annotate <pgnfile> [<name> <value>]...: Annotate the games of a PGN file with evals, assessments and best lines, and sum up the accuracy of the players. Settings: output, depth, movetime, nodes, measure (cp or winprob), inaccuracy, mistake, blunder, pvPlies, hash (MB)
+- puzzles <pgnfile> [<name> <value>]...: Extract puzzles from the games of a PGN file, where a single move wins after an error of the opponent. Settings: output, scanDepth, depth, winning, gap, error (cp), minMoves, maxMoves, hash (MB)
+- index <pgnfile> [<name> <value>]...: Index the positions reached in the games of a PGN file for the explorer, or open the index if it is up to date. Settings: output, maxPlies, memory (MB)
+- explore [<fen>]: Show the moves played from a position in the indexed games, with their results, and the games which reached it. Defaults to the current position
+- query <pgnfiles> [<name> <value>]... where <query>: Search the games of comma separated PGN files or patterns for positions matching a query on the material and the placement of the pieces, such as "material KRP*vKRP* and passed P on a*". Settings: output, format (pgn or epd), matches (first or all), threads
+- calibrate [<name> <value>]...: Measure the Elo of the skill levels with matches between them. Settings: pairs, tc, step, anchor, randomPlies, hash (MB), seed
 - exit: Exit the main menu and quit the program`
 )
 
 type EngineInterface struct {
 	GameSearcher GameSearcher
 	Evaluator    Evaluator
+
+	// NewEvaluator creates independent evaluator instances for concurrent tasks, such as self-play data generation.
+	// If nil, such tasks run on a single thread using Evaluator.
+	NewEvaluator func() Evaluator
+
+	// NewGameSearcher creates independent game searchers for concurrent tasks, such as the analysis server. If nil,
+	// such tasks use GameSearcher only.
+	NewGameSearcher func() GameSearcher
+
+	positionIndex *PositionIndex
 }
 
 func NewCustomEngineInterface(GameSearcher GameSearcher, Evaluator Evaluator) EngineInterface {
@@ -41,17 +66,41 @@ func NewDefaultEngineInterface() EngineInterface {
 	ComputePieceMoveTables()
 	InitializeZobristHashing()
 	InitEvaluationRelatedMasks()
+	InitializeEndgameRegistry()
+	InitializeKPKBitbase()
 	InitializeLateMoveReductions()
 
-	defaultGameSearcher := DefaultSearcher{}
 	defaultEvaluator := DefaultEvaluator{}
 
 	return EngineInterface{
-		GameSearcher: &defaultGameSearcher,
-		Evaluator:    &defaultEvaluator,
+		GameSearcher:    NewDefaultSearcher(),
+		Evaluator:       &defaultEvaluator,
+		NewEvaluator:    func() Evaluator { return &DefaultEvaluator{} },
+		NewGameSearcher: func() GameSearcher { return NewDefaultSearcher() },
 	}
 }
 
+func NewNnueEngineInterface(networkFilePath string) (EngineInterface, error) {
+	network, err := LoadNnueNetwork(networkFilePath)
+	if err != nil {
+		return EngineInterface{}, err
+	}
+
+	ComputePieceMoveTables()
+	InitializeZobristHashing()
+	InitEvaluationRelatedMasks()
+	InitializeEndgameRegistry()
+	InitializeKPKBitbase()
+	InitializeLateMoveReductions()
+
+	return EngineInterface{
+		GameSearcher:    NewDefaultSearcher(),
+		Evaluator:       NewNnueEvaluator(network),
+		NewEvaluator:    func() Evaluator { return NewNnueEvaluator(network) },
+		NewGameSearcher: func() GameSearcher { return NewDefaultSearcher() },
+	}, nil
+}
+
 func reflectFenString(position *Position, fenString string, evaluator Evaluator) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -103,22 +152,353 @@ func runDividePerft(dperftCommand string, position *Position, evaluator Evaluato
 	fmt.Printf("Execution time: %vs\n", calculationTimeDuration.Seconds())
 }
 
+func (engineInterface *EngineInterface) runSelfPlayDataGeneration(generationCommand string) {
+	settings, err := ParseSelfPlaySettings(generationCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	newEvaluator := engineInterface.NewEvaluator
+	if newEvaluator == nil {
+		if settings.Threads > 1 {
+			fmt.Println("The evaluator can't be duplicated, generating on a single thread")
+			settings.Threads = 1
+		}
+		newEvaluator = func() Evaluator { return engineInterface.Evaluator }
+	}
+
+	if err := GenerateSelfPlayData(settings, newEvaluator); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (engineInterface *EngineInterface) runSkillCalibration(calibrationCommand string) {
+	settings, err := ParseSkillCalibrationSettings(calibrationCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	newEvaluator := engineInterface.NewEvaluator
+	if newEvaluator == nil {
+		newEvaluator = func() Evaluator { return engineInterface.Evaluator }
+	}
+
+	levelElos, err := CalibrateSkillLevels(settings, newEvaluator, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("SkillLevelElos: %v\n", levelElos)
+}
+
+func (engineInterface *EngineInterface) runAnalysisServer(serveCommand string) {
+	settings, err := ParseAnalysisServerSettings(serveCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	gameSearchers, evaluators := []GameSearcher{engineInterface.GameSearcher}, []Evaluator{engineInterface.Evaluator}
+	if engineInterface.NewGameSearcher != nil && engineInterface.NewEvaluator != nil {
+		gameSearchers, evaluators = nil, nil
+		for index := 0; index < settings.Searchers; index++ {
+			gameSearchers = append(gameSearchers, engineInterface.NewGameSearcher())
+			evaluators = append(evaluators, engineInterface.NewEvaluator())
+		}
+	} else if settings.Searchers > 1 {
+		fmt.Println("The searcher can't be duplicated, serving with a single searcher")
+	}
+
+	server, err := NewAnalysisServer(settings, gameSearchers, evaluators)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (engineInterface *EngineInterface) runUciBridge(bridgeCommand string) {
+	settings, err := ParseUciBridgeSettings(bridgeCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	bridge, err := NewUciBridge(settings, engineInterface.NewGameSearcher, engineInterface.NewEvaluator)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := bridge.ListenAndServe(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (engineInterface *EngineInterface) runLichessBot(lichessCommand string) {
+	settings, err := ParseLichessBotSettings(lichessCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	bot, err := NewLichessBot(settings, engineInterface.NewGameSearcher, engineInterface.NewEvaluator, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := bot.Run(context.Background()); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (engineInterface *EngineInterface) runPgnAnnotation(annotationCommand string) {
+	settings, err := ParseAnnotationSettings(annotationCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	gameSearcher, evaluator := engineInterface.GameSearcher, engineInterface.Evaluator
+	if engineInterface.NewGameSearcher != nil && engineInterface.NewEvaluator != nil {
+		gameSearcher, evaluator = engineInterface.NewGameSearcher(), engineInterface.NewEvaluator()
+		gameSearcher.Reset(evaluator)
+		if defaultSearcher, ok := gameSearcher.(*DefaultSearcher); ok {
+			defaultSearcher.SetTranspositionTable(NewDefaultTranspositionTable(settings.TranspositionTableSize * 1024 * 1024))
+		}
+	}
+
+	startTimeInstant := time.Now()
+	if err := AnnotatePgnFile(settings, gameSearcher, evaluator, os.Stdout); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Annotated games written to %s in %.1fs\n", settings.OutputFilePath, time.Since(startTimeInstant).Seconds())
+}
+
+func (engineInterface *EngineInterface) runPuzzleExtraction(extractionCommand string) {
+	settings, err := ParsePuzzleSettings(extractionCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	gameSearcher, evaluator := engineInterface.GameSearcher, engineInterface.Evaluator
+	if engineInterface.NewGameSearcher != nil && engineInterface.NewEvaluator != nil {
+		gameSearcher, evaluator = engineInterface.NewGameSearcher(), engineInterface.NewEvaluator()
+		gameSearcher.Reset(evaluator)
+		if defaultSearcher, ok := gameSearcher.(*DefaultSearcher); ok {
+			defaultSearcher.SetTranspositionTable(NewDefaultTranspositionTable(settings.TranspositionTableSize * 1024 * 1024))
+		}
+	}
+
+	startTimeInstant := time.Now()
+	if err := ExtractPuzzlesFromPgnFile(settings, gameSearcher, evaluator, os.Stdout); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Puzzles written to %s in %.1fs\n", settings.OutputFilePath, time.Since(startTimeInstant).Seconds())
+}
+
+func (engineInterface *EngineInterface) runUciReplay(logFilePath string) {
+	if logFilePath == "" {
+		fmt.Println("Usage: replay <logfile>")
+		return
+	}
+
+	logFile, err := os.Open(logFilePath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	commands, err := ReadUciDebugLog(logFile)
+	logFile.Close()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	gameSearcher, evaluator := engineInterface.GameSearcher, engineInterface.Evaluator
+	if engineInterface.NewGameSearcher != nil && engineInterface.NewEvaluator != nil {
+		gameSearcher, evaluator = engineInterface.NewGameSearcher(), engineInterface.NewEvaluator()
+	}
+
+	commandReader, commandWriter := io.Pipe()
+	go func() {
+		commandWriter.CloseWithError(ReplayUciCommands(commands, commandWriter))
+	}()
+
+	NewUciInterface(gameSearcher, evaluator, commandReader, os.Stdout).Run()
+	commandReader.Close()
+}
+
+func runTablebaseGeneration(generationCommand string) {
+	commandFields := strings.Fields(generationCommand)
+	if len(commandFields) == 0 || len(commandFields) > 2 {
+		fmt.Println("Usage: gentb <materials> [<directory>]")
+		return
+	}
+
+	directory := DefaultTablebaseDirectory
+	if len(commandFields) == 2 {
+		directory = commandFields[1]
+	}
+
+	startTimeInstant := time.Now()
+	if err := GenerateTablebases(commandFields[0], directory, os.Stdout); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Execution time: %vs\n", time.Since(startTimeInstant).Seconds())
+}
+
+func (engineInterface *EngineInterface) runPositionIndexing(indexCommand string) {
+	settings, err := ParsePositionIndexSettings(indexCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if engineInterface.positionIndex != nil {
+		engineInterface.positionIndex.Close()
+		engineInterface.positionIndex = nil
+	}
+
+	positionIndex, err := OpenPositionIndex(settings.OutputFilePath, settings.InputFilePath)
+	if err == nil && positionIndex.MaximumPlies != settings.MaximumPlies {
+		positionIndex.Close()
+		err = errors.New("the index was built with other settings")
+	}
+	if err != nil {
+		evaluator := engineInterface.Evaluator
+		if engineInterface.NewEvaluator != nil {
+			evaluator = engineInterface.NewEvaluator()
+		}
+
+		startTimeInstant := time.Now()
+		if err := BuildPositionIndex(settings, evaluator, os.Stdout); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Index written to %s in %.1fs\n", settings.OutputFilePath, time.Since(startTimeInstant).Seconds())
+
+		if positionIndex, err = OpenPositionIndex(settings.OutputFilePath, settings.InputFilePath); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	engineInterface.positionIndex = positionIndex
+	fmt.Printf("Exploring %d positions of %s\n", positionIndex.PositionCount(), settings.InputFilePath)
+}
+
+func (engineInterface *EngineInterface) runPositionExplorer(fenString string, currentPosition *Position) {
+	if engineInterface.positionIndex == nil {
+		fmt.Println("No games to explore, index a PGN file first")
+		return
+	}
+
+	if fenString == "" {
+		fenString = currentPosition.GenFEN()
+	}
+	if err := ValidateFEN(fenString); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	evaluator := engineInterface.Evaluator
+	if engineInterface.NewEvaluator != nil {
+		evaluator = engineInterface.NewEvaluator()
+	}
+	position := Position{}
+	position.LoadFEN(fenString, evaluator)
+
+	statistics, err := engineInterface.positionIndex.GetPositionStatistics(&position, evaluator)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(statistics)
+
+	for gameIndex, occurrence := range statistics.Occurrences {
+		if gameIndex == DefaultExplorerGameCount {
+			fmt.Printf("And %d more games\n", len(statistics.Occurrences)-gameIndex)
+			break
+		}
+
+		game, err := engineInterface.positionIndex.ReadGame(occurrence.GameOffset)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(describeIndexedGame(&game, int(occurrence.Ply), position.SideToMove))
+	}
+}
+
+func (engineInterface *EngineInterface) runPositionQuery(queryCommand string) {
+	settings, err := ParseQuerySettings(queryCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	newEvaluator := engineInterface.NewEvaluator
+	if newEvaluator == nil {
+		settings.Threads = 1
+		newEvaluator = func() Evaluator { return engineInterface.Evaluator }
+	}
+
+	startTimeInstant := time.Now()
+	if err := SearchPgnFiles(settings, newEvaluator, os.Stdout); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Matches written to %s in %.1fs\n", settings.OutputFilePath, time.Since(startTimeInstant).Seconds())
+}
+
+// describeIndexedGame names the players, the result, the event and the date of a game, leaving out missing tags, and
+// the move where it reached the explored position.
+func describeIndexedGame(game *PgnGame, ply int, sideToMove uint8) string {
+	details := []string{}
+	for _, detail := range []string{game.Tag("White") + " - " + game.Tag("Black"), game.Result, game.Tag("Event"), game.Tag("Date")} {
+		if strings.Trim(detail, " -?.") != "" {
+			details = append(details, detail)
+		}
+	}
+
+	separator := "."
+	if sideToMove == Black {
+		separator = "..."
+	}
+	return fmt.Sprintf("%s, move %d%s", strings.Join(details, ", "), game.getMoveNumber(ply), separator)
+}
+
 func (engineInterface *EngineInterface) StartEngine() {
 	consoleReader := bufio.NewReader(os.Stdin)
-	uciInterface := UciInterface{
-		gameSearcher: engineInterface.GameSearcher,
-		evaluator:    engineInterface.Evaluator,
-	}
+	uciInterface := NewUciInterface(engineInterface.GameSearcher, engineInterface.Evaluator, consoleReader, os.Stdout)
 
 	uciInterface.gameSearcher.InitializeSearchInfo(FENStartPosition, uciInterface.evaluator)
 	fmt.Println(mainMenuMessage)
 
 	for {
-		userCommand, _ := consoleReader.ReadString('\n')
+		userCommand, err := consoleReader.ReadString('\n')
 		command := strings.TrimSpace(strings.Replace(userCommand, "\r\n", "\n", -1))
 
+		// Without any more input, e.g. once a program driving GoFish closes its input, there is nothing left to do.
+		if err != nil && command == "" {
+			break
+		}
+
 		if command == "uci" {
 			uciInterface.Run()
+		} else if strings.HasPrefix(command, "replay") {
+			engineInterface.runUciReplay(strings.TrimSpace(strings.TrimPrefix(command, "replay")))
 		} else if command == "seeBoardState" {
 			fmt.Println(uciInterface.gameSearcher.Position())
 		} else if strings.HasPrefix(command, "changePosition") {
@@ -132,6 +512,28 @@ func (engineInterface *EngineInterface) StartEngine() {
 		} else if strings.HasPrefix(command, "dividePerft") {
 			dividePerftCommand := strings.TrimPrefix(command, "dividePerft ")
 			runDividePerft(dividePerftCommand, uciInterface.gameSearcher.Position(), engineInterface.Evaluator)
+		} else if strings.HasPrefix(command, "gensfens") {
+			engineInterface.runSelfPlayDataGeneration(strings.TrimPrefix(command, "gensfens"))
+		} else if strings.HasPrefix(command, "serve") {
+			engineInterface.runAnalysisServer(strings.TrimPrefix(command, "serve"))
+		} else if strings.HasPrefix(command, "wsuci") {
+			engineInterface.runUciBridge(strings.TrimPrefix(command, "wsuci"))
+		} else if strings.HasPrefix(command, "lichess") {
+			engineInterface.runLichessBot(strings.TrimPrefix(command, "lichess"))
+		} else if strings.HasPrefix(command, "annotate") {
+			engineInterface.runPgnAnnotation(strings.TrimPrefix(command, "annotate"))
+		} else if strings.HasPrefix(command, "puzzles") {
+			engineInterface.runPuzzleExtraction(strings.TrimPrefix(command, "puzzles"))
+		} else if strings.HasPrefix(command, "index") {
+			engineInterface.runPositionIndexing(strings.TrimPrefix(command, "index"))
+		} else if strings.HasPrefix(command, "explore") {
+			engineInterface.runPositionExplorer(strings.TrimSpace(strings.TrimPrefix(command, "explore")), uciInterface.gameSearcher.Position())
+		} else if strings.HasPrefix(command, "query") {
+			engineInterface.runPositionQuery(strings.TrimPrefix(command, "query"))
+		} else if strings.HasPrefix(command, "calibrate") {
+			engineInterface.runSkillCalibration(strings.TrimPrefix(command, "calibrate"))
+		} else if strings.HasPrefix(command, "gentb") {
+			runTablebaseGeneration(strings.TrimPrefix(command, "gentb"))
 		} else if command == "evaluatePosition" {
 			fmt.Println(uciInterface.evaluator.EvaluatePosition(uciInterface.gameSearcher.Position()))
 		} else {
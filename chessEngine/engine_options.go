@@ -0,0 +1,227 @@
+package chessEngine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type OptionType string
+
+const (
+	CheckOptionType  OptionType = "check"
+	SpinOptionType   OptionType = "spin"
+	ComboOptionType  OptionType = "combo"
+	ButtonOptionType OptionType = "button"
+	StringOptionType OptionType = "string"
+)
+
+// NewCheckOption creates an option accepting "true" or "false".
+func NewCheckOption(defaultValue bool, set func(enabled bool)) EngineOption {
+	return EngineOption{
+		optionType:   CheckOptionType,
+		defaultValue: strconv.FormatBool(defaultValue),
+		setOption: func(optionValue string) error {
+			switch strings.ToLower(optionValue) {
+			case "true":
+				set(true)
+			case "false":
+				set(false)
+			default:
+				return fmt.Errorf("expected true or false, got %q", optionValue)
+			}
+			return nil
+		},
+	}
+}
+
+// NewSpinOption creates an option accepting the integers between the minimum and the maximum values.
+func NewSpinOption(defaultValue int, minValue int, maxValue int, set func(value int)) EngineOption {
+	return EngineOption{
+		optionType:   SpinOptionType,
+		defaultValue: strconv.Itoa(defaultValue),
+		minValue:     minValue,
+		maxValue:     maxValue,
+		setOption: func(optionValue string) error {
+			value, err := strconv.Atoi(optionValue)
+			if err != nil {
+				return fmt.Errorf("expected an integer, got %q", optionValue)
+			}
+			if value < minValue || value > maxValue {
+				return fmt.Errorf("%d is outside the range %d to %d", value, minValue, maxValue)
+			}
+			set(value)
+			return nil
+		},
+	}
+}
+
+// NewComboOption creates an option accepting one of the choices, which are matched regardless of case.
+func NewComboOption(defaultValue string, choices []string, set func(choice string)) EngineOption {
+	return EngineOption{
+		optionType:   ComboOptionType,
+		defaultValue: defaultValue,
+		fixedValues:  choices,
+		setOption: func(optionValue string) error {
+			for _, choice := range choices {
+				if strings.EqualFold(choice, optionValue) {
+					set(choice)
+					return nil
+				}
+			}
+			return fmt.Errorf("expected one of %s, got %q", strings.Join(choices, ", "), optionValue)
+		},
+	}
+}
+
+// NewButtonOption creates an option which triggers an action, without a value.
+func NewButtonOption(press func()) EngineOption {
+	return EngineOption{
+		optionType: ButtonOptionType,
+		setOption: func(_ string) error {
+			press()
+			return nil
+		},
+	}
+}
+
+// NewStringOption creates an option accepting any text. GUIs send "<empty>" for an empty string.
+func NewStringOption(defaultValue string, set func(value string)) EngineOption {
+	return EngineOption{
+		optionType:   StringOptionType,
+		defaultValue: defaultValue,
+		setOption: func(optionValue string) error {
+			set(optionValue)
+			return nil
+		},
+	}
+}
+
+func (option EngineOption) Type() OptionType {
+	return option.optionType
+}
+
+func (option EngineOption) DefaultValue() string {
+	return option.defaultValue
+}
+
+// Set validates the value and applies it.
+func (option EngineOption) Set(optionValue string) error {
+	return option.setOption(optionValue)
+}
+
+// UciOptionOffer is an option as offered by the "option" line of a UCI engine.
+type UciOptionOffer struct {
+	Name    string
+	Type    OptionType
+	Default string
+	Min     int
+	Max     int
+	Choices []string
+}
+
+func (offer UciOptionOffer) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("option name %s type %s", offer.Name, offer.Type))
+
+	switch offer.Type {
+	case SpinOptionType:
+		sb.WriteString(fmt.Sprintf(" default %s min %d max %d", offer.Default, offer.Min, offer.Max))
+	case ComboOptionType:
+		sb.WriteString(fmt.Sprintf(" default %s", offer.Default))
+		for _, choice := range offer.Choices {
+			sb.WriteString(fmt.Sprintf(" var %s", choice))
+		}
+	case CheckOptionType, StringOptionType:
+		sb.WriteString(fmt.Sprintf(" default %s", offer.Default))
+	}
+
+	return sb.String()
+}
+
+// ParseUciOptionOffer reads an "option" line. The name, the default value and the choices may contain spaces, so
+// each of them extends to the next keyword.
+func ParseUciOptionOffer(line string) (UciOptionOffer, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "option" || fields[1] != "name" {
+		return UciOptionOffer{}, false
+	}
+
+	offer := UciOptionOffer{}
+	keyword, values := "", []string{}
+	applyKeyword := func() {
+		value := strings.Join(values, " ")
+		switch keyword {
+		case "name":
+			offer.Name = value
+		case "type":
+			offer.Type = OptionType(value)
+		case "default":
+			offer.Default = value
+		case "min":
+			offer.Min, _ = strconv.Atoi(value)
+		case "max":
+			offer.Max, _ = strconv.Atoi(value)
+		case "var":
+			offer.Choices = append(offer.Choices, value)
+		}
+	}
+
+	for _, field := range fields[1:] {
+		switch field {
+		case "name", "type", "default", "min", "max", "var":
+			if keyword != "name" || field == "type" {
+				applyKeyword()
+				keyword, values = field, []string{}
+				continue
+			}
+		}
+		values = append(values, field)
+	}
+	applyKeyword()
+
+	return offer, offer.Name != "" && offer.Type != ""
+}
+
+// Validate checks that the value is accepted by the option, as GoFish checks its own options.
+func (offer UciOptionOffer) Validate(value string) error {
+	var option EngineOption
+	switch offer.Type {
+	case CheckOptionType:
+		option = NewCheckOption(false, func(bool) {})
+	case SpinOptionType:
+		option = NewSpinOption(0, offer.Min, offer.Max, func(int) {})
+	case ComboOptionType:
+		option = NewComboOption(offer.Default, offer.Choices, func(string) {})
+	default:
+		return nil
+	}
+	return option.Set(value)
+}
+
+// getUciOffer returns the offer of the option in response to the uci command.
+func (option EngineOption) getUciOffer(optionName string) UciOptionOffer {
+	return UciOptionOffer{
+		Name:    optionName,
+		Type:    option.optionType,
+		Default: option.defaultValue,
+		Min:     option.minValue,
+		Max:     option.maxValue,
+		Choices: option.fixedValues,
+	}
+}
+
+// findEngineOption looks the option up by its name regardless of case, as UCI option names are case insensitive,
+// and returns it with its name as offered.
+func findEngineOption(options map[string]EngineOption, optionName string) (string, EngineOption, bool) {
+	if option, ok := options[optionName]; ok {
+		return optionName, option, true
+	}
+
+	for name, option := range options {
+		if strings.EqualFold(name, optionName) {
+			return name, option, true
+		}
+	}
+	return "", EngineOption{}, false
+}
@@ -0,0 +1,330 @@
+package chessEngine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ClockMode uint8
+
+const (
+	FischerClockMode ClockMode = iota
+	BronsteinClockMode
+	SimpleDelayClockMode
+	HourglassClockMode
+)
+
+var clockModeNames = [...]string{"fischer", "bronstein", "delay", "hourglass"}
+
+func (mode ClockMode) String() string {
+	if int(mode) < len(clockModeNames) {
+		return clockModeNames[mode]
+	}
+	return "unknown"
+}
+
+func ParseClockMode(name string) (ClockMode, error) {
+	for mode, modeName := range clockModeNames {
+		if strings.EqualFold(name, modeName) {
+			return ClockMode(mode), nil
+		}
+	}
+	return FischerClockMode, fmt.Errorf("unknown clock mode %q", name)
+}
+
+// TimeSource provides the current instant to the clocks, so that they can be driven by a fake time source.
+type TimeSource interface {
+	Now() time.Time
+}
+
+type SystemTimeSource struct{}
+
+func (SystemTimeSource) Now() time.Time {
+	return time.Now()
+}
+
+// FakeTimeSource only moves forward when advanced, which makes the clocks it drives deterministic.
+type FakeTimeSource struct {
+	lock    sync.Mutex
+	instant time.Time
+}
+
+func NewFakeTimeSource(instant time.Time) *FakeTimeSource {
+	return &FakeTimeSource{instant: instant}
+}
+
+func (timeSource *FakeTimeSource) Now() time.Time {
+	timeSource.lock.Lock()
+	defer timeSource.lock.Unlock()
+	return timeSource.instant
+}
+
+func (timeSource *FakeTimeSource) Advance(duration time.Duration) {
+	timeSource.lock.Lock()
+	defer timeSource.lock.Unlock()
+	timeSource.instant = timeSource.instant.Add(duration)
+}
+
+// TimeControlStage gives the time to play a number of moves, or the rest of the game when Moves is zero. Increment
+// is the time added after each move with the Fischer mode, or the delay with the Bronstein and simple delay modes.
+type TimeControlStage struct {
+	Moves     int
+	Time      time.Duration
+	Increment time.Duration
+}
+
+// TimeControl is a sequence of stages, the last of which is repeated when it has a number of moves.
+type TimeControl struct {
+	Stages []TimeControlStage
+	Mode   ClockMode
+}
+
+// ParseTimeControl reads the PGN TimeControl tag format, in seconds, with the stages separated by colons, e.g.
+// "40/5400+30:1800+30" for 40 moves in 90 minutes followed by 30 minutes for the rest of the game, with 30 seconds
+// added per move. An hourglass time control is given as "*<seconds>".
+func ParseTimeControl(timeControlSpecification string, mode ClockMode) (TimeControl, error) {
+	timeControl := TimeControl{Mode: mode}
+
+	if strings.HasPrefix(timeControlSpecification, "*") {
+		seconds, err := strconv.ParseFloat(timeControlSpecification[1:], 64)
+		if err != nil || seconds <= 0 {
+			return timeControl, fmt.Errorf("invalid hourglass time control %q", timeControlSpecification)
+		}
+		timeControl.Mode = HourglassClockMode
+		timeControl.Stages = []TimeControlStage{{Time: secondsToDuration(seconds)}}
+		return timeControl, nil
+	}
+
+	for _, stageSpecification := range strings.Split(timeControlSpecification, ":") {
+		stage := TimeControlStage{}
+
+		if movesValue, remainder, found := strings.Cut(stageSpecification, "/"); found {
+			moves, err := strconv.Atoi(movesValue)
+			if err != nil || moves <= 0 {
+				return timeControl, fmt.Errorf("invalid number of moves in %q", stageSpecification)
+			}
+			stage.Moves = moves
+			stageSpecification = remainder
+		}
+
+		timeValue, incrementValue, hasIncrement := strings.Cut(stageSpecification, "+")
+		seconds, err := strconv.ParseFloat(timeValue, 64)
+		if err != nil || seconds <= 0 {
+			return timeControl, fmt.Errorf("invalid time in %q", stageSpecification)
+		}
+		stage.Time = secondsToDuration(seconds)
+
+		if hasIncrement {
+			incrementSeconds, err := strconv.ParseFloat(incrementValue, 64)
+			if err != nil || incrementSeconds < 0 {
+				return timeControl, fmt.Errorf("invalid increment in %q", stageSpecification)
+			}
+			stage.Increment = secondsToDuration(incrementSeconds)
+		}
+
+		timeControl.Stages = append(timeControl.Stages, stage)
+	}
+
+	return timeControl, nil
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds(), 'f', -1, 64)
+}
+
+// String returns the time control in the PGN TimeControl tag format.
+func (timeControl TimeControl) String() string {
+	if timeControl.Mode == HourglassClockMode && len(timeControl.Stages) > 0 {
+		return "*" + formatSeconds(timeControl.Stages[0].Time)
+	}
+
+	stageSpecifications := make([]string, 0, len(timeControl.Stages))
+	for _, stage := range timeControl.Stages {
+		stageSpecification := formatSeconds(stage.Time)
+		if stage.Moves > 0 {
+			stageSpecification = strconv.Itoa(stage.Moves) + "/" + stageSpecification
+		}
+		if stage.Increment > 0 {
+			stageSpecification += "+" + formatSeconds(stage.Increment)
+		}
+		stageSpecifications = append(stageSpecifications, stageSpecification)
+	}
+	return strings.Join(stageSpecifications, ":")
+}
+
+// GameClock keeps the time of both players during a game. The clock of the side to move runs from Start until
+// Press completes its move and starts the clock of the opponent.
+type GameClock struct {
+	timeControl      TimeControl
+	timeSource       TimeSource
+	remainingTime    [2]time.Duration
+	stageIndex       [2]int
+	stageMovesPlayed [2]int
+	movesPlayed      [2]int
+	flagged          [2]bool
+	sideToMove       uint8
+	moveStartInstant time.Time
+	running          bool
+}
+
+func NewGameClock(timeControl TimeControl, timeSource TimeSource) (*GameClock, error) {
+	if len(timeControl.Stages) == 0 {
+		return nil, errors.New("the time control has no stages")
+	}
+
+	if timeSource == nil {
+		timeSource = SystemTimeSource{}
+	}
+
+	clock := &GameClock{timeControl: timeControl, timeSource: timeSource}
+	clock.remainingTime[White] = timeControl.Stages[0].Time
+	clock.remainingTime[Black] = timeControl.Stages[0].Time
+	return clock, nil
+}
+
+// Start runs the clock of the side to move.
+func (clock *GameClock) Start(sideToMove uint8) {
+	clock.sideToMove = sideToMove
+	clock.moveStartInstant = clock.timeSource.Now()
+	clock.running = true
+}
+
+// Stop pauses the running clock, charging the side to move for the time it used so far.
+func (clock *GameClock) Stop() {
+	if !clock.running {
+		return
+	}
+
+	clock.remainingTime = clock.getLiveRemainingTimes()
+	clock.running = false
+	clock.updateFlags()
+}
+
+// Press completes the move of the side to move, and starts the clock of the opponent. It returns false when the
+// side to move ran out of time during the move.
+func (clock *GameClock) Press() bool {
+	if !clock.running {
+		return !clock.flagged[clock.sideToMove]
+	}
+
+	side := clock.sideToMove
+	elapsedTime := clock.timeSource.Now().Sub(clock.moveStartInstant)
+	clock.remainingTime = clock.getLiveRemainingTimes()
+	clock.updateFlags()
+
+	if !clock.flagged[side] {
+		stage := clock.currentStage(side)
+		switch clock.timeControl.Mode {
+		case FischerClockMode:
+			clock.remainingTime[side] += stage.Increment
+		case BronsteinClockMode:
+			clock.remainingTime[side] += min(elapsedTime, stage.Increment)
+		}
+	}
+
+	clock.movesPlayed[side]++
+	clock.stageMovesPlayed[side]++
+	if stage := clock.currentStage(side); stage.Moves > 0 && clock.stageMovesPlayed[side] == stage.Moves {
+		clock.stageIndex[side] = min(clock.stageIndex[side]+1, len(clock.timeControl.Stages)-1)
+		clock.stageMovesPlayed[side] = 0
+		clock.remainingTime[side] += clock.currentStage(side).Time
+	}
+
+	clock.Start(side ^ 1)
+	return !clock.flagged[side]
+}
+
+func (clock *GameClock) currentStage(side uint8) TimeControlStage {
+	return clock.timeControl.Stages[clock.stageIndex[side]]
+}
+
+// getLiveRemainingTimes returns the remaining times of both sides, accounting for the running move.
+func (clock *GameClock) getLiveRemainingTimes() [2]time.Duration {
+	remainingTime := clock.remainingTime
+	if !clock.running {
+		return remainingTime
+	}
+
+	side := clock.sideToMove
+	elapsedTime := clock.timeSource.Now().Sub(clock.moveStartInstant)
+	switch clock.timeControl.Mode {
+	case SimpleDelayClockMode:
+		remainingTime[side] -= max(0, elapsedTime-clock.currentStage(side).Increment)
+	case HourglassClockMode:
+		remainingTime[side] -= elapsedTime
+		remainingTime[side^1] += elapsedTime
+	default:
+		remainingTime[side] -= elapsedTime
+	}
+	return remainingTime
+}
+
+func (clock *GameClock) updateFlags() {
+	for side := Black; side <= White; side++ {
+		if clock.remainingTime[side] < 0 {
+			clock.flagged[side] = true
+			clock.remainingTime[side] = 0
+		}
+	}
+}
+
+func (clock *GameClock) SideToMove() uint8 {
+	return clock.sideToMove
+}
+
+func (clock *GameClock) Running() bool {
+	return clock.running
+}
+
+func (clock *GameClock) RemainingTime(side uint8) time.Duration {
+	return max(0, clock.getLiveRemainingTimes()[side])
+}
+
+func (clock *GameClock) Flagged(side uint8) bool {
+	return clock.flagged[side] || clock.getLiveRemainingTimes()[side] < 0
+}
+
+func (clock *GameClock) MovesPlayed(side uint8) int {
+	return clock.movesPlayed[side]
+}
+
+// MovesToGo returns the number of moves the side has to play until its next time control, or zero when the
+// current stage lasts for the rest of the game.
+func (clock *GameClock) MovesToGo(side uint8) int {
+	if stage := clock.currentStage(side); stage.Moves > 0 {
+		return stage.Moves - clock.stageMovesPlayed[side]
+	}
+	return 0
+}
+
+// Increment returns the time the side gains per move, which is passed to engines as winc or binc. The delay modes
+// report their delay, as a move played within it costs no time. The hourglass has none.
+func (clock *GameClock) Increment(side uint8) time.Duration {
+	if clock.timeControl.Mode == HourglassClockMode {
+		return 0
+	}
+	return clock.currentStage(side).Increment
+}
+
+// GoCommand returns the UCI go command for the side to move, with the current state of the clocks.
+func (clock *GameClock) GoCommand() string {
+	remainingTime := clock.getLiveRemainingTimes()
+	side := clock.sideToMove
+
+	goCommand := fmt.Sprintf("go wtime %d btime %d", max(0, remainingTime[White]).Milliseconds(), max(0, remainingTime[Black]).Milliseconds())
+	if whiteIncrement, blackIncrement := clock.Increment(White), clock.Increment(Black); whiteIncrement > 0 || blackIncrement > 0 {
+		goCommand += fmt.Sprintf(" winc %d binc %d", whiteIncrement.Milliseconds(), blackIncrement.Milliseconds())
+	}
+	if movesToGo := clock.MovesToGo(side); movesToGo > 0 {
+		goCommand += fmt.Sprintf(" movestogo %d", movesToGo)
+	}
+	return goCommand
+}
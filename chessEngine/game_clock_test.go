@@ -0,0 +1,150 @@
+package chessEngine
+
+import (
+	"testing"
+	"time"
+)
+
+// playClockMoves presses the clock after each move duration, white moving first, and fails on a flag.
+func playClockMoves(t *testing.T, clock *GameClock, timeSource *FakeTimeSource, moveDurations []time.Duration) {
+	clock.Start(White)
+	for moveIndex, moveDuration := range moveDurations {
+		timeSource.Advance(moveDuration)
+		if !clock.Press() {
+			t.Fatalf("flagged on move %d", moveIndex)
+		}
+	}
+}
+
+func repeatDurations(duration time.Duration, count int) []time.Duration {
+	durations := make([]time.Duration, count)
+	for index := range durations {
+		durations[index] = duration
+	}
+	return durations
+}
+
+func TestGameClockModes(t *testing.T) {
+	testCases := []struct {
+		name                string
+		timeControl         string
+		mode                ClockMode
+		moveDurations       []time.Duration
+		expectedWhiteTime   time.Duration
+		expectedBlackTime   time.Duration
+		expectedGoCommand   string
+		expectedTimeControl string
+	}{
+		{
+			"fischer", "60+2", FischerClockMode,
+			[]time.Duration{5 * time.Second, 3 * time.Second, 10 * time.Second},
+			49 * time.Second, 59 * time.Second, "go wtime 49000 btime 59000 winc 2000 binc 2000", "60+2",
+		},
+		{
+			// The increment is capped at the time used by the move
+			"bronstein", "60+5", BronsteinClockMode,
+			[]time.Duration{3 * time.Second, 8 * time.Second, 5 * time.Second},
+			60 * time.Second, 57 * time.Second, "go wtime 60000 btime 57000 winc 5000 binc 5000", "60+5",
+		},
+		{
+			"simple delay", "60+5", SimpleDelayClockMode,
+			[]time.Duration{3 * time.Second, 8 * time.Second, 12 * time.Second},
+			53 * time.Second, 57 * time.Second, "go wtime 53000 btime 57000 winc 5000 binc 5000", "60+5",
+		},
+		{
+			// The time used by a side goes to the other one
+			"hourglass", "*60", FischerClockMode,
+			[]time.Duration{10 * time.Second, 25 * time.Second},
+			75 * time.Second, 45 * time.Second, "go wtime 75000 btime 45000", "*60",
+		},
+		{
+			"before the time control", "40/5400+30:1800+30", FischerClockMode,
+			repeatDurations(time.Minute, 78),
+			4230 * time.Second, 4230 * time.Second, "go wtime 4230000 btime 4230000 winc 30000 binc 30000 movestogo 1", "40/5400+30:1800+30",
+		},
+		{
+			// Both sides get the time of the second stage after their 40th move
+			"after the time control", "40/5400+30:1800+30", FischerClockMode,
+			repeatDurations(time.Minute, 80),
+			6000 * time.Second, 6000 * time.Second, "go wtime 6000000 btime 6000000 winc 30000 binc 30000", "40/5400+30:1800+30",
+		},
+		{
+			// The last stage is repeated when it has a number of moves
+			"repeated stage", "2/60", FischerClockMode,
+			repeatDurations(10*time.Second, 4),
+			100 * time.Second, 100 * time.Second, "go wtime 100000 btime 100000 movestogo 2", "2/60",
+		},
+	}
+
+	for _, testCase := range testCases {
+		timeControl, err := ParseTimeControl(testCase.timeControl, testCase.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timeControl.String() != testCase.expectedTimeControl {
+			t.Errorf("%s: the time control is written as %s", testCase.name, timeControl)
+		}
+
+		timeSource := NewFakeTimeSource(time.Unix(0, 0))
+		clock, err := NewGameClock(timeControl, timeSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		playClockMoves(t, clock, timeSource, testCase.moveDurations)
+
+		if whiteTime, blackTime := clock.RemainingTime(White), clock.RemainingTime(Black); whiteTime != testCase.expectedWhiteTime || blackTime != testCase.expectedBlackTime {
+			t.Errorf("%s: the remaining times are %v and %v, expected %v and %v", testCase.name, whiteTime, blackTime, testCase.expectedWhiteTime, testCase.expectedBlackTime)
+		}
+		if goCommand := clock.GoCommand(); goCommand != testCase.expectedGoCommand {
+			t.Errorf("%s: the go command is %q, expected %q", testCase.name, goCommand, testCase.expectedGoCommand)
+		}
+	}
+}
+
+func TestGameClockFlag(t *testing.T) {
+	for _, mode := range []ClockMode{FischerClockMode, BronsteinClockMode, SimpleDelayClockMode, HourglassClockMode} {
+		timeControl, _ := ParseTimeControl("10+5", mode)
+		if mode == HourglassClockMode {
+			timeControl, _ = ParseTimeControl("*10", mode)
+		}
+		timeSource := NewFakeTimeSource(time.Unix(0, 0))
+		clock, _ := NewGameClock(timeControl, timeSource)
+		playClockMoves(t, clock, timeSource, []time.Duration{time.Second})
+
+		// The delay of the simple delay mode is used before the clock runs down, and the hourglass gave black the
+		// second used by white
+		timeSource.Advance(11 * time.Second)
+		if clock.Flagged(Black) != (mode == FischerClockMode || mode == BronsteinClockMode) {
+			t.Errorf("%s: black flagged is %v after 11 seconds", mode, clock.Flagged(Black))
+		}
+		timeSource.Advance(5 * time.Second)
+		if !clock.Flagged(Black) || clock.RemainingTime(Black) != 0 {
+			t.Errorf("%s: black isn't flagged with %v left", mode, clock.RemainingTime(Black))
+		}
+
+		if clock.Press() || !clock.Flagged(Black) || clock.Flagged(White) {
+			t.Errorf("%s: the move on which black flagged was accepted", mode)
+		}
+		if clock.RemainingTime(Black) != 0 {
+			t.Errorf("%s: black has %v left after flagging", mode, clock.RemainingTime(Black))
+		}
+	}
+}
+
+func TestGameClockStop(t *testing.T) {
+	timeControl, _ := ParseTimeControl("60", FischerClockMode)
+	timeSource := NewFakeTimeSource(time.Unix(0, 0))
+	clock, _ := NewGameClock(timeControl, timeSource)
+
+	clock.Start(Black)
+	timeSource.Advance(20 * time.Second)
+	clock.Stop()
+	timeSource.Advance(time.Hour)
+
+	if clock.Running() || clock.RemainingTime(Black) != 40*time.Second || clock.RemainingTime(White) != time.Minute {
+		t.Errorf("the stopped clock has %v and %v left", clock.RemainingTime(White), clock.RemainingTime(Black))
+	}
+	if goCommand := clock.GoCommand(); goCommand != "go wtime 60000 btime 40000" {
+		t.Errorf("the go command is %q", goCommand)
+	}
+}
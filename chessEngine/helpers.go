@@ -38,6 +38,22 @@ func max[Int constraints.Integer](a, b Int) Int {
 	return b
 }
 
+func min[Int constraints.Integer](a, b Int) Int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func sign[Int constraints.Signed](n Int) Int {
+	if n > 0 {
+		return 1
+	} else if n < 0 {
+		return -1
+	}
+	return 0
+}
+
 type RandomNumberGenerator struct {
 	seed uint64
 }
@@ -10,13 +10,66 @@ type Evaluator interface {
 	GetTotalPhaseWeight() int16
 }
 
+// IncrementalEvaluator is optionally implemented by evaluators which maintain their own incremental state
+// (e.g. NNUE accumulators, pawn keys or attack maps) alongside the position.
+//
+// OnMoveDone is invoked at the start of Position.DoMove, before any board change, and is followed by an
+// OnPieceRemoved/OnPiecePlaced call for each board change the move makes. OnMoveUndone is invoked once
+// UnDoPreviousMove has restored the board, without reporting the individual board changes, so evaluators are
+// expected to keep a per-ply stack of their state indexed by Position.StateStackSize(). Null moves make no
+// board changes and are not reported. OnPositionLoaded is invoked whenever the position is set up from scratch,
+// or a game move that can't be undone is applied to it.
+type IncrementalEvaluator interface {
+	Evaluator
+	OnPositionLoaded(position *Position)
+	OnPiecePlaced(position *Position, piece Piece, square uint8)
+	OnPieceRemoved(position *Position, piece Piece, square uint8)
+	OnMoveDone(position *Position, move Move)
+	OnMoveUndone(position *Position, move Move)
+}
+
+// ConfigurableEvaluator is optionally implemented by evaluators which offer their own UCI options, which are
+// offered alongside the options of the game searcher.
+type ConfigurableEvaluator interface {
+	Evaluator
+	GetOptions() map[string]EngineOption
+}
+
+// EngineOption describes a UCI option. Options are created with NewCheckOption, NewSpinOption, NewComboOption,
+// NewButtonOption and NewStringOption, which validate the values before passing them to the setter.
 type EngineOption struct {
-	optionType   string
+	optionType   OptionType
 	defaultValue string
-	minValue     string
-	maxValue     string
+	minValue     int
+	maxValue     int
 	fixedValues  []string
-	setOption    func(optionValue string)
+	setOption    func(optionValue string) error
+}
+
+// TranspositionTable stores search results keyed by the position hash. Probe returns a copy of the stored entry,
+// so implementations are free to pack entries in their own layout.
+type TranspositionTable interface {
+	Probe(hash uint64) (TableEntry, bool)
+	Store(hash uint64, move Move, score int16, staticEvaluation int16, pliesFromRoot uint8, depth uint8, entryType uint8)
+	Clear()
+	Resize(tableSize uint64)
+	Hashfull() int
+	Prefetch(hash uint64)
+	NewSearch()
+}
+
+// TimeManager decides how long a search may take. The soft limit is checked between the iterations of iterative
+// deepening, and the hard limit is polled during the search, which is stopped once it's reached.
+type TimeManager interface {
+	Initialize(remainingTime int64, increment int64, moveTime int64, movesToGo int16, depth uint8, nodeCount uint64)
+	SetMoveOverhead(moveOverhead int64)
+	StartMoveTimeAllocation(plyNumber uint16)
+	IterationCompleted(depth uint8, bestMove Move, score int16, bestMoveNodeFraction float64)
+	AspirationWindowMissed(depth uint8)
+	SoftLimitReached() bool
+	HardLimitReached() bool
+	DepthLimit() uint8
+	NodeLimit() uint64
 }
 
 type GameSearcher interface {
@@ -0,0 +1,171 @@
+package chessEngine
+
+const (
+	// Positions are indexed with the strong side as white and the pawn on files A to D, ranks 2 to 7
+	KPKBitbaseSize = 2 * 24 * 64 * 64
+
+	kpkInvalid uint8 = 0
+	kpkUnknown uint8 = 1
+	kpkDraw    uint8 = 2
+	kpkWin     uint8 = 4
+)
+
+var kpkBitbase [KPKBitbaseSize / 32]uint32
+
+func kpkIndex(sideToMove uint8, strongKingSquare uint8, weakKingSquare uint8, pawnSquare uint8) uint32 {
+	return uint32(strongKingSquare) | uint32(weakKingSquare)<<6 | uint32(sideToMove)<<12 | uint32(File(pawnSquare))<<13 | uint32(Rank7-Rank(pawnSquare))<<15
+}
+
+// InitializeKPKBitbase computes the result of every KPK position by retrograde iteration: the positions decided
+// immediately are classified first, then the unknown positions are repeatedly classified from their successors
+// until nothing changes. A position which is still unknown at the end is a draw.
+func InitializeKPKBitbase() {
+	results := make([]uint8, KPKBitbaseSize)
+	for index := uint32(0); index < KPKBitbaseSize; index++ {
+		results[index] = classifyInitialKPKPosition(index)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for index := uint32(0); index < KPKBitbaseSize; index++ {
+			if results[index] == kpkUnknown {
+				results[index] = classifyKPKPositionFromSuccessors(index, results)
+				changed = changed || results[index] != kpkUnknown
+			}
+		}
+	}
+
+	kpkBitbase = [KPKBitbaseSize / 32]uint32{}
+	for index := uint32(0); index < KPKBitbaseSize; index++ {
+		if results[index] == kpkWin {
+			kpkBitbase[index/32] |= 1 << (index % 32)
+		}
+	}
+}
+
+func decodeKPKIndex(index uint32) (sideToMove uint8, strongKingSquare uint8, weakKingSquare uint8, pawnSquare uint8) {
+	strongKingSquare = uint8(index & 0x3f)
+	weakKingSquare = uint8((index >> 6) & 0x3f)
+	sideToMove = uint8((index >> 12) & 1)
+	pawnSquare = uint8((Rank7-(index>>15)&7)*8 + (index>>13)&3)
+	return
+}
+
+func classifyInitialKPKPosition(index uint32) uint8 {
+	sideToMove, strongKingSquare, weakKingSquare, pawnSquare := decodeKPKIndex(index)
+	squareInFrontOfPawn := pawnSquare + 8
+
+	if chebyshevDistance(strongKingSquare, weakKingSquare) <= 1 || strongKingSquare == pawnSquare || weakKingSquare == pawnSquare ||
+		(sideToMove == White && ComputedPawnCaptures[White][pawnSquare]&BitboardForSquare[weakKingSquare] != 0) {
+		return kpkInvalid
+	}
+
+	if sideToMove == White && Rank(pawnSquare) == Rank7 && strongKingSquare != squareInFrontOfPawn &&
+		(chebyshevDistance(weakKingSquare, squareInFrontOfPawn) > 1 || chebyshevDistance(strongKingSquare, squareInFrontOfPawn) == 1) {
+		// The pawn promotes safely
+		return kpkWin
+	}
+
+	if sideToMove == Black {
+		weakKingMoves := ComputedKingMoves[weakKingSquare]
+		strongKingMoves := ComputedKingMoves[strongKingSquare]
+		isStalemate := weakKingMoves&^(strongKingMoves|ComputedPawnCaptures[White][pawnSquare]) == 0
+		canCapturePawn := weakKingMoves&BitboardForSquare[pawnSquare]&^strongKingMoves != 0
+		if isStalemate || canCapturePawn {
+			return kpkDraw
+		}
+	}
+
+	return kpkUnknown
+}
+
+// With white to move a single winning successor makes the position a win, and with black to move a single
+// drawing successor makes it a draw. Successors which are invalid positions are illegal moves and are ignored.
+func classifyKPKPositionFromSuccessors(index uint32, results []uint8) uint8 {
+	sideToMove, strongKingSquare, weakKingSquare, pawnSquare := decodeKPKIndex(index)
+	successorResults := kpkInvalid
+
+	if sideToMove == White {
+		kingMoves := ComputedKingMoves[strongKingSquare]
+		for kingMoves != 0 {
+			successorResults |= results[kpkIndex(Black, kingMoves.PopMostSignificantBit(), weakKingSquare, pawnSquare)]
+		}
+
+		squareInFrontOfPawn := pawnSquare + 8
+		if Rank(pawnSquare) < Rank7 {
+			successorResults |= results[kpkIndex(Black, strongKingSquare, weakKingSquare, squareInFrontOfPawn)]
+		}
+		if Rank(pawnSquare) == Rank2 && squareInFrontOfPawn != strongKingSquare && squareInFrontOfPawn != weakKingSquare {
+			successorResults |= results[kpkIndex(Black, strongKingSquare, weakKingSquare, squareInFrontOfPawn+8)]
+		}
+
+		if successorResults&kpkWin != 0 {
+			return kpkWin
+		} else if successorResults&kpkUnknown != 0 {
+			return kpkUnknown
+		}
+		return kpkDraw
+	}
+
+	kingMoves := ComputedKingMoves[weakKingSquare]
+	for kingMoves != 0 {
+		successorResults |= results[kpkIndex(White, strongKingSquare, kingMoves.PopMostSignificantBit(), pawnSquare)]
+	}
+
+	if successorResults&kpkDraw != 0 {
+		return kpkDraw
+	} else if successorResults&kpkUnknown != 0 {
+		return kpkUnknown
+	}
+	return kpkWin
+}
+
+// ProbeKPKBitbase returns whether the strong side, the only side with a pawn, wins the KPK position.
+func ProbeKPKBitbase(position *Position, strongSide uint8) bool {
+	strongKingSquare := position.PiecesBitBoard[strongSide][King].MostSignificantBit()
+	weakKingSquare := position.PiecesBitBoard[strongSide^1][King].MostSignificantBit()
+	pawnSquare := position.PiecesBitBoard[strongSide][Pawn].MostSignificantBit()
+
+	if strongSide == Black {
+		strongKingSquare, weakKingSquare, pawnSquare = strongKingSquare^56, weakKingSquare^56, pawnSquare^56
+	}
+
+	if File(pawnSquare) >= FileE {
+		strongKingSquare, weakKingSquare, pawnSquare = strongKingSquare^7, weakKingSquare^7, pawnSquare^7
+	}
+
+	sideToMove := Black
+	if position.SideToMove == strongSide {
+		sideToMove = White
+	}
+
+	index := kpkIndex(sideToMove, strongKingSquare, weakKingSquare, pawnSquare)
+	return kpkBitbase[index/32]&(1<<(index%32)) != 0
+}
+
+// getKPKStrongSide returns the side owning the pawn if the position is a KPK position.
+func getKPKStrongSide(position *Position) (uint8, bool) {
+	occupancyBitboard := position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]
+	if occupancyBitboard.CountSetBits() != 3 {
+		return White, false
+	}
+
+	for color := Black; color <= White; color++ {
+		if position.PiecesBitBoard[color][Pawn] != 0 {
+			return color, true
+		}
+	}
+	return White, false
+}
+
+// kpkScore returns the exact KPK evaluation from the strong side's point of view. Winning positions favor
+// advanced pawns escorted by their king so that the search makes progress towards promotion.
+func kpkScore(position *Position, strongSide uint8) int16 {
+	if !ProbeKPKBitbase(position, strongSide) {
+		return drawScore
+	}
+
+	pawnSquare := relativeSquare(strongSide, position.PiecesBitBoard[strongSide][Pawn].MostSignificantBit())
+	strongKingSquare := relativeSquare(strongSide, position.PiecesBitBoard[strongSide][King].MostSignificantBit())
+	return EndgameKnownWinScore + StandardPieceValuesScaled[Pawn] + 10*int16(Rank(pawnSquare)) - 2*int16(chebyshevDistance(strongKingSquare, pawnSquare+8))
+}
@@ -0,0 +1,46 @@
+package chessEngine
+
+import "testing"
+
+func TestProbeKPKBitbase(t *testing.T) {
+	testCases := []struct {
+		fen          string
+		strongSide   uint8
+		expectedWins bool
+	}{
+		// The side to move decides whether the pawn promotes or the lone king is stalemated
+		{"4k3/8/3KP3/8/8/8/8/8 w - - 0 1", White, true},
+		{"4k3/8/3KP3/8/8/8/8/8 b - - 0 1", White, false},
+		{"8/8/8/8/8/3kp3/8/4K3 b - - 0 1", Black, true},
+		{"8/8/8/8/8/3kp3/8/4K3 w - - 0 1", Black, false},
+
+		// The king in front of its pawn on the sixth rank wins regardless
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", White, true},
+		{"5k2/8/5K2/5P2/8/8/8/8 b - - 0 1", White, true},
+
+		// The lone king is outside the square of the pawn
+		{"8/8/8/P7/8/8/8/K3k3 b - - 0 1", White, true},
+
+		// The defending king reaches the corner in front of the rook pawn
+		{"k7/8/1K6/P7/8/8/8/8 w - - 0 1", White, false},
+		{"8/8/8/8/7p/6k1/8/7K b - - 0 1", Black, false},
+	}
+
+	evaluator := &DefaultEvaluator{}
+	for _, testCase := range testCases {
+		position := Position{}
+		position.LoadFEN(testCase.fen, evaluator)
+		if wins := ProbeKPKBitbase(&position, testCase.strongSide); wins != testCase.expectedWins {
+			t.Errorf("%s: probed %v, expected %v", testCase.fen, wins, testCase.expectedWins)
+		}
+
+		// The evaluation is exact for the side to move
+		score := evaluator.EvaluatePosition(&position)
+		if position.SideToMove != testCase.strongSide {
+			score = -score
+		}
+		if (score > EndgameKnownWinScore) != testCase.expectedWins || (!testCase.expectedWins && score != drawScore) {
+			t.Errorf("%s: evaluated as %d", testCase.fen, score)
+		}
+	}
+}
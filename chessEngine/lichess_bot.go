@@ -0,0 +1,617 @@
+package chessEngine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLichessURL            = "https://lichess.org"
+	LichessTokenEnvironment      = "LICHESS_BOT_TOKEN"
+	DefaultLichessGames          = 1
+	DefaultLichessHashMB         = 64
+	DefaultLichessMaximumTime    = 3 * 60 * 60
+	DefaultLichessMaximumInc     = 180
+	DefaultLichessReconnectDelay = 5 * time.Second
+	MaximumLichessLineSize       = 1 << 20
+
+	LichessStartedStatus = "started"
+	LichessCreatedStatus = "created"
+)
+
+var errLichessGameOver = errors.New("the game is over")
+
+type LichessUser struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Title  string `json:"title,omitempty"`
+	Rating int    `json:"rating,omitempty"`
+}
+
+type LichessVariant struct {
+	Key string `json:"key"`
+}
+
+// LichessTimeControl has the initial time (limit) and the increment in seconds for the "clock" type, the other
+// types being "correspondence" and "unlimited".
+type LichessTimeControl struct {
+	Type      string `json:"type"`
+	Limit     int    `json:"limit,omitempty"`
+	Increment int    `json:"increment,omitempty"`
+}
+
+// LichessChallenge is a challenge of the event stream. Color is the color requested by the challenger.
+type LichessChallenge struct {
+	ID          string             `json:"id"`
+	Challenger  LichessUser        `json:"challenger"`
+	DestUser    *LichessUser       `json:"destUser,omitempty"`
+	Variant     LichessVariant     `json:"variant"`
+	Rated       bool               `json:"rated"`
+	Speed       string             `json:"speed"`
+	TimeControl LichessTimeControl `json:"timeControl"`
+	Color       string             `json:"color"`
+	InitialFen  string             `json:"initialFen,omitempty"`
+}
+
+// LichessGameState is the state of a game stream, with the moves in the UCI notation separated by spaces and the
+// clocks in milliseconds.
+type LichessGameState struct {
+	Type   string `json:"type"`
+	Moves  string `json:"moves"`
+	Wtime  int64  `json:"wtime"`
+	Btime  int64  `json:"btime"`
+	Winc   int64  `json:"winc"`
+	Binc   int64  `json:"binc"`
+	Status string `json:"status"`
+	Winner string `json:"winner,omitempty"`
+}
+
+// LichessGameFull is the first line of a game stream. The initial FEN is "startpos" for the standard start.
+type LichessGameFull struct {
+	Type       string           `json:"type"`
+	ID         string           `json:"id"`
+	Variant    LichessVariant   `json:"variant"`
+	White      LichessUser      `json:"white"`
+	Black      LichessUser      `json:"black"`
+	InitialFen string           `json:"initialFen"`
+	State      LichessGameState `json:"state"`
+}
+
+type lichessEventGame struct {
+	GameID string `json:"gameId"`
+	ID     string `json:"id"`
+}
+
+type lichessEvent struct {
+	Type      string            `json:"type"`
+	Challenge *LichessChallenge `json:"challenge,omitempty"`
+	Game      *lichessEventGame `json:"game,omitempty"`
+}
+
+// ChallengeRules decide which challenges are accepted. The initial times and increments are in seconds.
+type ChallengeRules struct {
+	Variants         []string
+	Speeds           []string
+	MinimumTime      int
+	MaximumTime      int
+	MinimumIncrement int
+	MaximumIncrement int
+	AcceptRated      bool
+	AcceptCasual     bool
+	AcceptBots       bool
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns whether the challenge is accepted, or the Lichess decline reason if it isn't.
+func (rules ChallengeRules) Evaluate(challenge LichessChallenge) (bool, string) {
+	if !containsFold(rules.Variants, challenge.Variant.Key) {
+		if challenge.Variant.Key == "standard" {
+			return false, "standard"
+		}
+		return false, "variant"
+	}
+
+	if challenge.InitialFen != "" && challenge.InitialFen != "startpos" && ValidateFEN(challenge.InitialFen) != nil {
+		return false, "generic"
+	}
+
+	if challenge.TimeControl.Type != "clock" || !containsFold(rules.Speeds, challenge.Speed) {
+		return false, "timeControl"
+	}
+	if challenge.TimeControl.Limit < rules.MinimumTime {
+		return false, "tooFast"
+	}
+	if challenge.TimeControl.Limit > rules.MaximumTime {
+		return false, "tooSlow"
+	}
+	if challenge.TimeControl.Increment < rules.MinimumIncrement || challenge.TimeControl.Increment > rules.MaximumIncrement {
+		return false, "timeControl"
+	}
+
+	if challenge.Rated && !rules.AcceptRated {
+		return false, "casual"
+	}
+	if !challenge.Rated && !rules.AcceptCasual {
+		return false, "rated"
+	}
+	if challenge.Challenger.Title == "BOT" && !rules.AcceptBots {
+		return false, "noBot"
+	}
+
+	return true, ""
+}
+
+type LichessBotSettings struct {
+	URL                    string
+	Token                  string
+	MaximumGames           int
+	TranspositionTableSize uint64
+	ReconnectDelay         time.Duration
+	Rules                  ChallengeRules
+}
+
+// DefaultLichessBotSettings reads the API token from the LICHESS_BOT_TOKEN environment variable, so that it doesn't
+// have to be typed into the main menu.
+func DefaultLichessBotSettings() LichessBotSettings {
+	return LichessBotSettings{
+		URL:                    DefaultLichessURL,
+		Token:                  os.Getenv(LichessTokenEnvironment),
+		MaximumGames:           DefaultLichessGames,
+		TranspositionTableSize: DefaultLichessHashMB,
+		ReconnectDelay:         DefaultLichessReconnectDelay,
+		Rules: ChallengeRules{
+			Variants:         []string{"standard", "fromPosition"},
+			Speeds:           []string{"bullet", "blitz", "rapid", "classical"},
+			MaximumTime:      DefaultLichessMaximumTime,
+			MaximumIncrement: DefaultLichessMaximumInc,
+			AcceptRated:      true,
+			AcceptCasual:     true,
+			AcceptBots:       true,
+		},
+	}
+}
+
+// ParseLichessBotSettings reads "<name> <value>" pairs, e.g. "games 2 speeds blitz,rapid minTime 60 rated false".
+func ParseLichessBotSettings(command string) (LichessBotSettings, error) {
+	settings := DefaultLichessBotSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 0 {
+		return settings, errors.New("expected <name> <value> pairs")
+	}
+
+	for index := 0; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "url":
+			settings.URL = strings.TrimSuffix(value, "/")
+		case "games":
+			settings.MaximumGames, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		case "variants":
+			settings.Rules.Variants = strings.Split(value, ",")
+		case "speeds":
+			settings.Rules.Speeds = strings.Split(value, ",")
+		case "minTime":
+			settings.Rules.MinimumTime, err = strconv.Atoi(value)
+		case "maxTime":
+			settings.Rules.MaximumTime, err = strconv.Atoi(value)
+		case "minIncrement":
+			settings.Rules.MinimumIncrement, err = strconv.Atoi(value)
+		case "maxIncrement":
+			settings.Rules.MaximumIncrement, err = strconv.Atoi(value)
+		case "rated":
+			settings.Rules.AcceptRated, err = strconv.ParseBool(value)
+		case "casual":
+			settings.Rules.AcceptCasual, err = strconv.ParseBool(value)
+		case "bots":
+			settings.Rules.AcceptBots, err = strconv.ParseBool(value)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	for _, variant := range settings.Rules.Variants {
+		if variant != "standard" && variant != "fromPosition" {
+			return settings, fmt.Errorf("unsupported variant %s, only standard and fromPosition can be played", variant)
+		}
+	}
+
+	if settings.MaximumGames < 1 || settings.TranspositionTableSize < 1 {
+		return settings, errors.New("games and hash must be positive")
+	}
+
+	return settings, nil
+}
+
+// LichessBot plays as a bot account through the Lichess Bot API. It streams the incoming events, answers the
+// challenges by its rules and plays each game with its own game searcher and evaluator.
+type LichessBot struct {
+	settings        LichessBotSettings
+	client          *http.Client
+	newGameSearcher func() GameSearcher
+	newEvaluator    func() Evaluator
+	output          io.Writer
+
+	botID       string
+	lock        sync.Mutex
+	activeGames map[string]bool
+	games       sync.WaitGroup
+}
+
+func NewLichessBot(settings LichessBotSettings, newGameSearcher func() GameSearcher, newEvaluator func() Evaluator, output io.Writer) (*LichessBot, error) {
+	if settings.Token == "" {
+		return nil, fmt.Errorf("an API token is required, set it in the %s environment variable", LichessTokenEnvironment)
+	}
+	if newGameSearcher == nil || newEvaluator == nil {
+		return nil, errors.New("expected functions creating the game searcher and the evaluator of each game")
+	}
+
+	return &LichessBot{
+		settings:        settings,
+		client:          &http.Client{},
+		newGameSearcher: newGameSearcher,
+		newEvaluator:    newEvaluator,
+		output:          output,
+		activeGames:     map[string]bool{},
+	}, nil
+}
+
+func (bot *LichessBot) logf(format string, arguments ...any) {
+	fmt.Fprintf(bot.output, format+"\n", arguments...)
+}
+
+func (bot *LichessBot) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, bot.settings.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+bot.settings.Token)
+	return request, nil
+}
+
+func readLichessError(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, MaximumLichessLineSize))
+	errorResponse := struct {
+		Error string `json:"error"`
+	}{}
+	if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != "" {
+		return fmt.Errorf("%s: %s", response.Status, errorResponse.Error)
+	}
+	return errors.New(response.Status)
+}
+
+func (bot *LichessBot) post(ctx context.Context, path string, form url.Values) error {
+	request, err := bot.newRequest(ctx, http.MethodPost, path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := bot.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return readLichessError(response)
+	}
+	return nil
+}
+
+// stream passes each line of a newline delimited JSON stream to the callback, skipping the empty keep-alive lines,
+// until the stream ends or the callback fails.
+func (bot *LichessBot) stream(ctx context.Context, path string, onLine func(line []byte) error) error {
+	request, err := bot.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := bot.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return readLichessError(response)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaximumLichessLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := onLine(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (bot *LichessBot) fetchBotID(ctx context.Context) (string, error) {
+	request, err := bot.newRequest(ctx, http.MethodGet, "/api/account", nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := bot.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", readLichessError(response)
+	}
+
+	account := LichessUser{}
+	if err := json.NewDecoder(response.Body).Decode(&account); err != nil {
+		return "", err
+	}
+	return strings.ToLower(account.ID), nil
+}
+
+// Run plays until the context is cancelled, reconnecting to the event stream when it ends. The games in progress
+// are stopped before it returns.
+func (bot *LichessBot) Run(ctx context.Context) error {
+	defer bot.games.Wait()
+
+	botID, err := bot.fetchBotID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the bot account: %w", err)
+	}
+	bot.botID = botID
+	bot.logf("Playing on %s as %s", bot.settings.URL, botID)
+
+	for {
+		err := bot.stream(ctx, "/api/stream/event", func(line []byte) error {
+			event := lichessEvent{}
+			if err := json.Unmarshal(line, &event); err != nil {
+				bot.logf("Ignoring an invalid event: %v", err)
+				return nil
+			}
+			bot.handleEvent(ctx, event)
+			return nil
+		})
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			bot.logf("The event stream failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bot.settings.ReconnectDelay):
+		}
+	}
+}
+
+func (bot *LichessBot) handleEvent(ctx context.Context, event lichessEvent) {
+	switch event.Type {
+	case "challenge":
+		if event.Challenge == nil || strings.EqualFold(event.Challenge.Challenger.ID, bot.botID) {
+			return
+		}
+		bot.answerChallenge(ctx, *event.Challenge)
+	case "gameStart":
+		if event.Game == nil {
+			return
+		}
+		gameID := event.Game.GameID
+		if gameID == "" {
+			gameID = event.Game.ID
+		}
+		bot.startGame(ctx, gameID)
+	}
+}
+
+func (bot *LichessBot) getActiveGameCount() int {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	return len(bot.activeGames)
+}
+
+func (bot *LichessBot) answerChallenge(ctx context.Context, challenge LichessChallenge) {
+	accepted, reason := bot.settings.Rules.Evaluate(challenge)
+	if accepted && bot.getActiveGameCount() >= bot.settings.MaximumGames {
+		accepted, reason = false, "later"
+	}
+
+	if accepted {
+		bot.logf("Accepting challenge %s from %s", challenge.ID, challenge.Challenger.Name)
+		if err := bot.post(ctx, "/api/challenge/"+challenge.ID+"/accept", nil); err != nil {
+			bot.logf("Failed to accept challenge %s: %v", challenge.ID, err)
+		}
+		return
+	}
+
+	bot.logf("Declining challenge %s from %s: %s", challenge.ID, challenge.Challenger.Name, reason)
+	if err := bot.post(ctx, "/api/challenge/"+challenge.ID+"/decline", url.Values{"reason": {reason}}); err != nil {
+		bot.logf("Failed to decline challenge %s: %v", challenge.ID, err)
+	}
+}
+
+func (bot *LichessBot) startGame(ctx context.Context, gameID string) {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+
+	if bot.activeGames[gameID] {
+		return
+	}
+	bot.activeGames[gameID] = true
+	bot.games.Add(1)
+
+	go func() {
+		defer func() {
+			bot.lock.Lock()
+			delete(bot.activeGames, gameID)
+			bot.lock.Unlock()
+			bot.games.Done()
+		}()
+		bot.playGame(ctx, gameID)
+	}()
+}
+
+// lichessGame is a game played by the bot, updated from the game stream.
+type lichessGame struct {
+	id           string
+	gameSearcher GameSearcher
+	evaluator    Evaluator
+	botColor     uint8
+	initialFen   string
+	seenPlies    int
+
+	runningSearch sync.WaitGroup
+}
+
+func (bot *LichessBot) playGame(ctx context.Context, gameID string) {
+	game := &lichessGame{id: gameID, gameSearcher: bot.newGameSearcher(), evaluator: bot.newEvaluator(), botColor: NoneColor, seenPlies: -1}
+	if infoOutputSearcher, ok := game.gameSearcher.(interface{ SetInfoOutput(io.Writer) }); ok {
+		infoOutputSearcher.SetInfoOutput(io.Discard)
+	}
+	game.gameSearcher.Reset(game.evaluator)
+	if defaultSearcher, ok := game.gameSearcher.(*DefaultSearcher); ok {
+		defaultSearcher.SetTranspositionTable(NewDefaultTranspositionTable(bot.settings.TranspositionTableSize * 1024 * 1024))
+	}
+
+	defer func() {
+		game.gameSearcher.StopSearch()
+		game.runningSearch.Wait()
+		game.gameSearcher.CleanUp()
+	}()
+
+	bot.logf("Game %s started", gameID)
+	err := bot.stream(ctx, "/api/bot/game/stream/"+gameID, func(line []byte) error {
+		eventType := struct {
+			Type string `json:"type"`
+		}{}
+		if err := json.Unmarshal(line, &eventType); err != nil {
+			return err
+		}
+
+		switch eventType.Type {
+		case "gameFull":
+			gameFull := LichessGameFull{}
+			if err := json.Unmarshal(line, &gameFull); err != nil {
+				return err
+			}
+			return bot.startLichessGame(ctx, game, gameFull)
+		case "gameState":
+			state := LichessGameState{}
+			if err := json.Unmarshal(line, &state); err != nil {
+				return err
+			}
+			return bot.updateLichessGame(ctx, game, state)
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errLichessGameOver) && ctx.Err() == nil {
+		bot.logf("Game %s failed: %v", gameID, err)
+	}
+}
+
+func (bot *LichessBot) startLichessGame(ctx context.Context, game *lichessGame, gameFull LichessGameFull) error {
+	switch bot.botID {
+	case strings.ToLower(gameFull.White.ID):
+		game.botColor = White
+	case strings.ToLower(gameFull.Black.ID):
+		game.botColor = Black
+	default:
+		return fmt.Errorf("the bot doesn't play game %s", game.id)
+	}
+
+	game.initialFen = gameFull.InitialFen
+	if game.initialFen == "" || game.initialFen == "startpos" {
+		game.initialFen = FENStartPosition
+	}
+	if err := ValidateFEN(game.initialFen); err != nil {
+		return fmt.Errorf("invalid initial FEN: %w", err)
+	}
+
+	game.gameSearcher.ResetToNewGame()
+	return bot.updateLichessGame(ctx, game, gameFull.State)
+}
+
+// updateLichessGame sets up the position of a new state and starts searching when the bot is to move.
+func (bot *LichessBot) updateLichessGame(ctx context.Context, game *lichessGame, state LichessGameState) error {
+	if state.Status != LichessStartedStatus && state.Status != LichessCreatedStatus {
+		game.gameSearcher.StopSearch()
+		bot.logf("Game %s finished: %s %s", game.id, state.Status, state.Winner)
+		return errLichessGameOver
+	}
+
+	uciMoves := strings.Fields(state.Moves)
+	if game.botColor == NoneColor || len(uciMoves) == game.seenPlies {
+		return nil
+	}
+	game.seenPlies = len(uciMoves)
+	game.runningSearch.Wait()
+
+	game.gameSearcher.InitializeSearchInfo(game.initialFen, game.evaluator)
+	for _, uciMove := range uciMoves {
+		move, found := findLegalUciMove(game.gameSearcher.Position(), uciMove, game.evaluator)
+		if !found {
+			return fmt.Errorf("illegal move %s", uciMove)
+		}
+		applyGameMove(game.gameSearcher, move, game.evaluator)
+	}
+
+	if game.gameSearcher.Position().SideToMove != game.botColor {
+		return nil
+	}
+
+	remainingTime, increment := state.Btime, state.Binc
+	if game.botColor == White {
+		remainingTime, increment = state.Wtime, state.Winc
+	}
+	game.gameSearcher.InitializeTimeManager(remainingTime, increment, NoValue, NoValue, MaxDepth, math.MaxUint64)
+
+	game.runningSearch.Add(1)
+	go func() {
+		defer game.runningSearch.Done()
+
+		move := game.gameSearcher.StartSearch(game.evaluator)
+		if move == NullMove || ctx.Err() != nil {
+			return
+		}
+		if err := bot.post(ctx, "/api/bot/game/"+game.id+"/move/"+move.String(), nil); err != nil && ctx.Err() == nil {
+			bot.logf("Failed to play %v in game %s: %v", move, game.id, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,266 @@
+package chessEngine
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testLichessBotID = "gofishbot"
+	testLichessToken = "test-token"
+)
+
+var testLichessOpponent = LichessUser{ID: "opponent", Name: "Opponent"}
+
+func TestChallengeRulesEvaluate(t *testing.T) {
+	rules := DefaultLichessBotSettings().Rules
+	rules.MinimumTime = 60
+	rules.MaximumTime = 600
+	rules.MaximumIncrement = 10
+	rules.AcceptCasual = false
+	rules.AcceptBots = false
+
+	newChallenge := func(modify func(challenge *LichessChallenge)) LichessChallenge {
+		challenge := LichessChallenge{
+			ID:          "challenge",
+			Challenger:  testLichessOpponent,
+			Variant:     LichessVariant{Key: "standard"},
+			Rated:       true,
+			Speed:       "blitz",
+			TimeControl: LichessTimeControl{Type: "clock", Limit: 180, Increment: 2},
+			Color:       "random",
+		}
+		modify(&challenge)
+		return challenge
+	}
+
+	testCases := []struct {
+		name           string
+		challenge      LichessChallenge
+		expectedReason string
+	}{
+		{"accepted", newChallenge(func(challenge *LichessChallenge) {}), ""},
+		{"from position", newChallenge(func(challenge *LichessChallenge) {
+			challenge.Variant.Key, challenge.InitialFen = "fromPosition", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"
+		}), ""},
+		{"variant", newChallenge(func(challenge *LichessChallenge) { challenge.Variant.Key = "chess960" }), "variant"},
+		{"invalid position", newChallenge(func(challenge *LichessChallenge) {
+			challenge.Variant.Key, challenge.InitialFen = "fromPosition", "8/8/8/8/8/8/8/8 w - - 0 1"
+		}), "generic"},
+		{"correspondence", newChallenge(func(challenge *LichessChallenge) {
+			challenge.Speed, challenge.TimeControl = "correspondence", LichessTimeControl{Type: "correspondence"}
+		}), "timeControl"},
+		{"too fast", newChallenge(func(challenge *LichessChallenge) { challenge.TimeControl.Limit = 30 }), "tooFast"},
+		{"too slow", newChallenge(func(challenge *LichessChallenge) { challenge.TimeControl.Limit = 900 }), "tooSlow"},
+		{"increment", newChallenge(func(challenge *LichessChallenge) { challenge.TimeControl.Increment = 30 }), "timeControl"},
+		{"casual", newChallenge(func(challenge *LichessChallenge) { challenge.Rated = false }), "rated"},
+		{"bot", newChallenge(func(challenge *LichessChallenge) { challenge.Challenger.Title = "BOT" }), "noBot"},
+	}
+
+	for _, testCase := range testCases {
+		accepted, reason := rules.Evaluate(testCase.challenge)
+		if accepted != (testCase.expectedReason == "") || reason != testCase.expectedReason {
+			t.Errorf("%s: evaluated as %v %q, expected %q", testCase.name, accepted, reason, testCase.expectedReason)
+		}
+	}
+
+	rules.Variants = []string{"fromPosition"}
+	if _, reason := rules.Evaluate(newChallenge(func(challenge *LichessChallenge) {})); reason != "standard" {
+		t.Errorf("standard challenge declined with %q, expected standard", reason)
+	}
+}
+
+// startTestLichessBot runs a bot against a fake Lichess server until the end of the test.
+func startTestLichessBot(t *testing.T, modifySettings func(settings *LichessBotSettings)) (*FakeLichessServer, *LichessBot) {
+	fakeServer := NewFakeLichessServer(testLichessBotID, testLichessToken, &DefaultEvaluator{})
+	httpServer := httptest.NewServer(fakeServer.Handler())
+
+	settings := DefaultLichessBotSettings()
+	settings.URL, settings.Token = httpServer.URL, testLichessToken
+	settings.TranspositionTableSize = 1
+	settings.ReconnectDelay = 10 * time.Millisecond
+	if modifySettings != nil {
+		modifySettings(&settings)
+	}
+
+	bot, err := NewLichessBot(settings, func() GameSearcher { return NewDefaultSearcher() }, func() Evaluator { return &DefaultEvaluator{} }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		bot.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		httpServer.Close()
+	})
+	return fakeServer, bot
+}
+
+// waitForChallengeStatus waits until the challenge is answered, returning the status and the decline reason.
+func waitForChallengeStatus(t *testing.T, fakeServer *FakeLichessServer, challengeID string) (string, string) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, reason := fakeServer.ChallengeStatus(challengeID); status != LichessCreatedStatus {
+			return status, reason
+		}
+		time.Sleep(fakeLichessPollInterval)
+	}
+	t.Fatalf("challenge %s wasn't answered", challengeID)
+	return "", ""
+}
+
+func waitForGameMoves(t *testing.T, fakeServer *FakeLichessServer, gameID string, moveCount int) []string {
+	state, err := fakeServer.WaitForGameState(gameID, moveCount, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := strings.Fields(state.Moves)
+	if len(moves) != moveCount || state.Status != LichessStartedStatus {
+		t.Fatalf("game %s is %s after the moves %v, expected %d moves", gameID, state.Status, moves, moveCount)
+	}
+	return moves
+}
+
+func TestLichessBotAnswersChallenges(t *testing.T) {
+	fakeServer, _ := startTestLichessBot(t, func(settings *LichessBotSettings) {
+		settings.Rules.AcceptCasual = false
+	})
+
+	casualChallengeID := fakeServer.SendChallenge(LichessChallenge{
+		Challenger:  testLichessOpponent,
+		Variant:     LichessVariant{Key: "standard"},
+		Speed:       "blitz",
+		TimeControl: LichessTimeControl{Type: "clock", Limit: 180},
+		Color:       "white",
+	})
+	if status, reason := waitForChallengeStatus(t, fakeServer, casualChallengeID); status != "declined" || reason != "rated" {
+		t.Errorf("casual challenge was %s %s, expected declined as rated", status, reason)
+	}
+
+	// The challenger plays white, so the bot waits for its first move
+	challenge := LichessChallenge{
+		Challenger:  testLichessOpponent,
+		Variant:     LichessVariant{Key: "standard"},
+		Rated:       true,
+		Speed:       "blitz",
+		TimeControl: LichessTimeControl{Type: "clock", Limit: 180},
+		Color:       "white",
+	}
+	challengeID := fakeServer.SendChallenge(challenge)
+	if status, _ := waitForChallengeStatus(t, fakeServer, challengeID); status != "accepted" {
+		t.Fatalf("challenge was %s, expected accepted", status)
+	}
+
+	// A single game is played at a time
+	laterChallengeID := fakeServer.SendChallenge(challenge)
+	if status, reason := waitForChallengeStatus(t, fakeServer, laterChallengeID); status != "declined" || reason != "later" {
+		t.Errorf("challenge during a game was %s %s, expected declined for later", status, reason)
+	}
+}
+
+func TestLichessBotPlaysGame(t *testing.T) {
+	fakeServer, _ := startTestLichessBot(t, nil)
+
+	// The gameFull line starts the game, the bot playing white
+	challengeID := fakeServer.SendChallenge(LichessChallenge{
+		Challenger:  testLichessOpponent,
+		Variant:     LichessVariant{Key: "standard"},
+		Rated:       true,
+		Speed:       "bullet",
+		TimeControl: LichessTimeControl{Type: "clock", Limit: 15},
+		Color:       "black",
+	})
+	if status, _ := waitForChallengeStatus(t, fakeServer, challengeID); status != "accepted" {
+		t.Fatalf("challenge was %s, expected accepted", status)
+	}
+	waitForGameMoves(t, fakeServer, challengeID, 1)
+
+	// Each gameState line with the bot to move gets a reply
+	for moveCount := 1; moveCount < 5; moveCount += 2 {
+		position := replayTestLichessGame(t, waitForGameMoves(t, fakeServer, challengeID, moveCount))
+		legalMoves := GenerateLegalMoves(&position, &DefaultEvaluator{})
+		if err := fakeServer.PlayOpponentMove(challengeID, legalMoves.Moves[0].String()); err != nil {
+			t.Fatal(err)
+		}
+		waitForGameMoves(t, fakeServer, challengeID, moveCount+2)
+	}
+}
+
+func replayTestLichessGame(t *testing.T, uciMoves []string) Position {
+	evaluator := &DefaultEvaluator{}
+	position := Position{}
+	position.LoadFEN(FENStartPosition, evaluator)
+	for _, uciMove := range uciMoves {
+		move, found := findLegalUciMove(&position, uciMove, evaluator)
+		if !found {
+			t.Fatalf("illegal move %s in %v", uciMove, uciMoves)
+		}
+		position.DoMove(move, evaluator)
+	}
+	return position
+}
+
+func TestLichessBotPromotions(t *testing.T) {
+	fakeServer, _ := startTestLichessBot(t, nil)
+
+	// The bot promotes its own pawn
+	if err := fakeServer.StartGame("promoting", testLichessOpponent, White, "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", 15*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	if moves := waitForGameMoves(t, fakeServer, "promoting", 1); !strings.HasPrefix(moves[0], "e7e8") {
+		t.Errorf("the bot played %s instead of promoting", moves[0])
+	}
+	fakeServer.EndGame("promoting", "aborted", "")
+
+	// The bot replies to the promotion of the opponent
+	if err := fakeServer.StartGame("promoted", testLichessOpponent, Black, "8/P7/8/8/8/8/k7/4K3 w - - 0 1", 15*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fakeServer.PlayOpponentMove("promoted", "a7a8q"); err != nil {
+		t.Fatal(err)
+	}
+	waitForGameMoves(t, fakeServer, "promoted", 2)
+}
+
+func TestLichessBotGameOverDuringSearch(t *testing.T) {
+	fakeServer, bot := startTestLichessBot(t, nil)
+
+	// With an hour on the clock, the bot is still searching when the opponent resigns
+	if err := fakeServer.StartGame("resigned", testLichessOpponent, White, "", time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for bot.getActiveGameCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(fakeLichessPollInterval)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := fakeServer.EndGame("resigned", "resign", "white"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The search is stopped, and its move isn't posted to the finished game
+	deadline = time.Now().Add(10 * time.Second)
+	for bot.getActiveGameCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the bot kept playing the finished game")
+		}
+		time.Sleep(fakeLichessPollInterval)
+	}
+
+	state, _ := fakeServer.WaitForGameState("resigned", 0, time.Second)
+	if state.Status != "resign" || state.Moves != "" {
+		t.Errorf("the finished game is %s with the moves %q", state.Status, state.Moves)
+	}
+}
@@ -0,0 +1,457 @@
+package chessEngine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fakeLichessSubscriberBuffer = 1024
+	fakeLichessPollInterval     = 10 * time.Millisecond
+)
+
+// FakeLichessServer stands in for the Lichess Bot API to exercise LichessBot offline with net/http/httptest. It
+// streams the events and the games of a single bot account, checks the moves of the bot, and lets the caller play
+// the challengers and their moves. As on Lichess, the event stream starts with the pending challenges and the games
+// in progress. Accepted challenges start a game with the challenge ID. The clocks of the games keep their initial
+// times.
+type FakeLichessServer struct {
+	botID     string
+	token     string
+	evaluator Evaluator
+
+	lock             sync.Mutex
+	eventSubscribers map[chan []byte]bool
+	challenges       map[string]*fakeLichessChallenge
+	games            map[string]*fakeLichessGame
+	nextID           int
+}
+
+type fakeLichessChallenge struct {
+	challenge     LichessChallenge
+	status        string
+	declineReason string
+}
+
+type fakeLichessGame struct {
+	gameFull    LichessGameFull
+	botColor    uint8
+	moves       []string
+	subscribers map[chan []byte]bool
+	changed     chan struct{}
+}
+
+// NewFakeLichessServer creates a server for the bot account, which requests must authorize with the token. The
+// evaluator is only used to check the moves.
+func NewFakeLichessServer(botID string, token string, evaluator Evaluator) *FakeLichessServer {
+	return &FakeLichessServer{
+		botID:            strings.ToLower(botID),
+		token:            token,
+		evaluator:        evaluator,
+		eventSubscribers: map[chan []byte]bool{},
+		challenges:       map[string]*fakeLichessChallenge{},
+		games:            map[string]*fakeLichessGame{},
+	}
+}
+
+func (server *FakeLichessServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/account", server.handleAccount)
+	mux.HandleFunc("/api/stream/event", server.handleEventStream)
+	mux.HandleFunc("/api/challenge/", server.handleChallenge)
+	mux.HandleFunc("/api/bot/game/stream/", server.handleGameStream)
+	mux.HandleFunc("/api/bot/game/", server.handleGameAction)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer "+server.token {
+			writeJSON(writer, http.StatusUnauthorized, map[string]string{"error": "No such token"})
+			return
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
+
+func marshalLichessLine(value any) []byte {
+	line, _ := json.Marshal(value)
+	return append(line, '\n')
+}
+
+// broadcast sends the line to the subscribers without blocking, the buffers being large enough for a test.
+func broadcastLichessLine(subscribers map[chan []byte]bool, line []byte) {
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- line:
+		default:
+		}
+	}
+}
+
+func (server *FakeLichessServer) streamLines(writer http.ResponseWriter, request *http.Request, subscriber chan []byte, unsubscribe func()) {
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+
+	keepAlive := time.NewTicker(time.Second)
+	defer keepAlive.Stop()
+
+	line := []byte("\n")
+	for {
+		if _, err := writer.Write(line); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case line = <-subscriber:
+		case <-keepAlive.C:
+			line = []byte("\n")
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+func (server *FakeLichessServer) handleAccount(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, map[string]string{"id": server.botID, "username": server.botID, "title": "BOT"})
+}
+
+func (server *FakeLichessServer) handleEventStream(writer http.ResponseWriter, request *http.Request) {
+	subscriber := make(chan []byte, fakeLichessSubscriberBuffer)
+
+	server.lock.Lock()
+	server.eventSubscribers[subscriber] = true
+	for _, challenge := range server.challenges {
+		if challenge.status == LichessCreatedStatus {
+			subscriber <- marshalLichessLine(lichessEvent{Type: "challenge", Challenge: &challenge.challenge})
+		}
+	}
+	for _, game := range server.games {
+		if game.gameFull.State.Status == LichessStartedStatus {
+			subscriber <- marshalLichessLine(lichessEvent{Type: "gameStart", Game: &lichessEventGame{GameID: game.gameFull.ID, ID: game.gameFull.ID}})
+		}
+	}
+	server.lock.Unlock()
+
+	server.streamLines(writer, request, subscriber, func() {
+		server.lock.Lock()
+		delete(server.eventSubscribers, subscriber)
+		server.lock.Unlock()
+	})
+}
+
+// SendChallenge sends the challenge to the bot, giving it an ID if it has none, and returns the ID.
+func (server *FakeLichessServer) SendChallenge(challenge LichessChallenge) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if challenge.ID == "" {
+		server.nextID++
+		challenge.ID = fmt.Sprintf("challenge%d", server.nextID)
+	}
+	server.challenges[challenge.ID] = &fakeLichessChallenge{challenge: challenge, status: LichessCreatedStatus}
+	broadcastLichessLine(server.eventSubscribers, marshalLichessLine(lichessEvent{Type: "challenge", Challenge: &challenge}))
+	return challenge.ID
+}
+
+// ChallengeStatus returns "created", "accepted" or "declined" with the decline reason.
+func (server *FakeLichessServer) ChallengeStatus(challengeID string) (string, string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	challenge, ok := server.challenges[challengeID]
+	if !ok {
+		return "", ""
+	}
+	return challenge.status, challenge.declineReason
+}
+
+func (server *FakeLichessServer) handleChallenge(writer http.ResponseWriter, request *http.Request) {
+	pathFields := strings.Split(strings.TrimPrefix(request.URL.Path, "/api/challenge/"), "/")
+	if request.Method != http.MethodPost || len(pathFields) != 2 {
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Not found"})
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	challenge, ok := server.challenges[pathFields[0]]
+	if !ok || challenge.status != LichessCreatedStatus {
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Challenge not found"})
+		return
+	}
+
+	switch pathFields[1] {
+	case "accept":
+		botColor := uint8(White)
+		if challenge.challenge.Color == "white" {
+			botColor = Black
+		}
+		timeControl := challenge.challenge.TimeControl
+		if err := server.startGame(challenge.challenge.ID, challenge.challenge.Challenger, botColor, challenge.challenge.InitialFen, time.Duration(timeControl.Limit)*time.Second, time.Duration(timeControl.Increment)*time.Second); err != nil {
+			writeJSON(writer, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		challenge.status = "accepted"
+	case "decline":
+		challenge.status = "declined"
+		challenge.declineReason = request.FormValue("reason")
+		if challenge.declineReason == "" {
+			challenge.declineReason = "generic"
+		}
+		broadcastLichessLine(server.eventSubscribers, marshalLichessLine(lichessEvent{Type: "challengeDeclined", Challenge: &challenge.challenge}))
+	default:
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Not found"})
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// StartGame starts a game between the bot, playing the color, and the opponent from the initial FEN, "startpos"
+// or empty for the standard start.
+func (server *FakeLichessServer) StartGame(gameID string, opponent LichessUser, botColor uint8, initialFen string, initialTime time.Duration, increment time.Duration) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.startGame(gameID, opponent, botColor, initialFen, initialTime, increment)
+}
+
+func (server *FakeLichessServer) startGame(gameID string, opponent LichessUser, botColor uint8, initialFen string, initialTime time.Duration, increment time.Duration) error {
+	if _, ok := server.games[gameID]; ok {
+		return fmt.Errorf("game %s already exists", gameID)
+	}
+
+	if initialFen == "" {
+		initialFen = "startpos"
+	}
+	if initialFen != "startpos" {
+		if err := ValidateFEN(initialFen); err != nil {
+			return err
+		}
+	}
+
+	bot := LichessUser{ID: server.botID, Name: server.botID, Title: "BOT"}
+	gameFull := LichessGameFull{
+		Type:       "gameFull",
+		ID:         gameID,
+		Variant:    LichessVariant{Key: "standard"},
+		White:      bot,
+		Black:      opponent,
+		InitialFen: initialFen,
+		State: LichessGameState{
+			Type:   "gameState",
+			Wtime:  initialTime.Milliseconds(),
+			Btime:  initialTime.Milliseconds(),
+			Winc:   increment.Milliseconds(),
+			Binc:   increment.Milliseconds(),
+			Status: LichessStartedStatus,
+		},
+	}
+	if botColor == Black {
+		gameFull.White, gameFull.Black = opponent, bot
+	}
+	if initialFen != "startpos" {
+		gameFull.Variant.Key = "fromPosition"
+	}
+
+	server.games[gameID] = &fakeLichessGame{gameFull: gameFull, botColor: botColor, subscribers: map[chan []byte]bool{}, changed: make(chan struct{})}
+	broadcastLichessLine(server.eventSubscribers, marshalLichessLine(lichessEvent{Type: "gameStart", Game: &lichessEventGame{GameID: gameID, ID: gameID}}))
+	return nil
+}
+
+func (server *FakeLichessServer) handleGameStream(writer http.ResponseWriter, request *http.Request) {
+	gameID := strings.TrimPrefix(request.URL.Path, "/api/bot/game/stream/")
+	subscriber := make(chan []byte, fakeLichessSubscriberBuffer)
+
+	server.lock.Lock()
+	game, ok := server.games[gameID]
+	if !ok {
+		server.lock.Unlock()
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Game not found"})
+		return
+	}
+	game.subscribers[subscriber] = true
+	subscriber <- marshalLichessLine(game.gameFull)
+	server.lock.Unlock()
+
+	server.streamLines(writer, request, subscriber, func() {
+		server.lock.Lock()
+		delete(game.subscribers, subscriber)
+		server.lock.Unlock()
+	})
+}
+
+func (server *FakeLichessServer) handleGameAction(writer http.ResponseWriter, request *http.Request) {
+	pathFields := strings.Split(strings.TrimPrefix(request.URL.Path, "/api/bot/game/"), "/")
+	if request.Method != http.MethodPost || len(pathFields) < 2 {
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Not found"})
+		return
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	game, ok := server.games[pathFields[0]]
+	if !ok {
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Game not found"})
+		return
+	}
+
+	var err error
+	switch {
+	case pathFields[1] == "move" && len(pathFields) == 3:
+		err = server.playMove(game, game.botColor, pathFields[2])
+	case pathFields[1] == "resign" && len(pathFields) == 2:
+		err = server.endGame(game, "resign", lichessColorName(game.botColor^1))
+	default:
+		writeJSON(writer, http.StatusNotFound, map[string]string{"error": "Not found"})
+		return
+	}
+
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func lichessColorName(color uint8) string {
+	if color == White {
+		return "white"
+	}
+	return "black"
+}
+
+// replayGame returns the position of the game after its moves, and how often that position occurred.
+func (server *FakeLichessServer) replayGame(game *fakeLichessGame) (Position, int) {
+	initialFen := game.gameFull.InitialFen
+	if initialFen == "startpos" {
+		initialFen = FENStartPosition
+	}
+
+	position := Position{}
+	position.LoadFEN(initialFen, server.evaluator)
+	positionOccurrences := map[uint64]int{position.PositionHash: 1}
+
+	for _, uciMove := range game.moves {
+		move, _ := findLegalUciMove(&position, uciMove, server.evaluator)
+		position.DoMove(move, server.evaluator)
+		position.stateStackSize--
+		positionOccurrences[position.PositionHash]++
+	}
+	return position, positionOccurrences[position.PositionHash]
+}
+
+func (server *FakeLichessServer) playMove(game *fakeLichessGame, color uint8, uciMove string) error {
+	if game.gameFull.State.Status != LichessStartedStatus {
+		return errors.New("the game is over")
+	}
+
+	position, _ := server.replayGame(game)
+	if position.SideToMove != color {
+		return errors.New("not your turn")
+	}
+	if _, found := findLegalUciMove(&position, uciMove, server.evaluator); !found {
+		return fmt.Errorf("illegal move %s", uciMove)
+	}
+
+	game.moves = append(game.moves, uciMove)
+	game.gameFull.State.Moves = strings.Join(game.moves, " ")
+
+	position, occurrences := server.replayGame(game)
+	legalMoves := GenerateLegalMoves(&position, server.evaluator)
+	switch {
+	case legalMoves.Size == 0 && position.IsCurrentSideInCheck():
+		return server.endGame(game, "mate", lichessColorName(position.SideToMove^1))
+	case legalMoves.Size == 0:
+		return server.endGame(game, "stalemate", "")
+	case position.Rule50 >= 100 || occurrences >= 3 || isDrawnState(&position):
+		return server.endGame(game, "draw", "")
+	}
+
+	server.publishGameState(game)
+	return nil
+}
+
+func (server *FakeLichessServer) publishGameState(game *fakeLichessGame) {
+	broadcastLichessLine(game.subscribers, marshalLichessLine(game.gameFull.State))
+	close(game.changed)
+	game.changed = make(chan struct{})
+}
+
+func (server *FakeLichessServer) endGame(game *fakeLichessGame, status string, winner string) error {
+	if game.gameFull.State.Status != LichessStartedStatus {
+		return errors.New("the game is over")
+	}
+
+	game.gameFull.State.Status = status
+	game.gameFull.State.Winner = winner
+	server.publishGameState(game)
+	broadcastLichessLine(server.eventSubscribers, marshalLichessLine(lichessEvent{Type: "gameFinish", Game: &lichessEventGame{GameID: game.gameFull.ID, ID: game.gameFull.ID}}))
+	return nil
+}
+
+// PlayOpponentMove plays the move for the opponent of the bot.
+func (server *FakeLichessServer) PlayOpponentMove(gameID string, uciMove string) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	game, ok := server.games[gameID]
+	if !ok {
+		return fmt.Errorf("game %s not found", gameID)
+	}
+	return server.playMove(game, game.botColor^1, uciMove)
+}
+
+// EndGame ends the game with the status, such as "resign", "outoftime" or "aborted", and the winner color name,
+// or no winner.
+func (server *FakeLichessServer) EndGame(gameID string, status string, winner string) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	game, ok := server.games[gameID]
+	if !ok {
+		return fmt.Errorf("game %s not found", gameID)
+	}
+	return server.endGame(game, status, winner)
+}
+
+// WaitForGameState waits until the game is started and has at least the number of moves or is over, and returns its state.
+func (server *FakeLichessServer) WaitForGameState(gameID string, moveCount int, timeout time.Duration) (LichessGameState, error) {
+	deadline := time.After(timeout)
+
+	for {
+		server.lock.Lock()
+		game, ok := server.games[gameID]
+		if !ok {
+			server.lock.Unlock()
+			select {
+			case <-time.After(fakeLichessPollInterval):
+				continue
+			case <-deadline:
+				return LichessGameState{}, fmt.Errorf("game %s not found", gameID)
+			}
+		}
+		state, changed := game.gameFull.State, game.changed
+		server.lock.Unlock()
+
+		if len(strings.Fields(state.Moves)) >= moveCount || state.Status != LichessStartedStatus {
+			return state, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return state, errors.New("timed out waiting for the game")
+		}
+	}
+}
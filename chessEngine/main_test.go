@@ -0,0 +1,53 @@
+package chessEngine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testEngineEnvironmentVariable makes the test binary run as an engine instead of running the tests, so that tests
+// can launch it as a subprocess.
+const testEngineEnvironmentVariable = "GOFISH_TEST_ENGINE"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(testEngineEnvironmentVariable); mode != "" && mode != "gofish" {
+		runFakeTestEngine(mode)
+	}
+
+	// Creating the engine interface initializes the move generation, hashing and evaluation tables
+	engineInterface := NewDefaultEngineInterface()
+	if os.Getenv(testEngineEnvironmentVariable) == "gofish" {
+		engineInterface.StartEngine()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeTestEngine answers the handshake and isready like an engine, misbehaving on go: the "crash" engine exits
+// with an error, and the "flood" engine prints far more lines than the client buffers before answering.
+func runFakeTestEngine(mode string) {
+	input := bufio.NewScanner(os.Stdin)
+	for input.Scan() {
+		switch command := strings.TrimSpace(input.Text()); {
+		case command == "uci":
+			fmt.Println("id name Fake" + mode)
+			fmt.Println("uciok")
+		case command == "isready":
+			fmt.Println("readyok")
+		case strings.HasPrefix(command, "go") && mode == "crash":
+			fmt.Fprintln(os.Stderr, "panic: the fake engine crashed")
+			os.Exit(2)
+		case strings.HasPrefix(command, "go") && mode == "flood":
+			for i := 0; i < 100*uciEngineOutputBuffer; i++ {
+				fmt.Printf("info string line %d\n", i)
+			}
+			fmt.Println("bestmove e2e4")
+		case command == "quit":
+			os.Exit(0)
+		}
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,177 @@
+package chessEngine
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	MatchWin = iota
+	MatchDraw
+	MatchLoss
+)
+
+const DefaultMatchMaximumGamePlies = 600
+
+// MatchPlayer is one side of a match, searching with its own game searcher and evaluator.
+type MatchPlayer struct {
+	Name         string
+	GameSearcher GameSearcher
+	Evaluator    Evaluator
+}
+
+type MatchSettings struct {
+	TimeControl        TimeControl
+	TimeSource         TimeSource
+	GamePairs          int
+	RandomOpeningPlies int
+	MaximumGamePlies   int
+	Seed               int64
+}
+
+// MatchResult counts the game outcomes from the point of view of the first player.
+type MatchResult struct {
+	Wins   int
+	Draws  int
+	Losses int
+}
+
+func (result MatchResult) Games() int {
+	return result.Wins + result.Draws + result.Losses
+}
+
+func (result MatchResult) Score() float64 {
+	if result.Games() == 0 {
+		return 0.5
+	}
+	return (float64(result.Wins) + float64(result.Draws)/2) / float64(result.Games())
+}
+
+// EloDifference estimates the rating difference of the first player over the second one from the match score.
+// Perfect scores are clamped, as their difference can't be estimated.
+func (result MatchResult) EloDifference() float64 {
+	score := math.Max(math.Min(result.Score(), 0.99), 0.01)
+	return -400 * math.Log10(1/score-1)
+}
+
+// RunMatch plays pairs of games from random openings, each player having both colors once in every pair, with
+// the clocks of the time control.
+func RunMatch(firstPlayer MatchPlayer, secondPlayer MatchPlayer, settings MatchSettings) (MatchResult, error) {
+	result := MatchResult{}
+	randomGenerator := rand.New(rand.NewSource(settings.Seed))
+
+	for pair := 0; pair < settings.GamePairs; pair++ {
+		openingMoves := generateRandomOpening(firstPlayer.Evaluator, settings.RandomOpeningPlies, randomGenerator)
+
+		for game := 0; game < 2; game++ {
+			players := [2]MatchPlayer{}
+			firstPlayerColor := uint8(White)
+			if game == 1 {
+				firstPlayerColor = Black
+			}
+			players[firstPlayerColor], players[firstPlayerColor^1] = firstPlayer, secondPlayer
+
+			winner, err := playMatchGame(players, openingMoves, settings)
+			if err != nil {
+				return result, err
+			}
+
+			switch winner {
+			case firstPlayerColor:
+				result.Wins++
+			case firstPlayerColor ^ 1:
+				result.Losses++
+			default:
+				result.Draws++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func generateRandomOpening(evaluator Evaluator, plies int, randomGenerator *rand.Rand) []Move {
+	position := Position{}
+	position.LoadFEN(FENStartPosition, evaluator)
+	openingMoves := []Move{}
+
+	for ply := 0; ply < plies; ply++ {
+		legalMoves := GenerateLegalMoves(&position, evaluator)
+		if legalMoves.Size == 0 {
+			break
+		}
+
+		move := legalMoves.Moves[randomGenerator.Intn(int(legalMoves.Size))]
+		position.DoMove(move, evaluator)
+		openingMoves = append(openingMoves, move)
+	}
+
+	return openingMoves
+}
+
+// playMatchGame plays a game between the players indexed by their colors, returning the winning color, or
+// NoneColor for a draw.
+func playMatchGame(players [2]MatchPlayer, openingMoves []Move, settings MatchSettings) (uint8, error) {
+	clock, err := NewGameClock(settings.TimeControl, settings.TimeSource)
+	if err != nil {
+		return NoneColor, err
+	}
+
+	for _, player := range players {
+		player.GameSearcher.ResetToNewGame()
+		player.GameSearcher.InitializeSearchInfo(FENStartPosition, player.Evaluator)
+		for _, move := range openingMoves {
+			applyGameMove(player.GameSearcher, move, player.Evaluator)
+		}
+	}
+
+	position := players[White].GameSearcher.Position()
+	positionOccurrences := map[uint64]int{position.PositionHash: 1}
+	maximumGamePlies := settings.MaximumGamePlies
+	if maximumGamePlies == 0 {
+		maximumGamePlies = DefaultMatchMaximumGamePlies
+	}
+
+	clock.Start(position.SideToMove)
+	for ply := len(openingMoves); ply < maximumGamePlies; ply++ {
+		sideToMove := position.SideToMove
+		player := players[sideToMove]
+
+		legalMoves := GenerateLegalMoves(player.GameSearcher.Position(), player.Evaluator)
+		if legalMoves.Size == 0 {
+			if player.GameSearcher.Position().IsCurrentSideInCheck() {
+				return sideToMove ^ 1, nil
+			}
+			return NoneColor, nil
+		}
+
+		if position.Rule50 >= 100 || positionOccurrences[position.PositionHash] >= 3 || isDrawnState(position) {
+			return NoneColor, nil
+		}
+
+		player.GameSearcher.InitializeTimeManager(
+			clock.RemainingTime(sideToMove).Milliseconds(),
+			clock.Increment(sideToMove).Milliseconds(),
+			NoValue,
+			int16(clock.MovesToGo(sideToMove)),
+			MaxDepth,
+			math.MaxUint64,
+		)
+		move := player.GameSearcher.StartSearch(player.Evaluator)
+
+		if !clock.Press() {
+			return sideToMove ^ 1, nil
+		}
+
+		if move == NullMove {
+			move = legalMoves.Moves[0]
+		}
+
+		for _, gamePlayer := range players {
+			applyGameMove(gamePlayer.GameSearcher, move, gamePlayer.Evaluator)
+		}
+		positionOccurrences[position.PositionHash]++
+	}
+
+	return NoneColor, nil
+}
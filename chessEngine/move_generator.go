@@ -24,6 +24,19 @@ func GeneratePseudoLegalMoves(currentPosition *Position) (moveList MoveList) {
 	return moveList
 }
 
+func GenerateLegalMoves(currentPosition *Position, evaluator Evaluator) (moveList MoveList) {
+	pseudoLegalMoves := GeneratePseudoLegalMoves(currentPosition)
+	for i := uint8(0); i < pseudoLegalMoves.Size; i++ {
+		pseudoLegalMove := pseudoLegalMoves.Moves[i]
+		if currentPosition.DoMove(pseudoLegalMove, evaluator) {
+			moveList.AddMove(pseudoLegalMove)
+		}
+		currentPosition.UnDoPreviousMove(pseudoLegalMove, evaluator)
+	}
+
+	return moveList
+}
+
 func generatePseudoLegalCapturesAndPromotionsToQueens(currentPosition *Position) (moveList MoveList) {
 	opponentSideBitboard := currentPosition.ColorsBitBoard[currentPosition.SideToMove^1]
 
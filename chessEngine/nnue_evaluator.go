@@ -0,0 +1,305 @@
+package chessEngine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	NnueFileMagic   uint32 = 0x45554e4e // "NNUE" in little endian
+	NnueFileVersion uint32 = 1
+
+	// HalfKP: for each perspective, a feature is the (own king square, non-king piece, piece square) triplet
+	NnueHalfKpPieceFeatureCount = 10 * 64
+	NnueHalfKpFeatureCount      = 64 * NnueHalfKpPieceFeatureCount
+	NnueMaximumHiddenSize       = 2048
+
+	NnueFeatureTransformerQuantization int64 = 255
+	NnueOutputQuantization             int64 = 64
+	NnueOutputScale                    int64 = 400
+
+	NnueAccumulatorStackSize = MaxStateStackSize + 1
+)
+
+var nnueEmptyPieceSquareTables [6][64]int16
+var nnueEmptyPieceValues [6]int16
+
+// NnueNetwork holds the quantized weights of a HalfKP network with a single hidden layer per perspective:
+// 40960 -> HiddenSize (x2 perspectives) -> 1
+type NnueNetwork struct {
+	HiddenSize     int
+	FeatureWeights []int16 // indexed by feature*HiddenSize + neuron
+	FeatureBiases  []int16
+	OutputWeights  []int16 // side to move perspective first, then the opponent perspective
+	OutputBias     int32
+}
+
+type nnueAccumulator struct {
+	values       [2][]int16
+	needsRefresh [2]bool
+}
+
+type NnueEvaluator struct {
+	network            *NnueNetwork
+	accumulators       [NnueAccumulatorStackSize]nnueAccumulator
+	currentAccumulator uint8
+}
+
+func NewNnueNetwork(hiddenSize int) *NnueNetwork {
+	return &NnueNetwork{
+		HiddenSize:     hiddenSize,
+		FeatureWeights: make([]int16, NnueHalfKpFeatureCount*hiddenSize),
+		FeatureBiases:  make([]int16, hiddenSize),
+		OutputWeights:  make([]int16, 2*hiddenSize),
+	}
+}
+
+func LoadNnueNetwork(filePath string) (*NnueNetwork, error) {
+	networkFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer networkFile.Close()
+
+	return ReadNnueNetwork(bufio.NewReader(networkFile))
+}
+
+func ReadNnueNetwork(reader io.Reader) (*NnueNetwork, error) {
+	var header [4]uint32
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading network header: %w", err)
+	}
+
+	magic, version, featureCount, hiddenSize := header[0], header[1], header[2], header[3]
+	if magic != NnueFileMagic {
+		return nil, errors.New("not a GoFish NNUE network file")
+	}
+	if version != NnueFileVersion {
+		return nil, fmt.Errorf("unsupported network version %d", version)
+	}
+	if featureCount != NnueHalfKpFeatureCount {
+		return nil, fmt.Errorf("unsupported feature count %d, expected HalfKP (%d)", featureCount, NnueHalfKpFeatureCount)
+	}
+	if hiddenSize == 0 || hiddenSize > NnueMaximumHiddenSize {
+		return nil, fmt.Errorf("invalid hidden layer size %d", hiddenSize)
+	}
+
+	network := NewNnueNetwork(int(hiddenSize))
+	for _, weights := range []interface{}{network.FeatureWeights, network.FeatureBiases, network.OutputWeights, &network.OutputBias} {
+		if err := binary.Read(reader, binary.LittleEndian, weights); err != nil {
+			return nil, fmt.Errorf("reading network weights: %w", err)
+		}
+	}
+
+	return network, nil
+}
+
+func (network *NnueNetwork) Write(writer io.Writer) error {
+	header := [4]uint32{NnueFileMagic, NnueFileVersion, NnueHalfKpFeatureCount, uint32(network.HiddenSize)}
+	for _, data := range []interface{}{header, network.FeatureWeights, network.FeatureBiases, network.OutputWeights, network.OutputBias} {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewNnueEvaluator(network *NnueNetwork) *NnueEvaluator {
+	evaluator := &NnueEvaluator{network: network}
+	for index := range evaluator.accumulators {
+		for perspective := Black; perspective <= White; perspective++ {
+			evaluator.accumulators[index].values[perspective] = make([]int16, network.HiddenSize)
+			evaluator.accumulators[index].needsRefresh[perspective] = true
+		}
+	}
+	return evaluator
+}
+
+func (evaluator *NnueEvaluator) GetMiddleGamePieceSquareTable() *[6][64]int16 {
+	return &nnueEmptyPieceSquareTables
+}
+
+func (evaluator *NnueEvaluator) GetEndGamePieceSquareTable() *[6][64]int16 {
+	return &nnueEmptyPieceSquareTables
+}
+
+func (evaluator *NnueEvaluator) GetMiddleGamePieceValues() *[6]int16 {
+	return &nnueEmptyPieceValues
+}
+
+func (evaluator *NnueEvaluator) GetEndGamePieceValues() *[6]int16 {
+	return &nnueEmptyPieceValues
+}
+
+func (evaluator *NnueEvaluator) GetPhaseValues() *[6]int16 {
+	return &PiecePhaseIncrements
+}
+
+func (evaluator *NnueEvaluator) GetTotalPhaseWeight() int16 {
+	return TotalPhaseIncrement
+}
+
+func (evaluator *NnueEvaluator) EvaluatePosition(position *Position) int16 {
+	if isDrawnState(position) {
+		return drawScore
+	}
+
+	accumulator := &evaluator.accumulators[evaluator.currentAccumulator]
+	for perspective := Black; perspective <= White; perspective++ {
+		if accumulator.needsRefresh[perspective] {
+			evaluator.refreshAccumulator(position, accumulator, perspective)
+		}
+	}
+
+	hiddenSize := evaluator.network.HiddenSize
+	sideToMoveValues := accumulator.values[position.SideToMove]
+	opponentValues := accumulator.values[position.SideToMove^1]
+	outputWeights := evaluator.network.OutputWeights
+
+	output := int64(evaluator.network.OutputBias)
+	for neuron := 0; neuron < hiddenSize; neuron++ {
+		output += clippedRelu(sideToMoveValues[neuron]) * int64(outputWeights[neuron])
+		output += clippedRelu(opponentValues[neuron]) * int64(outputWeights[hiddenSize+neuron])
+	}
+
+	score := output * NnueOutputScale / (NnueFeatureTransformerQuantization * NnueOutputQuantization)
+	if score >= MateThreshold {
+		score = MateThreshold - 1
+	} else if score <= -MateThreshold {
+		score = -MateThreshold + 1
+	}
+
+	return int16(score)
+}
+
+func (evaluator *NnueEvaluator) refreshAccumulator(position *Position, accumulator *nnueAccumulator, perspective uint8) {
+	values := accumulator.values[perspective]
+	copy(values, evaluator.network.FeatureBiases)
+
+	kingSquare := position.PiecesBitBoard[perspective][King].MostSignificantBit()
+	for color := Black; color <= White; color++ {
+		for pieceType := Pawn; pieceType < King; pieceType++ {
+			pieceBitboard := position.PiecesBitBoard[color][pieceType]
+			for pieceBitboard != 0 {
+				square := pieceBitboard.PopMostSignificantBit()
+				evaluator.addFeature(values, halfKpFeatureIndex(perspective, kingSquare, Piece{PieceType: pieceType, Color: color}, square))
+			}
+		}
+	}
+
+	accumulator.needsRefresh[perspective] = false
+}
+
+func (evaluator *NnueEvaluator) addFeature(values []int16, featureIndex int) {
+	hiddenSize := evaluator.network.HiddenSize
+	weights := evaluator.network.FeatureWeights[featureIndex*hiddenSize : (featureIndex+1)*hiddenSize]
+	for neuron, weight := range weights {
+		values[neuron] += weight
+	}
+}
+
+func (evaluator *NnueEvaluator) subtractFeature(values []int16, featureIndex int) {
+	hiddenSize := evaluator.network.HiddenSize
+	weights := evaluator.network.FeatureWeights[featureIndex*hiddenSize : (featureIndex+1)*hiddenSize]
+	for neuron, weight := range weights {
+		values[neuron] -= weight
+	}
+}
+
+func (evaluator *NnueEvaluator) OnPositionLoaded(position *Position) {
+	evaluator.currentAccumulator = position.StateStackSize()
+	evaluator.accumulators[evaluator.currentAccumulator].needsRefresh = [2]bool{true, true}
+}
+
+func (evaluator *NnueEvaluator) OnMoveDone(position *Position, move Move) {
+	// The position may have made null moves since the last push, which don't notify the evaluator.
+	// Fill the skipped slots so that undoing back into them finds a valid accumulator.
+	destination := position.StateStackSize() + 1
+	for source := evaluator.currentAccumulator; source != destination; {
+		next := source + 1
+		if source > destination {
+			next = destination
+		}
+		evaluator.copyAccumulator(source, next)
+		source = next
+	}
+	evaluator.currentAccumulator = destination
+}
+
+func (evaluator *NnueEvaluator) copyAccumulator(source uint8, destination uint8) {
+	sourceAccumulator := &evaluator.accumulators[source]
+	destinationAccumulator := &evaluator.accumulators[destination]
+	for perspective := Black; perspective <= White; perspective++ {
+		destinationAccumulator.needsRefresh[perspective] = sourceAccumulator.needsRefresh[perspective]
+		if !sourceAccumulator.needsRefresh[perspective] {
+			copy(destinationAccumulator.values[perspective], sourceAccumulator.values[perspective])
+		}
+	}
+}
+
+func (evaluator *NnueEvaluator) OnMoveUndone(position *Position, move Move) {
+	evaluator.currentAccumulator = position.StateStackSize()
+}
+
+func (evaluator *NnueEvaluator) OnPiecePlaced(position *Position, piece Piece, square uint8) {
+	evaluator.updatePieceFeatures(position, piece, square, true)
+}
+
+func (evaluator *NnueEvaluator) OnPieceRemoved(position *Position, piece Piece, square uint8) {
+	evaluator.updatePieceFeatures(position, piece, square, false)
+}
+
+func (evaluator *NnueEvaluator) updatePieceFeatures(position *Position, piece Piece, square uint8, isAddition bool) {
+	accumulator := &evaluator.accumulators[evaluator.currentAccumulator]
+
+	// Every feature of a perspective depends on its king square, so a king move invalidates the
+	// whole accumulator of that perspective, which is rebuilt lazily on the next evaluation.
+	if piece.PieceType == King {
+		accumulator.needsRefresh[piece.Color] = true
+		return
+	}
+
+	for perspective := Black; perspective <= White; perspective++ {
+		if accumulator.needsRefresh[perspective] {
+			continue
+		}
+		kingSquare := position.PiecesBitBoard[perspective][King].MostSignificantBit()
+		featureIndex := halfKpFeatureIndex(perspective, kingSquare, piece, square)
+		if isAddition {
+			evaluator.addFeature(accumulator.values[perspective], featureIndex)
+		} else {
+			evaluator.subtractFeature(accumulator.values[perspective], featureIndex)
+		}
+	}
+}
+
+func halfKpFeatureIndex(perspective uint8, kingSquare uint8, piece Piece, square uint8) int {
+	relativeColor := 0
+	if piece.Color != perspective {
+		relativeColor = 1
+	}
+
+	pieceIndex := int(piece.PieceType)*2 + relativeColor
+	return int(orientSquare(perspective, kingSquare))*NnueHalfKpPieceFeatureCount + pieceIndex*64 + int(orientSquare(perspective, square))
+}
+
+func orientSquare(perspective uint8, square uint8) uint8 {
+	if perspective == Black {
+		return square ^ 56
+	}
+	return square
+}
+
+func clippedRelu(value int16) int64 {
+	if value < 0 {
+		return 0
+	}
+	if int64(value) > NnueFeatureTransformerQuantization {
+		return NnueFeatureTransformerQuantization
+	}
+	return int64(value)
+}
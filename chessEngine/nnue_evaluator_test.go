@@ -0,0 +1,142 @@
+package chessEngine
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+const testNnueHiddenSize = 32
+
+func newRandomNnueNetwork(random *rand.Rand) *NnueNetwork {
+	network := NewNnueNetwork(testNnueHiddenSize)
+	for index := range network.FeatureWeights {
+		network.FeatureWeights[index] = int16(random.Intn(17) - 8)
+	}
+	for index := range network.FeatureBiases {
+		network.FeatureBiases[index] = int16(random.Intn(129) - 64)
+	}
+	for index := range network.OutputWeights {
+		network.OutputWeights[index] = int16(random.Intn(129) - 64)
+	}
+	network.OutputBias = int32(random.Intn(2001) - 1000)
+	return network
+}
+
+// checkNnueAccumulator compares the incrementally updated accumulator of each perspective with a full refresh, and
+// the evaluation with the one of an evaluator which only ever refreshes.
+func checkNnueAccumulator(t *testing.T, evaluator *NnueEvaluator, position *Position) {
+	accumulator := &evaluator.accumulators[evaluator.currentAccumulator]
+	refreshedAccumulator := nnueAccumulator{values: [2][]int16{make([]int16, testNnueHiddenSize), make([]int16, testNnueHiddenSize)}}
+
+	for perspective := Black; perspective <= White; perspective++ {
+		if accumulator.needsRefresh[perspective] {
+			continue
+		}
+		evaluator.refreshAccumulator(position, &refreshedAccumulator, perspective)
+		if !slicesEqual(accumulator.values[perspective], refreshedAccumulator.values[perspective]) {
+			t.Fatalf("%s: the accumulator of perspective %d differs from a full refresh", position.GenFEN(), perspective)
+		}
+	}
+
+	refreshingEvaluator := NewNnueEvaluator(evaluator.network)
+	refreshingEvaluator.OnPositionLoaded(position)
+	if score, refreshedScore := evaluator.EvaluatePosition(position), refreshingEvaluator.EvaluatePosition(position); score != refreshedScore {
+		t.Fatalf("%s: evaluated as %d, expected %d after a full refresh", position.GenFEN(), score, refreshedScore)
+	}
+}
+
+func slicesEqual(first []int16, second []int16) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for index := range first {
+		if first[index] != second[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// playRandomMove plays a random legal move, telling whether there was one.
+func playRandomMove(position *Position, evaluator Evaluator, random *rand.Rand) (Move, bool) {
+	pseudoLegalMoves := GeneratePseudoLegalMoves(position)
+	for _, moveIndex := range random.Perm(int(pseudoLegalMoves.Size)) {
+		move := pseudoLegalMoves.Moves[moveIndex]
+		if position.DoMove(move, evaluator) {
+			return move, true
+		}
+		position.UnDoPreviousMove(move, evaluator)
+	}
+	return NullMove, false
+}
+
+func TestNnueAccumulatorMatchesRefresh(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	evaluator := NewNnueEvaluator(newRandomNnueNetwork(random))
+
+	// Random walks through the game tree, mixing moves, null moves and undos as a search does
+	for game := 0; game < 30; game++ {
+		position := &Position{}
+		position.LoadFEN(FENStartPosition, evaluator)
+		playedMoves := []Move{}
+		undoLastMove := func() {
+			lastMove := playedMoves[len(playedMoves)-1]
+			playedMoves = playedMoves[:len(playedMoves)-1]
+			if lastMove == NullMove {
+				position.unDoPreviousNullMove()
+			} else {
+				position.UnDoPreviousMove(lastMove, evaluator)
+			}
+		}
+
+		for step := 0; step < 300; step++ {
+			canUndo := len(playedMoves) > 0
+			lastMoveIsNull := canUndo && playedMoves[len(playedMoves)-1] == NullMove
+
+			switch action := random.Intn(10); {
+			case canUndo && (action < 3 || len(playedMoves) >= MaxStateStackSize/2):
+				undoLastMove()
+			case action == 3 && !lastMoveIsNull && !position.IsCurrentSideInCheck():
+				position.DoNullMove()
+				playedMoves = append(playedMoves, NullMove)
+			default:
+				if move, found := playRandomMove(position, evaluator, random); found {
+					playedMoves = append(playedMoves, move)
+				} else if canUndo {
+					undoLastMove()
+				}
+			}
+
+			checkNnueAccumulator(t, evaluator, position)
+		}
+	}
+}
+
+func TestNnueNetworkFileRoundTrip(t *testing.T) {
+	network := newRandomNnueNetwork(rand.New(rand.NewSource(2)))
+
+	var networkFile bytes.Buffer
+	if err := network.Write(&networkFile); err != nil {
+		t.Fatal(err)
+	}
+	fileContents := networkFile.Bytes()
+
+	readNetwork, err := ReadNnueNetwork(bytes.NewReader(fileContents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readNetwork.HiddenSize != network.HiddenSize || !slicesEqual(readNetwork.FeatureWeights, network.FeatureWeights) ||
+		!slicesEqual(readNetwork.FeatureBiases, network.FeatureBiases) || !slicesEqual(readNetwork.OutputWeights, network.OutputWeights) ||
+		readNetwork.OutputBias != network.OutputBias {
+		t.Error("the network read differs from the one written")
+	}
+
+	if _, err := ReadNnueNetwork(bytes.NewReader(fileContents[:len(fileContents)-1])); err == nil {
+		t.Error("a truncated network was read")
+	}
+	fileContents[0] ^= 1
+	if _, err := ReadNnueNetwork(bytes.NewReader(fileContents)); err == nil {
+		t.Error("a network with a wrong magic number was read")
+	}
+}
@@ -0,0 +1,573 @@
+package chessEngine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	PgnWhiteWinResult = "1-0"
+	PgnBlackWinResult = "0-1"
+	PgnDrawResult     = "1/2-1/2"
+	PgnUnknownResult  = "*"
+
+	pgnLineLength = 80
+
+	// pgnStartPosition is the standard start position numbered from the first move, as the FENs of PGN files are.
+	pgnStartPosition = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+)
+
+// Numeric annotation glyphs for the move assessments, written as "!", "?", "!!", "??", "!?" and "?!" in SAN.
+const (
+	GoodMoveNAG        = 1
+	MistakeNAG         = 2
+	BrilliantMoveNAG   = 3
+	BlunderNAG         = 4
+	InterestingMoveNAG = 5
+	InaccuracyNAG      = 6
+)
+
+var pgnMoveSuffixNAGs = map[string]int{
+	"!":  GoodMoveNAG,
+	"?":  MistakeNAG,
+	"!!": BrilliantMoveNAG,
+	"??": BlunderNAG,
+	"!?": InterestingMoveNAG,
+	"?!": InaccuracyNAG,
+}
+
+type PgnTag struct {
+	Name  string
+	Value string
+}
+
+// PgnMove is a move of the movetext in SAN, with its numeric annotation glyphs, the comments before and after it,
+// and the variations played instead of it.
+type PgnMove struct {
+	SAN           string
+	NAGs          []int
+	CommentBefore string
+	Comment       string
+	Variations    [][]PgnMove
+}
+
+// PgnGame is a game of a PGN file, with its tags in the order they were read and its main line.
+type PgnGame struct {
+	Tags   []PgnTag
+	Moves  []PgnMove
+	Result string
+
+	// Offset is the position in bytes of the game in the file it was read from.
+	Offset int64
+}
+
+// Tag returns the value of the tag, or an empty string if the game doesn't have it.
+func (game *PgnGame) Tag(name string) string {
+	for _, tag := range game.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// SetTag replaces the value of the tag, or adds it after the others.
+func (game *PgnGame) SetTag(name string, value string) {
+	for index := range game.Tags {
+		if game.Tags[index].Name == name {
+			game.Tags[index].Value = value
+			return
+		}
+	}
+	game.Tags = append(game.Tags, PgnTag{Name: name, Value: value})
+}
+
+// StartingFEN returns the position the game starts from, given by the FEN tag or the standard start position.
+func (game *PgnGame) StartingFEN() string {
+	if fen := game.Tag("FEN"); fen != "" {
+		return fen
+	}
+	return pgnStartPosition
+}
+
+// getStartingMoveNumber returns the number of the first move and whether white plays it, from the FEN tag.
+func (game *PgnGame) getStartingMoveNumber() (int, bool) {
+	fenFields := strings.Fields(game.StartingFEN())
+	moveNumber := 1
+	if len(fenFields) >= 6 {
+		if fullMove, err := strconv.Atoi(fenFields[5]); err == nil && fullMove > 1 {
+			moveNumber = fullMove
+		}
+	}
+	return moveNumber, len(fenFields) < 2 || fenFields[1] != "b"
+}
+
+// getMoveNumber returns the number of the move played at the ply of the main line, counted from 0.
+func (game *PgnGame) getMoveNumber(ply int) int {
+	moveNumber, whiteStarts := game.getStartingMoveNumber()
+	if !whiteStarts {
+		ply++
+	}
+	return moveNumber + ply/2
+}
+
+// String writes the game in the PGN export format: the tags, an empty line and the movetext wrapped at 80
+// characters, ending with the result.
+func (game PgnGame) String() string {
+	var sb strings.Builder
+	for _, tag := range game.Tags {
+		value := strings.ReplaceAll(strings.ReplaceAll(tag.Value, `\`, `\\`), `"`, `\"`)
+		fmt.Fprintf(&sb, "[%s \"%s\"]\n", tag.Name, value)
+	}
+	sb.WriteString("\n")
+
+	moveNumber, whiteToMove := game.getStartingMoveNumber()
+	tokens := appendPgnMoveTokens(nil, game.Moves, moveNumber, whiteToMove)
+	result := game.Result
+	if result == "" {
+		result = PgnUnknownResult
+	}
+	tokens = append(tokens, result)
+
+	lineLength := 0
+	for _, token := range tokens {
+		if lineLength > 0 && lineLength+1+len(token) > pgnLineLength {
+			sb.WriteString("\n")
+			lineLength = 0
+		} else if lineLength > 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+		sb.WriteString(token)
+		lineLength += len(token)
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func formatPgnComment(comment string) string {
+	return "{" + strings.ReplaceAll(comment, "}", ")") + "}"
+}
+
+// appendPgnMoveTokens writes the moves as movetext tokens, numbering the white moves, and the black moves which
+// follow a comment or a variation.
+func appendPgnMoveTokens(tokens []string, moves []PgnMove, moveNumber int, whiteToMove bool) []string {
+	needsNumber := true
+	for _, move := range moves {
+		if move.CommentBefore != "" {
+			tokens = append(tokens, formatPgnComment(move.CommentBefore))
+			needsNumber = true
+		}
+
+		if whiteToMove {
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		} else if needsNumber {
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, move.SAN)
+		needsNumber = false
+
+		for _, nag := range move.NAGs {
+			tokens = append(tokens, fmt.Sprintf("$%d", nag))
+		}
+		if move.Comment != "" {
+			tokens = append(tokens, formatPgnComment(move.Comment))
+			needsNumber = true
+		}
+		for _, variation := range move.Variations {
+			variationTokens := appendPgnMoveTokens(nil, variation, moveNumber, whiteToMove)
+			if len(variationTokens) > 0 {
+				variationTokens[0] = "(" + variationTokens[0]
+				variationTokens[len(variationTokens)-1] += ")"
+			}
+			tokens = append(tokens, variationTokens...)
+			needsNumber = true
+		}
+
+		if !whiteToMove {
+			moveNumber++
+		}
+		whiteToMove = !whiteToMove
+	}
+	return tokens
+}
+
+type pgnTokenType uint8
+
+const (
+	pgnEndOfFile pgnTokenType = iota
+	pgnTagStart
+	pgnTagEnd
+	pgnString
+	pgnComment
+	pgnVariationStart
+	pgnVariationEnd
+	pgnNAG
+	pgnSymbol
+)
+
+type pgnToken struct {
+	tokenType  pgnTokenType
+	value      string
+	lineNumber int
+	offset     int64
+}
+
+// PgnReader reads the games of a PGN file one at a time, so that large databases can be processed as a stream.
+type PgnReader struct {
+	reader       *bufio.Reader
+	lineNumber   int
+	atLineStart  bool
+	pendingToken *pgnToken
+	offset       int64
+	lastRuneSize int
+}
+
+func NewPgnReader(reader io.Reader) *PgnReader {
+	return &PgnReader{reader: bufio.NewReader(reader), lineNumber: 1, atLineStart: true}
+}
+
+// ReadPgnGameAt reads the game found at the offset of the file, as given by PgnGame.Offset.
+func ReadPgnGameAt(file io.ReadSeeker, offset int64) (PgnGame, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return PgnGame{}, err
+	}
+
+	pgnReader := NewPgnReader(file)
+	pgnReader.offset = offset
+	game, err := pgnReader.ReadGame()
+	if err == io.EOF {
+		return game, fmt.Errorf("no game at offset %d", offset)
+	}
+	return game, err
+}
+
+func (pgnReader *PgnReader) readRune() (rune, bool) {
+	character, size, err := pgnReader.reader.ReadRune()
+	if err != nil {
+		return 0, false
+	}
+
+	pgnReader.offset += int64(size)
+	pgnReader.lastRuneSize = size
+	pgnReader.atLineStart = character == '\n'
+	if character == '\n' {
+		pgnReader.lineNumber++
+	}
+	return character, true
+}
+
+// unreadRune puts back the last character read, restoring whether the reader was at the start of a line before it.
+func (pgnReader *PgnReader) unreadRune(character rune, atLineStart bool) {
+	if pgnReader.reader.UnreadRune() != nil {
+		return
+	}
+	pgnReader.offset -= int64(pgnReader.lastRuneSize)
+	pgnReader.atLineStart = atLineStart
+	if character == '\n' {
+		pgnReader.lineNumber--
+	}
+}
+
+func (pgnReader *PgnReader) skipLine() {
+	for {
+		character, ok := pgnReader.readRune()
+		if !ok || character == '\n' {
+			return
+		}
+	}
+}
+
+func isPgnSymbolCharacter(character rune) bool {
+	return unicode.IsLetter(character) || unicode.IsDigit(character) || strings.ContainsRune("_+#=:-/.*!?", character)
+}
+
+func (pgnReader *PgnReader) nextToken() (pgnToken, error) {
+	if pgnReader.pendingToken != nil {
+		token := *pgnReader.pendingToken
+		pgnReader.pendingToken = nil
+		return token, nil
+	}
+
+	for {
+		atLineStart, offset := pgnReader.atLineStart, pgnReader.offset
+		character, ok := pgnReader.readRune()
+		if !ok {
+			return pgnToken{tokenType: pgnEndOfFile, lineNumber: pgnReader.lineNumber, offset: offset}, nil
+		}
+		token := pgnToken{lineNumber: pgnReader.lineNumber, offset: offset}
+
+		switch {
+		case unicode.IsSpace(character) || character == '\ufeff':
+			continue
+		case character == '%' && atLineStart:
+			pgnReader.skipLine()
+			continue
+		case character == ';':
+			pgnReader.skipLine()
+			continue
+		case character == '[':
+			token.tokenType = pgnTagStart
+		case character == ']':
+			token.tokenType = pgnTagEnd
+		case character == '(':
+			token.tokenType = pgnVariationStart
+		case character == ')':
+			token.tokenType = pgnVariationEnd
+		case character == '{':
+			token.tokenType = pgnComment
+			var sb strings.Builder
+			for {
+				character, ok = pgnReader.readRune()
+				if !ok {
+					return token, fmt.Errorf("line %d: unterminated comment", token.lineNumber)
+				}
+				if character == '}' {
+					break
+				}
+				sb.WriteRune(character)
+			}
+			token.value = strings.Join(strings.Fields(sb.String()), " ")
+		case character == '"':
+			token.tokenType = pgnString
+			var sb strings.Builder
+			for {
+				character, ok = pgnReader.readRune()
+				if !ok || character == '\n' {
+					return token, fmt.Errorf("line %d: unterminated string", token.lineNumber)
+				}
+				if character == '"' {
+					break
+				}
+				if character == '\\' {
+					if character, ok = pgnReader.readRune(); !ok {
+						return token, fmt.Errorf("line %d: unterminated string", token.lineNumber)
+					}
+				}
+				sb.WriteRune(character)
+			}
+			token.value = sb.String()
+		case character == '$':
+			token.tokenType = pgnNAG
+			token.value = pgnReader.readSymbolRest("")
+		case isPgnSymbolCharacter(character):
+			token.tokenType = pgnSymbol
+			token.value = pgnReader.readSymbolRest(string(character))
+		default:
+			return token, fmt.Errorf("line %d: unexpected character %q", token.lineNumber, character)
+		}
+		return token, nil
+	}
+}
+
+func (pgnReader *PgnReader) readSymbolRest(symbol string) string {
+	for {
+		character, ok := pgnReader.readRune()
+		if !ok {
+			return symbol
+		}
+		if !isPgnSymbolCharacter(character) {
+			pgnReader.unreadRune(character, false)
+			return symbol
+		}
+		symbol += string(character)
+	}
+}
+
+func (pgnReader *PgnReader) unreadToken(token pgnToken) {
+	pgnReader.pendingToken = &token
+}
+
+// ReadGame returns the next game, or io.EOF once there are no more games. After a malformed game, the error tells
+// its line and the reader skips to the next game, so that the following games can still be read.
+func (pgnReader *PgnReader) ReadGame() (PgnGame, error) {
+	game := PgnGame{Result: PgnUnknownResult}
+
+	token, err := pgnReader.nextToken()
+	game.Offset = token.offset
+	for err == nil && token.tokenType == pgnTagStart {
+		var tag PgnTag
+		if tag, err = pgnReader.readTag(); err == nil {
+			game.Tags = append(game.Tags, tag)
+			token, err = pgnReader.nextToken()
+		}
+	}
+
+	if err == nil {
+		if token.tokenType == pgnEndOfFile && len(game.Tags) == 0 {
+			return game, io.EOF
+		}
+		pgnReader.unreadToken(token)
+		game.Moves, game.Result, err = pgnReader.readMoves(0)
+	}
+
+	if err != nil {
+		pgnReader.skipToNextGame()
+		return game, err
+	}
+	if tagResult := game.Tag("Result"); game.Result == PgnUnknownResult && tagResult != "" {
+		game.Result = tagResult
+	}
+	return game, nil
+}
+
+func (pgnReader *PgnReader) readTag() (PgnTag, error) {
+	name, err := pgnReader.nextToken()
+	if err != nil {
+		return PgnTag{}, err
+	}
+	value, err := pgnReader.nextToken()
+	if err != nil {
+		return PgnTag{}, err
+	}
+	end, err := pgnReader.nextToken()
+	if err != nil {
+		return PgnTag{}, err
+	}
+
+	if name.tokenType != pgnSymbol || value.tokenType != pgnString || end.tokenType != pgnTagEnd {
+		return PgnTag{}, fmt.Errorf("line %d: malformed tag", name.lineNumber)
+	}
+	return PgnTag{Name: name.value, Value: value.value}, nil
+}
+
+func isPgnResult(symbol string) bool {
+	return symbol == PgnWhiteWinResult || symbol == PgnBlackWinResult || symbol == PgnDrawResult || symbol == PgnUnknownResult
+}
+
+// readMoves reads a line of moves, the main line at depth 0 ending with the result, the start of the next game or
+// the end of the file, and a variation ending with its closing parenthesis.
+func (pgnReader *PgnReader) readMoves(depth int) ([]PgnMove, string, error) {
+	moves := []PgnMove{}
+	pendingComment := ""
+
+	for {
+		token, err := pgnReader.nextToken()
+		if err != nil {
+			return moves, "", err
+		}
+
+		switch token.tokenType {
+		case pgnEndOfFile:
+			if depth > 0 {
+				return moves, "", fmt.Errorf("line %d: unterminated variation", token.lineNumber)
+			}
+			return moves, PgnUnknownResult, nil
+		case pgnTagStart:
+			pgnReader.unreadToken(token)
+			if depth > 0 {
+				return moves, "", fmt.Errorf("line %d: unterminated variation", token.lineNumber)
+			}
+			return moves, PgnUnknownResult, nil
+		case pgnVariationEnd:
+			if depth == 0 {
+				return moves, "", fmt.Errorf("line %d: unexpected )", token.lineNumber)
+			}
+			return moves, "", nil
+		case pgnComment:
+			if len(moves) == 0 || pendingComment != "" {
+				pendingComment = strings.TrimSpace(pendingComment + " " + token.value)
+			} else {
+				lastMove := &moves[len(moves)-1]
+				lastMove.Comment = strings.TrimSpace(lastMove.Comment + " " + token.value)
+			}
+		case pgnNAG:
+			nag, err := strconv.Atoi(token.value)
+			if err != nil || len(moves) == 0 {
+				return moves, "", fmt.Errorf("line %d: unexpected NAG $%s", token.lineNumber, token.value)
+			}
+			moves[len(moves)-1].NAGs = append(moves[len(moves)-1].NAGs, nag)
+		case pgnVariationStart:
+			if len(moves) == 0 {
+				return moves, "", fmt.Errorf("line %d: variation without a move to replace", token.lineNumber)
+			}
+			variation, _, err := pgnReader.readMoves(depth + 1)
+			if err != nil {
+				return moves, "", err
+			}
+			moves[len(moves)-1].Variations = append(moves[len(moves)-1].Variations, variation)
+		case pgnSymbol:
+			if isPgnResult(token.value) {
+				if depth > 0 {
+					continue
+				}
+				return moves, token.value, nil
+			}
+
+			// Move numbers may be glued to the move, as in "12.e4", or stand alone, as in "12..." before a black move.
+			san := token.value
+			if withoutNumber := strings.TrimLeft(san, "0123456789"); withoutNumber != san && strings.HasPrefix(withoutNumber, ".") {
+				san = strings.TrimLeft(withoutNumber, ".")
+			}
+			if san == "" {
+				continue
+			}
+
+			if nag, ok := pgnMoveSuffixNAGs[san]; ok {
+				if len(moves) == 0 {
+					return moves, "", fmt.Errorf("line %d: unexpected %s", token.lineNumber, san)
+				}
+				moves[len(moves)-1].NAGs = append(moves[len(moves)-1].NAGs, nag)
+				continue
+			}
+
+			move := PgnMove{SAN: strings.TrimRight(san, "!?"), CommentBefore: pendingComment}
+			if nag, ok := pgnMoveSuffixNAGs[san[len(move.SAN):]]; ok {
+				move.NAGs = append(move.NAGs, nag)
+			}
+			moves = append(moves, move)
+			pendingComment = ""
+		default:
+			return moves, "", fmt.Errorf("line %d: unexpected token in the movetext", token.lineNumber)
+		}
+	}
+}
+
+// skipToNextGame drops the rest of a malformed game, up to the tags of the next game.
+func (pgnReader *PgnReader) skipToNextGame() {
+	if pgnReader.pendingToken != nil && pgnReader.pendingToken.tokenType == pgnTagStart {
+		return
+	}
+	pgnReader.pendingToken = nil
+	for {
+		atLineStart := pgnReader.atLineStart
+		character, ok := pgnReader.readRune()
+		if !ok {
+			return
+		}
+		if character == '[' && atLineStart {
+			pgnReader.unreadRune(character, atLineStart)
+			return
+		}
+	}
+}
+
+// ReplayPgnGame sets the position up at the start of the game and plays its main line, calling the visitor with
+// the position before each move, which the visitor mustn't change, and the move to play. It fails on the first
+// illegal move, or with the error of the visitor.
+func ReplayPgnGame(game *PgnGame, position *Position, evaluator Evaluator, visit func(position *Position, ply int, move Move) error) error {
+	if err := ValidateFEN(game.StartingFEN()); err != nil {
+		return err
+	}
+	position.LoadFEN(game.StartingFEN(), evaluator)
+
+	for ply, pgnMove := range game.Moves {
+		move, err := ParseSANMove(position, pgnMove.SAN, evaluator)
+		if err != nil {
+			return fmt.Errorf("move %d: %w", game.getMoveNumber(ply), err)
+		}
+
+		if visit != nil {
+			if err := visit(position, ply, move); err != nil {
+				return err
+			}
+		}
+		position.DoGameMove(move, evaluator)
+	}
+	return nil
+}
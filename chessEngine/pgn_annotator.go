@@ -0,0 +1,450 @@
+package chessEngine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	CentipawnLossMeasure      = "cp"
+	WinProbabilityLossMeasure = "winprob"
+
+	DefaultAnnotationDepth          = 12
+	DefaultAnnotationVariationPlies = 8
+	DefaultAnnotationHashMB         = 64
+
+	// The centipawn thresholds are the classic ones, and the win probability ones, in percentage points, match the
+	// winning chances used by Lichess.
+	DefaultCentipawnInaccuracy      = 50
+	DefaultCentipawnMistake         = 100
+	DefaultCentipawnBlunder         = 300
+	DefaultWinProbabilityInaccuracy = 5
+	DefaultWinProbabilityMistake    = 10
+	DefaultWinProbabilityBlunder    = 15
+
+	// Scores beyond the cap, including mates, are decided positions which don't lose more by getting larger.
+	annotationScoreCap = 1000
+)
+
+type AnnotationSettings struct {
+	InputFilePath          string
+	OutputFilePath         string
+	Depth                  uint8
+	MoveTime               int64
+	NodeCount              uint64
+	Measure                string
+	InaccuracyThreshold    float64
+	MistakeThreshold       float64
+	BlunderThreshold       float64
+	VariationPlies         int
+	TranspositionTableSize uint64
+}
+
+func DefaultAnnotationSettings() AnnotationSettings {
+	settings := AnnotationSettings{
+		Depth:                  DefaultAnnotationDepth,
+		Measure:                WinProbabilityLossMeasure,
+		VariationPlies:         DefaultAnnotationVariationPlies,
+		TranspositionTableSize: DefaultAnnotationHashMB,
+	}
+	settings.applyDefaultThresholds()
+	return settings
+}
+
+// ParseAnnotationSettings reads the input PGN file followed by "<name> <value>" pairs, e.g.
+// "games.pgn output annotated.pgn depth 14 measure cp blunder 250". The output defaults to the input file name with
+// an "_annotated" suffix, and the thresholds to those of the measure.
+func ParseAnnotationSettings(command string) (AnnotationSettings, error) {
+	settings := DefaultAnnotationSettings()
+	commandFields := strings.Fields(command)
+
+	// The thresholds which aren't given default to those of the measure, which is only known once all are read
+	settings.InaccuracyThreshold, settings.MistakeThreshold, settings.BlunderThreshold = 0, 0, 0
+
+	if len(commandFields)%2 != 1 {
+		return settings, errors.New("expected the input PGN file followed by <name> <value> pairs")
+	}
+	settings.InputFilePath = commandFields[0]
+
+	for index := 1; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "output":
+			settings.OutputFilePath = value
+		case "depth":
+			var depth uint64
+			depth, err = strconv.ParseUint(value, 10, 8)
+			settings.Depth = uint8(depth)
+		case "movetime":
+			settings.MoveTime, err = strconv.ParseInt(value, 10, 64)
+		case "nodes":
+			settings.NodeCount, err = strconv.ParseUint(value, 10, 64)
+		case "measure":
+			settings.Measure = value
+			if value != CentipawnLossMeasure && value != WinProbabilityLossMeasure {
+				err = errors.New("unknown measure")
+			}
+		case "inaccuracy":
+			settings.InaccuracyThreshold, err = strconv.ParseFloat(value, 64)
+		case "mistake":
+			settings.MistakeThreshold, err = strconv.ParseFloat(value, 64)
+		case "blunder":
+			settings.BlunderThreshold, err = strconv.ParseFloat(value, 64)
+		case "pvPlies":
+			settings.VariationPlies, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.OutputFilePath == "" {
+		settings.OutputFilePath = strings.TrimSuffix(settings.InputFilePath, ".pgn") + "_annotated.pgn"
+	}
+	settings.applyDefaultThresholds()
+
+	if settings.Depth < 1 || settings.Depth > MaxDepth || settings.MoveTime < 0 || settings.VariationPlies < 0 || settings.TranspositionTableSize < 1 {
+		return settings, fmt.Errorf("depth must be between 1 and %d, movetime and pvPlies not negative and hash at least 1", MaxDepth)
+	}
+	if settings.InaccuracyThreshold <= 0 || settings.MistakeThreshold < settings.InaccuracyThreshold || settings.BlunderThreshold < settings.MistakeThreshold {
+		return settings, errors.New("the thresholds must be positive, and increase from inaccuracy to mistake to blunder")
+	}
+
+	return settings, nil
+}
+
+func (settings *AnnotationSettings) applyDefaultThresholds() {
+	inaccuracy, mistake, blunder := float64(DefaultWinProbabilityInaccuracy), float64(DefaultWinProbabilityMistake), float64(DefaultWinProbabilityBlunder)
+	if settings.Measure == CentipawnLossMeasure {
+		inaccuracy, mistake, blunder = DefaultCentipawnInaccuracy, DefaultCentipawnMistake, DefaultCentipawnBlunder
+	}
+
+	if settings.InaccuracyThreshold == 0 {
+		settings.InaccuracyThreshold = inaccuracy
+	}
+	if settings.MistakeThreshold == 0 {
+		settings.MistakeThreshold = mistake
+	}
+	if settings.BlunderThreshold == 0 {
+		settings.BlunderThreshold = blunder
+	}
+}
+
+// PlayerAccuracy sums up the moves of a player. The accuracy is the average of the accuracies of the moves, each
+// derived from the win probability it lost as Lichess does, from 100 for the best move down to 0.
+type PlayerAccuracy struct {
+	Name                 string
+	Moves                int
+	Accuracy             float64
+	AverageCentipawnLoss float64
+	Inaccuracies         int
+	Mistakes             int
+	Blunders             int
+}
+
+func (accuracy *PlayerAccuracy) add(other PlayerAccuracy) {
+	totalMoves := accuracy.Moves + other.Moves
+	if totalMoves == 0 {
+		return
+	}
+
+	accuracy.Accuracy = (accuracy.Accuracy*float64(accuracy.Moves) + other.Accuracy*float64(other.Moves)) / float64(totalMoves)
+	accuracy.AverageCentipawnLoss = (accuracy.AverageCentipawnLoss*float64(accuracy.Moves) + other.AverageCentipawnLoss*float64(other.Moves)) / float64(totalMoves)
+	accuracy.Moves = totalMoves
+	accuracy.Inaccuracies += other.Inaccuracies
+	accuracy.Mistakes += other.Mistakes
+	accuracy.Blunders += other.Blunders
+}
+
+func (accuracy PlayerAccuracy) String() string {
+	return fmt.Sprintf("%s: accuracy %.1f%%, average centipawn loss %.0f, %d inaccuracies, %d mistakes, %d blunders over %d moves",
+		accuracy.Name, accuracy.Accuracy, accuracy.AverageCentipawnLoss, accuracy.Inaccuracies, accuracy.Mistakes, accuracy.Blunders, accuracy.Moves)
+}
+
+// annotatedPosition is the result of the search of a position of the game, with the score from the point of view
+// of the side to move.
+type annotatedPosition struct {
+	score    SearchInfo
+	bestMove Move
+	bestSAN  string
+	bestLine []string
+}
+
+// getWinProbability converts a score in centipawns, from the point of view of the side to move, into its winning
+// chances in percent, with the model fitted by Lichess on rated games.
+func getWinProbability(centipawns int) float64 {
+	return 50 + 50*(2/(1+math.Exp(-0.00368208*float64(centipawns)))-1)
+}
+
+// getMoveAccuracy converts the win probability lost by a move into its accuracy in percent.
+func getMoveAccuracy(winProbabilityLoss float64) float64 {
+	accuracy := 103.1668*math.Exp(-0.04354*math.Max(winProbabilityLoss, 0)) - 3.1669
+	return math.Max(math.Min(accuracy, 100), 0)
+}
+
+// getCappedScore returns the score of the search in centipawns within the cap, mates being at the cap.
+func getCappedScore(searchInfo SearchInfo) int {
+	if searchInfo.ScoreType == MateScoreType {
+		if searchInfo.Score > 0 {
+			return annotationScoreCap
+		}
+		return -annotationScoreCap
+	}
+	return max(min(searchInfo.Score, annotationScoreCap), -annotationScoreCap)
+}
+
+// formatAnnotationScore writes a score from the point of view of white, in pawns or as a mate distance, as Lichess
+// does in its eval comments, e.g. "0.35", "-1.20" or "#-3".
+func formatAnnotationScore(searchInfo SearchInfo) string {
+	if searchInfo.ScoreType == MateScoreType {
+		return fmt.Sprintf("#%d", searchInfo.Score)
+	}
+	return fmt.Sprintf("%.2f", float64(searchInfo.Score)/100)
+}
+
+func getWhitePointOfView(searchInfo SearchInfo, sideToMove uint8) SearchInfo {
+	if sideToMove == Black {
+		searchInfo.Score = -searchInfo.Score
+	}
+	return searchInfo
+}
+
+// searchAnnotatedPosition searches the current position of the game searcher, or scores it directly once the game
+// is over.
+func searchAnnotatedPosition(gameSearcher GameSearcher, evaluator Evaluator, settings AnnotationSettings, latestInfo *SearchInfo) annotatedPosition {
+	position := gameSearcher.Position()
+	if GenerateLegalMoves(position, evaluator).Size == 0 {
+		if position.IsCurrentSideInCheck() {
+			return annotatedPosition{score: SearchInfo{ScoreType: MateScoreType, Score: 0}}
+		}
+		return annotatedPosition{score: SearchInfo{ScoreType: CentipawnScoreType}}
+	}
+
+	nodeCount := settings.NodeCount
+	if nodeCount == 0 {
+		nodeCount = math.MaxUint64
+	}
+
+	*latestInfo = SearchInfo{ScoreType: CentipawnScoreType}
+	gameSearcher.InitializeTimeManager(InfiniteTime, NoValue, settings.MoveTime, NoValue, settings.Depth, nodeCount)
+	bestMove := gameSearcher.StartSearch(evaluator)
+
+	result := annotatedPosition{score: *latestInfo, bestMove: bestMove}
+	if bestMove != NullMove {
+		result.bestSAN = ConvertMoveToSAN(position, bestMove, evaluator)
+		bestLine := latestInfo.PV
+		if len(bestLine) == 0 || bestLine[0] != bestMove.String() {
+			bestLine = []string{bestMove.String()}
+		}
+		result.bestLine = ConvertUciLineToSAN(position, bestLine[:min(len(bestLine), settings.VariationPlies)], evaluator)
+	}
+	return result
+}
+
+// AnnotateGame searches every position of the main line of the game and annotates its moves: each move gets an
+// eval comment with the score after it, from the point of view of white, and the moves losing at least the
+// thresholds are marked as inaccuracies, mistakes or blunders, with the best line as a variation. It returns the
+// summaries of the players, indexed by color.
+func AnnotateGame(game *PgnGame, gameSearcher GameSearcher, evaluator Evaluator, settings AnnotationSettings) ([2]PlayerAccuracy, error) {
+	summaries := [2]PlayerAccuracy{{Name: game.Tag("Black")}, {Name: game.Tag("White")}}
+	if summaries[White].Name == "" {
+		summaries[White].Name = "White"
+	}
+	if summaries[Black].Name == "" {
+		summaries[Black].Name = "Black"
+	}
+	if len(game.Moves) >= MaximumNumberOfPlies-1 {
+		return summaries, fmt.Errorf("games longer than %d plies can't be annotated", MaximumNumberOfPlies-2)
+	}
+
+	infoOutputSearcher, ok := gameSearcher.(interface{ SetInfoOutput(io.Writer) })
+	if !ok {
+		return summaries, errors.New("the game searcher doesn't report the scores of its searches")
+	}
+	latestInfo := SearchInfo{}
+	infoOutputSearcher.SetInfoOutput(&searchInfoWriter{onLine: func(line string) {
+		if searchInfo, ok := ParseSearchInfo(line); ok && searchInfo.MultiPV == 1 {
+			latestInfo = searchInfo
+		}
+	}})
+	defer infoOutputSearcher.SetInfoOutput(io.Discard)
+
+	if err := ValidateFEN(game.StartingFEN()); err != nil {
+		return summaries, err
+	}
+	gameSearcher.ResetToNewGame()
+	gameSearcher.InitializeSearchInfo(game.StartingFEN(), evaluator)
+	position := gameSearcher.Position()
+
+	positions := make([]annotatedPosition, 0, len(game.Moves)+1)
+	sidesToMove := make([]uint8, 0, len(game.Moves)+1)
+	playedMoves := make([]Move, 0, len(game.Moves))
+	for ply, pgnMove := range game.Moves {
+		move, err := ParseSANMove(position, pgnMove.SAN, evaluator)
+		if err != nil {
+			return summaries, fmt.Errorf("move %d: %w", game.getMoveNumber(ply), err)
+		}
+
+		sidesToMove = append(sidesToMove, position.SideToMove)
+		positions = append(positions, searchAnnotatedPosition(gameSearcher, evaluator, settings, &latestInfo))
+		playedMoves = append(playedMoves, move)
+		applyGameMove(gameSearcher, move, evaluator)
+	}
+	sidesToMove = append(sidesToMove, position.SideToMove)
+	positions = append(positions, searchAnnotatedPosition(gameSearcher, evaluator, settings, &latestInfo))
+
+	for ply := range game.Moves {
+		mover := sidesToMove[ply]
+		before, after := positions[ply].score, positions[ply+1].score
+
+		// The score after the move is negated once capped, so that a mate delivered, scored as mate 0 for the mated
+		// side, is a win for the mover.
+		scoreBefore, scoreAfter := getCappedScore(before), -getCappedScore(after)
+		centipawnLoss := max(scoreBefore-scoreAfter, 0)
+		winProbabilityLoss := math.Max(getWinProbability(scoreBefore)-getWinProbability(scoreAfter), 0)
+		if playedMoves[ply].IsSameMove(positions[ply].bestMove) {
+			centipawnLoss, winProbabilityLoss = 0, 0
+		}
+
+		summary := &summaries[mover]
+		summary.Moves++
+		summary.Accuracy += getMoveAccuracy(winProbabilityLoss)
+		summary.AverageCentipawnLoss += float64(centipawnLoss)
+
+		loss := winProbabilityLoss
+		if settings.Measure == CentipawnLossMeasure {
+			loss = float64(centipawnLoss)
+		}
+
+		// Checkmating moves get no eval comment, as there is no score left to give.
+		pgnMove := &game.Moves[ply]
+		comment := ""
+		if after.ScoreType != MateScoreType || after.Score != 0 {
+			comment = fmt.Sprintf("[%%eval %s]", formatAnnotationScore(getWhitePointOfView(after, sidesToMove[ply+1])))
+		}
+
+		assessment, nag := "", 0
+		switch {
+		case loss >= settings.BlunderThreshold:
+			assessment, nag = "Blunder", BlunderNAG
+			summary.Blunders++
+		case loss >= settings.MistakeThreshold:
+			assessment, nag = "Mistake", MistakeNAG
+			summary.Mistakes++
+		case loss >= settings.InaccuracyThreshold:
+			assessment, nag = "Inaccuracy", InaccuracyNAG
+			summary.Inaccuracies++
+		}
+
+		if nag != 0 {
+			comment += fmt.Sprintf(" %s (%s -> %s). %s was best.", assessment,
+				formatAnnotationScore(getWhitePointOfView(before, mover)),
+				formatAnnotationScore(getWhitePointOfView(after, sidesToMove[ply+1])),
+				positions[ply].bestSAN)
+			pgnMove.NAGs = append(removeMoveAssessmentNAGs(pgnMove.NAGs), nag)
+
+			if len(positions[ply].bestLine) > 0 {
+				variation := make([]PgnMove, len(positions[ply].bestLine))
+				for index, san := range positions[ply].bestLine {
+					variation[index] = PgnMove{SAN: san}
+				}
+				pgnMove.Variations = append(pgnMove.Variations, variation)
+			}
+		}
+		pgnMove.Comment = strings.TrimSpace(pgnMove.Comment + " " + comment)
+	}
+
+	for color := range summaries {
+		if summaries[color].Moves > 0 {
+			summaries[color].Accuracy /= float64(summaries[color].Moves)
+			summaries[color].AverageCentipawnLoss /= float64(summaries[color].Moves)
+		}
+	}
+
+	game.SetTag("Annotator", "GoFish")
+	game.SetTag("WhiteAccuracy", fmt.Sprintf("%.1f", summaries[White].Accuracy))
+	game.SetTag("BlackAccuracy", fmt.Sprintf("%.1f", summaries[Black].Accuracy))
+	return summaries, nil
+}
+
+// removeMoveAssessmentNAGs drops the glyphs assessing the move, from "!" to "?!", since a move has a single
+// assessment and the one of the engine replaces them.
+func removeMoveAssessmentNAGs(nags []int) []int {
+	remainingNAGs := []int{}
+	for _, nag := range nags {
+		if nag < GoodMoveNAG || nag > InaccuracyNAG {
+			remainingNAGs = append(remainingNAGs, nag)
+		}
+	}
+	return remainingNAGs
+}
+
+// AnnotatePgnFile annotates the games of the input file into the output file, writing the summaries of the players
+// of each game to the output as it goes, followed by the summary of each player over all the games. Games which
+// can't be annotated, such as those with illegal moves, are reported and copied unchanged.
+func AnnotatePgnFile(settings AnnotationSettings, gameSearcher GameSearcher, evaluator Evaluator, output io.Writer) error {
+	inputFile, err := os.Open(settings.InputFilePath)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	outputFile, err := os.Create(settings.OutputFilePath)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	playerNames := []string{}
+	playerSummaries := map[string]*PlayerAccuracy{}
+	pgnReader := NewPgnReader(inputFile)
+
+	for gameNumber := 1; ; gameNumber++ {
+		game, err := pgnReader.ReadGame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(output, "Game %d: skipped, %v\n", gameNumber, err)
+			continue
+		}
+
+		summaries, err := AnnotateGame(&game, gameSearcher, evaluator, settings)
+		if err != nil {
+			fmt.Fprintf(output, "Game %d: not annotated, %v\n", gameNumber, err)
+		} else {
+			fmt.Fprintf(output, "Game %d: %s - %s %s\n", gameNumber, summaries[White].Name, summaries[Black].Name, game.Result)
+			for _, color := range []uint8{White, Black} {
+				fmt.Fprintf(output, "  %s\n", summaries[color])
+
+				if _, found := playerSummaries[summaries[color].Name]; !found {
+					playerNames = append(playerNames, summaries[color].Name)
+					playerSummaries[summaries[color].Name] = &PlayerAccuracy{Name: summaries[color].Name}
+				}
+				playerSummaries[summaries[color].Name].add(summaries[color])
+			}
+		}
+
+		if _, err := fmt.Fprintln(outputFile, game); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(output, "Players:")
+	for _, name := range playerNames {
+		fmt.Fprintf(output, "  %s\n", playerSummaries[name])
+	}
+	return nil
+}
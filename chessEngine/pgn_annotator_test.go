@@ -0,0 +1,96 @@
+package chessEngine
+
+import (
+	"strings"
+	"testing"
+)
+
+func readTestPgnGame(t *testing.T, pgn string) PgnGame {
+	game, err := NewPgnReader(strings.NewReader(pgn)).ReadGame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+func TestAnnotateGameCheckmatingMoves(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+
+	settings := DefaultAnnotationSettings()
+	settings.Depth = 4
+
+	// Both rooks mate on the back rank, only one of them being the first choice of the engine
+	for _, checkmatingMove := range []string{"Re8#", "Ra8#"} {
+		game := readTestPgnGame(t, `[FEN "6k1/5ppp/8/8/8/8/8/R3R1K1 w - - 0 1"]
+[SetUp "1"]
+
+1. `+checkmatingMove+` 1-0
+`)
+
+		summaries, err := AnnotateGame(&game, searcher, evaluator, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if move := game.Moves[0]; len(move.NAGs) != 0 || move.Comment != "" {
+			t.Errorf("%s was annotated with %v %q", checkmatingMove, move.NAGs, move.Comment)
+		}
+		if summaries[White].Accuracy < 99.9 || summaries[White].Blunders != 0 {
+			t.Errorf("%s was summarized as %v", checkmatingMove, summaries[White])
+		}
+	}
+}
+
+func TestAnnotateGameBlunder(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+
+	settings := DefaultAnnotationSettings()
+	settings.Depth = 4
+
+	// Instead of taking the rook, white puts the queen where the rook takes it
+	game := readTestPgnGame(t, `[FEN "3r2k1/5ppp/8/8/8/8/5PPP/3Q2K1 w - - 0 1"]
+[SetUp "1"]
+
+1. Qd4 Rxd4 *
+`)
+
+	summaries, err := AnnotateGame(&game, searcher, evaluator, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blunder := game.Moves[0]
+	if len(blunder.NAGs) != 1 || blunder.NAGs[0] != BlunderNAG || len(blunder.Variations) != 1 || blunder.Variations[0][0].SAN != "Qxd8#" && blunder.Variations[0][0].SAN != "Qxd8+" {
+		t.Errorf("Qd4 was annotated with %v %q %v", blunder.NAGs, blunder.Comment, blunder.Variations)
+	}
+	if !strings.Contains(blunder.Comment, "Blunder") {
+		t.Errorf("Qd4 was commented with %q", blunder.Comment)
+	}
+	if reply := game.Moves[1]; len(reply.NAGs) != 0 {
+		t.Errorf("Rxd4 was annotated with %v %q", reply.NAGs, reply.Comment)
+	}
+	if summaries[White].Blunders != 1 || summaries[Black].Blunders != 0 || summaries[Black].Accuracy < 99.9 {
+		t.Errorf("the game was summarized as %v and %v", summaries[White], summaries[Black])
+	}
+}
+
+func TestParseAnnotationSettingsThresholds(t *testing.T) {
+	settings, err := ParseAnnotationSettings("games.pgn measure cp blunder 250")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.InaccuracyThreshold != DefaultCentipawnInaccuracy || settings.MistakeThreshold != DefaultCentipawnMistake || settings.BlunderThreshold != 250 {
+		t.Errorf("parsed the thresholds %v, %v and %v", settings.InaccuracyThreshold, settings.MistakeThreshold, settings.BlunderThreshold)
+	}
+	if settings.OutputFilePath != "games_annotated.pgn" {
+		t.Errorf("parsed the output file %s", settings.OutputFilePath)
+	}
+
+	settings = DefaultAnnotationSettings()
+	if settings.InaccuracyThreshold != DefaultWinProbabilityInaccuracy || settings.MistakeThreshold != DefaultWinProbabilityMistake || settings.BlunderThreshold != DefaultWinProbabilityBlunder {
+		t.Errorf("default thresholds are %v, %v and %v", settings.InaccuracyThreshold, settings.MistakeThreshold, settings.BlunderThreshold)
+	}
+}
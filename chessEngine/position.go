@@ -34,8 +34,9 @@ const (
 	A7, B7, C7, D7, E7, F7, G7, H7 = 48, 49, 50, 51, 52, 53, 54, 55
 	A8, B8, C8, D8, E8, F8, G8, H8 = 56, 57, 58, 59, 60, 61, 62, 63
 
-	NoneSquare       = 64
-	FENStartPosition = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0"
+	NoneSquare        = 64
+	MaxStateStackSize = 100
+	FENStartPosition  = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0"
 )
 
 type RookCastleMove struct {
@@ -129,10 +130,11 @@ type Position struct {
 	// Game state information
 	SideToMove      uint8
 	PositionHash    uint64
+	PawnHash        uint64
 	CastlingRights  uint8
 	Rule50          uint8
 	EnPassantSquare uint8
-	PreviousStates  [100]StateInfo
+	PreviousStates  [MaxStateStackSize]StateInfo
 	CurrentPly      uint16
 	MidGameScores   [2]int16
 	EndGameScores   [2]int16
@@ -141,6 +143,7 @@ type Position struct {
 }
 type StateInfo struct {
 	PositionHash    uint64
+	PawnHash        uint64
 	CastlingRights  uint8
 	Rule50          uint8
 	EnPassantSquare uint8
@@ -229,6 +232,97 @@ func (position *Position) LoadFEN(FEN string, evaluator Evaluator) {
 
 	// Generate the zobrist hash for the position...
 	position.PositionHash = ZobristSingleton.GenHash(position)
+	position.PawnHash = ZobristSingleton.GenPawnHash(position)
+
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnPositionLoaded(position)
+	}
+}
+
+// ValidateFEN checks that the FEN string describes a position which LoadFEN can set up: a full board with one
+// king of each color, no pawns on the first and last ranks, and castling rights backed by the king and rook.
+func ValidateFEN(FEN string) error {
+	fields := strings.Fields(FEN)
+	if len(fields) != 6 {
+		return fmt.Errorf("expected 6 fields, found %d", len(fields))
+	}
+
+	board := [64]byte{}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("expected 8 ranks, found %d", len(ranks))
+	}
+
+	kingCounts := map[byte]int{}
+	for rankIndex, rank := range ranks {
+		file := 0
+		for index := 0; index < len(rank); index++ {
+			char := rank[index]
+			if char >= '1' && char <= '8' {
+				file += int(char - '0')
+				continue
+			}
+
+			if _, ok := CharToPiece[char]; !ok {
+				return fmt.Errorf("invalid piece %q", char)
+			}
+			if file >= 8 {
+				return fmt.Errorf("rank %d has more than 8 squares", 8-rankIndex)
+			}
+			if (char == 'p' || char == 'P') && (rankIndex == 0 || rankIndex == 7) {
+				return fmt.Errorf("pawn on the rank %d", 8-rankIndex)
+			}
+			if char == 'k' || char == 'K' {
+				kingCounts[char]++
+			}
+			board[(7-rankIndex)*8+file] = char
+			file++
+		}
+
+		if file != 8 {
+			return fmt.Errorf("rank %d doesn't have 8 squares", 8-rankIndex)
+		}
+	}
+
+	if kingCounts['K'] != 1 || kingCounts['k'] != 1 {
+		return fmt.Errorf("expected one king of each color")
+	}
+
+	if fields[1] != "w" && fields[1] != "b" {
+		return fmt.Errorf("invalid side to move %q", fields[1])
+	}
+
+	if fields[2] != "-" {
+		castlingSquares := map[rune][2]uint8{'K': {E1, H1}, 'Q': {E1, A1}, 'k': {E8, H8}, 'q': {E8, A8}}
+		for _, char := range fields[2] {
+			squares, ok := castlingSquares[char]
+			if !ok {
+				return fmt.Errorf("invalid castling rights %q", fields[2])
+			}
+
+			king, rook := byte('K'), byte('R')
+			if unicode.IsLower(char) {
+				king, rook = 'k', 'r'
+			}
+			if board[squares[0]] != king || board[squares[1]] != rook {
+				return fmt.Errorf("castling right %c without the king and rook on their squares", char)
+			}
+		}
+	}
+
+	if fields[3] != "-" && (len(fields[3]) != 2 || fields[3][0] < 'a' || fields[3][0] > 'h' || (fields[3][1] != '3' && fields[3][1] != '6')) {
+		return fmt.Errorf("invalid en passant square %q", fields[3])
+	}
+
+	if halfMoveCounter, err := strconv.Atoi(fields[4]); err != nil || halfMoveCounter < 0 || halfMoveCounter > 255 {
+		return fmt.Errorf("invalid half move counter %q", fields[4])
+	}
+
+	if fullMoveCounter, err := strconv.Atoi(fields[5]); err != nil || fullMoveCounter < 0 {
+		return fmt.Errorf("invalid full move counter %q", fields[5])
+	}
+
+	return nil
 }
 
 func (position *Position) DoMove(move Move, evaluator Evaluator) (isValid bool) {
@@ -236,6 +330,7 @@ func (position *Position) DoMove(move Move, evaluator Evaluator) (isValid bool)
 
 	state := StateInfo{
 		PositionHash:    position.PositionHash,
+		PawnHash:        position.PawnHash,
 		CastlingRights:  position.CastlingRights,
 		EnPassantSquare: position.EnPassantSquare,
 		Rule50:          position.Rule50,
@@ -243,6 +338,10 @@ func (position *Position) DoMove(move Move, evaluator Evaluator) (isValid bool)
 		MovedPiece:      position.SquareContent[fromSquare],
 	}
 
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnMoveDone(position, move)
+	}
+
 	position.CurrentPly++
 	position.Rule50++
 
@@ -260,7 +359,7 @@ func (position *Position) DoMove(move Move, evaluator Evaluator) (isValid bool)
 			state.CapturedPiece = position.SquareContent[capSq]
 
 			position.clearSquareUpdateHashAndAdjustScore(capSq, evaluator)
-			position.placePieceAndAdjustScore(Piece{PieceType: Pawn, Color: position.SideToMove}, toSquare, evaluator)
+			position.placePieceUpdateHashAndAdjustScore(Piece{PieceType: Pawn, Color: position.SideToMove}, toSquare, evaluator)
 		} else {
 			position.clearSquareUpdateHashAndAdjustScore(toSquare, evaluator)
 			position.placePieceUpdateHashAndAdjustScore(Piece{PieceType: state.MovedPiece.PieceType, Color: position.SideToMove}, toSquare, evaluator)
@@ -312,6 +411,7 @@ func (position *Position) UnDoPreviousMove(previousMove Move, evaluator Evaluato
 	stateInfoForMoveReversal := position.PreviousStates[position.stateStackSize]
 
 	position.PositionHash = stateInfoForMoveReversal.PositionHash
+	position.PawnHash = stateInfoForMoveReversal.PawnHash
 	position.CastlingRights = stateInfoForMoveReversal.CastlingRights
 	position.Rule50 = stateInfoForMoveReversal.Rule50
 	position.EnPassantSquare = stateInfoForMoveReversal.EnPassantSquare
@@ -343,7 +443,23 @@ func (position *Position) UnDoPreviousMove(previousMove Move, evaluator Evaluato
 		position.clearPieceAtSquareAdjustScore(castleToSquare, evaluator)
 		position.placePieceAndAdjustScore(Piece{PieceType: Rook, Color: position.SideToMove}, castleFromSquare, evaluator)
 	}
+
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnMoveUndone(position, previousMove)
+	}
 }
+
+// DoGameMove plays a move which is part of the game history rather than the search tree, so the position state
+// stack is not grown and the move can't be undone. Games of any length can be replayed this way.
+func (position *Position) DoGameMove(move Move, evaluator Evaluator) {
+	position.DoMove(move, evaluator)
+	position.stateStackSize--
+
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnPositionLoaded(position)
+	}
+}
+
 func (position *Position) DoNullMove() {
 	currentState := StateInfo{
 		PositionHash:    position.PositionHash,
@@ -369,6 +485,9 @@ func (position *Position) unDoPreviousNullMove() {
 	position.CurrentPly--
 	position.SideToMove ^= 1
 }
+func (position *Position) StateStackSize() uint8 {
+	return position.stateStackSize
+}
 func (position *Position) IsCurrentSideInCheck() bool {
 	kingSquare := position.PiecesBitBoard[position.SideToMove][King].MostSignificantBit()
 	occupancyBitboard := position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]
@@ -422,7 +541,14 @@ func (position *Position) clearPieceAtSquareAdjustScore(square uint8, evaluator
 func (position *Position) clearSquareUpdateHashAndAdjustScore(square uint8, evaluator Evaluator) {
 	piece := position.SquareContent[square]
 	position.PositionHash ^= ZobristSingleton.GetPieceSquareRandomNumber(piece, square)
+	if piece.PieceType == Pawn {
+		position.PawnHash ^= ZobristSingleton.GetPieceSquareRandomNumber(piece, square)
+	}
 	position.clearPieceAtSquareAdjustScore(square, evaluator)
+
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnPieceRemoved(position, piece, square)
+	}
 }
 func (position *Position) placePieceAndAdjustScore(piece Piece, toSquare uint8, evaluator Evaluator) {
 	PSQT_MG := evaluator.GetMiddleGamePieceSquareTable()
@@ -444,7 +570,14 @@ func (position *Position) placePieceAndAdjustScore(piece Piece, toSquare uint8,
 }
 func (position *Position) placePieceUpdateHashAndAdjustScore(piece Piece, toSquare uint8, evaluator Evaluator) {
 	position.PositionHash ^= ZobristSingleton.GetPieceSquareRandomNumber(piece, toSquare)
+	if piece.PieceType == Pawn {
+		position.PawnHash ^= ZobristSingleton.GetPieceSquareRandomNumber(piece, toSquare)
+	}
 	position.placePieceAndAdjustScore(piece, toSquare, evaluator)
+
+	if incrementalEvaluator, ok := evaluator.(IncrementalEvaluator); ok {
+		incrementalEvaluator.OnPiecePlaced(position, piece, toSquare)
+	}
 }
 func getPawnForwardDelta(color uint8) int8 {
 	if color == White {
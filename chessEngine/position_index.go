@@ -0,0 +1,759 @@
+package chessEngine
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPositionIndexMemoryMB = 256
+	DefaultExplorerGameCount     = 10
+
+	positionIndexMagic      = "GFPINDEX"
+	positionIndexVersion    = 1
+	positionIndexHeaderSize = 48
+	positionIndexRecordSize = 25
+
+	positionIndexProgressInterval = 10000
+)
+
+// The results of the indexed games, matching the colors for the decisive ones.
+const (
+	IndexedBlackWin uint8 = iota
+	IndexedWhiteWin
+	IndexedDraw
+	IndexedUnknownResult
+)
+
+var indexedResults = map[string]uint8{
+	PgnWhiteWinResult: IndexedWhiteWin,
+	PgnBlackWinResult: IndexedBlackWin,
+	PgnDrawResult:     IndexedDraw,
+}
+
+type PositionIndexSettings struct {
+	InputFilePath  string
+	OutputFilePath string
+
+	// MaximumPlies limits the indexed positions to the start of the games, e.g. to the opening. 0 indexes whole games.
+	MaximumPlies int
+
+	// SortMemory is the memory in megabytes for sorting the positions, beyond which they are sorted in runs on disk.
+	SortMemory uint64
+}
+
+func DefaultPositionIndexSettings() PositionIndexSettings {
+	return PositionIndexSettings{SortMemory: DefaultPositionIndexMemoryMB}
+}
+
+// ParsePositionIndexSettings reads the input PGN file followed by "<name> <value>" pairs, e.g.
+// "games.pgn output games.idx maxPlies 30". The output defaults to the input file name with the ".idx" extension.
+func ParsePositionIndexSettings(command string) (PositionIndexSettings, error) {
+	settings := DefaultPositionIndexSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 1 {
+		return settings, errors.New("expected the input PGN file followed by <name> <value> pairs")
+	}
+	settings.InputFilePath = commandFields[0]
+
+	for index := 1; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "output":
+			settings.OutputFilePath = value
+		case "maxPlies":
+			settings.MaximumPlies, err = strconv.Atoi(value)
+		case "memory":
+			settings.SortMemory, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.OutputFilePath == "" {
+		settings.OutputFilePath = getPositionIndexFilePath(settings.InputFilePath)
+	}
+
+	if settings.MaximumPlies < 0 || settings.SortMemory < 1 {
+		return settings, errors.New("maxPlies can't be negative, and memory must be at least 1")
+	}
+
+	return settings, nil
+}
+
+func getPositionIndexFilePath(pgnFilePath string) string {
+	return strings.TrimSuffix(pgnFilePath, ".pgn") + ".idx"
+}
+
+// PositionOccurrence is a position reached in an indexed game, with the move played from it, NullMove where the game
+// or its indexed part ends, and the result and ratings of the game for the statistics.
+type PositionOccurrence struct {
+	PositionHash uint64
+	GameOffset   int64
+	Ply          uint16
+	Move         Move
+	WhiteElo     uint16
+	BlackElo     uint16
+	Result       uint8
+}
+
+func (occurrence *PositionOccurrence) encode(buffer []byte) {
+	binary.LittleEndian.PutUint64(buffer[0:], occurrence.PositionHash)
+	binary.LittleEndian.PutUint64(buffer[8:], uint64(occurrence.GameOffset))
+	binary.LittleEndian.PutUint16(buffer[16:], occurrence.Ply)
+	binary.LittleEndian.PutUint16(buffer[18:], uint16(occurrence.Move>>16))
+	binary.LittleEndian.PutUint16(buffer[20:], occurrence.WhiteElo)
+	binary.LittleEndian.PutUint16(buffer[22:], occurrence.BlackElo)
+	buffer[24] = occurrence.Result
+}
+
+func decodePositionOccurrence(buffer []byte) PositionOccurrence {
+	return PositionOccurrence{
+		PositionHash: binary.LittleEndian.Uint64(buffer[0:]),
+		GameOffset:   int64(binary.LittleEndian.Uint64(buffer[8:])),
+		Ply:          binary.LittleEndian.Uint16(buffer[16:]),
+		Move:         Move(binary.LittleEndian.Uint16(buffer[18:])) << 16,
+		WhiteElo:     binary.LittleEndian.Uint16(buffer[20:]),
+		BlackElo:     binary.LittleEndian.Uint16(buffer[22:]),
+		Result:       buffer[24],
+	}
+}
+
+// comesBefore orders the occurrences by position, then by game and ply, so that the occurrences of a position are
+// contiguous in the index, in the order of the games in the PGN file.
+func (occurrence *PositionOccurrence) comesBefore(other *PositionOccurrence) bool {
+	if occurrence.PositionHash != other.PositionHash {
+		return occurrence.PositionHash < other.PositionHash
+	}
+	if occurrence.GameOffset != other.GameOffset {
+		return occurrence.GameOffset < other.GameOffset
+	}
+	return occurrence.Ply < other.Ply
+}
+
+func readPositionOccurrence(reader io.Reader, buffer []byte) (PositionOccurrence, error) {
+	if _, err := io.ReadFull(reader, buffer); err != nil {
+		return PositionOccurrence{}, err
+	}
+	return decodePositionOccurrence(buffer), nil
+}
+
+func writePositionOccurrence(writer io.Writer, occurrence *PositionOccurrence, buffer []byte) error {
+	occurrence.encode(buffer)
+	_, err := writer.Write(buffer)
+	return err
+}
+
+// positionIndexBuilder sorts the occurrences in memory, spilling sorted runs to temporary files once the memory is
+// full, which are merged at the end.
+type positionIndexBuilder struct {
+	occurrences        []PositionOccurrence
+	maximumOccurrences int
+	runFiles           []*os.File
+	occurrenceCount    uint64
+}
+
+func newPositionIndexBuilder(sortMemory uint64) *positionIndexBuilder {
+	maximumOccurrences := max(int(sortMemory*1024*1024/positionIndexRecordSize), 1)
+	return &positionIndexBuilder{maximumOccurrences: maximumOccurrences}
+}
+
+func (builder *positionIndexBuilder) add(occurrence PositionOccurrence) error {
+	builder.occurrences = append(builder.occurrences, occurrence)
+	builder.occurrenceCount++
+	if len(builder.occurrences) >= builder.maximumOccurrences {
+		return builder.flushRun()
+	}
+	return nil
+}
+
+func (builder *positionIndexBuilder) sortOccurrences() {
+	sort.Slice(builder.occurrences, func(first, second int) bool {
+		return builder.occurrences[first].comesBefore(&builder.occurrences[second])
+	})
+}
+
+func (builder *positionIndexBuilder) flushRun() error {
+	runFile, err := os.CreateTemp("", "gofish-index-run-*")
+	if err != nil {
+		return err
+	}
+	builder.runFiles = append(builder.runFiles, runFile)
+
+	builder.sortOccurrences()
+	writer := bufio.NewWriter(runFile)
+	buffer := make([]byte, positionIndexRecordSize)
+	for index := range builder.occurrences {
+		if err := writePositionOccurrence(writer, &builder.occurrences[index], buffer); err != nil {
+			return err
+		}
+	}
+	builder.occurrences = builder.occurrences[:0]
+	return writer.Flush()
+}
+
+// write writes all the occurrences in order, directly if they fit in memory, by merging the runs otherwise.
+func (builder *positionIndexBuilder) write(writer io.Writer) error {
+	buffer := make([]byte, positionIndexRecordSize)
+	if len(builder.runFiles) == 0 {
+		builder.sortOccurrences()
+		for index := range builder.occurrences {
+			if err := writePositionOccurrence(writer, &builder.occurrences[index], buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(builder.occurrences) > 0 {
+		if err := builder.flushRun(); err != nil {
+			return err
+		}
+	}
+
+	runs := positionIndexRunHeap{}
+	for _, runFile := range builder.runFiles {
+		if _, err := runFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		run := &positionIndexRun{reader: bufio.NewReader(runFile), buffer: make([]byte, positionIndexRecordSize)}
+		if err := run.next(); err != nil {
+			return err
+		}
+		runs = append(runs, run)
+	}
+	heap.Init(&runs)
+
+	for len(runs) > 0 {
+		run := runs[0]
+		if err := writePositionOccurrence(writer, &run.current, buffer); err != nil {
+			return err
+		}
+
+		err := run.next()
+		switch {
+		case err == io.EOF:
+			heap.Pop(&runs)
+		case err != nil:
+			return err
+		default:
+			heap.Fix(&runs, 0)
+		}
+	}
+	return nil
+}
+
+func (builder *positionIndexBuilder) close() {
+	for _, runFile := range builder.runFiles {
+		runFile.Close()
+		os.Remove(runFile.Name())
+	}
+	builder.runFiles = nil
+}
+
+type positionIndexRun struct {
+	reader  *bufio.Reader
+	buffer  []byte
+	current PositionOccurrence
+}
+
+func (run *positionIndexRun) next() (err error) {
+	run.current, err = readPositionOccurrence(run.reader, run.buffer)
+	return err
+}
+
+type positionIndexRunHeap []*positionIndexRun
+
+func (runs positionIndexRunHeap) Len() int {
+	return len(runs)
+}
+
+func (runs positionIndexRunHeap) Less(first, second int) bool {
+	return runs[first].current.comesBefore(&runs[second].current)
+}
+
+func (runs positionIndexRunHeap) Swap(first, second int) {
+	runs[first], runs[second] = runs[second], runs[first]
+}
+
+func (runs *positionIndexRunHeap) Push(run any) {
+	*runs = append(*runs, run.(*positionIndexRun))
+}
+
+func (runs *positionIndexRunHeap) Pop() any {
+	run := (*runs)[len(*runs)-1]
+	*runs = (*runs)[:len(*runs)-1]
+	return run
+}
+
+// positionIndexHeader identifies the index format and the PGN file the index was built from, by its size and
+// modification time, so that an index left behind by changes to the PGN file isn't used.
+type positionIndexHeader struct {
+	occurrenceCount uint64
+	pgnFileSize     int64
+	pgnModTime      int64
+	maximumPlies    uint32
+}
+
+func (header *positionIndexHeader) encode() []byte {
+	buffer := make([]byte, positionIndexHeaderSize)
+	copy(buffer, positionIndexMagic)
+	binary.LittleEndian.PutUint32(buffer[8:], positionIndexVersion)
+	binary.LittleEndian.PutUint32(buffer[12:], positionIndexRecordSize)
+	binary.LittleEndian.PutUint64(buffer[16:], header.occurrenceCount)
+	binary.LittleEndian.PutUint64(buffer[24:], uint64(header.pgnFileSize))
+	binary.LittleEndian.PutUint64(buffer[32:], uint64(header.pgnModTime))
+	binary.LittleEndian.PutUint32(buffer[40:], header.maximumPlies)
+	return buffer
+}
+
+func decodePositionIndexHeader(buffer []byte) (positionIndexHeader, error) {
+	if string(buffer[:8]) != positionIndexMagic {
+		return positionIndexHeader{}, errors.New("not a position index")
+	}
+	if binary.LittleEndian.Uint32(buffer[8:]) != positionIndexVersion || binary.LittleEndian.Uint32(buffer[12:]) != positionIndexRecordSize {
+		return positionIndexHeader{}, errors.New("unsupported position index version")
+	}
+
+	return positionIndexHeader{
+		occurrenceCount: binary.LittleEndian.Uint64(buffer[16:]),
+		pgnFileSize:     int64(binary.LittleEndian.Uint64(buffer[24:])),
+		pgnModTime:      int64(binary.LittleEndian.Uint64(buffer[32:])),
+		maximumPlies:    binary.LittleEndian.Uint32(buffer[40:]),
+	}, nil
+}
+
+func getGameRating(game *PgnGame, tagName string) uint16 {
+	rating, err := strconv.ParseUint(game.Tag(tagName), 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(rating)
+}
+
+// BuildPositionIndex replays the games of a PGN file and writes the positions they reach, sorted by their Zobrist
+// hash, with the offset of their game in the PGN file. Games which can't be read are skipped, and games with an
+// illegal move are indexed up to it.
+func BuildPositionIndex(settings PositionIndexSettings, evaluator Evaluator, output io.Writer) error {
+	pgnFile, err := os.Open(settings.InputFilePath)
+	if err != nil {
+		return err
+	}
+	defer pgnFile.Close()
+
+	pgnFileInfo, err := pgnFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	builder := newPositionIndexBuilder(settings.SortMemory)
+	defer builder.close()
+
+	position := Position{}
+	indexedGames, skippedGames := 0, 0
+	pgnReader := NewPgnReader(pgnFile)
+	for gameNumber := 1; ; gameNumber++ {
+		game, err := pgnReader.ReadGame()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = ValidateFEN(game.StartingFEN())
+		}
+		if err != nil {
+			fmt.Fprintf(output, "Game %d: skipped, %v\n", gameNumber, err)
+			skippedGames++
+			continue
+		}
+
+		result, ok := indexedResults[game.Result]
+		if !ok {
+			result = IndexedUnknownResult
+		}
+		occurrence := PositionOccurrence{
+			GameOffset: game.Offset,
+			WhiteElo:   getGameRating(&game, "WhiteElo"),
+			BlackElo:   getGameRating(&game, "BlackElo"),
+			Result:     result,
+		}
+		if settings.MaximumPlies > 0 && len(game.Moves) > settings.MaximumPlies {
+			game.Moves = game.Moves[:settings.MaximumPlies]
+		}
+
+		var indexErr error
+		reachedPlies := 0
+		addOccurrence := func(position *Position, ply int, move Move) error {
+			occurrence.PositionHash, occurrence.Ply, occurrence.Move = position.PositionHash, uint16(ply), move
+			reachedPlies = ply + 1
+			indexErr = builder.add(occurrence)
+			return indexErr
+		}
+
+		replayErr := ReplayPgnGame(&game, &position, evaluator, addOccurrence)
+		if replayErr != nil && indexErr == nil {
+			fmt.Fprintf(output, "Game %d: indexed up to %v\n", gameNumber, replayErr)
+		}
+		if indexErr == nil {
+			addOccurrence(&position, reachedPlies, NullMove)
+		}
+		if indexErr != nil {
+			return indexErr
+		}
+
+		indexedGames++
+		if indexedGames%positionIndexProgressInterval == 0 {
+			fmt.Fprintf(output, "Indexed %d games\n", indexedGames)
+		}
+	}
+
+	temporaryFilePath := settings.OutputFilePath + ".tmp"
+	indexFile, err := os.Create(temporaryFilePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFilePath)
+	defer indexFile.Close()
+
+	header := positionIndexHeader{
+		occurrenceCount: builder.occurrenceCount,
+		pgnFileSize:     pgnFileInfo.Size(),
+		pgnModTime:      pgnFileInfo.ModTime().UnixNano(),
+		maximumPlies:    uint32(settings.MaximumPlies),
+	}
+	writer := bufio.NewWriter(indexFile)
+	if _, err := writer.Write(header.encode()); err != nil {
+		return err
+	}
+	if err := builder.write(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := indexFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryFilePath, settings.OutputFilePath); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "Indexed %d positions of %d games, skipped %d games\n", builder.occurrenceCount, indexedGames, skippedGames)
+	return nil
+}
+
+// PositionIndex looks positions up in an index built by BuildPositionIndex, reading the index and the games from
+// disk as needed.
+type PositionIndex struct {
+	IndexFilePath string
+	PgnFilePath   string
+	MaximumPlies  int
+
+	indexFile       *os.File
+	pgnFile         *os.File
+	occurrenceCount int64
+}
+
+// OpenPositionIndex opens the index of a PGN file, failing if the PGN file changed since the index was built.
+func OpenPositionIndex(indexFilePath string, pgnFilePath string) (*PositionIndex, error) {
+	indexFile, err := os.Open(indexFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := openPositionIndexFile(indexFile, indexFilePath, pgnFilePath)
+	if err != nil {
+		indexFile.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+func openPositionIndexFile(indexFile *os.File, indexFilePath string, pgnFilePath string) (*PositionIndex, error) {
+	headerBuffer := make([]byte, positionIndexHeaderSize)
+	if _, err := io.ReadFull(indexFile, headerBuffer); err != nil {
+		return nil, fmt.Errorf("%s: not a position index", indexFilePath)
+	}
+	header, err := decodePositionIndexHeader(headerBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", indexFilePath, err)
+	}
+
+	indexFileInfo, err := indexFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(indexFileInfo.Size()) != positionIndexHeaderSize+header.occurrenceCount*positionIndexRecordSize {
+		return nil, fmt.Errorf("%s: truncated position index", indexFilePath)
+	}
+
+	pgnFile, err := os.Open(pgnFilePath)
+	if err != nil {
+		return nil, err
+	}
+	pgnFileInfo, err := pgnFile.Stat()
+	if err != nil || pgnFileInfo.Size() != header.pgnFileSize || pgnFileInfo.ModTime().UnixNano() != header.pgnModTime {
+		pgnFile.Close()
+		return nil, fmt.Errorf("%s changed since %s was built", pgnFilePath, indexFilePath)
+	}
+
+	return &PositionIndex{
+		IndexFilePath:   indexFilePath,
+		PgnFilePath:     pgnFilePath,
+		MaximumPlies:    int(header.maximumPlies),
+		indexFile:       indexFile,
+		pgnFile:         pgnFile,
+		occurrenceCount: int64(header.occurrenceCount),
+	}, nil
+}
+
+func (index *PositionIndex) Close() error {
+	pgnErr := index.pgnFile.Close()
+	if err := index.indexFile.Close(); err != nil {
+		return err
+	}
+	return pgnErr
+}
+
+// PositionCount returns the number of indexed positions, counting each time a game reached one.
+func (index *PositionIndex) PositionCount() int64 {
+	return index.occurrenceCount
+}
+
+func (index *PositionIndex) readOccurrence(occurrenceIndex int64, buffer []byte) (PositionOccurrence, error) {
+	if _, err := index.indexFile.ReadAt(buffer, positionIndexHeaderSize+occurrenceIndex*positionIndexRecordSize); err != nil {
+		return PositionOccurrence{}, err
+	}
+	return decodePositionOccurrence(buffer), nil
+}
+
+// FindPosition returns the occurrences of the position with the Zobrist hash, ordered by game and ply, by a binary
+// search of the index.
+func (index *PositionIndex) FindPosition(positionHash uint64) ([]PositionOccurrence, error) {
+	buffer := make([]byte, positionIndexRecordSize)
+	low, high := int64(0), index.occurrenceCount
+	for low < high {
+		middle := low + (high-low)/2
+		occurrence, err := index.readOccurrence(middle, buffer)
+		if err != nil {
+			return nil, err
+		}
+		if occurrence.PositionHash < positionHash {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+
+	occurrences := []PositionOccurrence{}
+	sectionOffset := positionIndexHeaderSize + low*positionIndexRecordSize
+	reader := bufio.NewReader(io.NewSectionReader(index.indexFile, sectionOffset, (index.occurrenceCount-low)*positionIndexRecordSize))
+	for {
+		occurrence, err := readPositionOccurrence(reader, buffer)
+		if err == io.EOF || (err == nil && occurrence.PositionHash != positionHash) {
+			return occurrences, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+}
+
+// ReadGame reads an indexed game from the PGN file, at the offset of one of its occurrences.
+func (index *PositionIndex) ReadGame(gameOffset int64) (PgnGame, error) {
+	return ReadPgnGameAt(index.pgnFile, gameOffset)
+}
+
+// ResultStatistics counts the results of games.
+type ResultStatistics struct {
+	Games     int
+	WhiteWins int
+	Draws     int
+	BlackWins int
+}
+
+func (statistics *ResultStatistics) add(result uint8) {
+	statistics.Games++
+	switch result {
+	case IndexedWhiteWin:
+		statistics.WhiteWins++
+	case IndexedDraw:
+		statistics.Draws++
+	case IndexedBlackWin:
+		statistics.BlackWins++
+	}
+}
+
+// GetScore returns the share of the points of the side in the games with a known result, between 0 and 1, and 0.5
+// without any such game.
+func (statistics ResultStatistics) GetScore(side uint8) float64 {
+	decidedGames := statistics.WhiteWins + statistics.Draws + statistics.BlackWins
+	if decidedGames == 0 {
+		return 0.5
+	}
+
+	wins := statistics.WhiteWins
+	if side == Black {
+		wins = statistics.BlackWins
+	}
+	return (float64(wins) + float64(statistics.Draws)/2) / float64(decidedGames)
+}
+
+func (statistics ResultStatistics) formatPercentages() string {
+	if statistics.Games == 0 {
+		return ""
+	}
+	percentage := func(count int) float64 { return 100 * float64(count) / float64(statistics.Games) }
+	return fmt.Sprintf("%5.1f%% %5.1f%% %5.1f%%", percentage(statistics.WhiteWins), percentage(statistics.Draws), percentage(statistics.BlackWins))
+}
+
+// MoveStatistics sums up the games where a move was played from a position. The score is the share of the points of
+// the side to move, the average rating the mean rating of the players who played the move, and the performance the
+// rating their results were worth against their opponents, both 0 without rated games.
+type MoveStatistics struct {
+	ResultStatistics
+	Move          Move
+	SAN           string
+	Score         float64
+	AverageRating int
+	Performance   int
+}
+
+// PositionStatistics sums up the games which reached a position, and the moves played from it, the most frequent
+// first. Occurrences holds the first occurrence of the position in each game, in the order of the PGN file.
+type PositionStatistics struct {
+	ResultStatistics
+	FEN         string
+	SideToMove  uint8
+	Moves       []MoveStatistics
+	Occurrences []PositionOccurrence
+}
+
+type moveRatingTotals struct {
+	ratedGames        int
+	ratingSum         int
+	opponentRatingSum int
+	pointBalance      float64
+}
+
+// GetPositionStatistics looks the position up and sums up the results of the games which reached it, for the
+// position and for each move played from it. A game which reached the position more than once counts once, with the
+// move played the first time.
+func (index *PositionIndex) GetPositionStatistics(position *Position, evaluator Evaluator) (PositionStatistics, error) {
+	statistics := PositionStatistics{FEN: position.GenFEN(), SideToMove: position.SideToMove}
+	occurrences, err := index.FindPosition(position.PositionHash)
+	if err != nil {
+		return statistics, err
+	}
+
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	moveIndices := map[Move]int{}
+	ratingTotals := []moveRatingTotals{}
+	for occurrenceIndex, occurrence := range occurrences {
+		if occurrenceIndex > 0 && occurrences[occurrenceIndex-1].GameOffset == occurrence.GameOffset {
+			continue
+		}
+		statistics.Occurrences = append(statistics.Occurrences, occurrence)
+		statistics.add(occurrence.Result)
+
+		if occurrence.Move == NullMove {
+			continue
+		}
+		moveIndex, ok := moveIndices[occurrence.Move]
+		if !ok {
+			legalMove, legal := findLegalMove(legalMoves, occurrence.Move)
+			if !legal {
+				continue
+			}
+			moveIndex = len(statistics.Moves)
+			moveIndices[occurrence.Move] = moveIndex
+			statistics.Moves = append(statistics.Moves, MoveStatistics{Move: legalMove, SAN: ConvertMoveToSAN(position, legalMove, evaluator)})
+			ratingTotals = append(ratingTotals, moveRatingTotals{})
+		}
+		statistics.Moves[moveIndex].add(occurrence.Result)
+
+		playerRating, opponentRating := occurrence.WhiteElo, occurrence.BlackElo
+		if position.SideToMove == Black {
+			playerRating, opponentRating = opponentRating, playerRating
+		}
+		if playerRating > 0 && opponentRating > 0 && occurrence.Result != IndexedUnknownResult {
+			totals := &ratingTotals[moveIndex]
+			totals.ratedGames++
+			totals.ratingSum += int(playerRating)
+			totals.opponentRatingSum += int(opponentRating)
+			switch {
+			case occurrence.Result == IndexedDraw:
+			case occurrence.Result == position.SideToMove:
+				totals.pointBalance++
+			default:
+				totals.pointBalance--
+			}
+		}
+	}
+
+	for moveIndex := range statistics.Moves {
+		moveStatistics, totals := &statistics.Moves[moveIndex], ratingTotals[moveIndex]
+		moveStatistics.Score = moveStatistics.GetScore(position.SideToMove)
+		if totals.ratedGames > 0 {
+			moveStatistics.AverageRating = totals.ratingSum / totals.ratedGames
+			moveStatistics.Performance = (totals.opponentRatingSum + int(400*totals.pointBalance)) / totals.ratedGames
+		}
+	}
+	sort.SliceStable(statistics.Moves, func(first, second int) bool {
+		return statistics.Moves[first].Games > statistics.Moves[second].Games
+	})
+
+	return statistics, nil
+}
+
+// findLegalMove returns the legal move matching an indexed move, which could only be missing for another position
+// with the same hash.
+func findLegalMove(legalMoves MoveList, move Move) (Move, bool) {
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		if legalMoves.Moves[moveIndex].IsSameMove(move) {
+			return legalMoves.Moves[moveIndex], true
+		}
+	}
+	return NullMove, false
+}
+
+// String writes the statistics as an opening explorer table, with the results from the point of view of white and
+// the score from the point of view of the side to move.
+func (statistics PositionStatistics) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", statistics.FEN)
+	if statistics.Games == 0 {
+		sb.WriteString("No games reached this position")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "%d games: %s", statistics.Games, statistics.formatPercentages())
+	if len(statistics.Moves) == 0 {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "\n%-8s %7s %6s %6s %6s %6s %7s %6s", "Move", "Games", "White", "Draw", "Black", "Score", "Rating", "Perf")
+	for _, move := range statistics.Moves {
+		rating, performance := "-", "-"
+		if move.AverageRating > 0 {
+			rating, performance = strconv.Itoa(move.AverageRating), strconv.Itoa(move.Performance)
+		}
+		fmt.Fprintf(&sb, "\n%-8s %7d %s %5.1f%% %7s %6s", move.SAN, move.Games, move.formatPercentages(), 100*move.Score, rating, performance)
+	}
+	return sb.String()
+}
@@ -0,0 +1,756 @@
+package chessEngine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	QueryPgnFormat = "pgn"
+	QueryEpdFormat = "epd"
+
+	queryMatchComment = "Query match"
+)
+
+var queryPieceTypes = map[byte]uint8{'K': King, 'Q': Queen, 'R': Rook, 'B': Bishop, 'N': Knight, 'P': Pawn}
+
+// queryNode is a node of a parsed query. Every node evaluates to an integer, conditions to 1 when they hold and 0
+// otherwise, and any value other than 0 holds as a condition.
+type queryNode interface {
+	evaluate(position *Position, ply int) int
+}
+
+type queryConstantNode int
+
+func (node queryConstantNode) evaluate(position *Position, ply int) int {
+	return int(node)
+}
+
+type queryPlyNode struct{}
+
+func (node queryPlyNode) evaluate(position *Position, ply int) int {
+	return ply
+}
+
+type querySideToMoveNode uint8
+
+func (node querySideToMoveNode) evaluate(position *Position, ply int) int {
+	return queryBool(position.SideToMove == uint8(node))
+}
+
+type queryCheckNode struct{}
+
+func (node queryCheckNode) evaluate(position *Position, ply int) int {
+	return queryBool(position.IsCurrentSideInCheck())
+}
+
+// queryPieceCountNode counts the pieces of a color and type on a set of squares, only the passed ones for pawns
+// with the passed modifier.
+type queryPieceCountNode struct {
+	color     uint8
+	pieceType uint8
+	squares   Bitboard
+	passed    bool
+}
+
+func (node queryPieceCountNode) evaluate(position *Position, ply int) int {
+	pieces := position.PiecesBitBoard[node.color][node.pieceType] & node.squares
+	if !node.passed {
+		return pieces.CountSetBits()
+	}
+
+	passedPawns := 0
+	for pieces != 0 {
+		if isQueryPassedPawn(position, node.color, pieces.PopMostSignificantBit()) {
+			passedPawns++
+		}
+	}
+	return passedPawns
+}
+
+// isQueryPassedPawn tells whether no enemy pawn stands in front of the pawn, on its file or an adjacent one.
+func isQueryPassedPawn(position *Position, color uint8, square uint8) bool {
+	enemyPawns := position.PiecesBitBoard[color^1][Pawn]
+	for enemyPawns != 0 {
+		enemySquare := enemyPawns.PopMostSignificantBit()
+		if abs(int(File(enemySquare))-int(File(square))) > 1 {
+			continue
+		}
+		if (color == White && Rank(enemySquare) > Rank(square)) || (color == Black && Rank(enemySquare) < Rank(square)) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryMaterialNode matches a material signature such as KRPvKR, with either side having either half of it.
+type queryMaterialNode struct {
+	counts   [2][6]int
+	anyPawns [2]bool
+}
+
+func (node queryMaterialNode) matchesSides(position *Position, firstColor uint8) bool {
+	for half, color := range [2]uint8{firstColor, firstColor ^ 1} {
+		for pieceType := Pawn; pieceType < King; pieceType++ {
+			if pieceType == Pawn && node.anyPawns[half] {
+				continue
+			}
+			if position.PiecesBitBoard[color][pieceType].CountSetBits() != node.counts[half][pieceType] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (node queryMaterialNode) evaluate(position *Position, ply int) int {
+	return queryBool(node.matchesSides(position, White) || node.matchesSides(position, Black))
+}
+
+type queryNotNode struct {
+	operand queryNode
+}
+
+func (node queryNotNode) evaluate(position *Position, ply int) int {
+	return queryBool(node.operand.evaluate(position, ply) == 0)
+}
+
+type queryBinaryNode struct {
+	operator string
+	left     queryNode
+	right    queryNode
+}
+
+func (node queryBinaryNode) evaluate(position *Position, ply int) int {
+	left := node.left.evaluate(position, ply)
+	switch node.operator {
+	case "and":
+		return queryBool(left != 0 && node.right.evaluate(position, ply) != 0)
+	case "or":
+		return queryBool(left != 0 || node.right.evaluate(position, ply) != 0)
+	}
+
+	right := node.right.evaluate(position, ply)
+	switch node.operator {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "==":
+		return queryBool(left == right)
+	case "!=":
+		return queryBool(left != right)
+	case "<":
+		return queryBool(left < right)
+	case "<=":
+		return queryBool(left <= right)
+	case ">":
+		return queryBool(left > right)
+	default:
+		return queryBool(left >= right)
+	}
+}
+
+func queryBool(condition bool) int {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// PositionQuery is a condition on a position of a game, written in a small query language:
+//
+//	query      := and ("or" and)*
+//	and        := not ("and" not)*
+//	not        := "not" not | comparison
+//	comparison := sum [("==" | "!=" | "<" | "<=" | ">" | ">=") sum]
+//	sum        := term (("+" | "-") term)*
+//	term       := "(" query ")" | number | "ply" | "wtm" | "btm" | "check" | "material" signature
+//	            | ["passed"] piece ["on" squares]
+//	squares    := square | "[" square ("," square)* "]"
+//
+// A piece is one of KQRBNP for white and kqrbnp for black, and counts the pieces of the color and type, on the
+// squares if given, and only the passed pawns with "passed". Squares are written as e4, a file as a*, a rank as *4,
+// and the light and dark squares as light and dark. A signature such as KRPvKR, where P* stands for any number of
+// pawns, holds when the material is exactly that, whichever side has which half. Any value other than 0 holds, so
+// "passed P on a*" holds when white has a passed a-pawn.
+type PositionQuery struct {
+	text string
+	root queryNode
+}
+
+func (query *PositionQuery) String() string {
+	return query.text
+}
+
+// Matches tells whether the position, reached at the ply of a game, matches the query.
+func (query *PositionQuery) Matches(position *Position, ply int) bool {
+	return query.root.evaluate(position, ply) != 0
+}
+
+// ParsePositionQuery parses a query, e.g. "R == 1 and r == 1 and Q + q + B + b + N + n == 0 and passed P on a*" for
+// rook endgames where white has a passed a-pawn.
+func ParsePositionQuery(text string) (*PositionQuery, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty query")
+	}
+
+	parser := queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.index < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %s in the query", parser.tokens[parser.index])
+	}
+	return &PositionQuery{text: strings.Join(tokens, " "), root: root}, nil
+}
+
+func isQueryWordCharacter(character rune) bool {
+	return unicode.IsLetter(character) || unicode.IsDigit(character) || character == '*'
+}
+
+func tokenizeQuery(text string) ([]string, error) {
+	tokens := []string{}
+	characters := []rune(text)
+	for index := 0; index < len(characters); {
+		character := characters[index]
+		switch {
+		case unicode.IsSpace(character):
+			index++
+		case isQueryWordCharacter(character):
+			start := index
+			for index < len(characters) && isQueryWordCharacter(characters[index]) {
+				index++
+			}
+			tokens = append(tokens, string(characters[start:index]))
+		case strings.ContainsRune("=!<>", character):
+			operator := string(character)
+			if index+1 < len(characters) && characters[index+1] == '=' {
+				operator += "="
+				index++
+			}
+			if operator == "=" {
+				operator = "=="
+			}
+			if operator == "!" {
+				return nil, errors.New("unexpected ! in the query, use != or not")
+			}
+			tokens = append(tokens, operator)
+			index++
+		case strings.ContainsRune("()[],+-", character):
+			tokens = append(tokens, string(character))
+			index++
+		default:
+			return nil, fmt.Errorf("unexpected character %q in the query", character)
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []string
+	index  int
+}
+
+func (parser *queryParser) peek() string {
+	if parser.index < len(parser.tokens) {
+		return parser.tokens[parser.index]
+	}
+	return ""
+}
+
+func (parser *queryParser) next() (string, error) {
+	if parser.index >= len(parser.tokens) {
+		return "", errors.New("unexpected end of the query")
+	}
+	parser.index++
+	return parser.tokens[parser.index-1], nil
+}
+
+func (parser *queryParser) expect(expected string) error {
+	token, err := parser.next()
+	if err == nil && token != expected {
+		err = fmt.Errorf("expected %s instead of %s in the query", expected, token)
+	}
+	return err
+}
+
+func (parser *queryParser) parseOr() (queryNode, error) {
+	left, err := parser.parseAnd()
+	for err == nil && parser.peek() == "or" {
+		parser.index++
+		var right queryNode
+		if right, err = parser.parseAnd(); err == nil {
+			left = queryBinaryNode{operator: "or", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (parser *queryParser) parseAnd() (queryNode, error) {
+	left, err := parser.parseNot()
+	for err == nil && parser.peek() == "and" {
+		parser.index++
+		var right queryNode
+		if right, err = parser.parseNot(); err == nil {
+			left = queryBinaryNode{operator: "and", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (parser *queryParser) parseNot() (queryNode, error) {
+	if parser.peek() != "not" {
+		return parser.parseComparison()
+	}
+
+	parser.index++
+	operand, err := parser.parseNot()
+	return queryNotNode{operand: operand}, err
+}
+
+func (parser *queryParser) parseComparison() (queryNode, error) {
+	left, err := parser.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator := parser.peek(); operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		parser.index++
+		right, err := parser.parseSum()
+		return queryBinaryNode{operator: operator, left: left, right: right}, err
+	default:
+		return left, nil
+	}
+}
+
+func (parser *queryParser) parseSum() (queryNode, error) {
+	left, err := parser.parseTerm()
+	for err == nil && (parser.peek() == "+" || parser.peek() == "-") {
+		operator := parser.tokens[parser.index]
+		parser.index++
+		var right queryNode
+		if right, err = parser.parseTerm(); err == nil {
+			left = queryBinaryNode{operator: operator, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (parser *queryParser) parseTerm() (queryNode, error) {
+	token, err := parser.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if number, err := strconv.Atoi(token); err == nil {
+		return queryConstantNode(number), nil
+	}
+
+	switch token {
+	case "(":
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, parser.expect(")")
+	case "ply":
+		return queryPlyNode{}, nil
+	case "wtm":
+		return querySideToMoveNode(White), nil
+	case "btm":
+		return querySideToMoveNode(Black), nil
+	case "check":
+		return queryCheckNode{}, nil
+	case "material":
+		signature, err := parser.next()
+		if err != nil {
+			return nil, err
+		}
+		return parseQueryMaterialSignature(signature)
+	case "passed":
+		if token, err = parser.next(); err != nil {
+			return nil, err
+		}
+		if token != "P" && token != "p" {
+			return nil, fmt.Errorf("expected P or p after passed instead of %s in the query", token)
+		}
+		return parser.parsePieceCount(token, true)
+	}
+
+	if len(token) == 1 {
+		if _, ok := queryPieceTypes[byte(unicode.ToUpper(rune(token[0])))]; ok {
+			return parser.parsePieceCount(token, false)
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s in the query", token)
+}
+
+func (parser *queryParser) parsePieceCount(piece string, passed bool) (queryNode, error) {
+	node := queryPieceCountNode{color: White, pieceType: queryPieceTypes[piece[0]], squares: FullBitBoard, passed: passed}
+	if unicode.IsLower(rune(piece[0])) {
+		node.color, node.pieceType = Black, queryPieceTypes[byte(unicode.ToUpper(rune(piece[0])))]
+	}
+
+	if parser.peek() != "on" {
+		return node, nil
+	}
+	parser.index++
+
+	if parser.peek() != "[" {
+		token, err := parser.next()
+		if err != nil {
+			return nil, err
+		}
+		node.squares, err = parseQuerySquares(token)
+		return node, err
+	}
+
+	parser.index++
+	node.squares = EmptyBitBoard
+	for {
+		token, err := parser.next()
+		if err != nil {
+			return nil, err
+		}
+		squares, err := parseQuerySquares(token)
+		if err != nil {
+			return nil, err
+		}
+		node.squares |= squares
+
+		if token, err = parser.next(); err != nil || token == "]" {
+			return node, err
+		}
+		if token != "," {
+			return nil, fmt.Errorf("expected , or ] instead of %s in the query", token)
+		}
+	}
+}
+
+// parseQuerySquares reads a square such as e4, a file such as a*, a rank such as *4, or the light or dark squares.
+func parseQuerySquares(token string) (Bitboard, error) {
+	squares := EmptyBitBoard
+	switch {
+	case token == "light" || token == "dark":
+		for square := uint8(0); square < 64; square++ {
+			if ((File(square)+Rank(square))%2 == 0) == (token == "dark") {
+				squares.SetBit(square)
+			}
+		}
+	case isSquareNotation(token):
+		squares.SetBit(convertSquareNotationToSquareNumber(token))
+	case len(token) == 2 && token[1] == '*' && token[0] >= 'a' && token[0] <= 'h':
+		for rank := uint8(0); rank < 8; rank++ {
+			squares.SetBit(rank*8 + token[0] - 'a')
+		}
+	case len(token) == 2 && token[0] == '*' && token[1] >= '1' && token[1] <= '8':
+		for file := uint8(0); file < 8; file++ {
+			squares.SetBit((token[1]-'1')*8 + file)
+		}
+	default:
+		return squares, fmt.Errorf("invalid squares %s in the query", token)
+	}
+	return squares, nil
+}
+
+func parseQueryMaterialSignature(signature string) (queryNode, error) {
+	node := queryMaterialNode{}
+	halves := strings.Split(signature, "v")
+	if len(halves) != 2 {
+		return nil, fmt.Errorf("invalid material %s in the query, expected e.g. KRPvKR", signature)
+	}
+
+	for half, pieces := range halves {
+		pieces = strings.TrimPrefix(pieces, "K")
+		for index := 0; index < len(pieces); index++ {
+			pieceType, ok := queryPieceTypes[pieces[index]]
+			if !ok || pieceType == King {
+				return nil, fmt.Errorf("invalid material %s in the query, expected e.g. KRPvKR", signature)
+			}
+			if pieceType == Pawn && index+1 < len(pieces) && pieces[index+1] == '*' {
+				node.anyPawns[half] = true
+				index++
+				continue
+			}
+			node.counts[half][pieceType]++
+		}
+	}
+	return node, nil
+}
+
+type QuerySettings struct {
+	InputFilePaths []string
+	OutputFilePath string
+	Format         string
+	AllMatches     bool
+	Threads        int
+	Query          *PositionQuery
+}
+
+func DefaultQuerySettings() QuerySettings {
+	return QuerySettings{Format: QueryPgnFormat, Threads: runtime.NumCPU()}
+}
+
+// ParseQuerySettings reads the input PGN files, separated by commas and possibly given as patterns such as
+// "games/*.pgn", followed by "<name> <value>" pairs, then "where" and the query, e.g.
+// "games/*.pgn format epd where material KRvKR". The output defaults to the first input file name with a "_query"
+// suffix and the extension of the format. With "matches first", the default, only the first matching position of
+// each game is reported, and with "matches all", every one of them.
+func ParseQuerySettings(command string) (QuerySettings, error) {
+	settings := DefaultQuerySettings()
+	commandFields := strings.Fields(command)
+
+	whereIndex := len(commandFields)
+	for index, field := range commandFields {
+		if field == "where" {
+			whereIndex = index
+			break
+		}
+	}
+	if whereIndex == len(commandFields) {
+		return settings, errors.New("expected the input PGN files followed by <name> <value> pairs, where and the query")
+	}
+
+	query, err := ParsePositionQuery(strings.Join(commandFields[whereIndex+1:], " "))
+	if err != nil {
+		return settings, err
+	}
+	settings.Query = query
+
+	settingFields := commandFields[:whereIndex]
+	if len(settingFields)%2 != 1 {
+		return settings, errors.New("expected the input PGN files followed by <name> <value> pairs, where and the query")
+	}
+
+	for _, pattern := range strings.Split(settingFields[0], ",") {
+		filePaths, err := filepath.Glob(pattern)
+		if err != nil || len(filePaths) == 0 {
+			return settings, fmt.Errorf("no files match %s", pattern)
+		}
+		settings.InputFilePaths = append(settings.InputFilePaths, filePaths...)
+	}
+
+	for index := 1; index < len(settingFields); index += 2 {
+		name, value := settingFields[index], settingFields[index+1]
+
+		var err error
+		switch name {
+		case "output":
+			settings.OutputFilePath = value
+		case "format":
+			settings.Format = value
+			if value != QueryPgnFormat && value != QueryEpdFormat {
+				err = errors.New("unknown format")
+			}
+		case "matches":
+			settings.AllMatches = value == "all"
+			if value != "all" && value != "first" {
+				err = errors.New("unknown matches")
+			}
+		case "threads":
+			settings.Threads, err = strconv.Atoi(value)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.OutputFilePath == "" {
+		settings.OutputFilePath = strings.TrimSuffix(settings.InputFilePaths[0], ".pgn") + "_query." + settings.Format
+	}
+
+	if settings.Threads < 1 {
+		return settings, errors.New("threads must be at least 1")
+	}
+
+	return settings, nil
+}
+
+// QueryHit is a game where the query matched, with the plies of the matching positions, counted from 0 for the
+// starting position, and their FENs.
+type QueryHit struct {
+	FilePath   string
+	GameNumber int
+	Game       PgnGame
+	Plies      []int
+	FENs       []string
+}
+
+// MarkedGame returns the game with a comment where each stretch of matching positions starts.
+func (hit QueryHit) MarkedGame() PgnGame {
+	game := hit.Game
+	game.Moves = append([]PgnMove{}, hit.Game.Moves...)
+
+	for index, ply := range hit.Plies {
+		if index > 0 && hit.Plies[index-1] == ply-1 {
+			continue
+		}
+		if ply < len(game.Moves) {
+			game.Moves[ply].CommentBefore = strings.TrimSpace(game.Moves[ply].CommentBefore + " " + queryMatchComment)
+		} else if ply > 0 {
+			game.Moves[ply-1].Comment = strings.TrimSpace(game.Moves[ply-1].Comment + " " + queryMatchComment)
+		}
+	}
+	return game
+}
+
+// EPDs returns the matching positions as EPD records, identified by the file and the number of the game, with the
+// players and the move number as a comment.
+func (hit QueryHit) EPDs() []string {
+	records := []string{}
+	for index, fen := range hit.FENs {
+		fenFields := strings.Fields(fen)
+		separator := "."
+		if fenFields[1] == "b" {
+			separator = "..."
+		}
+
+		records = append(records, fmt.Sprintf("%s hmvc %s; fmvn %s; id \"%s #%d\"; c0 \"%s - %s, move %d%s\";",
+			strings.Join(fenFields[:4], " "), fenFields[4], fenFields[5], filepath.Base(hit.FilePath), hit.GameNumber,
+			hit.Game.Tag("White"), hit.Game.Tag("Black"), hit.Game.getMoveNumber(hit.Plies[index]), separator))
+	}
+	return records
+}
+
+var errQueryMatched = errors.New("query matched")
+
+// SearchPgnFile replays the games of a PGN file and returns those where a position matches the query, with the
+// first matching position or all of them, and the number of games searched. Games which can't be read are skipped,
+// and games with an illegal move are searched up to it.
+func SearchPgnFile(query *PositionQuery, filePath string, evaluator Evaluator, allMatches bool) ([]QueryHit, int, error) {
+	pgnFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer pgnFile.Close()
+
+	hits := []QueryHit{}
+	searchedGames := 0
+	position := Position{}
+	pgnReader := NewPgnReader(pgnFile)
+	for gameNumber := 1; ; gameNumber++ {
+		game, err := pgnReader.ReadGame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || ValidateFEN(game.StartingFEN()) != nil {
+			continue
+		}
+		searchedGames++
+
+		hit := QueryHit{FilePath: filePath, GameNumber: gameNumber}
+		reachedPlies := 0
+		matchPosition := func(position *Position, ply int, move Move) error {
+			reachedPlies = ply + 1
+			if !query.Matches(position, ply) {
+				return nil
+			}
+
+			hit.Plies = append(hit.Plies, ply)
+			hit.FENs = append(hit.FENs, setFENMoveNumber(position.GenFEN(), game.getMoveNumber(ply)))
+			if !allMatches {
+				return errQueryMatched
+			}
+			return nil
+		}
+
+		// The position reached after the last move, or before an illegal one, hasn't been visited yet.
+		if ReplayPgnGame(&game, &position, evaluator, matchPosition) != errQueryMatched {
+			matchPosition(&position, reachedPlies, NullMove)
+		}
+
+		if len(hit.Plies) > 0 {
+			hit.Game = game
+			hits = append(hits, hit)
+		}
+	}
+	return hits, searchedGames, nil
+}
+
+type queryFileResult struct {
+	hits          []QueryHit
+	searchedGames int
+	err           error
+}
+
+// SearchPgnFiles searches the PGN files for the query, in parallel over the files, and writes the matching games to
+// the output file, as PGN games with a comment where the matches start or as EPD records of the matching positions,
+// in the order of the files and of the games.
+func SearchPgnFiles(settings QuerySettings, newEvaluator func() Evaluator, output io.Writer) error {
+	results := make([]queryFileResult, len(settings.InputFilePaths))
+	fileIndices := make(chan int, len(settings.InputFilePaths))
+	completedFiles := make(chan int)
+
+	for fileIndex := range settings.InputFilePaths {
+		fileIndices <- fileIndex
+	}
+	close(fileIndices)
+
+	for worker := 0; worker < min(settings.Threads, len(settings.InputFilePaths)); worker++ {
+		go func() {
+			evaluator := newEvaluator()
+			for fileIndex := range fileIndices {
+				result := &results[fileIndex]
+				result.hits, result.searchedGames, result.err = SearchPgnFile(settings.Query, settings.InputFilePaths[fileIndex], evaluator, settings.AllMatches)
+				completedFiles <- fileIndex
+			}
+		}()
+	}
+
+	for range settings.InputFilePaths {
+		fileIndex := <-completedFiles
+		result := results[fileIndex]
+		if result.err != nil {
+			fmt.Fprintf(output, "%s: skipped, %v\n", settings.InputFilePaths[fileIndex], result.err)
+		} else {
+			fmt.Fprintf(output, "%s: %d of %d games match\n", settings.InputFilePaths[fileIndex], len(result.hits), result.searchedGames)
+		}
+	}
+
+	outputFile, err := os.Create(settings.OutputFilePath)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	writer := bufio.NewWriter(outputFile)
+	hitCount, positionCount, searchedGames := 0, 0, 0
+	for _, result := range results {
+		searchedGames += result.searchedGames
+		for _, hit := range result.hits {
+			if settings.Format == QueryEpdFormat {
+				for _, record := range hit.EPDs() {
+					fmt.Fprintln(writer, record)
+				}
+			} else {
+				fmt.Fprintln(writer, hit.MarkedGame())
+			}
+			hitCount++
+			positionCount += len(hit.Plies)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "%d of %d games match, at %d positions\n", hitCount, searchedGames, positionCount)
+	return nil
+}
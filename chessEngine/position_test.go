@@ -0,0 +1,43 @@
+package chessEngine
+
+import "testing"
+
+func TestEnPassantCaptureHash(t *testing.T) {
+	testCases := []struct {
+		fen     string
+		uciMove string
+	}{
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6"},
+		{"rnbqkbnr/pppp1ppp/8/8/3PpP2/8/PPP1P1PP/RNBQKBNR b KQkq d3 0 3", "e4d3"},
+	}
+
+	evaluator := &DefaultEvaluator{}
+	for _, testCase := range testCases {
+		position := Position{}
+		position.LoadFEN(testCase.fen, evaluator)
+		initialHash := position.PositionHash
+
+		legalMoves := GeneratePseudoLegalMoves(&position)
+		found := false
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			move := legalMoves.Moves[moveIndex]
+			if move.String() != testCase.uciMove {
+				continue
+			}
+			found = true
+
+			// The capturing pawn is hashed on its destination square like any other moved piece
+			position.DoMove(move, evaluator)
+			if position.PositionHash != ZobristSingleton.GenHash(&position) {
+				t.Errorf("%s: the hash after %s differs from the hash of the resulting position", testCase.fen, testCase.uciMove)
+			}
+			position.UnDoPreviousMove(move, evaluator)
+			if position.PositionHash != initialHash {
+				t.Errorf("%s: the hash isn't restored after undoing %s", testCase.fen, testCase.uciMove)
+			}
+		}
+		if !found {
+			t.Errorf("%s: %s isn't a legal move", testCase.fen, testCase.uciMove)
+		}
+	}
+}
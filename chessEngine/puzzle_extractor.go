@@ -0,0 +1,411 @@
+package chessEngine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPuzzleScanDepth      = 8
+	DefaultPuzzleDepth          = 14
+	DefaultPuzzleWinningScore   = 250
+	DefaultPuzzleScoreGap       = 200
+	DefaultPuzzleErrorLoss      = 200
+	DefaultPuzzleMinimumMoves   = 2
+	DefaultPuzzleMaximumMoves   = 6
+	DefaultPuzzleHashMB         = 64
+	MinimumPuzzleRating         = 600
+	MaximumPuzzleRating         = 3000
+	puzzleBaseRating            = 800
+	puzzleRatingPerMove         = 200
+	puzzleQuietFirstMoveRating  = 300
+	puzzleRatingPerDiscoveryPly = 40
+)
+
+type PuzzleSettings struct {
+	InputFilePath          string
+	OutputFilePath         string
+	ScanDepth              uint8
+	Depth                  uint8
+	WinningScore           int
+	ScoreGap               int
+	ErrorLoss              int
+	MinimumMoves           int
+	MaximumMoves           int
+	TranspositionTableSize uint64
+}
+
+func DefaultPuzzleSettings() PuzzleSettings {
+	return PuzzleSettings{
+		ScanDepth:              DefaultPuzzleScanDepth,
+		Depth:                  DefaultPuzzleDepth,
+		WinningScore:           DefaultPuzzleWinningScore,
+		ScoreGap:               DefaultPuzzleScoreGap,
+		ErrorLoss:              DefaultPuzzleErrorLoss,
+		MinimumMoves:           DefaultPuzzleMinimumMoves,
+		MaximumMoves:           DefaultPuzzleMaximumMoves,
+		TranspositionTableSize: DefaultPuzzleHashMB,
+	}
+}
+
+// ParsePuzzleSettings reads the input PGN file followed by "<name> <value>" pairs, e.g.
+// "games.pgn output puzzles.txt depth 16 gap 300". The output defaults to the input file name with a "_puzzles.txt"
+// suffix.
+func ParsePuzzleSettings(command string) (PuzzleSettings, error) {
+	settings := DefaultPuzzleSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 1 {
+		return settings, errors.New("expected the input PGN file followed by <name> <value> pairs")
+	}
+	settings.InputFilePath = commandFields[0]
+
+	for index := 1; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "output":
+			settings.OutputFilePath = value
+		case "scanDepth", "depth":
+			var depth uint64
+			depth, err = strconv.ParseUint(value, 10, 8)
+			if name == "depth" {
+				settings.Depth = uint8(depth)
+			} else {
+				settings.ScanDepth = uint8(depth)
+			}
+		case "winning":
+			settings.WinningScore, err = strconv.Atoi(value)
+		case "gap":
+			settings.ScoreGap, err = strconv.Atoi(value)
+		case "error":
+			settings.ErrorLoss, err = strconv.Atoi(value)
+		case "minMoves":
+			settings.MinimumMoves, err = strconv.Atoi(value)
+		case "maxMoves":
+			settings.MaximumMoves, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.OutputFilePath == "" {
+		settings.OutputFilePath = strings.TrimSuffix(settings.InputFilePath, ".pgn") + "_puzzles.txt"
+	}
+
+	if settings.ScanDepth < 1 || settings.Depth < 1 || settings.Depth > MaxDepth || settings.ScanDepth > MaxDepth || settings.TranspositionTableSize < 1 {
+		return settings, fmt.Errorf("scanDepth and depth must be between 1 and %d, and hash at least 1", MaxDepth)
+	}
+	if settings.WinningScore <= 0 || settings.ScoreGap <= 0 || settings.ErrorLoss <= 0 {
+		return settings, errors.New("winning, gap and error must be positive")
+	}
+	if settings.MinimumMoves < 1 || settings.MaximumMoves < settings.MinimumMoves {
+		return settings, errors.New("minMoves must be positive and maxMoves at least minMoves")
+	}
+
+	return settings, nil
+}
+
+// Puzzle is a position where the side to move has a single winning move, with the forced solution line, alternating
+// the moves of the solver and the best replies of the opponent, and a rough estimate of its difficulty as a rating.
+type Puzzle struct {
+	FEN      string
+	UciMoves []string
+	SANMoves []string
+	Rating   int
+	Source   string
+}
+
+// String writes the puzzle as "<fen> | <uci moves> | <san moves> | <rating> | <source>".
+func (puzzle Puzzle) String() string {
+	return fmt.Sprintf("%s | %s | %s | %d | %s", puzzle.FEN, strings.Join(puzzle.UciMoves, " "), strings.Join(puzzle.SANMoves, " "), puzzle.Rating, puzzle.Source)
+}
+
+// puzzleSearch is the result of a search for the puzzle extraction, with the latest line of each principal variation
+// and the depth from which the best move didn't change anymore.
+type puzzleSearch struct {
+	lines          []SearchInfo
+	bestMove       Move
+	legalMoves     uint8
+	discoveryDepth int
+}
+
+// puzzleSearcher searches the positions of the games with the game searcher, collecting its principal variations.
+type puzzleSearcher struct {
+	gameSearcher   GameSearcher
+	evaluator      Evaluator
+	multiPVOption  EngineOption
+	latestLines    map[int]SearchInfo
+	discoveryDepth int
+}
+
+func newPuzzleSearcher(gameSearcher GameSearcher, evaluator Evaluator) (*puzzleSearcher, error) {
+	infoOutputSearcher, ok := gameSearcher.(interface{ SetInfoOutput(io.Writer) })
+	if !ok {
+		return nil, errors.New("the game searcher doesn't report the scores of its searches")
+	}
+	_, multiPVOption, ok := findEngineOption(gameSearcher.GetOptions(), "MultiPV")
+	if !ok {
+		return nil, errors.New("the game searcher can't search several principal variations")
+	}
+
+	searcher := &puzzleSearcher{gameSearcher: gameSearcher, evaluator: evaluator, multiPVOption: multiPVOption}
+	infoOutputSearcher.SetInfoOutput(&searchInfoWriter{onLine: func(line string) {
+		searchInfo, ok := ParseSearchInfo(line)
+		if !ok {
+			return
+		}
+
+		previousBestLine := searcher.latestLines[1]
+		searcher.latestLines[searchInfo.MultiPV] = searchInfo
+		if searchInfo.MultiPV == 1 && len(searchInfo.PV) > 0 && (len(previousBestLine.PV) == 0 || previousBestLine.PV[0] != searchInfo.PV[0]) {
+			searcher.discoveryDepth = searchInfo.Depth
+		}
+	}})
+	return searcher, nil
+}
+
+func (searcher *puzzleSearcher) close() {
+	searcher.multiPVOption.Set("1")
+	searcher.gameSearcher.(interface{ SetInfoOutput(io.Writer) }).SetInfoOutput(io.Discard)
+}
+
+func (searcher *puzzleSearcher) search(depth uint8, lineCount int) puzzleSearch {
+	result := puzzleSearch{legalMoves: GenerateLegalMoves(searcher.gameSearcher.Position(), searcher.evaluator).Size}
+	if result.legalMoves == 0 {
+		return result
+	}
+
+	searcher.multiPVOption.Set(strconv.Itoa(lineCount))
+	searcher.latestLines = map[int]SearchInfo{}
+	searcher.discoveryDepth = 0
+
+	searcher.gameSearcher.InitializeTimeManager(InfiniteTime, NoValue, NoValue, NoValue, depth, math.MaxUint64)
+	result.bestMove = searcher.gameSearcher.StartSearch(searcher.evaluator)
+	result.discoveryDepth = searcher.discoveryDepth
+	for lineNumber := 1; lineNumber <= lineCount; lineNumber++ {
+		if searchInfo, found := searcher.latestLines[lineNumber]; found {
+			result.lines = append(result.lines, searchInfo)
+		}
+	}
+	return result
+}
+
+// getScore returns the capped score of the best line, from the point of view of the side to move, or the score of
+// the game result once it's over.
+func (result puzzleSearch) getScore(position *Position) int {
+	if result.legalMoves == 0 {
+		if position.IsCurrentSideInCheck() {
+			return -annotationScoreCap
+		}
+		return 0
+	}
+	if len(result.lines) == 0 {
+		return 0
+	}
+	return getCappedScore(result.lines[0])
+}
+
+// hasSingleWinningMove tells whether the best move wins, and the second best move is far enough behind.
+func (result puzzleSearch) hasSingleWinningMove(settings PuzzleSettings) bool {
+	if len(result.lines) == 0 || getCappedScore(result.lines[0]) < settings.WinningScore {
+		return false
+	}
+	if len(result.lines) == 1 {
+		return result.legalMoves == 1
+	}
+	return getCappedScore(result.lines[1]) <= getCappedScore(result.lines[0])-settings.ScoreGap
+}
+
+// ExtractPuzzles scans the main line of the game for the positions following an error of the opponent, where the
+// side to move has a single winning move, and keeps those whose solution stays forced for the minimum number of
+// moves, or ends with a checkmate. The solution goes on while each move of the solver is the single winning one,
+// the opponent replying with its best move.
+func ExtractPuzzles(game *PgnGame, gameSearcher GameSearcher, evaluator Evaluator, settings PuzzleSettings) ([]Puzzle, error) {
+	if len(game.Moves) >= MaximumNumberOfPlies-2*settings.MaximumMoves {
+		return nil, fmt.Errorf("games longer than %d plies can't be scanned", MaximumNumberOfPlies-2*settings.MaximumMoves-1)
+	}
+	if err := ValidateFEN(game.StartingFEN()); err != nil {
+		return nil, err
+	}
+
+	searcher, err := newPuzzleSearcher(gameSearcher, evaluator)
+	if err != nil {
+		return nil, err
+	}
+	defer searcher.close()
+
+	gameSearcher.ResetToNewGame()
+	gameSearcher.InitializeSearchInfo(game.StartingFEN(), evaluator)
+	position := gameSearcher.Position()
+
+	puzzles := []Puzzle{}
+	playedMoves := []Move{}
+	previousScore, nextCandidatePly := 0, 1
+	for ply := 0; ply <= len(game.Moves); ply++ {
+		score := searcher.search(settings.ScanDepth, 1).getScore(position)
+
+		// The move of the opponent lost at least the error threshold, and left a winning position.
+		if ply >= nextCandidatePly && score+previousScore >= settings.ErrorLoss && score >= settings.WinningScore {
+			separator := "."
+			if position.SideToMove == Black {
+				separator = "..."
+			}
+
+			puzzle, found := findPuzzle(searcher, settings)
+			if found {
+				puzzle.FEN = setFENMoveNumber(puzzle.FEN, game.getMoveNumber(ply))
+				puzzle.Source = fmt.Sprintf("%s - %s, move %d%s", game.Tag("White"), game.Tag("Black"), game.getMoveNumber(ply), separator)
+				puzzles = append(puzzles, puzzle)
+				nextCandidatePly = ply + len(puzzle.UciMoves)
+			}
+
+			// The solution was played on the searcher, so the game is replayed up to the current position.
+			gameSearcher.InitializeSearchInfo(game.StartingFEN(), evaluator)
+			for _, move := range playedMoves {
+				applyGameMove(gameSearcher, move, evaluator)
+			}
+		}
+
+		if ply == len(game.Moves) {
+			break
+		}
+		move, err := ParseSANMove(position, game.Moves[ply].SAN, evaluator)
+		if err != nil {
+			return puzzles, fmt.Errorf("move %d: %w", game.getMoveNumber(ply), err)
+		}
+		applyGameMove(gameSearcher, move, evaluator)
+		playedMoves = append(playedMoves, move)
+		previousScore = score
+	}
+
+	return puzzles, nil
+}
+
+// setFENMoveNumber replaces the move number of the FEN, since the positions reached by a move with black to move
+// are numbered one move ahead by GenFEN.
+func setFENMoveNumber(fen string, moveNumber int) string {
+	fenFields := strings.Fields(fen)
+	if len(fenFields) != 6 {
+		return fen
+	}
+	fenFields[5] = strconv.Itoa(moveNumber)
+	return strings.Join(fenFields, " ")
+}
+
+// findPuzzle plays the solution from the current position of the searcher, and tells whether it's a puzzle.
+func findPuzzle(searcher *puzzleSearcher, settings PuzzleSettings) (Puzzle, bool) {
+	position := searcher.gameSearcher.Position()
+	puzzle := Puzzle{FEN: position.GenFEN(), UciMoves: []string{}, SANMoves: []string{}}
+
+	firstSearch := searcher.search(settings.Depth, 2)
+	if firstSearch.legalMoves < 2 || !firstSearch.hasSingleWinningMove(settings) {
+		return puzzle, false
+	}
+
+	solverSearch, solverMoves, checkmate := firstSearch, 0, false
+	for {
+		solverMove := solverSearch.bestMove
+		puzzle.UciMoves = append(puzzle.UciMoves, solverMove.String())
+		puzzle.SANMoves = append(puzzle.SANMoves, ConvertMoveToSAN(position, solverMove, searcher.evaluator))
+		applyGameMove(searcher.gameSearcher, solverMove, searcher.evaluator)
+		solverMoves++
+
+		opponentSearch := searcher.search(settings.Depth, 1)
+		if opponentSearch.legalMoves == 0 {
+			checkmate = position.IsCurrentSideInCheck()
+			break
+		}
+		if solverMoves == settings.MaximumMoves {
+			break
+		}
+
+		opponentMove := opponentSearch.bestMove
+		opponentSAN := ConvertMoveToSAN(position, opponentMove, searcher.evaluator)
+		applyGameMove(searcher.gameSearcher, opponentMove, searcher.evaluator)
+
+		solverSearch = searcher.search(settings.Depth, 2)
+		if !solverSearch.hasSingleWinningMove(settings) {
+			break
+		}
+		puzzle.UciMoves = append(puzzle.UciMoves, opponentMove.String())
+		puzzle.SANMoves = append(puzzle.SANMoves, opponentSAN)
+	}
+
+	if solverMoves < settings.MinimumMoves && !checkmate {
+		return puzzle, false
+	}
+
+	puzzle.Rating = estimatePuzzleRating(puzzle, firstSearch)
+	return puzzle, true
+}
+
+// estimatePuzzleRating rates the puzzle from the length of its solution, whether its first move is a quiet move,
+// which is harder to spot than a capture or a check, and the search depth needed to find it.
+func estimatePuzzleRating(puzzle Puzzle, firstSearch puzzleSearch) int {
+	rating := puzzleBaseRating + puzzleRatingPerMove*(len(puzzle.UciMoves)/2)
+	firstSAN := puzzle.SANMoves[0]
+	if !strings.ContainsAny(firstSAN, "x+#=") {
+		rating += puzzleQuietFirstMoveRating
+	}
+	rating += puzzleRatingPerDiscoveryPly * max(firstSearch.discoveryDepth-1, 0)
+	return max(min(rating, MaximumPuzzleRating), MinimumPuzzleRating)
+}
+
+// ExtractPuzzlesFromPgnFile writes the puzzles found in the games of the input file into the output file, one per
+// line, reporting the progress of each game to the output.
+func ExtractPuzzlesFromPgnFile(settings PuzzleSettings, gameSearcher GameSearcher, evaluator Evaluator, output io.Writer) error {
+	inputFile, err := os.Open(settings.InputFilePath)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	outputFile, err := os.Create(settings.OutputFilePath)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	puzzleCount := 0
+	pgnReader := NewPgnReader(inputFile)
+	for gameNumber := 1; ; gameNumber++ {
+		game, err := pgnReader.ReadGame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(output, "Game %d: skipped, %v\n", gameNumber, err)
+			continue
+		}
+
+		puzzles, err := ExtractPuzzles(&game, gameSearcher, evaluator, settings)
+		for _, puzzle := range puzzles {
+			if _, err := fmt.Fprintln(outputFile, puzzle); err != nil {
+				return err
+			}
+		}
+		puzzleCount += len(puzzles)
+
+		if err != nil {
+			fmt.Fprintf(output, "Game %d: %d puzzles, then stopped: %v\n", gameNumber, len(puzzles), err)
+		} else {
+			fmt.Fprintf(output, "Game %d: %d puzzles\n", gameNumber, len(puzzles))
+		}
+	}
+
+	fmt.Fprintf(output, "Found %d puzzles\n", puzzleCount)
+	return nil
+}
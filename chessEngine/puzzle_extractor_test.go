@@ -0,0 +1,40 @@
+package chessEngine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractPuzzlesBackRankMates(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+
+	settings := DefaultPuzzleSettings()
+	settings.ScanDepth, settings.Depth = 4, 6
+
+	// Black leaves the back rank twice, white only taking the second chance. The second error follows the first
+	// puzzle by less than twice its length.
+	game := readTestPgnGame(t, `[White "White"]
+[Black "Black"]
+[FEN "3r2k1/5ppp/8/8/8/8/5PPP/R5K1 b - - 0 1"]
+[SetUp "1"]
+
+1... Rd2 2. h3 Rd8 3. Kh2 Rd2 4. Ra8+ Rd8 5. Rxd8# 1-0
+`)
+
+	puzzles, err := ExtractPuzzles(&game, searcher, evaluator, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSources := []string{"White - Black, move 2.", "White - Black, move 4."}
+	if len(puzzles) != len(expectedSources) {
+		t.Fatalf("found the puzzles %v", puzzles)
+	}
+	for index, puzzle := range puzzles {
+		if strings.Join(puzzle.UciMoves, " ") != "a1a8 d2d8 a8d8" || strings.Join(puzzle.SANMoves, " ") != "Ra8+ Rd8 Rxd8#" || puzzle.Source != expectedSources[index] {
+			t.Errorf("found the puzzle %v", puzzle)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package chessEngine
+
+const raceDetectorEnabled = false
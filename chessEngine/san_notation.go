@@ -0,0 +1,193 @@
+package chessEngine
+
+import (
+	"fmt"
+	"strings"
+)
+
+var sanPieceLetters = map[uint8]string{Knight: "N", Bishop: "B", Rook: "R", Queen: "Q", King: "K"}
+
+var sanPromotionLetters = map[uint8]string{
+	PromotionToKnight: "N",
+	PromotionToBishop: "B",
+	PromotionToRook:   "R",
+	PromotionToQueen:  "Q",
+}
+
+// ConvertMoveToSAN writes a legal move of the position in the standard algebraic notation used by PGN, e.g. "Nbd7",
+// "exd5", "e8=Q+" or "O-O-O#".
+func ConvertMoveToSAN(position *Position, move Move, evaluator Evaluator) string {
+	fromSquare, toSquare := move.GetFromSquare(), move.GetToSquare()
+	pieceType := position.SquareContent[fromSquare].PieceType
+
+	var sb strings.Builder
+	switch {
+	case move.GetMoveType() == CastleMoveType:
+		if File(toSquare) == File(G1) {
+			sb.WriteString("O-O")
+		} else {
+			sb.WriteString("O-O-O")
+		}
+	case pieceType == Pawn:
+		if isCaptureMove(position, move) {
+			sb.WriteByte(convertSquareNumberToSquareNotation(fromSquare)[0])
+			sb.WriteString("x")
+		}
+		sb.WriteString(convertSquareNumberToSquareNotation(toSquare))
+		if move.GetMoveType() == PromotionMoveType {
+			sb.WriteString("=" + sanPromotionLetters[move.GetMoveInfo()])
+		}
+	default:
+		sb.WriteString(sanPieceLetters[pieceType])
+		sb.WriteString(getSANDisambiguation(position, move, evaluator))
+		if isCaptureMove(position, move) {
+			sb.WriteString("x")
+		}
+		sb.WriteString(convertSquareNumberToSquareNotation(toSquare))
+	}
+
+	position.DoMove(move, evaluator)
+	if position.IsCurrentSideInCheck() {
+		if GenerateLegalMoves(position, evaluator).Size == 0 {
+			sb.WriteString("#")
+		} else {
+			sb.WriteString("+")
+		}
+	}
+	position.UnDoPreviousMove(move, evaluator)
+
+	return sb.String()
+}
+
+// getSANDisambiguation returns the file, the rank or the square of origin of a piece move when other pieces of the
+// same type can reach the same square, preferring the file, then the rank.
+func getSANDisambiguation(position *Position, move Move, evaluator Evaluator) string {
+	fromSquare := move.GetFromSquare()
+	pieceType := position.SquareContent[fromSquare].PieceType
+	sameFile, sameRank, ambiguous := false, false, false
+
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		otherMove := legalMoves.Moves[moveIndex]
+		otherFromSquare := otherMove.GetFromSquare()
+		if otherMove.GetToSquare() != move.GetToSquare() || otherFromSquare == fromSquare || position.SquareContent[otherFromSquare].PieceType != pieceType {
+			continue
+		}
+
+		ambiguous = true
+		sameFile = sameFile || File(otherFromSquare) == File(fromSquare)
+		sameRank = sameRank || Rank(otherFromSquare) == Rank(fromSquare)
+	}
+
+	fromNotation := convertSquareNumberToSquareNotation(fromSquare)
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return fromNotation[:1]
+	case !sameRank:
+		return fromNotation[1:]
+	default:
+		return fromNotation
+	}
+}
+
+// ParseSANMove returns the legal move of the position written in the standard algebraic notation. Check and mate
+// markers, annotation suffixes such as "!?", a missing "=" before the promotion piece, needless disambiguation and
+// castling written with zeros are tolerated.
+func ParseSANMove(position *Position, san string, evaluator Evaluator) (Move, error) {
+	notation := strings.TrimRight(san, "+#!?")
+	notation = strings.ReplaceAll(notation, "0", "O")
+
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	if notation == "O-O" || notation == "O-O-O" {
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			move := legalMoves.Moves[moveIndex]
+			if move.GetMoveType() == CastleMoveType && (File(move.GetToSquare()) == File(G1)) == (notation == "O-O") {
+				return move, nil
+			}
+		}
+		return NullMove, fmt.Errorf("illegal move %s", san)
+	}
+
+	pieceType := Pawn
+	if len(notation) > 0 && strings.ContainsRune("NBRQK", rune(notation[0])) {
+		pieceType = CharToPiece[notation[0]].PieceType
+		notation = notation[1:]
+	}
+
+	promotionPieceType := NoneType
+	if pieceType == Pawn && len(notation) > 0 && strings.ContainsRune("NBRQ", rune(notation[len(notation)-1])) {
+		promotionPieceType = CharToPiece[notation[len(notation)-1]].PieceType
+		notation = strings.TrimSuffix(notation[:len(notation)-1], "=")
+	}
+
+	notation = strings.ReplaceAll(strings.ReplaceAll(notation, "x", ""), "-", "")
+	if len(notation) < 2 || len(notation) > 4 || !isSquareNotation(notation[len(notation)-2:]) {
+		return NullMove, fmt.Errorf("invalid move %s", san)
+	}
+	toSquare := convertSquareNotationToSquareNumber(notation[len(notation)-2:])
+	disambiguation := notation[:len(notation)-2]
+
+	matchingMove, matches := NullMove, 0
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		move := legalMoves.Moves[moveIndex]
+		fromNotation := convertSquareNumberToSquareNotation(move.GetFromSquare())
+		if move.GetToSquare() != toSquare || position.SquareContent[move.GetFromSquare()].PieceType != pieceType || move.GetMoveType() == CastleMoveType {
+			continue
+		}
+		if !strings.Contains(fromNotation, disambiguation) {
+			continue
+		}
+
+		movePromotionPieceType := NoneType
+		if move.GetMoveType() == PromotionMoveType {
+			movePromotionPieceType = move.GetMoveInfo() + 1
+		}
+		if movePromotionPieceType != promotionPieceType {
+			continue
+		}
+
+		matchingMove = move
+		matches++
+	}
+
+	switch matches {
+	case 0:
+		return NullMove, fmt.Errorf("illegal move %s", san)
+	case 1:
+		return matchingMove, nil
+	default:
+		return NullMove, fmt.Errorf("ambiguous move %s", san)
+	}
+}
+
+func isSquareNotation(notation string) bool {
+	return len(notation) == 2 && notation[0] >= 'a' && notation[0] <= 'h' && notation[1] >= '1' && notation[1] <= '8'
+}
+
+// ConvertUciLineToSAN writes the moves of a line given in the UCI notation, such as a principal variation, in the
+// standard algebraic notation, stopping at the first illegal move. The position is left as it was.
+func ConvertUciLineToSAN(position *Position, uciMoves []string, evaluator Evaluator) []string {
+	sanMoves := []string{}
+	playedMoves := []Move{}
+
+	for _, uciMove := range uciMoves {
+		if position.stateStackSize >= MaxStateStackSize-2 {
+			break
+		}
+		move, ok := findLegalUciMove(position, uciMove, evaluator)
+		if !ok {
+			break
+		}
+
+		sanMoves = append(sanMoves, ConvertMoveToSAN(position, move, evaluator))
+		position.DoMove(move, evaluator)
+		playedMoves = append(playedMoves, move)
+	}
+
+	for index := len(playedMoves) - 1; index >= 0; index-- {
+		position.UnDoPreviousMove(playedMoves[index], evaluator)
+	}
+	return sanMoves
+}
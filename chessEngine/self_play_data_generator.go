@@ -0,0 +1,334 @@
+package chessEngine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultSelfPlayPositionCount        = 1000000
+	DefaultSelfPlayThreads              = 1
+	DefaultSelfPlayDepth                = 8
+	DefaultSelfPlayNodeCount            = 20000
+	DefaultSelfPlayRandomOpeningPlies   = 8
+	DefaultSelfPlayMaximumGamePlies     = 400
+	DefaultSelfPlayTranspositionTableMB = 16
+	MinimumSelfPlayNodeCount            = 1000
+	SelfPlayProgressReportInterval      = 10 * time.Second
+
+	WhiteWinResult = "1.0"
+	DrawResult     = "0.5"
+	BlackWinResult = "0.0"
+)
+
+type SelfPlaySettings struct {
+	OutputFilePath         string
+	PositionCount          uint64
+	Threads                int
+	Depth                  uint8
+	NodeCount              uint64
+	RandomOpeningPlies     int
+	MaximumGamePlies       int
+	TranspositionTableSize uint64
+	Seed                   int64
+}
+
+type TrainingPosition struct {
+	FEN      string
+	Score    int16
+	BestMove Move
+}
+
+type selfPlayGame struct {
+	positions []TrainingPosition
+	result    string
+}
+
+func DefaultSelfPlaySettings() SelfPlaySettings {
+	return SelfPlaySettings{
+		OutputFilePath:         "gofish_training_data.txt",
+		PositionCount:          DefaultSelfPlayPositionCount,
+		Threads:                DefaultSelfPlayThreads,
+		Depth:                  DefaultSelfPlayDepth,
+		NodeCount:              DefaultSelfPlayNodeCount,
+		RandomOpeningPlies:     DefaultSelfPlayRandomOpeningPlies,
+		MaximumGamePlies:       DefaultSelfPlayMaximumGamePlies,
+		TranspositionTableSize: DefaultSelfPlayTranspositionTableMB,
+		Seed:                   time.Now().UnixNano(),
+	}
+}
+
+// ParseSelfPlaySettings reads "<name> <value>" pairs, e.g. "output data.txt positions 100000 depth 6 threads 4".
+func ParseSelfPlaySettings(command string) (SelfPlaySettings, error) {
+	settings := DefaultSelfPlaySettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 0 {
+		return settings, errors.New("expected <name> <value> pairs")
+	}
+
+	for index := 0; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "output":
+			settings.OutputFilePath = value
+		case "positions":
+			settings.PositionCount, err = strconv.ParseUint(value, 10, 64)
+		case "threads":
+			settings.Threads, err = strconv.Atoi(value)
+		case "depth":
+			var depth uint64
+			depth, err = strconv.ParseUint(value, 10, 8)
+			settings.Depth = uint8(depth)
+		case "nodes":
+			settings.NodeCount, err = strconv.ParseUint(value, 10, 64)
+		case "randomPlies":
+			settings.RandomOpeningPlies, err = strconv.Atoi(value)
+		case "maxPlies":
+			settings.MaximumGamePlies, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		case "seed":
+			settings.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.Threads < 1 || settings.Depth < 1 || settings.Depth > MaxDepth || settings.NodeCount < MinimumSelfPlayNodeCount || settings.TranspositionTableSize < 1 {
+		return settings, fmt.Errorf("threads and depth must be positive (depth at most %d), nodes at least %d and hash at least 1", MaxDepth, MinimumSelfPlayNodeCount)
+	}
+
+	if settings.RandomOpeningPlies < 0 || settings.MaximumGamePlies <= settings.RandomOpeningPlies || settings.MaximumGamePlies >= MaximumNumberOfPlies {
+		return settings, fmt.Errorf("maxPlies must be greater than randomPlies and less than %d", MaximumNumberOfPlies)
+	}
+
+	return settings, nil
+}
+
+// GenerateSelfPlayData plays concurrent self-play games and appends the quiet positions encountered to the output
+// file, one per line, as "<fen> | <score> | <result> | <best move>". Score and result are from white's point of
+// view, with the result being 1.0, 0.5 or 0.0. If the output file already holds positions, generation resumes
+// and stops once the file holds the requested number of positions.
+func GenerateSelfPlayData(settings SelfPlaySettings, newEvaluator func() Evaluator) error {
+	existingPositions, err := prepareSelfPlayOutputFile(settings.OutputFilePath)
+	if err != nil {
+		return err
+	}
+
+	if existingPositions >= settings.PositionCount {
+		fmt.Printf("%s already holds %d positions\n", settings.OutputFilePath, existingPositions)
+		return nil
+	}
+
+	outputFile, err := os.OpenFile(settings.OutputFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	if existingPositions > 0 {
+		fmt.Printf("Resuming from %d positions\n", existingPositions)
+	}
+
+	games := make(chan selfPlayGame, settings.Threads)
+	var stopGeneration atomic.Bool
+	var workers sync.WaitGroup
+
+	for worker := 0; worker < settings.Threads; worker++ {
+		workers.Add(1)
+		// Offset the seed by the existing positions so that a resumed run doesn't replay the same games.
+		workerSeed := settings.Seed + int64(existingPositions) + int64(worker)*7919
+		go func() {
+			defer workers.Done()
+			playSelfPlayGames(settings, newEvaluator(), rand.New(rand.NewSource(workerSeed)), games, &stopGeneration)
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(games)
+	}()
+
+	writtenPositions, writeErr := writeSelfPlayGames(outputFile, games, existingPositions, settings.PositionCount)
+	stopGeneration.Store(true)
+	for range games {
+	}
+
+	if writeErr != nil {
+		return writeErr
+	}
+
+	fmt.Printf("Generated %d positions, %s holds %d positions\n", writtenPositions-existingPositions, settings.OutputFilePath, writtenPositions)
+	return nil
+}
+
+func prepareSelfPlayOutputFile(outputFilePath string) (uint64, error) {
+	outputFile, err := os.OpenFile(outputFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer outputFile.Close()
+
+	positionCount := uint64(0)
+	completeLinesLength := int64(0)
+	fileReader := bufio.NewReader(outputFile)
+
+	for {
+		line, err := fileReader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		completeLinesLength += int64(len(line))
+		positionCount++
+	}
+
+	// Drop a partially written line left behind by an interrupted run.
+	return positionCount, outputFile.Truncate(completeLinesLength)
+}
+
+func writeSelfPlayGames(outputFile *os.File, games chan selfPlayGame, writtenPositions uint64, requiredPositions uint64) (uint64, error) {
+	var gameBuffer bytes.Buffer
+	startInstant := time.Now()
+	lastReportInstant := startInstant
+	startPositions := writtenPositions
+	gameCount := 0
+
+	for game := range games {
+		gameBuffer.Reset()
+		gamePositions := uint64(0)
+		for _, trainingPosition := range game.positions {
+			if writtenPositions+gamePositions >= requiredPositions {
+				break
+			}
+
+			fmt.Fprintf(&gameBuffer, "%s | %d | %s | %v\n", trainingPosition.FEN, trainingPosition.Score, game.result, trainingPosition.BestMove)
+			gamePositions++
+		}
+
+		// Each game is written with a single call, so that an interrupted run leaves complete games behind.
+		if _, err := outputFile.Write(gameBuffer.Bytes()); err != nil {
+			return writtenPositions, err
+		}
+		writtenPositions += gamePositions
+
+		gameCount++
+		if time.Since(lastReportInstant) >= SelfPlayProgressReportInterval {
+			lastReportInstant = time.Now()
+			positionsPerSecond := float64(writtenPositions-startPositions) / time.Since(startInstant).Seconds()
+			fmt.Printf("%d/%d positions, %d games, %.0f positions/s\n", writtenPositions, requiredPositions, gameCount, positionsPerSecond)
+		}
+
+		if writtenPositions >= requiredPositions {
+			break
+		}
+	}
+
+	return writtenPositions, nil
+}
+
+func playSelfPlayGames(settings SelfPlaySettings, evaluator Evaluator, randomGenerator *rand.Rand, games chan selfPlayGame, stopGeneration *atomic.Bool) {
+	searcher := NewDefaultSearcher()
+	searcher.SetInfoOutput(io.Discard)
+	searcher.SetTranspositionTable(NewDefaultTranspositionTable(settings.TranspositionTableSize * 1024 * 1024))
+	defer searcher.CleanUp()
+
+	for !stopGeneration.Load() {
+		game, ok := playSelfPlayGame(searcher, settings, evaluator, randomGenerator, stopGeneration)
+		if ok && len(game.positions) > 0 {
+			games <- game
+		}
+	}
+}
+
+func playSelfPlayGame(searcher *DefaultSearcher, settings SelfPlaySettings, evaluator Evaluator, randomGenerator *rand.Rand, stopGeneration *atomic.Bool) (selfPlayGame, bool) {
+	game := selfPlayGame{}
+	searcher.ResetToNewGame()
+	searcher.InitializeSearchInfo(FENStartPosition, evaluator)
+	position := searcher.Position()
+
+	positionOccurrences := map[uint64]int{position.PositionHash: 1}
+
+	for ply := 0; ply < settings.RandomOpeningPlies; ply++ {
+		legalMoves := GenerateLegalMoves(position, evaluator)
+		if legalMoves.Size == 0 {
+			return game, false
+		}
+
+		applyGameMove(searcher, legalMoves.Moves[randomGenerator.Intn(int(legalMoves.Size))], evaluator)
+		positionOccurrences[position.PositionHash]++
+	}
+
+	for ply := settings.RandomOpeningPlies; ply < settings.MaximumGamePlies; ply++ {
+		if stopGeneration.Load() {
+			return game, false
+		}
+
+		legalMoves := GenerateLegalMoves(position, evaluator)
+		if legalMoves.Size == 0 {
+			game.result = DrawResult
+			if position.IsCurrentSideInCheck() {
+				game.result = winResultForColor(position.SideToMove ^ 1)
+			}
+			return game, true
+		}
+
+		if position.Rule50 >= 100 || positionOccurrences[position.PositionHash] >= 3 || isDrawnState(position) {
+			game.result = DrawResult
+			return game, true
+		}
+
+		searcher.InitializeTimeManager(InfiniteTime, NoValue, NoValue, NoValue, settings.Depth, settings.NodeCount)
+		bestMove := searcher.StartSearch(evaluator)
+		score := searcher.LastSearchScore()
+
+		if bestMove == NullMove {
+			return game, false
+		}
+
+		isQuietPosition := !position.IsCurrentSideInCheck() &&
+			bestMove.GetMoveType() != CaptureMoveType &&
+			bestMove.GetMoveType() != PromotionMoveType &&
+			abs(score) < MateThreshold
+
+		if isQuietPosition {
+			whiteScore := score
+			if position.SideToMove == Black {
+				whiteScore = -score
+			}
+			game.positions = append(game.positions, TrainingPosition{FEN: position.GenFEN(), Score: whiteScore, BestMove: bestMove})
+		}
+
+		applyGameMove(searcher, bestMove, evaluator)
+		positionOccurrences[position.PositionHash]++
+	}
+
+	game.result = DrawResult
+	return game, true
+}
+
+func winResultForColor(color uint8) string {
+	if color == White {
+		return WhiteWinResult
+	}
+	return BlackWinResult
+}
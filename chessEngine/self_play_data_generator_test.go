@@ -0,0 +1,71 @@
+package chessEngine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSelfPlaySettings(t *testing.T) {
+	settings, err := ParseSelfPlaySettings("output data.txt positions 5000 threads 4 depth 6 nodes 5000 randomPlies 4 maxPlies 200 hash 8 seed 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSettings := SelfPlaySettings{
+		OutputFilePath:         "data.txt",
+		PositionCount:          5000,
+		Threads:                4,
+		Depth:                  6,
+		NodeCount:              5000,
+		RandomOpeningPlies:     4,
+		MaximumGamePlies:       200,
+		TranspositionTableSize: 8,
+		Seed:                   42,
+	}
+	if settings != expectedSettings {
+		t.Errorf("parsed %+v, expected %+v", settings, expectedSettings)
+	}
+
+	invalidCommands := []string{
+		"positions",
+		"positions many",
+		"depth 300",
+		"depth 0",
+		"threads 0",
+		"nodes 10",
+		"hash 0",
+		"randomPlies -1",
+		"randomPlies 10 maxPlies 10",
+		"maxPlies 1024",
+		"unknown 1",
+	}
+	for _, command := range invalidCommands {
+		if _, err := ParseSelfPlaySettings(command); err == nil {
+			t.Errorf("%q was accepted", command)
+		}
+	}
+}
+
+func TestPrepareSelfPlayOutputFile(t *testing.T) {
+	outputFilePath := filepath.Join(t.TempDir(), "data.txt")
+
+	positionCount, err := prepareSelfPlayOutputFile(outputFilePath)
+	if err != nil || positionCount != 0 {
+		t.Fatalf("a new file holds %d positions: %v", positionCount, err)
+	}
+
+	// The partial line of an interrupted run is dropped
+	completeLines := "8/8/8/8/8/8/8/K6k w - - 0 1 | 0 | 0.5 | a1a2\n8/8/8/8/8/8/K7/7k b - - 1 1 | 0 | 0.5 | h1h2\n"
+	if err := os.WriteFile(outputFilePath, []byte(completeLines+"8/8/8/8/8/8/K6k/8 w - - 2 2 | 0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	positionCount, err = prepareSelfPlayOutputFile(outputFilePath)
+	if err != nil || positionCount != 2 {
+		t.Fatalf("the file holds %d positions: %v", positionCount, err)
+	}
+	if contents, _ := os.ReadFile(outputFilePath); string(contents) != completeLines {
+		t.Errorf("the file holds %q after resuming", contents)
+	}
+}
@@ -0,0 +1,142 @@
+package chessEngine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCalibrationGamePairs          = 20
+	DefaultCalibrationTimeControl        = "10+0.1"
+	DefaultCalibrationLevelStep          = 2
+	DefaultCalibrationRandomOpeningPlies = 8
+	DefaultCalibrationTranspositionTable = 16
+)
+
+type SkillCalibrationSettings struct {
+	GamePairs              int
+	TimeControl            string
+	LevelStep              int
+	AnchorElo              int
+	RandomOpeningPlies     int
+	TranspositionTableSize uint64
+	Seed                   int64
+}
+
+func DefaultSkillCalibrationSettings() SkillCalibrationSettings {
+	return SkillCalibrationSettings{
+		GamePairs:              DefaultCalibrationGamePairs,
+		TimeControl:            DefaultCalibrationTimeControl,
+		LevelStep:              DefaultCalibrationLevelStep,
+		AnchorElo:              MaximumUciElo,
+		RandomOpeningPlies:     DefaultCalibrationRandomOpeningPlies,
+		TranspositionTableSize: DefaultCalibrationTranspositionTable,
+		Seed:                   time.Now().UnixNano(),
+	}
+}
+
+// ParseSkillCalibrationSettings reads "<name> <value>" pairs, e.g. "pairs 50 tc 5+0.05 step 4".
+func ParseSkillCalibrationSettings(command string) (SkillCalibrationSettings, error) {
+	settings := DefaultSkillCalibrationSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 0 {
+		return settings, errors.New("expected <name> <value> pairs")
+	}
+
+	for index := 0; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "pairs":
+			settings.GamePairs, err = strconv.Atoi(value)
+		case "tc":
+			settings.TimeControl = value
+		case "step":
+			settings.LevelStep, err = strconv.Atoi(value)
+		case "anchor":
+			settings.AnchorElo, err = strconv.Atoi(value)
+		case "randomPlies":
+			settings.RandomOpeningPlies, err = strconv.Atoi(value)
+		case "hash":
+			settings.TranspositionTableSize, err = strconv.ParseUint(value, 10, 64)
+		case "seed":
+			settings.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.GamePairs < 1 || settings.LevelStep < 1 || settings.LevelStep > MaximumSkillLevel || settings.RandomOpeningPlies < 0 || settings.TranspositionTableSize < 1 {
+		return settings, fmt.Errorf("pairs and hash must be positive, step between 1 and %d and randomPlies not negative", MaximumSkillLevel)
+	}
+
+	return settings, nil
+}
+
+func newCalibrationPlayer(skillLevel int, settings SkillCalibrationSettings, evaluator Evaluator) MatchPlayer {
+	searcher := NewDefaultSearcher()
+	searcher.SetInfoOutput(io.Discard)
+	searcher.Reset(evaluator)
+	searcher.SetTranspositionTable(NewDefaultTranspositionTable(settings.TranspositionTableSize * 1024 * 1024))
+	searcher.GetOptions()["Skill Level"].Set(strconv.Itoa(skillLevel))
+
+	return MatchPlayer{Name: fmt.Sprintf("Skill Level %d", skillLevel), GameSearcher: searcher, Evaluator: evaluator}
+}
+
+// CalibrateSkillLevels plays matches between neighbouring skill levels, from the full strength down, and chains
+// the measured Elo differences from the anchor rating of the full strength. It returns the ratings of all the
+// skill levels, interpolating between the measured ones, in the layout of SkillLevelElos.
+func CalibrateSkillLevels(settings SkillCalibrationSettings, newEvaluator func() Evaluator, output io.Writer) ([MaximumSkillLevel + 1]int, error) {
+	levelElos := [MaximumSkillLevel + 1]int{}
+	timeControl, err := ParseTimeControl(settings.TimeControl, FischerClockMode)
+	if err != nil {
+		return levelElos, err
+	}
+
+	matchSettings := MatchSettings{
+		TimeControl:        timeControl,
+		GamePairs:          settings.GamePairs,
+		RandomOpeningPlies: settings.RandomOpeningPlies,
+		Seed:               settings.Seed,
+	}
+
+	levelElos[MaximumSkillLevel] = settings.AnchorElo
+	higherLevel := MaximumSkillLevel
+	higherPlayer := newCalibrationPlayer(higherLevel, settings, newEvaluator())
+
+	for higherLevel > 0 {
+		lowerLevel := max(0, higherLevel-settings.LevelStep)
+		lowerPlayer := newCalibrationPlayer(lowerLevel, settings, newEvaluator())
+
+		result, err := RunMatch(lowerPlayer, higherPlayer, matchSettings)
+		higherPlayer.GameSearcher.CleanUp()
+		if err != nil {
+			lowerPlayer.GameSearcher.CleanUp()
+			return levelElos, err
+		}
+
+		eloDifference := result.EloDifference()
+		levelElos[lowerLevel] = levelElos[higherLevel] + int(math.Round(eloDifference))
+		fmt.Fprintf(output, "level %d vs level %d: +%d =%d -%d, %+.0f Elo, level %d rated %d\n", lowerLevel, higherLevel, result.Wins, result.Draws, result.Losses, eloDifference, lowerLevel, levelElos[lowerLevel])
+
+		for level := lowerLevel + 1; level < higherLevel; level++ {
+			levelElos[level] = levelElos[lowerLevel] + (levelElos[higherLevel]-levelElos[lowerLevel])*(level-lowerLevel)/(higherLevel-lowerLevel)
+		}
+
+		higherLevel, higherPlayer = lowerLevel, lowerPlayer
+	}
+
+	higherPlayer.GameSearcher.CleanUp()
+	return levelElos, nil
+}
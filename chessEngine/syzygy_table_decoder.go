@@ -0,0 +1,912 @@
+package chessEngine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	SyzygyMaxPieces = 7
+
+	syzygyWDLMagic uint32 = 0x5d23e871
+	syzygyDTZMagic uint32 = 0xa50c66d7
+
+	syzygySplitHeaderFlag    uint8 = 1
+	syzygyHasPawnsHeaderFlag uint8 = 2
+
+	syzygySideToMoveFlag  uint8 = 1
+	syzygyMappedFlag      uint8 = 2
+	syzygyWinPliesFlag    uint8 = 4
+	syzygyLossPliesFlag   uint8 = 8
+	syzygyWideFlag        uint8 = 16
+	syzygySingleValueFlag uint8 = 128
+
+	syzygyLeafSymbol       = 0xfff
+	syzygySparseEntrySize  = 6
+	syzygyUniquePiecesSize = 31332
+	syzygyKingPairsSize    = 462
+)
+
+var errCorruptedSyzygyTable = errors.New("corrupted syzygy table")
+
+var (
+	syzygyMapB1H1H7     [64]uint64
+	syzygyMapA1D1D4     [64]uint64
+	syzygyMapKK         [10][64]uint64
+	syzygyBinomial      [6][64]uint64
+	syzygyMapPawns      [64]int
+	syzygyLeadPawnIndex [6][64]uint64
+	syzygyLeadPawnsSize [6][4]uint64
+
+	initializeSyzygyIndexingOnce sync.Once
+)
+
+// syzygyPairsData describes one compressed sub-table: the values of a side to move and, for tables with pawns, a
+// file of the leading pawn. Values are compressed with recursive pairing, each symbol expanding into a pair of
+// symbols, and the resulting symbols are stored in blocks as canonical Huffman codes.
+type syzygyPairsData struct {
+	flags           uint8
+	minSymbolLength uint8
+	maxSymbolLength uint8
+	numberOfBlocks  uint32
+	blockSize       int64
+	span            uint64
+	sparseIndexSize uint64
+	blockLengthSize uint64
+	lowestSymbols   []uint16
+	base64          []uint64
+	symbolLengths   []uint8
+	binaryTree      []byte
+	sparseIndex     []byte
+	blockLengths    []uint16
+	dataOffset      int64
+	pieces          [SyzygyMaxPieces]uint8
+	groupIndex      [SyzygyMaxPieces + 1]uint64
+	groupLength     [SyzygyMaxPieces + 1]int
+	mapIndex        [4]int
+}
+
+// syzygyTable is the WDL or DTZ file of a material such as KRPvKR, whose first side is white. The file is opened
+// and its header parsed on the first probe.
+type syzygyTable struct {
+	code            string
+	filePath        string
+	isDTZ           bool
+	key             uint64
+	mirroredKey     uint64
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int
+
+	loadOnce  sync.Once
+	loadError error
+	file      *os.File
+	pairsData [2][4]syzygyPairsData
+	dtzMap    []byte
+}
+
+// syzygyFileCursor reads a table file sequentially, keeping the first error it encounters.
+type syzygyFileCursor struct {
+	file   *os.File
+	offset int64
+	err    error
+}
+
+func offDiagonalA1H8(square uint8) int {
+	return int(Rank(square)) - int(File(square))
+}
+
+func initializeSyzygyIndexing() {
+	code := uint64(0)
+	for square := uint8(0); square < 64; square++ {
+		if offDiagonalA1H8(square) < 0 {
+			syzygyMapB1H1H7[square] = code
+			code++
+		}
+	}
+
+	var diagonalSquares []uint8
+	code = 0
+	for square := uint8(A1); square <= D4; square++ {
+		if offDiagonalA1H8(square) < 0 && File(square) <= FileD {
+			syzygyMapA1D1D4[square] = code
+			code++
+		} else if offDiagonalA1H8(square) == 0 && File(square) <= FileD {
+			diagonalSquares = append(diagonalSquares, square)
+		}
+	}
+	for _, square := range diagonalSquares {
+		syzygyMapA1D1D4[square] = code
+		code++
+	}
+
+	// Kings which are both on the a1-h8 diagonal are encoded last, and the second king isn't above the
+	// diagonal when the first one is on it.
+	type kingPair struct {
+		firstKingCode uint64
+		secondKing    uint8
+	}
+	var kingsOnDiagonal []kingPair
+	code = 0
+	for firstKingCode := uint64(0); firstKingCode < 10; firstKingCode++ {
+		for firstKing := uint8(A1); firstKing <= D4; firstKing++ {
+			if syzygyMapA1D1D4[firstKing] != firstKingCode || (firstKingCode == 0 && firstKing != B1) {
+				continue
+			}
+
+			for secondKing := uint8(0); secondKing < 64; secondKing++ {
+				if firstKing == secondKing || ComputedKingMoves[firstKing]&BitboardForSquare[secondKing] != 0 {
+					continue
+				} else if offDiagonalA1H8(firstKing) == 0 && offDiagonalA1H8(secondKing) > 0 {
+					continue
+				} else if offDiagonalA1H8(firstKing) == 0 && offDiagonalA1H8(secondKing) == 0 {
+					kingsOnDiagonal = append(kingsOnDiagonal, kingPair{firstKingCode, secondKing})
+				} else {
+					syzygyMapKK[firstKingCode][secondKing] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, pair := range kingsOnDiagonal {
+		syzygyMapKK[pair.firstKingCode][pair.secondKing] = code
+		code++
+	}
+
+	syzygyBinomial[0][0] = 1
+	for squareCount := 1; squareCount < 64; squareCount++ {
+		for pieceCount := 0; pieceCount < 6 && pieceCount <= squareCount; pieceCount++ {
+			if pieceCount > 0 {
+				syzygyBinomial[pieceCount][squareCount] += syzygyBinomial[pieceCount-1][squareCount-1]
+			}
+			if pieceCount < squareCount {
+				syzygyBinomial[pieceCount][squareCount] += syzygyBinomial[pieceCount][squareCount-1]
+			}
+		}
+	}
+
+	// The leading pawn is the one with the highest mapping, which is the closest to the edge and, among
+	// pawns of the same file, the one with the lowest rank. The mapping of a square is the number of squares
+	// available to the other pawns when the leading pawn is on it.
+	availableSquares := 47
+	for leadPawnCount := 1; leadPawnCount <= 5; leadPawnCount++ {
+		for file := uint8(FileA); file <= FileD; file++ {
+			index := uint64(0)
+			for rank := uint8(Rank2); rank <= Rank7; rank++ {
+				square := rank*8 + file
+				if leadPawnCount == 1 {
+					syzygyMapPawns[square] = availableSquares
+					syzygyMapPawns[square^7] = availableSquares - 1
+					availableSquares -= 2
+				}
+				syzygyLeadPawnIndex[leadPawnCount][square] = index
+				index += syzygyBinomial[leadPawnCount-1][syzygyMapPawns[square]]
+			}
+			syzygyLeadPawnsSize[leadPawnCount][file] = index
+		}
+	}
+}
+
+func isValidSyzygyCode(code string) bool {
+	sides := strings.Split(code, "v")
+	if len(sides) != 2 || len(sides[0])+len(sides[1]) > SyzygyMaxPieces {
+		return false
+	}
+
+	for _, side := range sides {
+		if !strings.HasPrefix(side, "K") || strings.Trim(side[1:], "QRBNP") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func newSyzygyTable(code string, filePath string, isDTZ bool) *syzygyTable {
+	table := &syzygyTable{
+		code:        code,
+		filePath:    filePath,
+		isDTZ:       isDTZ,
+		key:         materialSignatureFromCode(code, White),
+		mirroredKey: materialSignatureFromCode(code, Black),
+	}
+
+	var pieceCounts [2][6]int
+	for sideIndex, side := range strings.Split(code, "v") {
+		for _, pieceChar := range side {
+			pieceCounts[sideIndex][CharToPiece[byte(pieceChar)].PieceType]++
+			table.pieceCount++
+		}
+
+		for pieceType := Pawn; pieceType < King; pieceType++ {
+			table.hasUniquePieces = table.hasUniquePieces || pieceCounts[sideIndex][pieceType] == 1
+		}
+	}
+
+	// The side with fewer pawns leads when both sides have pawns, as it compresses better
+	whitePawns, blackPawns := pieceCounts[0][Pawn], pieceCounts[1][Pawn]
+	table.hasPawns = whitePawns+blackPawns > 0
+	if blackPawns == 0 || (whitePawns > 0 && blackPawns >= whitePawns) {
+		table.pawnCount = [2]int{whitePawns, blackPawns}
+	} else {
+		table.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+
+	return table
+}
+
+func (table *syzygyTable) load() error {
+	table.loadOnce.Do(func() {
+		if err := table.readHeader(); err != nil {
+			table.loadError = fmt.Errorf("%s: %w", table.filePath, err)
+			fmt.Printf("info string failed to load syzygy table %v\n", table.loadError)
+		}
+	})
+	return table.loadError
+}
+
+func (table *syzygyTable) close() {
+	if table.file != nil {
+		table.file.Close()
+	}
+}
+
+func (table *syzygyTable) readHeader() error {
+	file, err := os.Open(table.filePath)
+	if err != nil {
+		return err
+	}
+
+	cursor := syzygyFileCursor{file: file}
+	expectedMagic := syzygyWDLMagic
+	if table.isDTZ {
+		expectedMagic = syzygyDTZMagic
+	}
+
+	if magic := cursor.readUint32(); cursor.err == nil && magic != expectedMagic {
+		file.Close()
+		return errors.New("not a syzygy table file")
+	}
+
+	headerFlags := cursor.readByte()
+	if cursor.err == nil && (headerFlags&syzygyHasPawnsHeaderFlag != 0) != table.hasPawns {
+		file.Close()
+		return errors.New("table header doesn't match the material")
+	}
+
+	sides, files := 1, 1
+	if !table.isDTZ && table.key != table.mirroredKey {
+		sides = 2
+	}
+	if table.hasPawns {
+		files = 4
+	}
+	bothSidesHavePawns := table.hasPawns && table.pawnCount[1] > 0
+
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		orderBytes := [2]uint8{cursor.readByte(), 0xff}
+		if bothSidesHavePawns {
+			orderBytes[1] = cursor.readByte()
+		}
+
+		pieceBytes := cursor.read(int64(table.pieceCount))
+		for side := 0; side < sides && cursor.err == nil; side++ {
+			pairs := &table.pairsData[side][tablebaseFile]
+			shift := 4 * side
+
+			for pieceIndex, pieceByte := range pieceBytes {
+				pairs.pieces[pieceIndex] = (pieceByte >> shift) & 0xf
+			}
+			table.setGroups(pairs, [2]int{int(orderBytes[0]>>shift) & 0xf, int(orderBytes[1]>>shift) & 0xf}, tablebaseFile)
+		}
+	}
+
+	cursor.alignTo(2)
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		for side := 0; side < sides; side++ {
+			cursor.readPairsSizes(&table.pairsData[side][tablebaseFile])
+		}
+	}
+
+	if table.isDTZ {
+		table.readDTZMap(&cursor, files)
+	}
+
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		for side := 0; side < sides; side++ {
+			pairs := &table.pairsData[side][tablebaseFile]
+			pairs.sparseIndex = cursor.read(int64(pairs.sparseIndexSize) * syzygySparseEntrySize)
+		}
+	}
+
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		for side := 0; side < sides; side++ {
+			pairs := &table.pairsData[side][tablebaseFile]
+			pairs.blockLengths = cursor.readUint16s(pairs.blockLengthSize)
+		}
+	}
+
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		for side := 0; side < sides; side++ {
+			pairs := &table.pairsData[side][tablebaseFile]
+			cursor.alignTo(64)
+			pairs.dataOffset = cursor.offset
+			cursor.offset += int64(pairs.numberOfBlocks) * pairs.blockSize
+		}
+	}
+
+	if cursor.err == nil {
+		if fileInfo, err := file.Stat(); err != nil {
+			cursor.err = err
+		} else if fileInfo.Size() < cursor.offset {
+			cursor.err = errCorruptedSyzygyTable
+		}
+	}
+
+	if cursor.err != nil {
+		file.Close()
+		return cursor.err
+	}
+
+	table.file = file
+	return nil
+}
+
+// setGroups groups the pieces which are encoded together: pieces of the same type and color, except for the
+// leading group, which is made of the leading pawns, of three unique pieces or of the two kings. The order of
+// the groups in the encoding is given by the table file.
+func (table *syzygyTable) setGroups(pairs *syzygyPairsData, order [2]int, tablebaseFile int) {
+	groupCount := 0
+	firstGroupLength := 2
+	if table.hasPawns {
+		firstGroupLength = 0
+	} else if table.hasUniquePieces {
+		firstGroupLength = 3
+	}
+
+	pairs.groupLength[0] = 1
+	for pieceIndex := 1; pieceIndex < table.pieceCount; pieceIndex++ {
+		firstGroupLength--
+		if firstGroupLength > 0 || pairs.pieces[pieceIndex] == pairs.pieces[pieceIndex-1] {
+			pairs.groupLength[groupCount]++
+		} else {
+			groupCount++
+			pairs.groupLength[groupCount] = 1
+		}
+	}
+	groupCount++
+	pairs.groupLength[groupCount] = 0
+
+	bothSidesHavePawns := table.hasPawns && table.pawnCount[1] > 0
+	nextGroup := 1
+	freeSquares := 64 - pairs.groupLength[0]
+	if bothSidesHavePawns {
+		nextGroup = 2
+		freeSquares -= pairs.groupLength[1]
+	}
+
+	index := uint64(1)
+	for encodingOrder := 0; nextGroup < groupCount || encodingOrder == order[0] || encodingOrder == order[1]; encodingOrder++ {
+		if encodingOrder == order[0] {
+			pairs.groupIndex[0] = index
+			if table.hasPawns {
+				index *= syzygyLeadPawnsSize[pairs.groupLength[0]][tablebaseFile]
+			} else if table.hasUniquePieces {
+				index *= syzygyUniquePiecesSize
+			} else {
+				index *= syzygyKingPairsSize
+			}
+		} else if encodingOrder == order[1] {
+			pairs.groupIndex[1] = index
+			index *= syzygyBinomial[pairs.groupLength[1]][48-pairs.groupLength[0]]
+		} else {
+			pairs.groupIndex[nextGroup] = index
+			index *= syzygyBinomial[pairs.groupLength[nextGroup]][freeSquares]
+			freeSquares -= pairs.groupLength[nextGroup]
+			nextGroup++
+		}
+	}
+	pairs.groupIndex[groupCount] = index
+}
+
+func (pairs *syzygyPairsData) size() uint64 {
+	groupCount := 0
+	for pairs.groupLength[groupCount] != 0 {
+		groupCount++
+	}
+	return pairs.groupIndex[groupCount]
+}
+
+func (pairs *syzygyPairsData) leftSymbol(symbol int) int {
+	return int(pairs.binaryTree[3*symbol+1]&0xf)<<8 | int(pairs.binaryTree[3*symbol])
+}
+
+func (pairs *syzygyPairsData) rightSymbol(symbol int) int {
+	return int(pairs.binaryTree[3*symbol+2])<<4 | int(pairs.binaryTree[3*symbol+1]>>4)
+}
+
+// computeSymbolLength returns the number of values, minus one, which a symbol expands into.
+func (pairs *syzygyPairsData) computeSymbolLength(symbol int, visited []bool) uint8 {
+	visited[symbol] = true
+	rightSymbol := pairs.rightSymbol(symbol)
+	if rightSymbol == syzygyLeafSymbol {
+		return 0
+	}
+
+	leftSymbol := pairs.leftSymbol(symbol)
+	if !visited[leftSymbol] {
+		pairs.symbolLengths[leftSymbol] = pairs.computeSymbolLength(leftSymbol, visited)
+	}
+	if !visited[rightSymbol] {
+		pairs.symbolLengths[rightSymbol] = pairs.computeSymbolLength(rightSymbol, visited)
+	}
+	return pairs.symbolLengths[leftSymbol] + pairs.symbolLengths[rightSymbol] + 1
+}
+
+func (cursor *syzygyFileCursor) readPairsSizes(pairs *syzygyPairsData) {
+	pairs.flags = cursor.readByte()
+	if pairs.flags&syzygySingleValueFlag != 0 {
+		pairs.minSymbolLength = cursor.readByte()
+		return
+	}
+
+	pairs.blockSize = 1 << cursor.readByte()
+	pairs.span = 1 << cursor.readByte()
+	pairs.sparseIndexSize = (pairs.size() + pairs.span - 1) / pairs.span
+	padding := cursor.readByte()
+	pairs.numberOfBlocks = cursor.readUint32()
+	pairs.blockLengthSize = uint64(pairs.numberOfBlocks) + uint64(padding)
+	pairs.maxSymbolLength = cursor.readByte()
+	pairs.minSymbolLength = cursor.readByte()
+	if cursor.err != nil || pairs.maxSymbolLength < pairs.minSymbolLength || pairs.minSymbolLength == 0 || pairs.maxSymbolLength > 64 {
+		cursor.fail(errCorruptedSyzygyTable)
+		return
+	}
+
+	// Longer canonical Huffman codes have lower values, so base64[i] is the lowest code of length
+	// minSymbolLength+i, left aligned to 64 bits, and codes of that length are at least base64[i].
+	lengthCount := int(pairs.maxSymbolLength-pairs.minSymbolLength) + 1
+	pairs.lowestSymbols = cursor.readUint16s(uint64(lengthCount))
+	pairs.base64 = make([]uint64, lengthCount)
+	for i := lengthCount - 2; i >= 0 && cursor.err == nil; i-- {
+		pairs.base64[i] = (pairs.base64[i+1] + uint64(pairs.lowestSymbols[i]) - uint64(pairs.lowestSymbols[i+1])) / 2
+	}
+	for i := range pairs.base64 {
+		pairs.base64[i] <<= 64 - i - int(pairs.minSymbolLength)
+	}
+
+	symbolCount := int(cursor.readUint16())
+	pairs.binaryTree = cursor.read(int64(3 * symbolCount))
+	cursor.offset += int64(symbolCount & 1)
+	if cursor.err != nil {
+		return
+	}
+
+	for symbol := 0; symbol < symbolCount; symbol++ {
+		if pairs.rightSymbol(symbol) != syzygyLeafSymbol && (pairs.leftSymbol(symbol) >= symbolCount || pairs.rightSymbol(symbol) >= symbolCount) {
+			cursor.fail(errCorruptedSyzygyTable)
+			return
+		}
+	}
+
+	pairs.symbolLengths = make([]uint8, symbolCount)
+	visited := make([]bool, symbolCount)
+	for symbol := 0; symbol < symbolCount; symbol++ {
+		if !visited[symbol] {
+			pairs.symbolLengths[symbol] = pairs.computeSymbolLength(symbol, visited)
+		}
+	}
+}
+
+// readDTZMap reads the maps from the stored DTZ values to the actual ones, which each sub-table may have for
+// wins, losses, cursed wins and blessed losses.
+func (table *syzygyTable) readDTZMap(cursor *syzygyFileCursor, files int) {
+	mapOffset := cursor.offset
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		pairs := &table.pairsData[0][tablebaseFile]
+		if pairs.flags&syzygyMappedFlag == 0 {
+			continue
+		}
+
+		if pairs.flags&syzygyWideFlag != 0 {
+			cursor.alignTo(2)
+			for i := range pairs.mapIndex {
+				pairs.mapIndex[i] = int(cursor.offset-mapOffset)/2 + 1
+				cursor.offset += 2 * int64(cursor.readUint16())
+			}
+		} else {
+			for i := range pairs.mapIndex {
+				pairs.mapIndex[i] = int(cursor.offset-mapOffset) + 1
+				cursor.offset += int64(cursor.readByte())
+			}
+		}
+	}
+	cursor.alignTo(2)
+
+	mapEnd := cursor.offset
+	cursor.offset = mapOffset
+	table.dtzMap = cursor.read(mapEnd - mapOffset)
+}
+
+func (cursor *syzygyFileCursor) fail(err error) {
+	if cursor.err == nil {
+		cursor.err = err
+	}
+}
+
+func (cursor *syzygyFileCursor) read(length int64) []byte {
+	if cursor.err != nil {
+		return nil
+	}
+
+	buffer := make([]byte, length)
+	if _, err := cursor.file.ReadAt(buffer, cursor.offset); err != nil {
+		if err == io.EOF {
+			err = errCorruptedSyzygyTable
+		}
+		cursor.fail(err)
+		return nil
+	}
+
+	cursor.offset += length
+	return buffer
+}
+
+func (cursor *syzygyFileCursor) readByte() uint8 {
+	if buffer := cursor.read(1); buffer != nil {
+		return buffer[0]
+	}
+	return 0
+}
+
+func (cursor *syzygyFileCursor) readUint16() uint16 {
+	if buffer := cursor.read(2); buffer != nil {
+		return binary.LittleEndian.Uint16(buffer)
+	}
+	return 0
+}
+
+func (cursor *syzygyFileCursor) readUint32() uint32 {
+	if buffer := cursor.read(4); buffer != nil {
+		return binary.LittleEndian.Uint32(buffer)
+	}
+	return 0
+}
+
+func (cursor *syzygyFileCursor) readUint16s(count uint64) []uint16 {
+	buffer := cursor.read(2 * int64(count))
+	if buffer == nil {
+		return nil
+	}
+
+	values := make([]uint16, count)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint16(buffer[2*i:])
+	}
+	return values
+}
+
+func (cursor *syzygyFileCursor) alignTo(alignment int64) {
+	cursor.offset = (cursor.offset + alignment - 1) / alignment * alignment
+}
+
+func getSyzygyPieceCode(piece Piece) uint8 {
+	if piece.Color == Black {
+		return piece.PieceType + 1 + 8
+	}
+	return piece.PieceType + 1
+}
+
+func bitToInt(condition bool) uint64 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// probe looks the position up, returning a WDL value from -2 to 2 for WDL tables, or the DTZ value in plies for
+// DTZ tables given the WDL value of the position. As DTZ tables may only store one side to move, changeSideToMove
+// reports positions with the other side to move.
+func (table *syzygyTable) probe(position *Position, wdl int) (value int, changeSideToMove bool, err error) {
+	pairs, index, tablebaseFile, changeSideToMove, err := table.encodePosition(position)
+	if err != nil || changeSideToMove {
+		return 0, changeSideToMove, err
+	}
+
+	value, err = table.decompressPairs(pairs, index)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !table.isDTZ {
+		return value - 2, false, nil
+	}
+	value, err = table.mapDTZValue(tablebaseFile, value, wdl)
+	return value, false, err
+}
+
+// encodePosition returns the sub-table of the position and its index within it.
+func (table *syzygyTable) encodePosition(position *Position) (pairs *syzygyPairsData, index uint64, tablebaseFile int, changeSideToMove bool, err error) {
+	var squares [SyzygyMaxPieces]uint8
+	var pieces [SyzygyMaxPieces]uint8
+	size, leadPawnCount := 0, 0
+	leadPawns := Bitboard(0)
+
+	// Tables are stored with the first side of the material as white, and only with white to move for
+	// symmetric materials, so the colors and the ranks are flipped for other positions
+	syzygySideToMove := int(position.SideToMove ^ 1)
+	flipColors := MaterialSignature(position) != table.key || (table.key == table.mirroredKey && position.SideToMove == Black)
+	colorFlip, squareFlip := uint8(0), uint8(0)
+	if flipColors {
+		colorFlip, squareFlip = 8, 56
+		syzygySideToMove ^= 1
+	}
+
+	if table.hasPawns {
+		leadPawnColor := White
+		if table.pairsData[0][0].pieces[0]^colorFlip >= 8 {
+			leadPawnColor = Black
+		}
+
+		leadPawns = position.PiecesBitBoard[leadPawnColor][Pawn]
+		for pawns := leadPawns; pawns != 0; size++ {
+			squares[size] = pawns.PopMostSignificantBit() ^ squareFlip
+		}
+		leadPawnCount = size
+
+		leadingPawnIndex := 0
+		for pawnIndex := 1; pawnIndex < leadPawnCount; pawnIndex++ {
+			if syzygyMapPawns[squares[pawnIndex]] > syzygyMapPawns[squares[leadingPawnIndex]] {
+				leadingPawnIndex = pawnIndex
+			}
+		}
+		squares[0], squares[leadingPawnIndex] = squares[leadingPawnIndex], squares[0]
+		tablebaseFile = int(min(File(squares[0]), FileH-File(squares[0])))
+	}
+
+	if table.isDTZ {
+		storedSideToMove := int(table.pairsData[0][tablebaseFile].flags & syzygySideToMoveFlag)
+		if storedSideToMove != syzygySideToMove && (table.key != table.mirroredKey || table.hasPawns) {
+			return nil, 0, tablebaseFile, true, nil
+		}
+	}
+
+	remainingPieces := (position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]) &^ leadPawns
+	for ; remainingPieces != 0 && size < SyzygyMaxPieces; size++ {
+		square := remainingPieces.PopMostSignificantBit()
+		squares[size] = square ^ squareFlip
+		pieces[size] = getSyzygyPieceCode(position.SquareContent[square]) ^ colorFlip
+	}
+	if size != table.pieceCount {
+		return nil, 0, tablebaseFile, false, errCorruptedSyzygyTable
+	}
+
+	pairs = &table.pairsData[0][tablebaseFile]
+	if !table.isDTZ {
+		pairs = &table.pairsData[syzygySideToMove][tablebaseFile]
+	}
+
+	// Order the pieces as in the table
+	for i := leadPawnCount; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if pairs.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	if File(squares[0]) > FileD {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	if table.hasPawns {
+		index = syzygyLeadPawnIndex[leadPawnCount][squares[0]]
+		for i := 2; i < leadPawnCount; i++ {
+			for j := i; j > 1 && syzygyMapPawns[squares[j]] < syzygyMapPawns[squares[j-1]]; j-- {
+				squares[j], squares[j-1] = squares[j-1], squares[j]
+			}
+		}
+
+		for i := 1; i < leadPawnCount; i++ {
+			index += syzygyBinomial[i][syzygyMapPawns[squares[i]]]
+		}
+	} else {
+		index = table.encodeLeadingPieces(pairs, squares[:size])
+	}
+
+	index *= pairs.groupIndex[0]
+	groupStart := pairs.groupLength[0]
+	remainingPawns := table.hasPawns && table.pawnCount[1] > 0
+
+	for group := 1; pairs.groupLength[group] != 0; group++ {
+		groupSquares := squares[groupStart : groupStart+pairs.groupLength[group]]
+		for i := 1; i < len(groupSquares); i++ {
+			for j := i; j > 0 && groupSquares[j] < groupSquares[j-1]; j-- {
+				groupSquares[j], groupSquares[j-1] = groupSquares[j-1], groupSquares[j]
+			}
+		}
+
+		// Squares are mapped down by the number of squares occupied by the previous groups before them
+		groupIndex := uint64(0)
+		for i, square := range groupSquares {
+			mappedSquare := int(square)
+			for _, previousSquare := range squares[:groupStart] {
+				if square > previousSquare {
+					mappedSquare--
+				}
+			}
+			if remainingPawns {
+				mappedSquare -= 8
+			}
+			groupIndex += syzygyBinomial[i+1][mappedSquare]
+		}
+
+		remainingPawns = false
+		index += groupIndex * pairs.groupIndex[group]
+		groupStart += pairs.groupLength[group]
+	}
+	return pairs, index, tablebaseFile, false, nil
+}
+
+// encodeLeadingPieces mirrors the squares so that the first piece is in the a1-d1-d4 triangle and the first
+// piece of the leading group which isn't on the a1-h8 diagonal is below it, then encodes the leading group.
+func (table *syzygyTable) encodeLeadingPieces(pairs *syzygyPairsData, squares []uint8) uint64 {
+	if Rank(squares[0]) > Rank4 {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+
+	for i := 0; i < pairs.groupLength[0]; i++ {
+		if offDiagonalA1H8(squares[i]) == 0 {
+			continue
+		}
+
+		if offDiagonalA1H8(squares[i]) > 0 {
+			for j := i; j < len(squares); j++ {
+				squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+			}
+		}
+		break
+	}
+
+	if !table.hasUniquePieces {
+		return syzygyMapKK[syzygyMapA1D1D4[squares[0]]][squares[1]]
+	}
+
+	secondSquare, thirdSquare := uint64(squares[1]), uint64(squares[2])
+	firstRank, secondRank, thirdRank := uint64(Rank(squares[0])), uint64(Rank(squares[1])), uint64(Rank(squares[2]))
+	secondAdjustment := bitToInt(squares[1] > squares[0])
+	thirdAdjustment := bitToInt(squares[2] > squares[0]) + bitToInt(squares[2] > squares[1])
+
+	if offDiagonalA1H8(squares[0]) != 0 {
+		return (syzygyMapA1D1D4[squares[0]]*63+secondSquare-secondAdjustment)*62 + thirdSquare - thirdAdjustment
+	} else if offDiagonalA1H8(squares[1]) != 0 {
+		return (6*63+firstRank*28+syzygyMapB1H1H7[squares[1]])*62 + thirdSquare - thirdAdjustment
+	} else if offDiagonalA1H8(squares[2]) != 0 {
+		return 6*63*62 + 4*28*62 + firstRank*7*28 + (secondRank-secondAdjustment)*28 + syzygyMapB1H1H7[squares[2]]
+	}
+	return 6*63*62 + 4*28*62 + 4*7*28 + firstRank*7*6 + (secondRank-secondAdjustment)*6 + thirdRank - thirdAdjustment
+}
+
+func (table *syzygyTable) mapDTZValue(tablebaseFile int, value int, wdl int) (int, error) {
+	wdlMapIndices := [5]int{1, 3, 0, 2, 0}
+	pairs := &table.pairsData[0][tablebaseFile]
+
+	if pairs.flags&syzygyMappedFlag != 0 {
+		mapIndex := pairs.mapIndex[wdlMapIndices[wdl+2]] + value
+		if pairs.flags&syzygyWideFlag != 0 {
+			if 2*mapIndex+2 > len(table.dtzMap) {
+				return 0, errCorruptedSyzygyTable
+			}
+			value = int(binary.LittleEndian.Uint16(table.dtzMap[2*mapIndex:]))
+		} else {
+			if mapIndex >= len(table.dtzMap) {
+				return 0, errCorruptedSyzygyTable
+			}
+			value = int(table.dtzMap[mapIndex])
+		}
+	}
+
+	// Values are stored in moves rather than plies unless the flags say otherwise
+	if (wdl == SyzygyWin && pairs.flags&syzygyWinPliesFlag == 0) || (wdl == SyzygyLoss && pairs.flags&syzygyLossPliesFlag == 0) ||
+		wdl == SyzygyCursedWin || wdl == SyzygyBlessedLoss {
+		value *= 2
+	}
+	return value + 1, nil
+}
+
+// decompressPairs returns the value at the index of the sub-table. The sparse index gives the block and the offset
+// within the block of every span-th value, then the Huffman codes of the block are read until reaching the symbol
+// which contains the value, and the symbol is expanded through its pairs.
+func (table *syzygyTable) decompressPairs(pairs *syzygyPairsData, index uint64) (int, error) {
+	if pairs.flags&syzygySingleValueFlag != 0 {
+		return int(pairs.minSymbolLength), nil
+	}
+
+	sparseEntry := index / pairs.span
+	if sparseEntry >= pairs.sparseIndexSize {
+		return 0, errCorruptedSyzygyTable
+	}
+
+	sparseIndex := pairs.sparseIndex[sparseEntry*syzygySparseEntrySize:]
+	block := int64(binary.LittleEndian.Uint32(sparseIndex))
+	offset := int64(binary.LittleEndian.Uint16(sparseIndex[4:]))
+	offset += int64(index%pairs.span) - int64(pairs.span/2)
+
+	for offset < 0 && block > 0 {
+		block--
+		offset += int64(pairs.blockLengths[block]) + 1
+	}
+	for block < int64(len(pairs.blockLengths)) && offset > int64(pairs.blockLengths[block]) {
+		offset -= int64(pairs.blockLengths[block]) + 1
+		block++
+	}
+	if offset < 0 || block >= int64(pairs.numberOfBlocks) {
+		return 0, errCorruptedSyzygyTable
+	}
+
+	blockData := make([]byte, pairs.blockSize+8)
+	if _, err := table.file.ReadAt(blockData[:pairs.blockSize], pairs.dataOffset+block*pairs.blockSize); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	buffer := binary.BigEndian.Uint64(blockData)
+	bufferPosition := 8
+	bufferBits := 64
+	symbol := 0
+
+	for {
+		length := 0
+		for length < len(pairs.base64) && buffer < pairs.base64[length] {
+			length++
+		}
+		if length == len(pairs.base64) {
+			return 0, errCorruptedSyzygyTable
+		}
+
+		symbol = int((buffer-pairs.base64[length])>>(64-length-int(pairs.minSymbolLength))) + int(pairs.lowestSymbols[length])
+		if symbol >= len(pairs.symbolLengths) {
+			return 0, errCorruptedSyzygyTable
+		}
+
+		if offset < int64(pairs.symbolLengths[symbol])+1 {
+			break
+		}
+
+		offset -= int64(pairs.symbolLengths[symbol]) + 1
+		length += int(pairs.minSymbolLength)
+		buffer <<= length
+		bufferBits -= length
+
+		if bufferBits <= 32 {
+			if bufferPosition+4 > len(blockData) {
+				return 0, errCorruptedSyzygyTable
+			}
+			bufferBits += 32
+			buffer |= uint64(binary.BigEndian.Uint32(blockData[bufferPosition:])) << (64 - bufferBits)
+			bufferPosition += 4
+		}
+	}
+
+	for pairs.symbolLengths[symbol] != 0 {
+		leftSymbol := pairs.leftSymbol(symbol)
+		if offset < int64(pairs.symbolLengths[leftSymbol])+1 {
+			symbol = leftSymbol
+		} else {
+			offset -= int64(pairs.symbolLengths[leftSymbol]) + 1
+			symbol = pairs.rightSymbol(symbol)
+		}
+	}
+
+	return pairs.leftSymbol(symbol), nil
+}
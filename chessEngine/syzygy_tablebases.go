@@ -0,0 +1,412 @@
+package chessEngine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SyzygyWDLExtension = ".rtbw"
+	SyzygyDTZExtension = ".rtbz"
+
+	// Positions with as many pieces as the largest tables are only probed from this depth
+	DefaultSyzygyProbeDepth = 1
+
+	// WDL values, cursed wins and blessed losses being drawn by the fifty move rule
+	SyzygyLoss        = -2
+	SyzygyBlessedLoss = -1
+	SyzygyDraw        = 0
+	SyzygyCursedWin   = 1
+	SyzygyWin         = 2
+
+	// Tablebase wins are scored below the mate scores, as the distance to mate is unknown
+	SyzygyWinScore int16 = MateThreshold - MaxDepth - 1
+
+	syzygyWinRank         = 1000
+	syzygyCursedWinRank   = 899
+	syzygyRule50WinBound  = 900
+	syzygyNoMinimumDTZ    = 0xffff
+	syzygyRule50MovePlies = 100
+)
+
+type syzygyProbeState uint8
+
+const (
+	syzygyProbeOK syzygyProbeState = iota
+	syzygyProbeFailed
+	// The best move is a capture or a pawn move, so the DTZ table can't be probed
+	syzygyProbeZeroingBestMove
+	// The DTZ table only stores the other side to move
+	syzygyProbeChangeSideToMove
+)
+
+type syzygyMaterialTables struct {
+	wdl *syzygyTable
+	dtz *syzygyTable
+}
+
+// SyzygyTablebases is the set of Syzygy WDL and DTZ tables found in the directories of a path, keyed by the
+// material signature of the positions.
+type SyzygyTablebases struct {
+	Path      string
+	tables    map[uint64]syzygyMaterialTables
+	count     int
+	dtzCount  int
+	maxPieces int
+}
+
+// SyzygyRootMove is a legal root move ranked by the tablebases, higher ranks being better, along with the
+// score the move is expected to achieve.
+type SyzygyRootMove struct {
+	Move  Move
+	Rank  int
+	Score int16
+}
+
+// LoadSyzygyTablebases finds the tables of the directories in the path, which are separated as in the PATH
+// environment variable. The tables themselves are only read when first probed.
+func LoadSyzygyTablebases(path string) (*SyzygyTablebases, error) {
+	initializeSyzygyIndexingOnce.Do(initializeSyzygyIndexing)
+
+	tablebases := &SyzygyTablebases{Path: path, tables: make(map[uint64]syzygyMaterialTables)}
+	wdlFilePaths, dtzFilePaths := make(map[string]string), make(map[string]string)
+
+	for _, directory := range filepath.SplitList(path) {
+		directoryEntries, err := os.ReadDir(directory)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, directoryEntry := range directoryEntries {
+			fileName := directoryEntry.Name()
+			fileExtension := filepath.Ext(fileName)
+			materialCode := strings.TrimSuffix(fileName, fileExtension)
+			if directoryEntry.IsDir() || !isValidSyzygyCode(materialCode) {
+				continue
+			}
+
+			filePaths := wdlFilePaths
+			if fileExtension == SyzygyDTZExtension {
+				filePaths = dtzFilePaths
+			} else if fileExtension != SyzygyWDLExtension {
+				continue
+			}
+
+			if _, found := filePaths[materialCode]; !found {
+				filePaths[materialCode] = filepath.Join(directory, fileName)
+			}
+		}
+	}
+
+	for materialCode, wdlFilePath := range wdlFilePaths {
+		materialTables := syzygyMaterialTables{wdl: newSyzygyTable(materialCode, wdlFilePath, false)}
+		if dtzFilePath, found := dtzFilePaths[materialCode]; found {
+			materialTables.dtz = newSyzygyTable(materialCode, dtzFilePath, true)
+			tablebases.dtzCount++
+		}
+
+		tablebases.tables[materialTables.wdl.key] = materialTables
+		tablebases.tables[materialTables.wdl.mirroredKey] = materialTables
+		tablebases.maxPieces = max(tablebases.maxPieces, materialTables.wdl.pieceCount)
+		tablebases.count++
+	}
+
+	return tablebases, nil
+}
+
+func (tablebases *SyzygyTablebases) Count() int {
+	return tablebases.count
+}
+
+func (tablebases *SyzygyTablebases) DTZCount() int {
+	return tablebases.dtzCount
+}
+
+func (tablebases *SyzygyTablebases) MaxPieces() int {
+	return tablebases.maxPieces
+}
+
+func (tablebases *SyzygyTablebases) Close() {
+	for _, materialTables := range tablebases.tables {
+		materialTables.wdl.close()
+		if materialTables.dtz != nil {
+			materialTables.dtz.close()
+		}
+	}
+}
+
+// CanProbe returns whether the position has few enough pieces to be in the tablebases and no castling rights.
+func (tablebases *SyzygyTablebases) CanProbe(position *Position) bool {
+	pieceCount := (position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]).CountSetBits()
+	return pieceCount <= tablebases.maxPieces && position.CastlingRights == 0
+}
+
+func (tablebases *SyzygyTablebases) probeTable(position *Position, isDTZ bool, wdl int) (int, syzygyProbeState) {
+	if (position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]).CountSetBits() == 2 {
+		return SyzygyDraw, syzygyProbeOK
+	}
+
+	materialTables, found := tablebases.tables[MaterialSignature(position)]
+	table := materialTables.wdl
+	if isDTZ {
+		table = materialTables.dtz
+	}
+
+	if !found || table == nil || table.load() != nil {
+		return 0, syzygyProbeFailed
+	}
+
+	value, changeSideToMove, err := table.probe(position, wdl)
+	if err != nil {
+		return 0, syzygyProbeFailed
+	} else if changeSideToMove {
+		return 0, syzygyProbeChangeSideToMove
+	}
+	return value, syzygyProbeOK
+}
+
+func isCaptureMove(position *Position, move Move) bool {
+	return move.GetMoveType() == CaptureMoveType || position.SquareContent[move.GetToSquare()].PieceType != NoneType
+}
+
+// searchWDL resolves the captures, and the pawn moves if checkZeroingMoves is set, before probing the WDL table,
+// since the tables store arbitrary values for positions whose best move is a winning capture, and don't account
+// for en passant captures.
+func (tablebases *SyzygyTablebases) searchWDL(position *Position, evaluator Evaluator, checkZeroingMoves bool) (int, syzygyProbeState) {
+	bestValue := SyzygyLoss
+	searchedMoves := 0
+	legalMoves := GenerateLegalMoves(position, evaluator)
+
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		move := legalMoves.Moves[moveIndex]
+		if !isCaptureMove(position, move) && (!checkZeroingMoves || position.SquareContent[move.GetFromSquare()].PieceType != Pawn) {
+			continue
+		}
+		searchedMoves++
+
+		position.DoMove(move, evaluator)
+		value, probeState := tablebases.searchWDL(position, evaluator, false)
+		position.UnDoPreviousMove(move, evaluator)
+
+		if probeState == syzygyProbeFailed {
+			return SyzygyDraw, syzygyProbeFailed
+		}
+
+		if -value > bestValue {
+			bestValue = -value
+			if bestValue >= SyzygyWin {
+				return bestValue, syzygyProbeZeroingBestMove
+			}
+		}
+	}
+
+	// When every legal move was searched, the stored value may be wrong, as for positions with en passant captures
+	allMovesSearched := searchedMoves > 0 && searchedMoves == int(legalMoves.Size)
+	value := bestValue
+	if !allMovesSearched {
+		var probeState syzygyProbeState
+		if value, probeState = tablebases.probeTable(position, false, SyzygyDraw); probeState == syzygyProbeFailed {
+			return SyzygyDraw, syzygyProbeFailed
+		}
+	}
+
+	if bestValue >= value {
+		if bestValue > SyzygyDraw || allMovesSearched {
+			return bestValue, syzygyProbeZeroingBestMove
+		}
+		return bestValue, syzygyProbeOK
+	}
+	return value, syzygyProbeOK
+}
+
+// ProbeWDL returns the WDL value of the position for the side to move, from SyzygyLoss to SyzygyWin.
+func (tablebases *SyzygyTablebases) ProbeWDL(position *Position, evaluator Evaluator) (int, bool) {
+	wdl, probeState := tablebases.searchWDL(position, evaluator, false)
+	return wdl, probeState != syzygyProbeFailed
+}
+
+// getDTZBeforeZeroing returns the DTZ value of a position whose best move is a capture or a pawn move.
+func getDTZBeforeZeroing(wdl int) int {
+	switch wdl {
+	case SyzygyWin:
+		return 1
+	case SyzygyCursedWin:
+		return syzygyRule50MovePlies + 1
+	case SyzygyBlessedLoss:
+		return -syzygyRule50MovePlies - 1
+	case SyzygyLoss:
+		return -1
+	}
+	return 0
+}
+
+// ProbeDTZ returns the number of plies to the next capture or pawn move of the winning line, positive for wins
+// and negative for losses. Cursed wins and blessed losses are beyond 100 plies, and draws are 0.
+func (tablebases *SyzygyTablebases) ProbeDTZ(position *Position, evaluator Evaluator) (int, bool) {
+	wdl, probeState := tablebases.searchWDL(position, evaluator, true)
+	if probeState == syzygyProbeFailed || wdl == SyzygyDraw {
+		return 0, probeState != syzygyProbeFailed
+	} else if probeState == syzygyProbeZeroingBestMove {
+		return getDTZBeforeZeroing(wdl), true
+	}
+
+	dtz, probeState := tablebases.probeTable(position, true, wdl)
+	if probeState == syzygyProbeFailed {
+		return 0, false
+	} else if probeState == syzygyProbeOK {
+		if wdl == SyzygyCursedWin || wdl == SyzygyBlessedLoss {
+			dtz += syzygyRule50MovePlies
+		}
+		return dtz * sign(wdl), true
+	}
+
+	// The DTZ table only has the other side to move, so the DTZ value is found with a one ply search
+	minimumDTZ := syzygyNoMinimumDTZ
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		move := legalMoves.Moves[moveIndex]
+		isZeroingMove := isCaptureMove(position, move) || position.SquareContent[move.GetFromSquare()].PieceType == Pawn
+
+		position.DoMove(move, evaluator)
+		childDTZ, found := 0, false
+		if isZeroingMove {
+			var childWDL int
+			childWDL, found = tablebases.ProbeWDL(position, evaluator)
+			childDTZ = -getDTZBeforeZeroing(childWDL)
+		} else {
+			childDTZ, found = tablebases.ProbeDTZ(position, evaluator)
+			childDTZ = -childDTZ
+		}
+
+		if childDTZ == 1 && position.IsCurrentSideInCheck() && GenerateLegalMoves(position, evaluator).Size == 0 {
+			minimumDTZ = 1
+		}
+		position.UnDoPreviousMove(move, evaluator)
+
+		if !found {
+			return 0, false
+		}
+
+		if !isZeroingMove {
+			childDTZ += sign(childDTZ)
+		}
+
+		if childDTZ < minimumDTZ && sign(childDTZ) == sign(wdl) {
+			minimumDTZ = childDTZ
+		}
+	}
+
+	// Without legal moves, the position is a mate
+	if minimumDTZ == syzygyNoMinimumDTZ {
+		return -1, true
+	}
+	return minimumDTZ, true
+}
+
+// RankRootMoves ranks the legal moves of the root position with the DTZ tables, or with the WDL tables when DTZ
+// tables are missing, returning whether the DTZ tables were used. With the fifty move rule, wins which can't be
+// converted in time are ranked as draws and scored near them, and moves which delay a loss beyond it are
+// preferred.
+func (tablebases *SyzygyTablebases) RankRootMoves(position *Position, evaluator Evaluator, useRule50 bool, hasRepeated bool) (rootMoves []SyzygyRootMove, usedDTZ bool, found bool) {
+	if !tablebases.CanProbe(position) {
+		return nil, false, false
+	}
+
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	rootMoves = make([]SyzygyRootMove, legalMoves.Size)
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		rootMoves[moveIndex].Move = legalMoves.Moves[moveIndex]
+	}
+
+	if tablebases.rankRootMovesByDTZ(position, evaluator, rootMoves, useRule50, hasRepeated) {
+		return rootMoves, true, true
+	}
+	return rootMoves, false, tablebases.rankRootMovesByWDL(position, evaluator, rootMoves, useRule50)
+}
+
+func (tablebases *SyzygyTablebases) rankRootMovesByDTZ(position *Position, evaluator Evaluator, rootMoves []SyzygyRootMove, useRule50 bool, hasRepeated bool) bool {
+	rule50Plies := int(position.Rule50)
+	winBound := 1
+	if useRule50 {
+		winBound = syzygyRule50WinBound
+	}
+
+	for moveIndex := range rootMoves {
+		rootMove := &rootMoves[moveIndex]
+		position.DoMove(rootMove.Move, evaluator)
+
+		dtz, found := 0, false
+		if position.Rule50 == 0 {
+			var wdl int
+			wdl, found = tablebases.ProbeWDL(position, evaluator)
+			dtz = getDTZBeforeZeroing(-wdl)
+		} else {
+			dtz, found = tablebases.ProbeDTZ(position, evaluator)
+			dtz = -dtz
+			dtz += sign(dtz)
+		}
+
+		if dtz == 2 && position.IsCurrentSideInCheck() && GenerateLegalMoves(position, evaluator).Size == 0 {
+			dtz = 1
+		}
+		position.UnDoPreviousMove(rootMove.Move, evaluator)
+
+		if !found {
+			return false
+		}
+
+		if dtz > 0 {
+			rootMove.Rank = syzygyWinRank
+			if dtz+rule50Plies >= syzygyRule50MovePlies || hasRepeated {
+				rootMove.Rank = syzygyWinRank - (dtz + rule50Plies)
+			}
+		} else if dtz < 0 {
+			rootMove.Rank = -syzygyWinRank
+			if -dtz*2+rule50Plies >= syzygyRule50MovePlies {
+				rootMove.Rank = -syzygyWinRank + (-dtz + rule50Plies)
+			}
+		}
+
+		// Wins drawn by the fifty move rule are scored from 1.5 to 49 centipawns, growing closer to real wins
+		switch {
+		case rootMove.Rank >= winBound:
+			rootMove.Score = SyzygyWinScore
+		case rootMove.Rank > 0:
+			rootMove.Score = int16(max(3, rootMove.Rank-800) * int(StandardPieceValuesScaled[Pawn]) / 200)
+		case rootMove.Rank == 0:
+			rootMove.Score = drawScore
+		case rootMove.Rank > -winBound:
+			rootMove.Score = int16(min(-3, rootMove.Rank+800) * int(StandardPieceValuesScaled[Pawn]) / 200)
+		default:
+			rootMove.Score = -SyzygyWinScore
+		}
+	}
+
+	return true
+}
+
+func (tablebases *SyzygyTablebases) rankRootMovesByWDL(position *Position, evaluator Evaluator, rootMoves []SyzygyRootMove, useRule50 bool) bool {
+	wdlRanks := [5]int{-syzygyWinRank, -syzygyCursedWinRank, 0, syzygyCursedWinRank, syzygyWinRank}
+	wdlScores := [5]int16{-SyzygyWinScore, drawScore - 2, drawScore, drawScore + 2, SyzygyWinScore}
+
+	for moveIndex := range rootMoves {
+		rootMove := &rootMoves[moveIndex]
+		position.DoMove(rootMove.Move, evaluator)
+		wdl, found := tablebases.ProbeWDL(position, evaluator)
+		position.UnDoPreviousMove(rootMove.Move, evaluator)
+
+		if !found {
+			return false
+		}
+
+		wdl = -wdl
+		rootMove.Rank = wdlRanks[wdl+2]
+		if !useRule50 {
+			wdl = SyzygyWin * sign(wdl)
+		}
+		rootMove.Score = wdlScores[wdl+2]
+	}
+
+	return true
+}
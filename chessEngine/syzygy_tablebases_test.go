@@ -0,0 +1,921 @@
+package chessEngine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const syzygyFixturesDirectory = "testdata/syzygy"
+
+// Probing every position of the fixtures takes minutes, so a spread out sample of them is probed
+const syzygyProbeSampleStride = 11
+
+var updateSyzygyFixtures = flag.Bool("update-syzygy-fixtures", false, "regenerate the syzygy tables of testdata from the DTM tablebases")
+
+// syzygyFixtureMaterials are the materials of the syzygy tables of testdata, with the codes of their pieces in the
+// order the tables encode them.
+var syzygyFixtureMaterials = []struct {
+	code       string
+	pieceCodes []uint8
+}{
+	{"KQvK", []uint8{6, 5, 14}},
+	{"KRvK", []uint8{6, 4, 14}},
+	{"KBvK", []uint8{6, 3, 14}},
+	{"KNvK", []uint8{6, 2, 14}},
+	{"KPvK", []uint8{1, 6, 14}},
+}
+
+// syzygyPairedFixtureMaterials are the four piece materials of testdata, whose leading group is the two kings and
+// whose identical pieces are encoded together. Their DTM tablebases take too long to generate on every run, so
+// their tables are checked against known positions.
+var syzygyPairedFixtureMaterials = []struct {
+	code       string
+	pieceCodes []uint8
+}{
+	{"KBBvK", []uint8{6, 14, 3, 3}},
+}
+
+var (
+	dtmTablebasesOnce sync.Once
+	dtmTablebases     *Tablebases
+	dtmTablebasesErr  error
+)
+
+// getDTMTablebases generates the DTM tablebases of the fixture materials in memory, which the syzygy tables are
+// generated from and checked against.
+func getDTMTablebases(t *testing.T) *Tablebases {
+	dtmTablebasesOnce.Do(func() {
+		dtmTablebases = NewTablebases("")
+		for _, material := range syzygyFixtureMaterials {
+			tablebaseMaterial, err := ParseTablebaseMaterial(material.code)
+			if err == nil {
+				_, err = dtmTablebases.Generate(tablebaseMaterial, io.Discard)
+			}
+			if err != nil {
+				dtmTablebasesErr = err
+				return
+			}
+		}
+	})
+
+	if dtmTablebasesErr != nil {
+		t.Fatalf("failed to generate the DTM tablebases: %v", dtmTablebasesErr)
+	}
+	return dtmTablebases
+}
+
+func loadSyzygyFixtures(t *testing.T) *SyzygyTablebases {
+	syzygyTablebases, err := LoadSyzygyTablebases(syzygyFixturesDirectory)
+	if err != nil {
+		t.Fatalf("failed to load the syzygy fixtures: %v", err)
+	}
+	tableCount := len(syzygyFixtureMaterials) + len(syzygyPairedFixtureMaterials)
+	if syzygyTablebases.Count() != tableCount || syzygyTablebases.DTZCount() != tableCount {
+		t.Fatalf("found %d syzygy tables (%d DTZ), expected %d of each", syzygyTablebases.Count(), syzygyTablebases.DTZCount(), tableCount)
+	}
+
+	t.Cleanup(syzygyTablebases.Close)
+	return syzygyTablebases
+}
+
+// forEachTablebasePosition calls visit with every legal position of the material, whose first side is white unless
+// the colors are swapped.
+func forEachTablebasePosition(materialCode string, colorsSwapped bool, visit func(position *Position)) {
+	material, err := ParseTablebaseMaterial(materialCode)
+	if err != nil {
+		panic(err)
+	}
+
+	pieces := append([]Piece{}, material.Pieces...)
+	if colorsSwapped {
+		for pieceIndex := range pieces {
+			pieces[pieceIndex].Color ^= 1
+		}
+	}
+
+	position := &Position{}
+	squares := make([]uint8, len(pieces))
+	occupied := Bitboard(0)
+
+	var placePieces func(pieceIndex int)
+	placePieces = func(pieceIndex int) {
+		if pieceIndex == len(pieces) {
+			for _, sideToMove := range []uint8{White, Black} {
+				// The side which isn't to move can't be in check
+				setUpTablebasePosition(position, pieces, sideToMove^1, squares)
+				if position.IsCurrentSideInCheck() {
+					continue
+				}
+
+				position.SideToMove = sideToMove
+				position.PositionHash = ZobristSingleton.GenHash(position)
+				visit(position)
+			}
+			return
+		}
+
+		for square := uint8(0); square < 64; square++ {
+			if occupied&BitboardForSquare[square] != 0 {
+				continue
+			}
+			if pieces[pieceIndex].PieceType == Pawn && (Rank(square) == Rank1 || Rank(square) == Rank8) {
+				continue
+			}
+
+			squares[pieceIndex] = square
+			occupied |= BitboardForSquare[square]
+			placePieces(pieceIndex + 1)
+			occupied &^= BitboardForSquare[square]
+		}
+	}
+	placePieces(0)
+}
+
+// tablebasePositionKey identifies the positions of a three piece material from the point of view of the side with
+// the third piece, so that positions with swapped colors have the same key.
+func tablebasePositionKey(position *Position) int {
+	strongColor, squareFlip := White, uint8(0)
+	if position.ColorsBitBoard[Black].CountSetBits() == 2 {
+		strongColor, squareFlip = Black, 56
+	}
+
+	strongKingSquare := position.PiecesBitBoard[strongColor][King].MostSignificantBit() ^ squareFlip
+	weakKingSquare := position.PiecesBitBoard[strongColor^1][King].MostSignificantBit() ^ squareFlip
+	pieceSquare := (position.ColorsBitBoard[strongColor] &^ position.PiecesBitBoard[strongColor][King]).MostSignificantBit() ^ squareFlip
+	return int(strongKingSquare) | int(weakKingSquare)<<6 | int(pieceSquare)<<12 | int(bitToInt(position.SideToMove == strongColor))<<18
+}
+
+// computeSyzygyFixtureDTZ returns the absolute DTZ values of the positions of the material by position key, 0 for
+// draws: the number of plies to the capture, pawn move or mate ending the winning line, which the winning side
+// makes as short as it can and the losing side as long as it can.
+func computeSyzygyFixtureDTZ(t *testing.T, materialCode string) []int {
+	const unresolvedDTZ = math.MaxInt
+	dtm := getDTMTablebases(t)
+	evaluator := &DefaultEvaluator{}
+
+	dtzValues := make([]int, 1<<19)
+	isWinning := make([]bool, len(dtzValues))
+	continuations := make([][]int, len(dtzValues))
+	decisiveKeys := []int{}
+
+	forEachTablebasePosition(materialCode, false, func(position *Position) {
+		score, _ := dtm.Probe(position)
+		if score == drawScore {
+			return
+		}
+
+		key := tablebasePositionKey(position)
+		isWinning[key] = score > drawScore
+		dtzValues[key] = unresolvedDTZ
+		decisiveKeys = append(decisiveKeys, key)
+
+		legalMoves := GenerateLegalMoves(position, evaluator)
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			move := legalMoves.Moves[moveIndex]
+			isZeroingMove := isCaptureMove(position, move) || position.SquareContent[move.GetFromSquare()].PieceType == Pawn
+
+			position.DoMove(move, evaluator)
+			// The DTM tablebases aren't probed with an en passant square, which doesn't matter with a single pawn
+			position.EnPassantSquare = NoneSquare
+			childScore, _ := dtm.Probe(position)
+			childKey := 0
+			if !isZeroingMove {
+				childKey = tablebasePositionKey(position)
+			}
+			position.UnDoPreviousMove(move, evaluator)
+
+			if isWinning[key] && childScore >= drawScore {
+				continue
+			}
+
+			if isZeroingMove || childScore == -CheckmateScore {
+				if isWinning[key] {
+					dtzValues[key] = 1
+				}
+				continue
+			}
+			continuations[key] = append(continuations[key], childKey)
+		}
+	})
+
+	// Lost positions without moves to other won positions are mates, or only have zeroing moves left
+	for _, key := range decisiveKeys {
+		if !isWinning[key] && len(continuations[key]) == 0 {
+			dtzValues[key] = 1
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, key := range decisiveKeys {
+			dtz := dtzValues[key]
+			if isWinning[key] {
+				for _, childKey := range continuations[key] {
+					if dtzValues[childKey] != unresolvedDTZ {
+						dtz = min(dtz, dtzValues[childKey]+1)
+					}
+				}
+			} else if len(continuations[key]) > 0 {
+				dtz = 1
+				for _, childKey := range continuations[key] {
+					if dtzValues[childKey] == unresolvedDTZ {
+						dtz = unresolvedDTZ
+						break
+					}
+					dtz = max(dtz, dtzValues[childKey]+1)
+				}
+			}
+
+			if dtz != dtzValues[key] {
+				dtzValues[key] = dtz
+				changed = true
+			}
+		}
+	}
+
+	for _, key := range decisiveKeys {
+		if dtzValues[key] == unresolvedDTZ {
+			t.Fatalf("%s: some won positions have no way to make progress", materialCode)
+		}
+	}
+	return dtzValues
+}
+
+// getPliesToMate returns the number of plies to mate of a DTM tablebase score, which is also the DTZ of positions
+// without pawns, except for mated positions whose DTZ is 1.
+func getPliesToMate(score int16) int {
+	if score == drawScore {
+		return 0
+	}
+	return max(1, int(CheckmateScore-abs(score)))
+}
+
+// syzygyFixtureSubTable holds the values of a sub-table of a fixture, along with its flags.
+type syzygyFixtureSubTable struct {
+	flags  uint8
+	values []int
+}
+
+// newSyzygyFixtureTable returns the table of the material with its pieces in the order of the fixture, whose
+// leading group comes first in the encoding. DTZ tables store wins in plies, with white to move.
+func newSyzygyFixtureTable(materialCode string, pieceCodes []uint8, isDTZ bool) *syzygyTable {
+	initializeSyzygyIndexingOnce.Do(initializeSyzygyIndexing)
+
+	table := newSyzygyTable(materialCode, "", isDTZ)
+	for tablebaseFile := range table.pairsData[0] {
+		for side := range table.pairsData {
+			pairs := &table.pairsData[side][tablebaseFile]
+			copy(pairs.pieces[:], pieceCodes)
+			table.setGroups(pairs, [2]int{0, 0xf}, tablebaseFile)
+			if isDTZ {
+				pairs.flags = syzygyWinPliesFlag
+			}
+		}
+	}
+	return table
+}
+
+// syzygyFixtureSymbol is a symbol of the compressed values of a fixture: a value, when right is the leaf symbol,
+// or the pair of symbols left and right. Length is the number of values it expands into.
+type syzygyFixtureSymbol struct {
+	left, right int
+	length      int
+}
+
+// pairSyzygyFixtureValues compresses the values as the syzygy generator does: starting with a symbol per value,
+// the most frequent pair of adjacent symbols is replaced by a new symbol, until no pair repeats or the symbols
+// run out. It returns the symbols and the compressed sequence.
+func pairSyzygyFixtureValues(values []int) ([]syzygyFixtureSymbol, []int) {
+	const maximumSymbols, maximumSymbolLength = 1024, 256
+
+	symbols := []syzygyFixtureSymbol{}
+	valueSymbols := map[int]int{}
+	sequence := make([]int, len(values))
+	for valueIndex, value := range values {
+		symbol, found := valueSymbols[value]
+		if !found {
+			symbol = len(symbols)
+			valueSymbols[value] = symbol
+			symbols = append(symbols, syzygyFixtureSymbol{value, syzygyLeafSymbol, 1})
+		}
+		sequence[valueIndex] = symbol
+	}
+
+	pairCounts := make([]int, maximumSymbols*maximumSymbols)
+	for len(symbols) < maximumSymbols {
+		for pairIndex := range pairCounts {
+			pairCounts[pairIndex] = 0
+		}
+
+		// Overlapping occurrences of a pair, as in runs of a symbol, can't all be replaced
+		bestPair, bestCount, lastCounted := 0, 1, -2
+		for index := 0; index+1 < len(sequence); index++ {
+			left, right := sequence[index], sequence[index+1]
+			if symbols[left].length+symbols[right].length > maximumSymbolLength {
+				continue
+			}
+			if lastCounted == index-1 && left == right && sequence[index-1] == left {
+				continue
+			}
+
+			pairIndex := left*maximumSymbols + right
+			pairCounts[pairIndex]++
+			lastCounted = index
+			if pairCounts[pairIndex] > bestCount {
+				bestPair, bestCount = pairIndex, pairCounts[pairIndex]
+			}
+		}
+		if bestCount < 2 {
+			break
+		}
+
+		left, right := bestPair/maximumSymbols, bestPair%maximumSymbols
+		pairSymbol := len(symbols)
+		symbols = append(symbols, syzygyFixtureSymbol{left, right, symbols[left].length + symbols[right].length})
+
+		pairedSequence := sequence[:0]
+		for index := 0; index < len(sequence); index++ {
+			if index+1 < len(sequence) && sequence[index] == left && sequence[index+1] == right {
+				pairedSequence = append(pairedSequence, pairSymbol)
+				index++
+			} else {
+				pairedSequence = append(pairedSequence, sequence[index])
+			}
+		}
+		sequence = pairedSequence
+	}
+
+	return symbols, sequence
+}
+
+// getHuffmanCodeLengths returns the lengths of the Huffman codes of the symbols with the frequencies, which are
+// zero for symbols without codes.
+func getHuffmanCodeLengths(frequencies []int) []int {
+	type huffmanNode struct {
+		frequency   int
+		left, right int
+	}
+
+	nodes := []huffmanNode{}
+	for symbol, frequency := range frequencies {
+		if frequency > 0 {
+			nodes = append(nodes, huffmanNode{frequency, -1, symbol})
+		}
+	}
+
+	codeLengths := make([]int, len(frequencies))
+	if len(nodes) == 1 {
+		codeLengths[nodes[0].right] = 1
+		return codeLengths
+	}
+
+	// The two least frequent trees are merged until a single one is left
+	roots := make([]int, len(nodes))
+	for nodeIndex := range roots {
+		roots[nodeIndex] = nodeIndex
+	}
+	for len(roots) > 1 {
+		sort.Slice(roots, func(i, j int) bool { return nodes[roots[i]].frequency < nodes[roots[j]].frequency })
+		nodes = append(nodes, huffmanNode{nodes[roots[0]].frequency + nodes[roots[1]].frequency, roots[0], roots[1]})
+		roots = append(roots[2:], len(nodes)-1)
+	}
+
+	var setLengths func(node int, depth int)
+	setLengths = func(node int, depth int) {
+		if nodes[node].left < 0 {
+			codeLengths[nodes[node].right] = depth
+			return
+		}
+		setLengths(nodes[node].left, depth+1)
+		setLengths(nodes[node].right, depth+1)
+	}
+	setLengths(roots[0], 0)
+	return codeLengths
+}
+
+// writeSyzygyFixture writes the table in the syzygy format, its sub-tables being given by file of the leading pawn
+// then by side to move. Values are compressed into pairs of symbols, whose canonical Huffman codes are stored in
+// blocks as in the tables of the syzygy generator.
+func writeSyzygyFixture(table *syzygyTable, filePath string, subTables []syzygyFixtureSubTable) error {
+	const blockSizeLog, spanLog = 5, 6
+	const blockBits, span, maximumBlockValues = 8 << blockSizeLog, 1 << spanLog, 1 << 16
+	buffer := bytes.Buffer{}
+
+	magic, headerFlags := syzygyWDLMagic, syzygySplitHeaderFlag
+	if table.isDTZ {
+		magic, headerFlags = syzygyDTZMagic, 0
+	}
+	if table.hasPawns {
+		headerFlags |= syzygyHasPawnsHeaderFlag
+	}
+	binary.Write(&buffer, binary.LittleEndian, magic)
+	buffer.WriteByte(headerFlags)
+
+	files := 1
+	if table.hasPawns {
+		files = 4
+	}
+	for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+		buffer.WriteByte(0)
+		for pieceIndex := 0; pieceIndex < table.pieceCount; pieceIndex++ {
+			buffer.WriteByte(table.pairsData[0][tablebaseFile].pieces[pieceIndex] | table.pairsData[1][tablebaseFile].pieces[pieceIndex]<<4)
+		}
+	}
+	if buffer.Len()%2 != 0 {
+		buffer.WriteByte(0)
+	}
+
+	sparseIndices := make([][]byte, len(subTables))
+	blockLengths := make([][]uint16, len(subTables))
+	blocks := make([][]byte, len(subTables))
+
+	for subTableIndex, subTable := range subTables {
+		minimumValue, maximumValue := math.MaxInt, 0
+		for _, value := range subTable.values {
+			minimumValue, maximumValue = min(minimumValue, value), max(maximumValue, value)
+		}
+
+		// Sub-tables whose positions all have the same value only store it
+		if minimumValue == maximumValue {
+			buffer.Write([]byte{subTable.flags | syzygySingleValueFlag, uint8(minimumValue)})
+			continue
+		}
+
+		symbols, sequence := pairSyzygyFixtureValues(subTable.values)
+		frequencies := make([]int, len(symbols))
+		for _, symbol := range sequence {
+			frequencies[symbol]++
+		}
+		codeLengths := getHuffmanCodeLengths(frequencies)
+
+		// Symbols are numbered by decreasing code length, those without codes coming last, so that the codes of
+		// each length are consecutive from the lowest symbol of the length
+		symbolOrder := make([]int, len(symbols))
+		for symbol := range symbolOrder {
+			symbolOrder[symbol] = symbol
+		}
+		sort.SliceStable(symbolOrder, func(i, j int) bool { return codeLengths[symbolOrder[i]] > codeLengths[symbolOrder[j]] })
+		symbolNumbers := make([]int, len(symbols))
+		for number, symbol := range symbolOrder {
+			symbolNumbers[symbol] = number
+		}
+
+		minimumCodeLength, maximumCodeLength := math.MaxInt, 0
+		for _, codeLength := range codeLengths {
+			if codeLength > 0 {
+				minimumCodeLength, maximumCodeLength = min(minimumCodeLength, codeLength), max(maximumCodeLength, codeLength)
+			}
+		}
+		if maximumCodeLength > 32 {
+			return fmt.Errorf("%s: Huffman codes of %d bits are too long", filePath, maximumCodeLength)
+		}
+
+		// Longer codes have lower values, the codes of each length starting after half of those of the next one
+		lowestSymbols := make([]uint16, maximumCodeLength-minimumCodeLength+1)
+		lowestCodes := make([]uint64, maximumCodeLength+1)
+		for codeLength := maximumCodeLength; codeLength >= minimumCodeLength; codeLength-- {
+			codeCount := 0
+			for _, symbolCodeLength := range codeLengths {
+				codeCount += int(bitToInt(symbolCodeLength == codeLength))
+			}
+			if codeLength > minimumCodeLength {
+				lowestSymbols[codeLength-1-minimumCodeLength] = lowestSymbols[codeLength-minimumCodeLength] + uint16(codeCount)
+				lowestCodes[codeLength-1] = (lowestCodes[codeLength] + uint64(codeCount)) / 2
+			}
+		}
+
+		// Blocks hold whole symbols, and the sparse index gives the block and the offset within it of the middle
+		// value of each span. The spans past the last value point to padding blocks of span values.
+		blockStarts := []int{0}
+		blockData := []byte{}
+		bitOffset, blockValues := 0, 0
+		for _, symbol := range sequence {
+			codeLength, symbolLength := codeLengths[symbol], symbols[symbol].length
+			if bitOffset+codeLength > blockBits || blockValues+symbolLength > maximumBlockValues {
+				blockStarts = append(blockStarts, blockStarts[len(blockStarts)-1]+blockValues)
+				blockLengths[subTableIndex] = append(blockLengths[subTableIndex], uint16(blockValues-1))
+				blockData = append(blockData, make([]byte, blockBits/8-(bitOffset+7)/8)...)
+				bitOffset, blockValues = 0, 0
+			}
+			if bitOffset%8 == 0 {
+				blockData = append(blockData, make([]byte, (codeLength+7)/8)...)
+			} else if extraBytes := (bitOffset%8 + codeLength + 7) / 8; extraBytes > 1 {
+				blockData = append(blockData, make([]byte, extraBytes-1)...)
+			}
+
+			code := lowestCodes[codeLength] + uint64(symbolNumbers[symbol]-int(lowestSymbols[codeLength-minimumCodeLength]))
+			blockStart := (len(blockStarts) - 1) * blockBits / 8
+			for bit := 0; bit < codeLength; bit++ {
+				if code>>(codeLength-1-bit)&1 != 0 {
+					blockData[blockStart+(bitOffset+bit)/8] |= 0x80 >> ((bitOffset + bit) % 8)
+				}
+			}
+			bitOffset += codeLength
+			blockValues += symbolLength
+		}
+		blockLengths[subTableIndex] = append(blockLengths[subTableIndex], uint16(blockValues-1))
+		blockData = append(blockData, make([]byte, blockBits/8-(bitOffset+7)/8)...)
+		blocks[subTableIndex] = blockData
+		blockCount := len(blockStarts)
+
+		paddingBlocks := 0
+		for spanStart := 0; spanStart < len(subTable.values); spanStart += span {
+			middleValue := spanStart + span/2
+			block, offset := blockCount+(middleValue-len(subTable.values))/span, (middleValue-len(subTable.values))%span
+			if middleValue < len(subTable.values) {
+				block = sort.SearchInts(blockStarts, middleValue+1) - 1
+				offset = middleValue - blockStarts[block]
+			} else {
+				paddingBlocks = max(paddingBlocks, block+1-blockCount)
+			}
+			sparseIndices[subTableIndex] = binary.LittleEndian.AppendUint32(sparseIndices[subTableIndex], uint32(block))
+			sparseIndices[subTableIndex] = binary.LittleEndian.AppendUint16(sparseIndices[subTableIndex], uint16(offset))
+		}
+		for block := 0; block < paddingBlocks; block++ {
+			blockLengths[subTableIndex] = append(blockLengths[subTableIndex], span-1)
+		}
+
+		buffer.Write([]byte{subTable.flags, blockSizeLog, spanLog, uint8(paddingBlocks)})
+		binary.Write(&buffer, binary.LittleEndian, uint32(blockCount))
+		buffer.Write([]byte{uint8(maximumCodeLength), uint8(minimumCodeLength)})
+		binary.Write(&buffer, binary.LittleEndian, lowestSymbols)
+
+		binary.Write(&buffer, binary.LittleEndian, uint16(len(symbols)))
+		for _, symbol := range symbolOrder {
+			left, right := symbols[symbol].left, symbols[symbol].right
+			if right != syzygyLeafSymbol {
+				left, right = symbolNumbers[left], symbolNumbers[right]
+			}
+			buffer.Write([]byte{uint8(left), uint8(left>>8) | uint8(right&0xf)<<4, uint8(right >> 4)})
+		}
+		if len(symbols)%2 != 0 {
+			buffer.WriteByte(0)
+		}
+	}
+
+	// The DTZ map, which the fixtures don't use, is aligned
+	if table.isDTZ && buffer.Len()%2 != 0 {
+		buffer.WriteByte(0)
+	}
+
+	for _, sparseIndex := range sparseIndices {
+		buffer.Write(sparseIndex)
+	}
+	for _, lengths := range blockLengths {
+		binary.Write(&buffer, binary.LittleEndian, lengths)
+	}
+	for _, blockData := range blocks {
+		for buffer.Len()%64 != 0 {
+			buffer.WriteByte(0)
+		}
+		buffer.Write(blockData)
+	}
+
+	return os.WriteFile(filePath, buffer.Bytes(), 0644)
+}
+
+// TestUpdateSyzygyFixtures regenerates the syzygy tables of testdata when run with -update-syzygy-fixtures.
+func TestUpdateSyzygyFixtures(t *testing.T) {
+	if !*updateSyzygyFixtures {
+		t.Skip("run with -update-syzygy-fixtures to regenerate the syzygy tables of testdata")
+	}
+
+	dtm := getDTMTablebases(t)
+	for _, material := range syzygyPairedFixtureMaterials {
+		tablebaseMaterial, err := ParseTablebaseMaterial(material.code)
+		if err == nil {
+			_, err = dtm.Generate(tablebaseMaterial, io.Discard)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(syzygyFixturesDirectory, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, material := range append(syzygyFixtureMaterials, syzygyPairedFixtureMaterials...) {
+		wdlTable := newSyzygyFixtureTable(material.code, material.pieceCodes, false)
+		dtzTable := newSyzygyFixtureTable(material.code, material.pieceCodes, true)
+
+		files := 1
+		if wdlTable.hasPawns {
+			files = 4
+		}
+		wdlSubTables := make([]syzygyFixtureSubTable, 2*files)
+		dtzSubTables := make([]syzygyFixtureSubTable, files)
+		for tablebaseFile := 0; tablebaseFile < files; tablebaseFile++ {
+			for side := 0; side < 2; side++ {
+				// Indices which no legal position encodes to are left as draws
+				values := make([]int, wdlTable.pairsData[side][tablebaseFile].size())
+				for index := range values {
+					values[index] = SyzygyDraw + 2
+				}
+				wdlSubTables[2*tablebaseFile+side].values = values
+			}
+			dtzSubTables[tablebaseFile] = syzygyFixtureSubTable{syzygyWinPliesFlag, make([]int, dtzTable.pairsData[0][tablebaseFile].size())}
+		}
+
+		// The paired materials have no pawns, and the losing side can't capture in lost positions, as it would
+		// reach a drawn material, so their DTZ is the distance to mate
+		var dtzValues []int
+		if len(material.pieceCodes) == 3 {
+			dtzValues = computeSyzygyFixtureDTZ(t, material.code)
+		}
+		forEachTablebasePosition(material.code, false, func(position *Position) {
+			score, _ := dtm.Probe(position)
+
+			pairs, index, tablebaseFile, _, err := wdlTable.encodePosition(position)
+			if err != nil {
+				t.Fatalf("failed to encode %s: %v", position.GenFEN(), err)
+			}
+			side := 0
+			if pairs != &wdlTable.pairsData[0][tablebaseFile] {
+				side = 1
+			}
+			wdlSubTables[2*tablebaseFile+side].values[index] = SyzygyWin*int(sign(score)) + 2
+
+			dtz := getPliesToMate(score)
+			if dtzValues != nil {
+				if !dtzTable.hasPawns && score != drawScore && dtzValues[tablebasePositionKey(position)] != dtz {
+					t.Fatalf("%s: computed DTZ %d, expected the %d plies to mate", position.GenFEN(), dtzValues[tablebasePositionKey(position)], dtz)
+				}
+				dtz = dtzValues[tablebasePositionKey(position)]
+			}
+
+			// DTZ values are stored minus one, only for the wins of white
+			_, index, tablebaseFile, changeSideToMove, _ := dtzTable.encodePosition(position)
+			if !changeSideToMove && score > drawScore {
+				dtzSubTables[tablebaseFile].values[index] = dtz - 1
+			}
+		})
+
+		wdlFilePath := filepath.Join(syzygyFixturesDirectory, material.code+SyzygyWDLExtension)
+		if err := writeSyzygyFixture(wdlTable, wdlFilePath, wdlSubTables); err != nil {
+			t.Fatal(err)
+		}
+		dtzFilePath := filepath.Join(syzygyFixturesDirectory, material.code+SyzygyDTZExtension)
+		if err := writeSyzygyFixture(dtzTable, dtzFilePath, dtzSubTables); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyzygyProbeWDL(t *testing.T) {
+	dtm := getDTMTablebases(t)
+	syzygyTablebases := loadSyzygyFixtures(t)
+	evaluator := &DefaultEvaluator{}
+
+	for _, material := range syzygyFixtureMaterials {
+		for _, colorsSwapped := range []bool{false, true} {
+			positionCount, mismatches := 0, 0
+			forEachTablebasePosition(material.code, colorsSwapped, func(position *Position) {
+				if positionCount++; positionCount%syzygyProbeSampleStride != 0 {
+					return
+				}
+
+				score, _ := dtm.Probe(position)
+				expectedWDL := SyzygyWin * int(sign(score))
+
+				if wdl, found := syzygyTablebases.ProbeWDL(position, evaluator); !found || wdl != expectedWDL {
+					if mismatches++; mismatches <= 5 {
+						t.Errorf("%s: got WDL %d (found %v), expected %d", position.GenFEN(), wdl, found, expectedWDL)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSyzygyProbeDTZ(t *testing.T) {
+	dtm := getDTMTablebases(t)
+	syzygyTablebases := loadSyzygyFixtures(t)
+	evaluator := &DefaultEvaluator{}
+
+	for _, material := range syzygyFixtureMaterials {
+		// Without pawns, the winning line only ends with mate, so the DTZ is the distance to mate
+		var dtzValues []int
+		if strings.Contains(material.code, "P") {
+			dtzValues = computeSyzygyFixtureDTZ(t, material.code)
+		}
+
+		for _, colorsSwapped := range []bool{false, true} {
+			positionCount, mismatches := 0, 0
+			forEachTablebasePosition(material.code, colorsSwapped, func(position *Position) {
+				if positionCount++; positionCount%syzygyProbeSampleStride != 0 {
+					return
+				}
+
+				score, _ := dtm.Probe(position)
+				expectedDTZ := getPliesToMate(score) * int(sign(score))
+				if dtzValues != nil {
+					expectedDTZ = dtzValues[tablebasePositionKey(position)] * int(sign(score))
+				}
+
+				if dtz, found := syzygyTablebases.ProbeDTZ(position, evaluator); !found || dtz != expectedDTZ {
+					if mismatches++; mismatches <= 5 {
+						t.Errorf("%s: got DTZ %d (found %v), expected %d", position.GenFEN(), dtz, found, expectedDTZ)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSyzygyKnownPositions(t *testing.T) {
+	syzygyTablebases := loadSyzygyFixtures(t)
+	evaluator := &DefaultEvaluator{}
+
+	knownPositions := []struct {
+		fen         string
+		expectedWDL int
+		expectedDTZ int
+	}{
+		// Mates with the queen and the rook
+		{"7k/8/6K1/8/8/8/Q7/8 w - - 0 1", SyzygyWin, 1},
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", SyzygyWin, 1},
+		{"R6k/8/6K1/8/8/8/8/8 b - - 0 1", SyzygyLoss, -1},
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", SyzygyWin, 27},
+		// Stalemate, and the rook is lost
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", SyzygyDraw, 0},
+		{"8/8/8/8/8/1k6/2R5/K7 b - - 0 1", SyzygyDraw, 0},
+		// The king in front of its pawn on the sixth rank wins, the pawn being pushed after a king move
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", SyzygyWin, 3},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", SyzygyLoss, -4},
+		{"8/8/8/8/8/8/4P3/4K1k1 w - - 0 1", SyzygyWin, 1},
+		{"8/8/8/8/8/k7/p7/2K5 w - - 0 1", SyzygyLoss, -2},
+		// Stalemate, the rook pawn, and the king in front of the pawn
+		{"4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", SyzygyDraw, 0},
+		{"k7/8/K7/P7/8/8/8/8 w - - 0 1", SyzygyDraw, 0},
+		{"8/4k3/8/8/8/8/4P3/4K3 w - - 0 1", SyzygyDraw, 0},
+	}
+
+	position := &Position{}
+	for _, knownPosition := range knownPositions {
+		position.LoadFEN(knownPosition.fen, evaluator)
+
+		if wdl, found := syzygyTablebases.ProbeWDL(position, evaluator); !found || wdl != knownPosition.expectedWDL {
+			t.Errorf("%s: got WDL %d (found %v), expected %d", knownPosition.fen, wdl, found, knownPosition.expectedWDL)
+		}
+		if dtz, found := syzygyTablebases.ProbeDTZ(position, evaluator); !found || dtz != knownPosition.expectedDTZ {
+			t.Errorf("%s: got DTZ %d (found %v), expected %d", knownPosition.fen, dtz, found, knownPosition.expectedDTZ)
+		}
+	}
+}
+
+func TestSyzygyPairedPieces(t *testing.T) {
+	syzygyTablebases := loadSyzygyFixtures(t)
+	evaluator := &DefaultEvaluator{}
+
+	// The fixtures are compressed with pairs and Huffman codes of several lengths, which the probes decode
+	for _, material := range syzygyPairedFixtureMaterials {
+		tables := syzygyTablebases.tables[materialSignatureFromCode(material.code, White)]
+		for _, table := range []*syzygyTable{tables.wdl, tables.dtz} {
+			if err := table.load(); err != nil {
+				t.Fatal(err)
+			}
+
+			pairs := &table.pairsData[0][0]
+			longestSymbol := uint8(0)
+			for _, symbolLength := range pairs.symbolLengths {
+				longestSymbol = max(longestSymbol, symbolLength)
+			}
+			if pairs.minSymbolLength == pairs.maxSymbolLength || longestSymbol == 0 {
+				t.Errorf("%s: codes of %d to %d bits, symbols of up to %d values", table.filePath, pairs.minSymbolLength, pairs.maxSymbolLength, longestSymbol+1)
+			}
+		}
+	}
+
+	knownPositions := []struct {
+		fen         string
+		expectedWDL int
+		expectedDTZ int
+	}{
+		// The longest win of the bishop pair is a mate in 19, with either color having the bishops
+		{"8/8/8/8/7B/8/3k4/K2B4 w - - 0 1", SyzygyWin, 37},
+		{"k2b4/3K4/8/7b/8/8/8/8 b - - 0 1", SyzygyWin, 37},
+		{"8/8/8/3k4/8/8/8/2B1KB2 b - - 0 1", SyzygyLoss, -34},
+		{"8/8/8/3K4/8/8/8/2b1kb2 w - - 0 1", SyzygyLoss, -34},
+		// Mate, and mate in one
+		{"k7/8/1K4B1/8/8/8/7B/8 w - - 0 1", SyzygyWin, 1},
+		{"k7/8/1K6/8/4B3/8/7B/8 b - - 0 1", SyzygyLoss, -1},
+		// Bishops of the same color, stalemate, and a bishop is lost
+		{"k7/8/1K6/8/8/8/8/2B1B3 w - - 0 1", SyzygyDraw, 0},
+		{"k7/2K5/1B6/8/8/7B/8/8 b - - 0 1", SyzygyDraw, 0},
+		{"8/8/8/8/8/8/1k6/BB2K3 b - - 0 1", SyzygyDraw, 0},
+	}
+
+	position := &Position{}
+	for _, knownPosition := range knownPositions {
+		position.LoadFEN(knownPosition.fen, evaluator)
+
+		if wdl, found := syzygyTablebases.ProbeWDL(position, evaluator); !found || wdl != knownPosition.expectedWDL {
+			t.Errorf("%s: got WDL %d (found %v), expected %d", knownPosition.fen, wdl, found, knownPosition.expectedWDL)
+		}
+		if dtz, found := syzygyTablebases.ProbeDTZ(position, evaluator); !found || dtz != knownPosition.expectedDTZ {
+			t.Errorf("%s: got DTZ %d (found %v), expected %d", knownPosition.fen, dtz, found, knownPosition.expectedDTZ)
+		}
+	}
+}
+
+func TestSyzygyRootMoveFiltering(t *testing.T) {
+	dtm := getDTMTablebases(t)
+	evaluator := &DefaultEvaluator{}
+
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+	searcher.SetInfoOutput(io.Discard)
+	searcher.SetSyzygyPath(syzygyFixturesDirectory)
+	t.Cleanup(func() { searcher.SetSyzygyPath("") })
+
+	testCases := []struct {
+		fen         string
+		fastestOnly bool
+	}{
+		// Moving the rook next to the black king loses it
+		{"8/8/8/8/8/8/2k5/R3K3 w - - 0 1", false},
+		// Near the fifty move rule, only the moves mating the fastest are kept
+		{"8/8/8/8/8/8/2k5/R3K3 w - - 90 80", true},
+		// Only the king moves keeping the opposition win
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", false},
+	}
+
+	for _, testCase := range testCases {
+		searcher.InitializeSearchInfo(testCase.fen, evaluator)
+		position := searcher.Position()
+
+		// The moves which should be kept are the winning ones, or the fastest of them
+		expectedMoves, bestScore := []Move{}, int16(-CheckmateScore-1)
+		legalMoves := GenerateLegalMoves(position, evaluator)
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			move := legalMoves.Moves[moveIndex]
+			position.DoMove(move, evaluator)
+			childScore, _ := dtm.Probe(position)
+			position.UnDoPreviousMove(move, evaluator)
+
+			moveScore := getTablebaseParentScore(childScore)
+			if moveScore <= drawScore || (testCase.fastestOnly && moveScore < bestScore) {
+				continue
+			}
+			if testCase.fastestOnly && moveScore > bestScore {
+				expectedMoves = expectedMoves[:0]
+			}
+			expectedMoves, bestScore = append(expectedMoves, move), max(bestScore, moveScore)
+		}
+
+		if len(expectedMoves) == 0 || len(expectedMoves) == int(legalMoves.Size) {
+			t.Fatalf("%s: expected some moves to be filtered out", testCase.fen)
+		}
+
+		searcher.InitializeTimeManager(InfiniteTime, NoValue, NoValue, NoValue, 4, math.MaxUint64)
+		bestMove := searcher.StartSearch(evaluator)
+
+		if len(searcher.syzygyRootMoves) != len(expectedMoves) {
+			t.Errorf("%s: kept the root moves %v, expected %v", testCase.fen, searcher.syzygyRootMoves, expectedMoves)
+		}
+		for _, rootMove := range searcher.syzygyRootMoves {
+			if !containsSameMove(expectedMoves, rootMove) {
+				t.Errorf("%s: kept the root move %v, expected %v", testCase.fen, rootMove, expectedMoves)
+			}
+		}
+		if !containsSameMove(expectedMoves, bestMove) {
+			t.Errorf("%s: played %v, expected one of %v", testCase.fen, bestMove, expectedMoves)
+		}
+	}
+}
+
+func TestSyzygyProbeDepthOption(t *testing.T) {
+	evaluator := &DefaultEvaluator{}
+	searcher := NewDefaultSearcher()
+	searcher.Reset(evaluator)
+
+	probeDepthOption := searcher.GetOptions()["SyzygyProbeDepth"]
+	if searcher.syzygyProbeDepth != DefaultSyzygyProbeDepth || probeDepthOption.DefaultValue() != "1" {
+		t.Errorf("the probe depth is %d, offered as %s, expected %d", searcher.syzygyProbeDepth, probeDepthOption.DefaultValue(), DefaultSyzygyProbeDepth)
+	}
+
+	probeDepthOption.Set("3")
+	searcher.Reset(evaluator)
+	if searcher.syzygyProbeDepth != 3 {
+		t.Errorf("the probe depth is %d after a reset, expected 3", searcher.syzygyProbeDepth)
+	}
+}
+
+func containsSameMove(moves []Move, move Move) bool {
+	for _, candidateMove := range moves {
+		if candidateMove.IsSameMove(move) {
+			return true
+		}
+	}
+	return false
+}
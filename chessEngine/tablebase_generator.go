@@ -0,0 +1,582 @@
+package chessEngine
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	MaxTablebasePieces = 5
+	MaxTablebasePlies  = 254
+
+	pawnlessKingSlots = 16
+	pawnKingSlots     = 32
+
+	tablebaseUnresolved uint8 = 0
+	tablebaseResolved   uint8 = 1
+	tablebaseInvalid    uint8 = 2
+
+	noConversionScore = -CheckmateScore - 1
+)
+
+var tablebasePieceOrder = []uint8{Queen, Rook, Bishop, Knight, Pawn}
+
+// TablebaseMaterial describes the pieces of a tablebase, with the first side of its code, such as "KRvKP", being white.
+// Pieces starts with the white and black kings, followed by the remaining white then black pieces.
+type TablebaseMaterial struct {
+	Code        string
+	Pieces      []Piece
+	HasPawns    bool
+	sameAsPrior []bool
+}
+
+// ParseTablebaseMaterial parses a material code such as "KQvKR", putting the stronger side first.
+func ParseTablebaseMaterial(code string) (TablebaseMaterial, error) {
+	sides := strings.Split(strings.ToUpper(code), "V")
+	if len(sides) != 2 {
+		return TablebaseMaterial{}, fmt.Errorf("invalid material %s, expected a code such as KRvKP", code)
+	}
+
+	var sidePieces [2][]uint8
+	for sideIndex, side := range sides {
+		if strings.Count(side, "K") != 1 || !strings.HasPrefix(side, "K") {
+			return TablebaseMaterial{}, fmt.Errorf("invalid material %s, each side needs exactly one king first", code)
+		}
+
+		for _, pieceChar := range side[1:] {
+			piece, ok := CharToPiece[byte(pieceChar)]
+			if !ok || piece.PieceType == King {
+				return TablebaseMaterial{}, fmt.Errorf("invalid piece %c in material %s", pieceChar, code)
+			}
+			sidePieces[sideIndex] = append(sidePieces[sideIndex], piece.PieceType)
+		}
+	}
+
+	if len(sidePieces[0])+len(sidePieces[1])+2 > MaxTablebasePieces {
+		return TablebaseMaterial{}, fmt.Errorf("material %s has more than %d pieces", code, MaxTablebasePieces)
+	}
+
+	return newTablebaseMaterial(sidePieces[0], sidePieces[1]), nil
+}
+
+func newTablebaseMaterial(firstSidePieces []uint8, secondSidePieces []uint8) TablebaseMaterial {
+	firstSideCode, secondSideCode := tablebaseSideCode(firstSidePieces), tablebaseSideCode(secondSidePieces)
+	if isStrongerTablebaseSide(secondSideCode, secondSidePieces, firstSideCode, firstSidePieces) {
+		firstSideCode, secondSideCode = secondSideCode, firstSideCode
+	}
+
+	material := TablebaseMaterial{
+		Code:   firstSideCode + "v" + secondSideCode,
+		Pieces: []Piece{{King, White}, {King, Black}},
+	}
+
+	for sideIndex, sideCode := range []string{firstSideCode, secondSideCode} {
+		color := White
+		if sideIndex == 1 {
+			color = Black
+		}
+
+		for _, pieceChar := range sideCode[1:] {
+			pieceType := CharToPiece[byte(pieceChar)].PieceType
+			material.Pieces = append(material.Pieces, Piece{pieceType, color})
+			material.HasPawns = material.HasPawns || pieceType == Pawn
+		}
+	}
+
+	material.sameAsPrior = make([]bool, len(material.Pieces))
+	for slot := 1; slot < len(material.Pieces); slot++ {
+		material.sameAsPrior[slot] = material.Pieces[slot] == material.Pieces[slot-1]
+	}
+
+	return material
+}
+
+func tablebaseSideCode(pieceTypes []uint8) string {
+	code := "K"
+	for _, orderedPieceType := range tablebasePieceOrder {
+		for _, pieceType := range pieceTypes {
+			if pieceType == orderedPieceType {
+				code += strings.ToUpper(string(PieceTypeToChar[pieceType]))
+			}
+		}
+	}
+	return code
+}
+
+func isStrongerTablebaseSide(code string, pieceTypes []uint8, otherCode string, otherPieceTypes []uint8) bool {
+	material, otherMaterial := int16(0), int16(0)
+	for _, pieceType := range pieceTypes {
+		material += StandardPieceValuesScaled[pieceType]
+	}
+	for _, pieceType := range otherPieceTypes {
+		otherMaterial += StandardPieceValuesScaled[pieceType]
+	}
+
+	if material != otherMaterial {
+		return material > otherMaterial
+	}
+	if len(code) != len(otherCode) {
+		return len(code) > len(otherCode)
+	}
+	return code > otherCode
+}
+
+// getTablebaseMaterialOfPosition returns the material of the position and whether its colors are swapped relative
+// to the material, i.e. whether black owns the first side of the code.
+func getTablebaseMaterialOfPosition(position *Position) (TablebaseMaterial, bool) {
+	var sidePieces [2][]uint8
+	for colorIndex, color := range []uint8{White, Black} {
+		for pieceType := Pawn; pieceType < King; pieceType++ {
+			for count := position.PiecesBitBoard[color][pieceType].CountSetBits(); count > 0; count-- {
+				sidePieces[colorIndex] = append(sidePieces[colorIndex], pieceType)
+			}
+		}
+	}
+
+	material := newTablebaseMaterial(sidePieces[0], sidePieces[1])
+	return material, material.Code != tablebaseSideCode(sidePieces[0])+"v"+tablebaseSideCode(sidePieces[1])
+}
+
+func (material *TablebaseMaterial) kingSlots() uint64 {
+	if material.HasPawns {
+		return pawnKingSlots
+	}
+	return pawnlessKingSlots
+}
+
+// Size is the number of entries of the tablebase. The white king is restricted to the files A to D, and to the
+// ranks 1 to 4 without pawns, using the board symmetries; every other piece may stand on any square.
+func (material *TablebaseMaterial) Size() uint64 {
+	size := 2 * material.kingSlots()
+	for slot := 1; slot < len(material.Pieces); slot++ {
+		size *= 64
+	}
+	return size
+}
+
+// encodeIndex mirrors the squares so that the white king stands in its restricted region, orders the squares of
+// identical pieces and returns the resulting index. The squares are modified in place.
+func (material *TablebaseMaterial) encodeIndex(sideToMove uint8, squares []uint8) uint64 {
+	if File(squares[0]) > FileD {
+		for slot := range squares {
+			squares[slot] ^= 7
+		}
+	}
+	if !material.HasPawns && Rank(squares[0]) > Rank4 {
+		for slot := range squares {
+			squares[slot] ^= 56
+		}
+	}
+
+	for slot := 1; slot < len(squares); slot++ {
+		for previous := slot; previous > 0 && material.sameAsPrior[previous] && squares[previous-1] > squares[previous]; previous-- {
+			squares[previous-1], squares[previous] = squares[previous], squares[previous-1]
+		}
+	}
+
+	index := uint64(sideToMove)*material.kingSlots() + uint64(Rank(squares[0])*4+File(squares[0]))
+	for slot := 1; slot < len(squares); slot++ {
+		index = index*64 + uint64(squares[slot])
+	}
+	return index
+}
+
+func (material *TablebaseMaterial) decodeIndex(index uint64, squares []uint8) (sideToMove uint8) {
+	for slot := len(squares) - 1; slot >= 1; slot-- {
+		squares[slot] = uint8(index % 64)
+		index /= 64
+	}
+
+	kingSlot := uint8(index % material.kingSlots())
+	squares[0] = (kingSlot/4)*8 + kingSlot%4
+	return uint8(index / material.kingSlots())
+}
+
+// getSquaresOfPosition fills the squares of the material pieces from the position, seen from the side owning the
+// first side of the material code, and returns the side to move seen the same way.
+func (material *TablebaseMaterial) getSquaresOfPosition(position *Position, colorsSwapped bool, squares []uint8) (sideToMove uint8) {
+	remainingPieces := position.PiecesBitBoard
+	for slot, piece := range material.Pieces {
+		color := piece.Color
+		if colorsSwapped {
+			color ^= 1
+		}
+
+		squares[slot] = remainingPieces[color][piece.PieceType].PopMostSignificantBit()
+		if colorsSwapped {
+			squares[slot] ^= 56
+		}
+	}
+
+	if colorsSwapped {
+		return position.SideToMove ^ 1
+	}
+	return position.SideToMove
+}
+
+type tablebaseGenerator struct {
+	material        TablebaseMaterial
+	tablebases      *Tablebases
+	position        Position
+	values          []uint8
+	states          []uint8
+	remainingMoves  []uint8
+	bestConversions []int16
+	levels          tablebaseLevels
+	predecessors    []uint64
+	progressOutput  io.Writer
+}
+
+// tablebaseLevels holds the positions scheduled to be resolved at each distance to mate, in plies.
+type tablebaseLevels [MaxTablebasePlies + 1][]uint32
+
+type tablebaseClassifier struct {
+	position  Position
+	evaluator DefaultEvaluator
+	levels    tablebaseLevels
+	err       error
+}
+
+// GenerateTablebase computes the distance to mate of every position of the material by retrograde analysis. The
+// tables of the materials reachable by captures and promotions must already be in the tablebases. En passant
+// captures and castling are not considered.
+func GenerateTablebase(material TablebaseMaterial, tablebases *Tablebases, progressOutput io.Writer) (*Tablebase, error) {
+	if material.Size() > math.MaxUint32 {
+		return nil, fmt.Errorf("material %s is too large to generate", material.Code)
+	}
+
+	generator := tablebaseGenerator{
+		material:        material,
+		tablebases:      tablebases,
+		values:          make([]uint8, material.Size()),
+		states:          make([]uint8, material.Size()),
+		remainingMoves:  make([]uint8, material.Size()),
+		bestConversions: make([]int16, material.Size()),
+		progressOutput:  progressOutput,
+	}
+
+	if err := generator.classifyAllPositions(); err != nil {
+		return nil, err
+	}
+
+	for plies := 0; plies <= MaxTablebasePlies && generator.hasScheduledPositions(plies); plies++ {
+		if err := generator.resolveLevel(plies); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Tablebase{Material: material, entries: generator.values}, nil
+}
+
+// getTablebaseDependencies returns the materials reachable from the material by a capture or a promotion.
+func getTablebaseDependencies(material TablebaseMaterial) []TablebaseMaterial {
+	dependencies := []TablebaseMaterial{}
+	for slot := 2; slot < len(material.Pieces); slot++ {
+		var sidePieces [2][]uint8
+		for otherSlot := 2; otherSlot < len(material.Pieces); otherSlot++ {
+			if otherSlot != slot {
+				piece := material.Pieces[otherSlot]
+				sidePieces[piece.Color^1] = append(sidePieces[piece.Color^1], piece.PieceType)
+			}
+		}
+		dependencies = append(dependencies, newTablebaseMaterial(sidePieces[0], sidePieces[1]))
+
+		piece := material.Pieces[slot]
+		if piece.PieceType != Pawn {
+			continue
+		}
+
+		for _, promotionPieceType := range []uint8{Queen, Rook, Bishop, Knight} {
+			promotedSidePieces := [2][]uint8{append([]uint8{}, sidePieces[0]...), append([]uint8{}, sidePieces[1]...)}
+			promotedSidePieces[piece.Color^1] = append(promotedSidePieces[piece.Color^1], promotionPieceType)
+			dependencies = append(dependencies, newTablebaseMaterial(promotedSidePieces[0], promotedSidePieces[1]))
+		}
+	}
+	return dependencies
+}
+
+func setUpTablebasePosition(position *Position, pieces []Piece, sideToMove uint8, squares []uint8) {
+	position.PiecesBitBoard = [2][6]Bitboard{}
+	position.ColorsBitBoard = [2]Bitboard{}
+	for square := range position.SquareContent {
+		position.SquareContent[square] = Piece{NoneType, NoneColor}
+	}
+
+	for slot, piece := range pieces {
+		position.PiecesBitBoard[piece.Color][piece.PieceType].SetBit(squares[slot])
+		position.ColorsBitBoard[piece.Color].SetBit(squares[slot])
+		position.SquareContent[squares[slot]] = piece
+	}
+
+	position.SideToMove = sideToMove
+	position.CastlingRights = 0
+	position.EnPassantSquare = NoneSquare
+	position.Rule50 = 0
+	position.stateStackSize = 0
+}
+
+func isValidTablebasePosition(position *Position, material *TablebaseMaterial, sideToMove uint8, squares []uint8, index uint64) bool {
+	var occupancyBitboard Bitboard
+	for slot, piece := range material.Pieces {
+		if occupancyBitboard&BitboardForSquare[squares[slot]] != 0 {
+			return false
+		}
+		if piece.PieceType == Pawn && (Rank(squares[slot]) == Rank1 || Rank(squares[slot]) == Rank8) {
+			return false
+		}
+		occupancyBitboard |= BitboardForSquare[squares[slot]]
+	}
+
+	var canonicalSquares [MaxTablebasePieces]uint8
+	copy(canonicalSquares[:], squares)
+	if material.encodeIndex(sideToMove, canonicalSquares[:len(squares)]) != index {
+		return false
+	}
+
+	// The side which isn't to move can't be in check
+	setUpTablebasePosition(position, material.Pieces, sideToMove^1, squares)
+	return !position.IsCurrentSideInCheck()
+}
+
+// classifyAllPositions splits the positions between concurrent classifiers, then gathers the positions they
+// scheduled.
+func (generator *tablebaseGenerator) classifyAllPositions() error {
+	classifiers := make([]tablebaseClassifier, runtime.NumCPU())
+	positionsPerClassifier := (uint64(len(generator.values)) + uint64(len(classifiers)) - 1) / uint64(len(classifiers))
+	var classifiersGroup sync.WaitGroup
+
+	for classifierIndex := range classifiers {
+		firstIndex := uint64(classifierIndex) * positionsPerClassifier
+		lastIndex := min(firstIndex+positionsPerClassifier, uint64(len(generator.values)))
+		classifier := &classifiers[classifierIndex]
+
+		classifiersGroup.Add(1)
+		go func() {
+			defer classifiersGroup.Done()
+			classifier.err = generator.classifyPositions(classifier, firstIndex, lastIndex)
+		}()
+	}
+	classifiersGroup.Wait()
+
+	for classifierIndex := range classifiers {
+		if classifiers[classifierIndex].err != nil {
+			return classifiers[classifierIndex].err
+		}
+		for plies := range generator.levels {
+			generator.levels[plies] = append(generator.levels[plies], classifiers[classifierIndex].levels[plies]...)
+		}
+	}
+	return nil
+}
+
+// classifyPositions finds the mates and stalemates, resolves the captures and promotions through the smaller
+// tables and counts the remaining moves of every valid position in the range.
+func (generator *tablebaseGenerator) classifyPositions(classifier *tablebaseClassifier, firstIndex uint64, lastIndex uint64) error {
+	var squares [MaxTablebasePieces]uint8
+	pieceSquares := squares[:len(generator.material.Pieces)]
+	position := &classifier.position
+
+	for index := firstIndex; index < lastIndex; index++ {
+		sideToMove := generator.material.decodeIndex(index, pieceSquares)
+		if !isValidTablebasePosition(position, &generator.material, sideToMove, pieceSquares, index) {
+			generator.states[index] = tablebaseInvalid
+			continue
+		}
+
+		setUpTablebasePosition(position, generator.material.Pieces, sideToMove, pieceSquares)
+		legalMoves := GenerateLegalMoves(position, &classifier.evaluator)
+
+		if legalMoves.Size == 0 {
+			if position.IsCurrentSideInCheck() {
+				classifier.levels[0] = append(classifier.levels[0], uint32(index))
+			} else {
+				generator.states[index] = tablebaseResolved
+			}
+			continue
+		}
+
+		bestConversion := int16(noConversionScore)
+		remainingMoves := uint8(0)
+
+		for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+			move := legalMoves.Moves[moveIndex]
+			if move.GetMoveType() != CaptureMoveType && move.GetMoveType() != PromotionMoveType {
+				remainingMoves++
+				continue
+			}
+
+			position.DoMove(move, &classifier.evaluator)
+			childScore, found := generator.tablebases.Probe(position)
+			position.UnDoPreviousMove(move, &classifier.evaluator)
+			if !found {
+				return fmt.Errorf("tablebase missing for a conversion of %s", generator.material.Code)
+			}
+
+			bestConversion = max(bestConversion, getTablebaseParentScore(childScore))
+		}
+
+		generator.remainingMoves[index] = remainingMoves
+		generator.bestConversions[index] = bestConversion
+
+		if bestConversion > drawScore {
+			if err := scheduleTablebasePosition(&classifier.levels, index, CheckmateScore-bestConversion); err != nil {
+				return err
+			}
+		} else if remainingMoves == 0 {
+			if err := generator.resolveWithoutRemainingMoves(&classifier.levels, index, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (generator *tablebaseGenerator) hasScheduledPositions(fromPlies int) bool {
+	for plies := fromPlies; plies <= MaxTablebasePlies; plies++ {
+		if len(generator.levels[plies]) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func scheduleTablebasePosition(levels *tablebaseLevels, index uint64, plies int16) error {
+	if plies > MaxTablebasePlies {
+		return fmt.Errorf("mates longer than %d plies aren't supported", MaxTablebasePlies)
+	}
+	levels[plies] = append(levels[plies], uint32(index))
+	return nil
+}
+
+// resolveWithoutRemainingMoves handles a position whose moves which stay within the table all lose, the last of
+// them in the given number of plies. Positions winning by conversion are already scheduled.
+func (generator *tablebaseGenerator) resolveWithoutRemainingMoves(levels *tablebaseLevels, index uint64, minimumPlies int16) error {
+	bestConversion := generator.bestConversions[index]
+	if bestConversion > drawScore {
+		return nil
+	}
+
+	if bestConversion == drawScore {
+		generator.states[index] = tablebaseResolved
+		return nil
+	}
+
+	plies := minimumPlies
+	if bestConversion != noConversionScore {
+		plies = max(plies, CheckmateScore+bestConversion)
+	}
+	return scheduleTablebasePosition(levels, index, plies)
+}
+
+// resolveLevel resolves the positions scheduled at the given distance to mate, and derives the positions
+// preceding them: those preceding a loss are wins one ply later, and those whose moves all lead to wins are losses.
+func (generator *tablebaseGenerator) resolveLevel(plies int) error {
+	var squares [MaxTablebasePieces]uint8
+	pieceSquares := squares[:len(generator.material.Pieces)]
+	isLossLevel := plies%2 == 0
+
+	for levelIndex := 0; levelIndex < len(generator.levels[plies]); levelIndex++ {
+		index := uint64(generator.levels[plies][levelIndex])
+		if generator.states[index] != tablebaseUnresolved {
+			continue
+		}
+
+		generator.states[index] = tablebaseResolved
+		generator.values[index] = uint8(plies + 1)
+
+		sideToMove := generator.material.decodeIndex(index, pieceSquares)
+		setUpTablebasePosition(&generator.position, generator.material.Pieces, sideToMove, pieceSquares)
+
+		for _, predecessorIndex := range generator.getPredecessorIndices(sideToMove, pieceSquares) {
+			if generator.states[predecessorIndex] != tablebaseUnresolved {
+				continue
+			}
+
+			if isLossLevel {
+				if err := scheduleTablebasePosition(&generator.levels, predecessorIndex, int16(plies+1)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			generator.remainingMoves[predecessorIndex]--
+			if generator.remainingMoves[predecessorIndex] == 0 {
+				if err := generator.resolveWithoutRemainingMoves(&generator.levels, predecessorIndex, int16(plies+1)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	generator.levels[plies] = nil
+	if generator.progressOutput != nil && plies%10 == 0 {
+		fmt.Fprintf(generator.progressOutput, "info string %s: resolved distance %d\n", generator.material.Code, plies)
+	}
+	return nil
+}
+
+// getPredecessorIndices un-moves the pieces of the side which just moved. Moves other than pawn pushes are
+// reversible, so their un-moves are the quiet moves generated for that side.
+func (generator *tablebaseGenerator) getPredecessorIndices(sideToMove uint8, squares []uint8) []uint64 {
+	position := &generator.position
+	movedSide := sideToMove ^ 1
+	generator.predecessors = generator.predecessors[:0]
+
+	var predecessorSquares [MaxTablebasePieces]uint8
+	addPredecessor := func(fromSquare uint8, toSquare uint8) {
+		copy(predecessorSquares[:], squares)
+		for slot := range squares {
+			if squares[slot] == fromSquare {
+				predecessorSquares[slot] = toSquare
+			}
+		}
+		generator.predecessors = append(generator.predecessors, generator.material.encodeIndex(movedSide, predecessorSquares[:len(squares)]))
+	}
+
+	position.SideToMove = movedSide
+	unMoves := GeneratePseudoLegalMoves(position)
+	position.SideToMove = sideToMove
+
+	for moveIndex := uint8(0); moveIndex < unMoves.Size; moveIndex++ {
+		unMove := unMoves.Moves[moveIndex]
+		if unMove.GetMoveType() == QuietMoveType && position.SquareContent[unMove.GetFromSquare()].PieceType != Pawn {
+			addPredecessor(unMove.GetFromSquare(), unMove.GetToSquare())
+		}
+	}
+
+	occupancyBitboard := position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]
+	pawns := position.PiecesBitBoard[movedSide][Pawn]
+	for pawns != 0 {
+		pawnSquare := pawns.PopMostSignificantBit()
+		relativeRank := Rank(relativeSquare(movedSide, pawnSquare))
+		backwardDelta := -getPawnForwardDelta(movedSide)
+		singlePushOrigin := uint8(int8(pawnSquare) + backwardDelta)
+
+		if relativeRank < Rank3 || occupancyBitboard&BitboardForSquare[singlePushOrigin] != 0 {
+			continue
+		}
+		addPredecessor(pawnSquare, singlePushOrigin)
+
+		doublePushOrigin := uint8(int8(singlePushOrigin) + backwardDelta)
+		if relativeRank == Rank4 && occupancyBitboard&BitboardForSquare[doublePushOrigin] == 0 {
+			addPredecessor(pawnSquare, doublePushOrigin)
+		}
+	}
+
+	return generator.predecessors
+}
+
+// getTablebaseParentScore converts the score of a position into the score of the move leading to it.
+func getTablebaseParentScore(childScore int16) int16 {
+	if childScore > drawScore {
+		return -childScore + 1
+	} else if childScore < drawScore {
+		return -childScore - 1
+	}
+	return drawScore
+}
@@ -0,0 +1,165 @@
+package chessEngine
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testTablebases holds the tables generated so far, as several tests share them.
+var testTablebases = NewTablebases("")
+
+func getTestTablebase(t *testing.T, materialCode string) *Tablebase {
+	material, err := ParseTablebaseMaterial(materialCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tablebase, err := testTablebases.Generate(material, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tablebase
+}
+
+func TestTablebaseLongestMates(t *testing.T) {
+	testCases := []struct {
+		materialCode     string
+		longestMatePlies int
+	}{
+		{"KQvK", 19},
+		{"KRvK", 31},
+		{"KBNvK", 65},
+		{"KPvK", 55},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.materialCode == "KBNvK" && (testing.Short() || raceDetectorEnabled) {
+			continue
+		}
+
+		// The second half of the entries has white, the stronger side, to move
+		tablebase := getTestTablebase(t, testCase.materialCode)
+		longestMatePlies := 0
+		for _, entry := range tablebase.entries[len(tablebase.entries)/2:] {
+			longestMatePlies = max(longestMatePlies, int(entry)-1)
+		}
+		if longestMatePlies != testCase.longestMatePlies {
+			t.Errorf("%s: the longest mate is %d plies, expected %d", testCase.materialCode, longestMatePlies, testCase.longestMatePlies)
+		}
+	}
+}
+
+func TestTablebaseAgreesWithKPKBitbase(t *testing.T) {
+	material := getTestTablebase(t, "KPvK").Material
+	position := Position{}
+	squares := make([]uint8, len(material.Pieces))
+	positionCount := 0
+
+	// Every square of the pawn is tried, without using the symmetries of the tablebase
+	for sideToMove := Black; sideToMove <= White; sideToMove++ {
+		for squares[0] = 0; squares[0] < 64; squares[0]++ {
+			for squares[1] = 0; squares[1] < 64; squares[1]++ {
+				for squares[2] = 8; squares[2] < 56; squares[2]++ {
+					if squares[0] == squares[1] || squares[0] == squares[2] || squares[1] == squares[2] || chebyshevDistance(squares[0], squares[1]) <= 1 {
+						continue
+					}
+
+					setUpTablebasePosition(&position, material.Pieces, sideToMove^1, squares)
+					if position.IsCurrentSideInCheck() {
+						continue
+					}
+					setUpTablebasePosition(&position, material.Pieces, sideToMove, squares)
+					positionCount++
+
+					score, found := testTablebases.Probe(&position)
+					whiteWins := score != drawScore && (score > drawScore) == (sideToMove == White)
+					if !found || whiteWins != ProbeKPKBitbase(&position, White) {
+						t.Fatalf("the tablebase scores %d the position with the squares %v and side to move %d", score, squares, sideToMove)
+					}
+				}
+			}
+		}
+	}
+
+	if positionCount != 331352 {
+		t.Errorf("compared %d positions, expected 331352", positionCount)
+	}
+}
+
+func TestTablebaseIndexRoundTrip(t *testing.T) {
+	for _, materialCode := range []string{"KQvK", "KBNvK", "KPvK", "KRvKP", "KNNvK"} {
+		material, err := ParseTablebaseMaterial(materialCode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		squares := make([]uint8, len(material.Pieces))
+		for index := uint64(0); index < material.Size(); index += 7 {
+			sideToMove := material.decodeIndex(index, squares)
+
+			// Indices whose squares aren't canonical map to another index, which must be canonical itself
+			encodedIndex := material.encodeIndex(sideToMove, squares)
+			if encodedIndex >= material.Size() {
+				t.Fatalf("%s: index %d is encoded as %d", materialCode, index, encodedIndex)
+			}
+			if encodedIndex != index {
+				canonicalSideToMove := material.decodeIndex(encodedIndex, squares)
+				if canonicalSideToMove != sideToMove || material.encodeIndex(sideToMove, squares) != encodedIndex {
+					t.Fatalf("%s: index %d is encoded as %d, which isn't canonical", materialCode, index, encodedIndex)
+				}
+			}
+		}
+	}
+}
+
+func TestTablebaseProbeSymmetries(t *testing.T) {
+	for _, materialCode := range []string{"KQvK", "KRvK", "KPvK"} {
+		getTestTablebase(t, materialCode)
+	}
+	evaluator := &DefaultEvaluator{}
+
+	// Each position is scored like its mirrored and color-swapped versions
+	testCases := []struct {
+		fens          []string
+		expectedScore int16
+	}{
+		{[]string{"7k/8/6K1/8/8/8/8/1Q6 w - - 0 1", "k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", "1Q6/8/8/8/8/6K1/8/7k w - - 0 1", "1q6/8/8/8/8/6k1/8/7K b - - 0 1"}, CheckmateScore - 1},
+		{[]string{"8/8/8/8/8/1K6/1R6/k7 b - - 0 1", "8/8/8/8/8/6K1/6R1/7k b - - 0 1", "K7/1r6/1k6/8/8/8/8/8 w - - 0 1"}, drawScore},
+		{[]string{"k7/8/1K6/P7/8/8/8/8 w - - 0 1", "7k/8/6K1/7P/8/8/8/8 w - - 0 1", "8/8/8/8/p7/1k6/8/K7 b - - 0 1"}, drawScore},
+	}
+
+	for _, testCase := range testCases {
+		for _, fen := range testCase.fens {
+			position := Position{}
+			position.LoadFEN(fen, evaluator)
+			if score, found := testTablebases.Probe(&position); !found || score != testCase.expectedScore {
+				t.Errorf("%s: scored %d, expected %d", fen, score, testCase.expectedScore)
+			}
+		}
+	}
+}
+
+func TestTablebaseFileRoundTrip(t *testing.T) {
+	tablebase := getTestTablebase(t, "KRvK")
+
+	var tablebaseFile bytes.Buffer
+	if err := tablebase.Write(&tablebaseFile); err != nil {
+		t.Fatal(err)
+	}
+	fileContents := tablebaseFile.Bytes()
+
+	readTablebase, err := ReadTablebase(bytes.NewReader(fileContents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readTablebase.Material.Code != "KRvK" || !bytes.Equal(readTablebase.entries, tablebase.entries) {
+		t.Errorf("read the tablebase %s with different entries", readTablebase.Material.Code)
+	}
+
+	if _, err := ReadTablebase(bytes.NewReader(fileContents[:len(fileContents)/2])); err == nil {
+		t.Error("a truncated tablebase was read")
+	}
+	fileContents[0] ^= 1
+	if _, err := ReadTablebase(bytes.NewReader(fileContents)); err == nil {
+		t.Error("a tablebase with a wrong magic number was read")
+	}
+}
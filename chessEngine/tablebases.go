@@ -0,0 +1,279 @@
+package chessEngine
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	TablebaseFileMagic        uint32 = 0x42544647
+	TablebaseFileVersion      uint32 = 1
+	TablebaseFileExtension           = ".gtb"
+	DefaultTablebaseDirectory        = "tablebases"
+)
+
+// Tablebase holds one byte per position: 0 for draws and invalid positions, and otherwise the number of plies to
+// mate plus one, the side to move winning when the number of plies is odd.
+type Tablebase struct {
+	Material TablebaseMaterial
+	entries  []uint8
+}
+
+type tablebaseEntry struct {
+	tablebase     *Tablebase
+	colorsSwapped bool
+}
+
+// Tablebases is the set of tablebases available for probing, keyed by the material signature of the positions.
+type Tablebases struct {
+	Directory string
+	entries   map[uint64]tablebaseEntry
+	count     int
+}
+
+func NewTablebases(directory string) *Tablebases {
+	return &Tablebases{Directory: directory, entries: make(map[uint64]tablebaseEntry)}
+}
+
+// LoadTablebases loads every tablebase file of the directory.
+func LoadTablebases(directory string) (*Tablebases, error) {
+	tablebases := NewTablebases(directory)
+	filePaths, err := filepath.Glob(filepath.Join(directory, "*"+TablebaseFileExtension))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filePath := range filePaths {
+		tablebase, err := LoadTablebase(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		tablebases.Add(tablebase)
+	}
+
+	return tablebases, nil
+}
+
+func (tablebases *Tablebases) Add(tablebase *Tablebase) {
+	materialCode := tablebase.Material.Code
+	if _, found := tablebases.entries[materialSignatureFromCode(materialCode, White)]; !found {
+		tablebases.count++
+	}
+	tablebases.entries[materialSignatureFromCode(materialCode, White)] = tablebaseEntry{tablebase, false}
+	tablebases.entries[materialSignatureFromCode(materialCode, Black)] = tablebaseEntry{tablebase, true}
+}
+
+func (tablebases *Tablebases) Count() int {
+	return tablebases.count
+}
+
+// Probe returns the tablebase score of the position for the side to move: CheckmateScore minus the plies to mate
+// for wins, its negation for losses and drawScore for draws. Positions with castling rights or an en passant square
+// aren't probed.
+func (tablebases *Tablebases) Probe(position *Position) (int16, bool) {
+	occupancyBitboard := position.ColorsBitBoard[White] | position.ColorsBitBoard[Black]
+	if occupancyBitboard.CountSetBits() > MaxTablebasePieces || position.CastlingRights != 0 || position.EnPassantSquare != NoneSquare {
+		return drawScore, false
+	}
+
+	if occupancyBitboard.CountSetBits() == 2 {
+		return drawScore, true
+	}
+
+	entry, found := tablebases.entries[MaterialSignature(position)]
+	if !found {
+		return drawScore, false
+	}
+	return entry.tablebase.probe(position, entry.colorsSwapped), true
+}
+
+// Generate generates the tablebase of the material along with the missing tablebases it depends on.
+func (tablebases *Tablebases) Generate(material TablebaseMaterial, progressOutput io.Writer) (*Tablebase, error) {
+	if entry, found := tablebases.entries[materialSignatureFromCode(material.Code, White)]; found {
+		return entry.tablebase, nil
+	}
+
+	for _, dependency := range getTablebaseDependencies(material) {
+		if len(dependency.Pieces) > 2 {
+			if _, err := tablebases.Generate(dependency, progressOutput); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tablebase, err := GenerateTablebase(material, tablebases, progressOutput)
+	if err != nil {
+		return nil, err
+	}
+	tablebases.Add(tablebase)
+
+	if tablebases.Directory != "" {
+		if err := tablebase.Save(filepath.Join(tablebases.Directory, material.Code+TablebaseFileExtension)); err != nil {
+			return nil, err
+		}
+	}
+
+	if progressOutput != nil {
+		fmt.Fprintf(progressOutput, "info string generated %s, %s\n", material.Code, tablebase.Statistics())
+	}
+	return tablebase, nil
+}
+
+func (tablebase *Tablebase) probe(position *Position, colorsSwapped bool) int16 {
+	var squares [MaxTablebasePieces]uint8
+	pieceSquares := squares[:len(tablebase.Material.Pieces)]
+	sideToMove := tablebase.Material.getSquaresOfPosition(position, colorsSwapped, pieceSquares)
+	return getTablebaseEntryScore(tablebase.entries[tablebase.Material.encodeIndex(sideToMove, pieceSquares)])
+}
+
+func getTablebaseEntryScore(entry uint8) int16 {
+	if entry == 0 {
+		return drawScore
+	}
+
+	plies := int16(entry) - 1
+	if plies%2 == 1 {
+		return CheckmateScore - plies
+	}
+	return -CheckmateScore + plies
+}
+
+// Statistics summarizes the results of the positions with the first side of the material, white, to move.
+func (tablebase *Tablebase) Statistics() string {
+	wins, losses, longestMatePlies := 0, 0, 0
+	for index := uint64(len(tablebase.entries)) / 2; index < uint64(len(tablebase.entries)); index++ {
+		entry := tablebase.entries[index]
+		if entry == 0 {
+			continue
+		}
+
+		if (entry-1)%2 == 1 {
+			wins++
+		} else {
+			losses++
+		}
+		longestMatePlies = max(longestMatePlies, int(entry)-1)
+	}
+	return fmt.Sprintf("%d wins, %d losses, longest mate %d plies", wins, losses, longestMatePlies)
+}
+
+func LoadTablebase(filePath string) (*Tablebase, error) {
+	tablebaseFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer tablebaseFile.Close()
+
+	return ReadTablebase(bufio.NewReader(tablebaseFile))
+}
+
+// ReadTablebase reads a header made of the magic number, the version, the length of the material code and the
+// entry count, followed by the material code and the deflate compressed entries.
+func ReadTablebase(reader io.Reader) (*Tablebase, error) {
+	var header [4]uint32
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading tablebase header: %w", err)
+	}
+
+	magic, version, codeLength, entryCount := header[0], header[1], header[2], header[3]
+	if magic != TablebaseFileMagic {
+		return nil, errors.New("not a GoFish tablebase file")
+	}
+	if version != TablebaseFileVersion {
+		return nil, fmt.Errorf("unsupported tablebase version %d", version)
+	}
+	if codeLength > 2*MaxTablebasePieces+1 {
+		return nil, fmt.Errorf("invalid material code length %d", codeLength)
+	}
+
+	code := make([]byte, codeLength)
+	if _, err := io.ReadFull(reader, code); err != nil {
+		return nil, fmt.Errorf("reading material code: %w", err)
+	}
+
+	material, err := ParseTablebaseMaterial(string(code))
+	if err != nil {
+		return nil, err
+	}
+	if material.Code != string(code) || uint64(entryCount) != material.Size() {
+		return nil, fmt.Errorf("invalid tablebase of material %s", code)
+	}
+
+	tablebase := &Tablebase{Material: material, entries: make([]uint8, entryCount)}
+	decompressor := flate.NewReader(reader)
+	defer decompressor.Close()
+
+	if _, err := io.ReadFull(decompressor, tablebase.entries); err != nil {
+		return nil, fmt.Errorf("reading tablebase entries: %w", err)
+	}
+	return tablebase, nil
+}
+
+func (tablebase *Tablebase) Write(writer io.Writer) error {
+	header := [4]uint32{TablebaseFileMagic, TablebaseFileVersion, uint32(len(tablebase.Material.Code)), uint32(len(tablebase.entries))}
+	if err := binary.Write(writer, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, tablebase.Material.Code); err != nil {
+		return err
+	}
+
+	compressor, err := flate.NewWriter(writer, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := compressor.Write(tablebase.entries); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+func (tablebase *Tablebase) Save(filePath string) error {
+	tablebaseFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	fileWriter := bufio.NewWriter(tablebaseFile)
+	if err := tablebase.Write(fileWriter); err != nil {
+		tablebaseFile.Close()
+		return err
+	}
+	if err := fileWriter.Flush(); err != nil {
+		tablebaseFile.Close()
+		return err
+	}
+	return tablebaseFile.Close()
+}
+
+// GenerateTablebases generates the tablebases of the given comma separated materials into the directory.
+func GenerateTablebases(materialCodes string, directory string, progressOutput io.Writer) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	tablebases, err := LoadTablebases(directory)
+	if err != nil {
+		return err
+	}
+
+	for _, materialCode := range strings.Split(materialCodes, ",") {
+		material, err := ParseTablebaseMaterial(strings.TrimSpace(materialCode))
+		if err != nil {
+			return err
+		}
+
+		if _, err := tablebases.Generate(material, progressOutput); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
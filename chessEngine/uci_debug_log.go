@@ -0,0 +1,179 @@
+package chessEngine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DebugLogFileOption     = "Debug Log File"
+	debugLogTimeLayout     = "2006-01-02 15:04:05.000000"
+	debugLogInboundMarker  = ">>"
+	debugLogOutboundMarker = "<<"
+)
+
+// uciDebugLog records the commands received and the lines sent by a UCI interface with timestamps, one per line:
+//
+//	2024-01-02 15:04:05.000000 >> go wtime 60000 btime 60000
+//	2024-01-02 15:04:06.250000 << bestmove e2e4
+type uciDebugLog struct {
+	lock          sync.Mutex
+	file          *os.File
+	pendingOutput []byte
+}
+
+// Open starts recording into the file, truncating it, or stops recording for an empty path or "<empty>".
+func (debugLog *uciDebugLog) Open(path string) error {
+	debugLog.Close()
+	if path == "" || path == "<empty>" {
+		return nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	debugLog.lock.Lock()
+	debugLog.file = file
+	debugLog.lock.Unlock()
+	return nil
+}
+
+func (debugLog *uciDebugLog) Close() {
+	debugLog.lock.Lock()
+	defer debugLog.lock.Unlock()
+
+	if debugLog.file != nil {
+		debugLog.file.Close()
+		debugLog.file = nil
+	}
+	debugLog.pendingOutput = nil
+}
+
+func (debugLog *uciDebugLog) writeEntry(marker string, line string) {
+	fmt.Fprintf(debugLog.file, "%s %s %s\n", time.Now().Format(debugLogTimeLayout), marker, line)
+}
+
+func (debugLog *uciDebugLog) RecordCommand(command string) {
+	debugLog.lock.Lock()
+	defer debugLog.lock.Unlock()
+
+	if debugLog.file != nil {
+		debugLog.writeEntry(debugLogInboundMarker, command)
+	}
+}
+
+// RecordOutput records each complete line of the output, keeping a partial line until it's completed.
+func (debugLog *uciDebugLog) RecordOutput(data []byte) {
+	debugLog.lock.Lock()
+	defer debugLog.lock.Unlock()
+
+	if debugLog.file == nil {
+		return
+	}
+
+	debugLog.pendingOutput = append(debugLog.pendingOutput, data...)
+	for {
+		lineEnd := strings.IndexByte(string(debugLog.pendingOutput), '\n')
+		if lineEnd < 0 {
+			return
+		}
+		debugLog.writeEntry(debugLogOutboundMarker, strings.TrimRight(string(debugLog.pendingOutput[:lineEnd]), "\r"))
+		debugLog.pendingOutput = debugLog.pendingOutput[lineEnd+1:]
+	}
+}
+
+// uciOutputWriter writes the output of a UCI interface, including the search info, and records it in the debug log.
+type uciOutputWriter struct {
+	uciInterface *UciInterface
+}
+
+func (writer uciOutputWriter) Write(data []byte) (int, error) {
+	output := writer.uciInterface.output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	writer.uciInterface.debugLog.RecordOutput(data)
+	return output.Write(data)
+}
+
+// RecordedUciCommand is a command read from a debug log, with the time it was received.
+type RecordedUciCommand struct {
+	Time    time.Time
+	Command string
+}
+
+// ReadUciDebugLog returns the commands recorded in a debug log, skipping the output lines.
+func ReadUciDebugLog(reader io.Reader) ([]RecordedUciCommand, error) {
+	commands := []RecordedUciCommand{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// The timestamp has two fields, followed by the marker.
+		lineFields := strings.SplitN(line, " ", 4)
+		if len(lineFields) < 3 {
+			return nil, fmt.Errorf("line %d: expected a timestamp and a direction marker", lineNumber)
+		}
+
+		timestamp, err := time.Parse(debugLogTimeLayout, lineFields[0]+" "+lineFields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %w", lineNumber, err)
+		}
+
+		switch lineFields[2] {
+		case debugLogInboundMarker:
+			command := ""
+			if len(lineFields) == 4 {
+				command = lineFields[3]
+			}
+			commands = append(commands, RecordedUciCommand{Time: timestamp, Command: command})
+		case debugLogOutboundMarker:
+		default:
+			return nil, fmt.Errorf("line %d: unknown direction marker %s", lineNumber, lineFields[2])
+		}
+	}
+
+	return commands, scanner.Err()
+}
+
+// isDebugLogFileCommand tells whether the command sets the debug log file, which a replay mustn't do since it would
+// overwrite the log being replayed.
+func isDebugLogFileCommand(command string) bool {
+	if !strings.HasPrefix(command, "setoption") {
+		return false
+	}
+	optionName, _ := parseSetOptionCommand(strings.TrimPrefix(command, "setoption"))
+	return strings.EqualFold(optionName, DebugLogFileOption)
+}
+
+// ReplayUciCommands writes the commands to the writer, one per line, waiting between them as long as they were
+// apart when recorded, so that stop commands reach searches at the same moments.
+func ReplayUciCommands(commands []RecordedUciCommand, writer io.Writer) error {
+	for index, command := range commands {
+		if index > 0 {
+			time.Sleep(command.Time.Sub(commands[index-1].Time))
+		}
+
+		if isDebugLogFileCommand(command.Command) {
+			continue
+		}
+		if _, err := io.WriteString(writer, command.Command+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
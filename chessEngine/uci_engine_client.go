@@ -0,0 +1,365 @@
+package chessEngine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUciEngineTimeout     = 10 * time.Second
+	DefaultUciEngineStopTimeout = 5 * time.Second
+	uciEngineOutputBuffer       = 256
+	uciEngineStderrLimit        = 4096
+)
+
+var (
+	ErrUciEngineExited  = errors.New("the engine exited")
+	ErrUciEngineTimeout = errors.New("the engine didn't answer in time")
+)
+
+// UciSearchResult is the answer of an engine to a go command, with the latest info of each principal variation,
+// ordered by their multipv number.
+type UciSearchResult struct {
+	BestMove   string
+	PonderMove string
+	Lines      []SearchInfo
+}
+
+// stderrTail keeps the end of the error output of an engine, to explain why it crashed.
+type stderrTail struct {
+	lock sync.Mutex
+	data []byte
+}
+
+func (tail *stderrTail) Write(data []byte) (int, error) {
+	tail.lock.Lock()
+	defer tail.lock.Unlock()
+
+	tail.data = append(tail.data, data...)
+	if len(tail.data) > uciEngineStderrLimit {
+		tail.data = tail.data[len(tail.data)-uciEngineStderrLimit:]
+	}
+	return len(data), nil
+}
+
+func (tail *stderrTail) String() string {
+	tail.lock.Lock()
+	defer tail.lock.Unlock()
+	return strings.TrimSpace(string(tail.data))
+}
+
+// UciEngineClient drives a UCI engine running as a subprocess, such as GoFish itself or another engine to compare
+// against. Its methods aren't safe for concurrent use, except for Kill.
+type UciEngineClient struct {
+	Name    string
+	Author  string
+	Options []UciOptionOffer
+
+	// Timeout bounds the wait for the answers to the handshake and isready, and StopTimeout the wait for the best
+	// move once a search is stopped.
+	Timeout     time.Duration
+	StopTimeout time.Duration
+
+	process *exec.Cmd
+	input   io.WriteCloser
+	lines   chan string
+	exited  chan struct{}
+	exitErr error
+	stderr  *stderrTail
+
+	// discardingOutput is closed once the client stops reading the lines of the engine, so that the engine can't
+	// block on a full buffer while it quits or is killed.
+	discardingOutput     chan struct{}
+	discardingOutputOnce sync.Once
+}
+
+// StartUciEngine launches the engine and completes the UCI handshake, reading its name, author and options. Lines
+// the engine prints before answering the uci command, such as a banner, are ignored.
+func StartUciEngine(path string, arguments ...string) (*UciEngineClient, error) {
+	client := &UciEngineClient{
+		Timeout:     DefaultUciEngineTimeout,
+		StopTimeout: DefaultUciEngineStopTimeout,
+		process:     exec.Command(path, arguments...),
+		lines:       make(chan string, uciEngineOutputBuffer),
+		exited:      make(chan struct{}),
+		stderr:      &stderrTail{},
+
+		discardingOutput: make(chan struct{}),
+	}
+	client.process.Stderr = client.stderr
+
+	input, err := client.process.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.process.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	client.input = input
+
+	if err := client.process.Start(); err != nil {
+		return nil, err
+	}
+	go client.readOutput(output)
+
+	if err := client.handshake(); err != nil {
+		client.Kill()
+		return nil, err
+	}
+	return client, nil
+}
+
+// readOutput passes the lines of the engine to the client until the engine exits, and records its exit status.
+// Once the client quits or kills the engine, the remaining lines are discarded.
+func (client *UciEngineClient) readOutput(output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		select {
+		case client.lines <- scanner.Text():
+		case <-client.discardingOutput:
+		}
+	}
+
+	client.exitErr = client.process.Wait()
+	close(client.exited)
+	close(client.lines)
+}
+
+func (client *UciEngineClient) discardOutput() {
+	client.discardingOutputOnce.Do(func() { close(client.discardingOutput) })
+}
+
+func (client *UciEngineClient) getExitError() error {
+	<-client.exited
+	err := fmt.Errorf("%w: %v", ErrUciEngineExited, client.exitErr)
+	if client.exitErr == nil {
+		err = ErrUciEngineExited
+	}
+
+	if stderr := client.stderr.String(); stderr != "" {
+		err = fmt.Errorf("%w, error output: %s", err, stderr)
+	}
+	return err
+}
+
+func (client *UciEngineClient) send(command string) error {
+	select {
+	case <-client.exited:
+		return client.getExitError()
+	default:
+	}
+
+	if _, err := io.WriteString(client.input, command+"\n"); err != nil {
+		return fmt.Errorf("failed to send %q: %w", command, err)
+	}
+	return nil
+}
+
+// readLine returns the next line of the engine, failing once the context is done.
+func (client *UciEngineClient) readLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-client.lines:
+		if !ok {
+			return "", client.getExitError()
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// waitForLine reads lines until one starts with the prefix and returns it, passing the others to the callback if
+// any.
+func (client *UciEngineClient) waitForLine(prefix string, timeout time.Duration, onOtherLine func(line string)) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		line, err := client.readLine(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w waiting for %s", ErrUciEngineTimeout, prefix)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if strings.HasPrefix(line, prefix) {
+			return line, nil
+		}
+		if onOtherLine != nil {
+			onOtherLine(line)
+		}
+	}
+}
+
+func (client *UciEngineClient) handshake() error {
+	if err := client.send("uci"); err != nil {
+		return err
+	}
+
+	_, err := client.waitForLine("uciok", client.Timeout, func(line string) {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			client.Name = name
+		} else if author, ok := strings.CutPrefix(line, "id author "); ok {
+			client.Author = author
+		} else if offer, ok := ParseUciOptionOffer(line); ok {
+			client.Options = append(client.Options, offer)
+		}
+	})
+	return err
+}
+
+// IsReady waits until the engine has processed the previous commands.
+func (client *UciEngineClient) IsReady() error {
+	if err := client.send("isready"); err != nil {
+		return err
+	}
+	_, err := client.waitForLine("readyok", client.Timeout, nil)
+	return err
+}
+
+// FindOption looks an offered option up by its name, regardless of case.
+func (client *UciEngineClient) FindOption(name string) (UciOptionOffer, bool) {
+	for _, offer := range client.Options {
+		if strings.EqualFold(offer.Name, name) {
+			return offer, true
+		}
+	}
+	return UciOptionOffer{}, false
+}
+
+// SetOption checks the value against the offer of the option before setting it, and waits until the engine has
+// applied it. Buttons take no value.
+func (client *UciEngineClient) SetOption(name string, value string) error {
+	offer, ok := client.FindOption(name)
+	if !ok {
+		return fmt.Errorf("the engine doesn't offer the option %s", name)
+	}
+	if err := offer.Validate(value); err != nil {
+		return fmt.Errorf("invalid value for option %s: %w", offer.Name, err)
+	}
+
+	command := "setoption name " + offer.Name
+	if offer.Type != ButtonOptionType {
+		command += " value " + value
+	}
+	if err := client.send(command); err != nil {
+		return err
+	}
+	return client.IsReady()
+}
+
+// NewGame tells the engine that the next position is from another game.
+func (client *UciEngineClient) NewGame() error {
+	if err := client.send("ucinewgame"); err != nil {
+		return err
+	}
+	return client.IsReady()
+}
+
+// SetPosition sends the position from the FEN, or the start position for an empty FEN or "startpos", followed by
+// the moves in the UCI notation.
+func (client *UciEngineClient) SetPosition(fen string, moves []string) error {
+	command := "position startpos"
+	if fen != "" && fen != "startpos" {
+		command = "position fen " + fen
+	}
+	if len(moves) > 0 {
+		command += " moves " + strings.Join(moves, " ")
+	}
+	return client.send(command)
+}
+
+// Search sends the go command and waits for the best move, passing each info line with a score to the callback,
+// if any. When the context is done first, the search is stopped and its best move returned. An engine which
+// doesn't answer the stop command within StopTimeout is killed.
+func (client *UciEngineClient) Search(ctx context.Context, limits UciSearchLimits, onInfo func(info SearchInfo)) (UciSearchResult, error) {
+	if err := client.send(limits.String()); err != nil {
+		return UciSearchResult{}, err
+	}
+
+	latestLines := map[int]SearchInfo{}
+	for {
+		line, err := client.readLine(ctx)
+		if ctx.Err() != nil && err == ctx.Err() {
+			return client.stopSearch(latestLines, onInfo)
+		}
+		if err != nil {
+			return UciSearchResult{}, err
+		}
+
+		if bestMove, ponderMove, ok := ParseBestMove(line); ok {
+			return UciSearchResult{BestMove: bestMove, PonderMove: ponderMove, Lines: sortSearchLines(latestLines)}, nil
+		}
+		if info, ok := ParseSearchInfo(line); ok {
+			latestLines[info.MultiPV] = info
+			if onInfo != nil {
+				onInfo(info)
+			}
+		}
+	}
+}
+
+func (client *UciEngineClient) stopSearch(latestLines map[int]SearchInfo, onInfo func(info SearchInfo)) (UciSearchResult, error) {
+	if err := client.send("stop"); err != nil {
+		return UciSearchResult{}, err
+	}
+
+	line, err := client.waitForLine("bestmove", client.StopTimeout, func(line string) {
+		if info, ok := ParseSearchInfo(line); ok {
+			latestLines[info.MultiPV] = info
+			if onInfo != nil {
+				onInfo(info)
+			}
+		}
+	})
+	if errors.Is(err, ErrUciEngineTimeout) {
+		client.Kill()
+	}
+	if err != nil {
+		return UciSearchResult{}, err
+	}
+
+	bestMove, ponderMove, _ := ParseBestMove(line)
+	return UciSearchResult{BestMove: bestMove, PonderMove: ponderMove, Lines: sortSearchLines(latestLines)}, nil
+}
+
+func sortSearchLines(latestLines map[int]SearchInfo) []SearchInfo {
+	lines := make([]SearchInfo, 0, len(latestLines))
+	for _, info := range latestLines {
+		lines = append(lines, info)
+	}
+	sort.Slice(lines, func(first, second int) bool { return lines[first].MultiPV < lines[second].MultiPV })
+	return lines
+}
+
+// Quit asks the engine to quit and closes its input, killing it if it doesn't exit within the timeout.
+func (client *UciEngineClient) Quit() error {
+	client.send("quit")
+	client.input.Close()
+	client.discardOutput()
+
+	select {
+	case <-client.exited:
+		return nil
+	case <-time.After(client.Timeout):
+		client.Kill()
+		return fmt.Errorf("%w to quit", ErrUciEngineTimeout)
+	}
+}
+
+// Kill ends the engine process immediately.
+func (client *UciEngineClient) Kill() {
+	client.discardOutput()
+	client.process.Process.Kill()
+}
@@ -0,0 +1,104 @@
+package chessEngine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestEngine launches the test binary as the engine of the mode, see TestMain.
+func startTestEngine(t *testing.T, mode string) *UciEngineClient {
+	t.Setenv(testEngineEnvironmentVariable, mode)
+	client, err := StartUciEngine(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Kill)
+	return client
+}
+
+func TestUciEngineClientSearch(t *testing.T) {
+	if raceDetectorEnabled {
+		t.Skip("GoFish takes longer to start than the handshake timeout with the race detector")
+	}
+	client := startTestEngine(t, "gofish")
+
+	if client.Name != EngineName || client.Author != Author {
+		t.Errorf("handshake read the engine %q by %q", client.Name, client.Author)
+	}
+	if _, found := client.FindOption("hash"); !found {
+		t.Error("handshake didn't read the Hash option")
+	}
+
+	if err := client.SetOption("Hash", "16"); err != nil {
+		t.Error(err)
+	}
+	if err := client.SetOption("Hash", "-1"); err == nil {
+		t.Error("setting Hash to -1 should fail")
+	}
+	if err := client.SetOption("No Such Option", "1"); err == nil {
+		t.Error("setting an option which isn't offered should fail")
+	}
+	if err := client.NewGame(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.SetPosition("startpos", []string{"e2e4", "e7e5"}); err != nil {
+		t.Fatal(err)
+	}
+	depths := []int{}
+	result, err := client.Search(context.Background(), ParseGoCommand("depth 5"), func(info SearchInfo) {
+		depths = append(depths, info.Depth)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.BestMove == "" || len(result.Lines) != 1 {
+		t.Fatalf("search returned %+v", result)
+	}
+	if line := result.Lines[0]; line.Depth != 5 || len(line.PV) == 0 || line.PV[0] != result.BestMove {
+		t.Errorf("search returned the line %+v with the best move %s", line, result.BestMove)
+	}
+	if len(depths) == 0 || depths[len(depths)-1] != 5 {
+		t.Errorf("search reported the depths %v", depths)
+	}
+
+	if err := client.Quit(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUciEngineClientCrashedEngine(t *testing.T) {
+	client := startTestEngine(t, "crash")
+	if client.Name != "Fakecrash" {
+		t.Errorf("handshake read the engine %q", client.Name)
+	}
+
+	_, err := client.Search(context.Background(), ParseGoCommand("depth 5"), nil)
+	if !errors.Is(err, ErrUciEngineExited) || !strings.Contains(err.Error(), "the fake engine crashed") {
+		t.Errorf("search of the crashed engine failed with %v", err)
+	}
+	if err := client.IsReady(); !errors.Is(err, ErrUciEngineExited) {
+		t.Errorf("isready to the crashed engine failed with %v", err)
+	}
+}
+
+// TestUciEngineClientQuitWithUnreadOutput checks that an engine printing more lines than the client buffers can
+// still quit, rather than being left blocked on its output.
+func TestUciEngineClientQuitWithUnreadOutput(t *testing.T) {
+	client := startTestEngine(t, "flood")
+	client.Timeout = 5 * time.Second
+
+	if err := client.send("go infinite"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := client.Quit(); err != nil {
+		t.Error(err)
+	}
+}
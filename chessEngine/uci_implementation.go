@@ -3,10 +3,16 @@ package chessEngine
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"math"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -20,67 +26,122 @@ const (
 type UciInterface struct {
 	gameSearcher GameSearcher
 	evaluator    Evaluator
+
+	// input and output carry the UCI commands and responses, defaulting to the standard input and output.
+	input  io.Reader
+	output io.Writer
+
+	runningSearch sync.WaitGroup
+
+	debugLog  uciDebugLog
+	debugMode atomic.Bool
+}
+
+func NewUciInterface(gameSearcher GameSearcher, evaluator Evaluator, input io.Reader, output io.Writer) *UciInterface {
+	return &UciInterface{gameSearcher: gameSearcher, evaluator: evaluator, input: input, output: output}
+}
+
+func (uciInterface *UciInterface) getInput() io.Reader {
+	if uciInterface.input == nil {
+		return os.Stdin
+	}
+	return uciInterface.input
+}
+
+func (uciInterface *UciInterface) getOutput() io.Writer {
+	return uciOutputWriter{uciInterface: uciInterface}
+}
+
+// printDebugInfo sends an info string with diagnostics when the debug mode is on.
+func (uciInterface *UciInterface) printDebugInfo(format string, arguments ...any) {
+	if uciInterface.debugMode.Load() {
+		fmt.Fprintf(uciInterface.getOutput(), "info string "+format+"\n", arguments...)
+	}
 }
 
 func (uciInterface *UciInterface) ReInitialize() {
 	uciInterface.gameSearcher.Reset(uciInterface.evaluator)
 }
 
-func (uciInterface *UciInterface) respondToUciCommand() {
-	fmt.Println("id name", EngineName)
-	fmt.Println("id author", Author)
-
+func (uciInterface *UciInterface) getEngineOptions() map[string]EngineOption {
 	engineOptions := uciInterface.gameSearcher.GetOptions()
 
-	for optionName, option := range engineOptions {
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("option name %s type %s ", optionName, option.optionType))
-		if option.optionType != "button" {
-			sb.WriteString(fmt.Sprintf("default %s ", option.defaultValue))
+	if configurableEvaluator, ok := uciInterface.evaluator.(ConfigurableEvaluator); ok {
+		for optionName, option := range configurableEvaluator.GetOptions() {
+			engineOptions[optionName] = option
 		}
+	}
 
-		if option.optionType == "spin" {
-			sb.WriteString(fmt.Sprintf("min %s max %s ", option.minValue, option.maxValue))
-		} else if option.optionType == "combo" {
-			for _, fixedValue := range option.fixedValues {
-				sb.WriteString(fmt.Sprintf("var %s ", fixedValue))
-			}
+	engineOptions[DebugLogFileOption] = NewStringOption("<empty>", func(path string) {
+		if err := uciInterface.debugLog.Open(path); err != nil {
+			fmt.Fprintf(uciInterface.getOutput(), "info string failed to open the debug log file: %v\n", err)
 		}
+	})
+
+	return engineOptions
+}
+
+func (uciInterface *UciInterface) respondToUciCommand() {
+	fmt.Fprintln(uciInterface.getOutput(), "id name", EngineName)
+	fmt.Fprintln(uciInterface.getOutput(), "id author", Author)
+
+	engineOptions := uciInterface.getEngineOptions()
+	optionNames := maps.Keys(engineOptions)
+	slices.Sort(optionNames)
 
-		optionOffer := strings.TrimSpace(sb.String())
-		fmt.Println(optionOffer)
+	for _, optionName := range optionNames {
+		fmt.Fprintln(uciInterface.getOutput(), engineOptions[optionName].getUciOffer(optionName))
 	}
 
-	fmt.Println("uciok")
+	fmt.Fprintln(uciInterface.getOutput(), "uciok")
 }
 
-func (uciInterface *UciInterface) respondToSetOptionCommand(setOptionCommand string) {
+// parseSetOptionCommand splits the arguments of a setoption command, "name <name> [value <value>]", into the option
+// name and value. Only the first "value" token separates them, so values may contain the keywords.
+func parseSetOptionCommand(setOptionCommand string) (string, string) {
 	commandFields := strings.Fields(setOptionCommand)
-	gettingOptionValue := false
+	if len(commandFields) > 0 && commandFields[0] == "name" {
+		commandFields = commandFields[1:]
+	}
 
-	var optionNameBuilder strings.Builder
-	var optionValueBuilder strings.Builder
-	for _, commandField := range commandFields {
+	for index, commandField := range commandFields {
 		if commandField == "value" {
-			gettingOptionValue = true
-		} else if commandField != "name" && !gettingOptionValue {
-			optionNameBuilder.WriteString(commandField + " ")
-		} else if commandField != "name" {
-			optionValueBuilder.WriteString(commandField + " ")
+			return strings.Join(commandFields[:index], " "), strings.Join(commandFields[index+1:], " ")
 		}
 	}
+	return strings.Join(commandFields, " "), ""
+}
 
-	optionName := strings.TrimSpace(optionNameBuilder.String())
-	optionValue := strings.TrimSpace(optionValueBuilder.String())
+func (uciInterface *UciInterface) respondToSetOptionCommand(setOptionCommand string) {
+	optionName, optionValue := parseSetOptionCommand(setOptionCommand)
+	engineOptions := uciInterface.getEngineOptions()
 
-	engineOptions := uciInterface.gameSearcher.GetOptions()
+	offeredName, option, ok := findEngineOption(engineOptions, optionName)
+	if !ok {
+		fmt.Fprintf(uciInterface.getOutput(), "info string unknown option %s\n", optionName)
+		return
+	}
+	optionName = offeredName
 
-	engineOptions[optionName].setOption(optionValue)
+	if err := option.Set(optionValue); err != nil {
+		fmt.Fprintf(uciInterface.getOutput(), "info string invalid value for option %s: %v\n", optionName, err)
+		return
+	}
+	uciInterface.printDebugInfo("option %s set to %s", optionName, optionValue)
+}
 
+func (uciInterface *UciInterface) respondToDebugCommand(debugCommand string) {
+	switch strings.TrimSpace(debugCommand) {
+	case "on":
+		uciInterface.debugMode.Store(true)
+		uciInterface.printDebugInfo("debug mode on")
+	case "off":
+		uciInterface.debugMode.Store(false)
+	}
 }
 
 func (uciInterface *UciInterface) respondToIsReadyCommand() {
-	fmt.Println("readyok")
+	fmt.Fprintln(uciInterface.getOutput(), "readyok")
 }
 
 func (UciInterface *UciInterface) respondToUciNewGameCommand() {
@@ -106,60 +167,59 @@ func (uciInterface *UciInterface) respondToPositionCommand(positionCommand strin
 	if strings.HasPrefix(movesString, "moves") {
 		uciMoves := strings.TrimSpace(strings.TrimPrefix(movesString, "moves "))
 		for _, uciMove := range strings.Fields(uciMoves) {
-			move := convertUciMoveIntoEncodedMove(uciInterface.gameSearcher.Position(), uciMove)
-			uciInterface.gameSearcher.Position().DoMove(move, uciInterface.evaluator)
-
-			positionHash := uciInterface.gameSearcher.Position().PositionHash
-			uciInterface.gameSearcher.RecordPositionHash(positionHash)
-
-			uciInterface.gameSearcher.Position().stateStackSize--
+			// The moves after an illegal one can't be played either, so the position is left before it
+			move, found := findLegalUciMove(uciInterface.gameSearcher.Position(), uciMove, uciInterface.evaluator)
+			if !found {
+				fmt.Fprintf(uciInterface.getOutput(), "info string illegal move %s in %s\n", uciMove, uciInterface.gameSearcher.Position().GenFEN())
+				break
+			}
+			applyGameMove(uciInterface.gameSearcher, move, uciInterface.evaluator)
 		}
 	}
+
+	uciInterface.printDebugInfo("position %s", uciInterface.gameSearcher.Position().GenFEN())
 }
 
-func (uciInterface *UciInterface) respondToGoCommand(goCommand string) {
-	commandFields := strings.Fields(goCommand)
+// applyGameMove plays a move which is part of the game history rather than the search tree, and records the
+// reached position for the repetition detection of the searcher.
+func applyGameMove(gameSearcher GameSearcher, move Move, evaluator Evaluator) {
+	position := gameSearcher.Position()
+	position.DoGameMove(move, evaluator)
+	gameSearcher.RecordPositionHash(position.PositionHash)
+}
 
-	sideToPlay := uciInterface.gameSearcher.Position().SideToMove
-	colorIndicator := ""
+func (uciInterface *UciInterface) respondToGoCommand(goCommand string) {
+	limits := ParseGoCommand(goCommand)
 
-	if sideToPlay == White {
-		colorIndicator = "w"
-	} else {
-		colorIndicator = "b"
+	remainingTime, increment := limits.BlackTime, limits.BlackIncrement
+	if uciInterface.gameSearcher.Position().SideToMove == White {
+		remainingTime, increment = limits.WhiteTime, limits.WhiteIncrement
 	}
 
-	remainingTime, increment, movesToGo := int(InfiniteTime), int(NoValue), int(NoValue)
-	depth, nodeCount, moveTime := uint64(MaxDepth), uint64(math.MaxUint64), uint64(NoValue)
-
-	for index, commandField := range commandFields {
-		switch commandField {
-		case "movestogo":
-			movesToGo, _ = strconv.Atoi(commandFields[index+1])
-		case "depth":
-			depth, _ = strconv.ParseUint(commandFields[index+1], 10, 8)
-		case "nodes":
-			nodeCount, _ = strconv.ParseUint(commandFields[index+1], 10, 64)
-		case "movetime":
-			moveTime, _ = strconv.ParseUint(commandFields[index+1], 10, 64)
-		case colorIndicator + "time":
-			remainingTime, _ = strconv.Atoi(commandFields[index+1])
-		case colorIndicator + "inc":
-			increment, _ = strconv.Atoi(commandFields[index+1])
-		}
+	depth, nodeCount := uint64(MaxDepth), uint64(math.MaxUint64)
+	if limits.Depth > 0 {
+		depth = uint64(min(MaxDepth, limits.Depth))
+	}
+	if limits.Nodes > 0 {
+		nodeCount = limits.Nodes
 	}
+	movesToGo, moveTime := limits.MovesToGo, limits.MoveTime
 
 	uciInterface.gameSearcher.InitializeTimeManager(
-		int64(remainingTime),
-		int64(increment),
-		int64(moveTime),
+		remainingTime,
+		increment,
+		moveTime,
 		int16(movesToGo),
 		uint8(depth),
 		nodeCount,
 	)
 
+	uciInterface.printDebugInfo("search limits time %d increment %d movestogo %d movetime %d depth %d nodes %d", remainingTime, increment, movesToGo, moveTime, depth, nodeCount)
+
+	searchStart := time.Now()
 	bestMoveEngineResponse := uciInterface.gameSearcher.StartSearch(uciInterface.evaluator)
-	fmt.Printf("bestmove %v\n", bestMoveEngineResponse)
+	uciInterface.printDebugInfo("search took %d ms", time.Since(searchStart).Milliseconds())
+	fmt.Fprintf(uciInterface.getOutput(), "bestmove %v\n", bestMoveEngineResponse)
 }
 
 func (uciInterface *UciInterface) respondToStopCommand() {
@@ -167,61 +227,44 @@ func (uciInterface *UciInterface) respondToStopCommand() {
 }
 
 func (uciInterface *UciInterface) respondToQuitCommand() {
+	uciInterface.gameSearcher.StopSearch()
+	uciInterface.runningSearch.Wait()
 	uciInterface.gameSearcher.CleanUp()
+	uciInterface.debugLog.Close()
 }
 
-func convertUciMoveIntoEncodedMove(position *Position, uciMove string) Move {
-	fromSquare := convertSquareNotationToSquareNumber(uciMove[0:2])
-	toSquare := convertSquareNotationToSquareNumber(uciMove[2:4])
-
-	pieceType := position.SquareContent[fromSquare].PieceType
-
-	var moveType uint8
-	var moveInfo uint8
-
-	uciMoveLastChar := uciMove[len(uciMove)-1]
-	if uciMoveLastChar == 'q' || uciMoveLastChar == 'r' || uciMoveLastChar == 'b' || uciMoveLastChar == 'n' {
-
-		moveType = CastleMoveType
-
-		switch uciMoveLastChar {
-		case 'q':
-			moveInfo = PromotionToQueen
-		case 'r':
-			moveInfo = PromotionToRook
-		case 'b':
-			moveInfo = PromotionToBishop
-		case 'n':
-			moveInfo = PromotionToKnight
-		}
-	} else if (uciMove == "e1g1" || uciMove == "e8g8" || uciMove == "e1c1" || uciMove == "e8c8") && pieceType == King {
-		moveType = CastleMoveType
-	} else if position.SquareContent[toSquare].PieceType != NoneType {
-		moveType = CaptureMoveType
-		if toSquare == position.EnPassantSquare && pieceType == Pawn {
-			moveInfo = EnPassant
-		}
-	} else {
-		moveType = QuietMoveType
+func (uciInterface *UciInterface) Run() {
+	if infoOutputSearcher, ok := uciInterface.gameSearcher.(interface{ SetInfoOutput(io.Writer) }); ok {
+		infoOutputSearcher.SetInfoOutput(uciInterface.getOutput())
+	}
+	if infoOutputEvaluator, ok := uciInterface.evaluator.(interface{ SetInfoOutput(io.Writer) }); ok {
+		infoOutputEvaluator.SetInfoOutput(uciInterface.getOutput())
 	}
 
-	return CreateMove(fromSquare, toSquare, moveType, moveInfo)
-}
-
-func (uciInterface *UciInterface) Run() {
 	uciInterface.respondToUciCommand()
 	uciInterface.ReInitialize()
 
-	consoleReader := bufio.NewReader(os.Stdin)
+	consoleReader := bufio.NewReader(uciInterface.getInput())
 
 	for {
-		userCommand, _ := consoleReader.ReadString('\n')
+		userCommand, err := consoleReader.ReadString('\n')
 		command := strings.TrimSpace(strings.Replace(userCommand, "\r\n", "\n", -1))
 
+		if command != "" {
+			uciInterface.debugLog.RecordCommand(command)
+		}
+
+		// The input is closed without a quit command, e.g. when the GUI or the connection goes away.
+		if err != nil && command == "" {
+			command = "quit"
+		}
+
 		if command == "uci" {
 			uciInterface.respondToUciCommand()
 		} else if strings.HasPrefix(command, "setoption") {
 			uciInterface.respondToSetOptionCommand(strings.TrimPrefix(command, "setoption "))
+		} else if strings.HasPrefix(command, "debug") {
+			uciInterface.respondToDebugCommand(strings.TrimPrefix(command, "debug"))
 		} else if command == "isready" {
 			uciInterface.respondToIsReadyCommand()
 		} else if command == "ucinewgame" {
@@ -229,12 +272,29 @@ func (uciInterface *UciInterface) Run() {
 		} else if strings.HasPrefix(command, "position") {
 			uciInterface.respondToPositionCommand(strings.TrimPrefix(command, "position "))
 		} else if strings.HasPrefix(command, "go") {
-			go uciInterface.respondToGoCommand(strings.TrimPrefix(command, "go "))
+			uciInterface.runningSearch.Add(1)
+			go func() {
+				defer uciInterface.runningSearch.Done()
+				uciInterface.respondToGoCommand(strings.TrimPrefix(command, "go "))
+			}()
 		} else if command == "stop" {
 			uciInterface.respondToStopCommand()
 		} else if command == "quit" {
 			uciInterface.respondToQuitCommand()
 			break
+		} else if command != "" {
+			uciInterface.printDebugInfo("unknown command %s", command)
+		}
+	}
+}
+
+// findLegalUciMove returns the legal move of the position written in the UCI notation.
+func findLegalUciMove(position *Position, uciMove string, evaluator Evaluator) (Move, bool) {
+	legalMoves := GenerateLegalMoves(position, evaluator)
+	for moveIndex := uint8(0); moveIndex < legalMoves.Size; moveIndex++ {
+		if legalMoves.Moves[moveIndex].String() == uciMove {
+			return legalMoves.Moves[moveIndex], true
 		}
 	}
+	return NullMove, false
 }
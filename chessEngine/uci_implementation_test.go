@@ -0,0 +1,51 @@
+package chessEngine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runUciCommands runs a UCI session on the commands, returning its output and the searcher for inspection.
+func runUciCommands(commands ...string) (string, *DefaultSearcher) {
+	searcher := NewDefaultSearcher()
+	output := &bytes.Buffer{}
+	uciInterface := NewUciInterface(searcher, &DefaultEvaluator{}, strings.NewReader(strings.Join(commands, "\n")+"\n"), output)
+	uciInterface.Run()
+	return output.String(), searcher
+}
+
+func TestUciPositionCommand(t *testing.T) {
+	testCases := []struct {
+		command     string
+		expectedFEN string
+	}{
+		{"position startpos moves e2e4 e7e5 g1f3", "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"},
+		{"position fen 8/4P3/8/8/8/8/k7/4K3 w - - 0 1 moves e7e8q", "4Q3/8/8/8/8/8/k7/4K3 b - - 0 1"},
+		{"position fen 8/4P3/8/8/8/8/k7/4K3 w - - 0 1 moves e7e8n a2b2", "4N3/8/8/8/8/8/1k6/4K3 w - - 1 2"},
+		{"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1 moves e1c1 e8g8", "r4rk1/8/8/8/8/8/8/2KR3R w - - 2 2"},
+		{"position fen 4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1 moves e5d6", "4k3/8/3P4/8/8/8/8/4K3 b - - 0 1"},
+	}
+
+	// The move numbers are left out, as only the moves are checked
+	for _, testCase := range testCases {
+		output, searcher := runUciCommands(testCase.command)
+		if fen := searcher.Position().GenFEN(); strings.Join(strings.Fields(fen)[:5], " ") != strings.Join(strings.Fields(testCase.expectedFEN)[:5], " ") {
+			t.Errorf("%s reached %s, expected %s", testCase.command, fen, testCase.expectedFEN)
+		}
+		if strings.Contains(output, "illegal move") {
+			t.Errorf("%s was answered with %q", testCase.command, output)
+		}
+	}
+}
+
+func TestUciPositionCommandIllegalMove(t *testing.T) {
+	output, searcher := runUciCommands("position startpos moves e2e4 e2e4 e7e5")
+
+	if !strings.Contains(output, "info string illegal move e2e4 in rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1\n") {
+		t.Errorf("the illegal move was answered with %q", output)
+	}
+	if fen := searcher.Position().GenFEN(); fen != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1" {
+		t.Errorf("the position is %s after the illegal move", fen)
+	}
+}
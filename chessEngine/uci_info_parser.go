@@ -0,0 +1,94 @@
+package chessEngine
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	CentipawnScoreType = "cp"
+	MateScoreType      = "mate"
+)
+
+// SearchInfo holds the fields of a UCI "info" line reporting the progress of a search.
+type SearchInfo struct {
+	Depth     int      `json:"depth"`
+	MultiPV   int      `json:"multipv"`
+	ScoreType string   `json:"scoreType"`
+	Score     int      `json:"score"`
+	Nodes     uint64   `json:"nodes"`
+	NPS       uint64   `json:"nps"`
+	Time      int64    `json:"time"`
+	Hashfull  int      `json:"hashfull"`
+	PV        []string `json:"pv"`
+}
+
+// ParseSearchInfo reads an info line with a depth and a score. Other info lines, such as "info string", aren't
+// search progress and are rejected.
+func ParseSearchInfo(line string) (SearchInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "info" {
+		return SearchInfo{}, false
+	}
+
+	searchInfo := SearchInfo{MultiPV: 1}
+	hasDepth, hasScore := false, false
+
+	for index := 1; index < len(fields); index++ {
+		value := ""
+		if index+1 < len(fields) {
+			value = fields[index+1]
+		}
+
+		switch fields[index] {
+		case "string":
+			return SearchInfo{}, false
+		case "depth":
+			searchInfo.Depth, _ = strconv.Atoi(value)
+			hasDepth = true
+			index++
+		case "multipv":
+			searchInfo.MultiPV, _ = strconv.Atoi(value)
+			index++
+		case "score":
+			if index+2 < len(fields) && (value == CentipawnScoreType || value == MateScoreType) {
+				searchInfo.ScoreType = value
+				searchInfo.Score, _ = strconv.Atoi(fields[index+2])
+				hasScore = true
+				index += 2
+			}
+		case "nodes":
+			searchInfo.Nodes, _ = strconv.ParseUint(value, 10, 64)
+			index++
+		case "nps":
+			searchInfo.NPS, _ = strconv.ParseUint(value, 10, 64)
+			index++
+		case "time":
+			searchInfo.Time, _ = strconv.ParseInt(value, 10, 64)
+			index++
+		case "hashfull":
+			searchInfo.Hashfull, _ = strconv.Atoi(value)
+			index++
+		case "seldepth", "currmove", "currmovenumber", "tbhits", "cpuload":
+			index++
+		case "pv":
+			searchInfo.PV = append([]string{}, fields[index+1:]...)
+			index = len(fields)
+		}
+	}
+
+	return searchInfo, hasDepth && hasScore
+}
+
+// ParseBestMove reads a "bestmove <move> [ponder <move>]" line, returning the best move and the ponder move, if any.
+func ParseBestMove(line string) (string, string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "bestmove" {
+		return "", "", false
+	}
+
+	if len(fields) >= 4 && fields[2] == "ponder" {
+		return fields[1], fields[3], true
+	}
+	return fields[1], "", true
+}
@@ -0,0 +1,89 @@
+package chessEngine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UciSearchLimits are the arguments of a go command, with the times in milliseconds.
+type UciSearchLimits struct {
+	WhiteTime      int64
+	BlackTime      int64
+	WhiteIncrement int64
+	BlackIncrement int64
+	MovesToGo      int
+	Depth          int
+	Nodes          uint64
+	MoveTime       int64
+	Infinite       bool
+}
+
+// ParseGoCommand reads the arguments of a go command. The clock times which aren't given are InfiniteTime, and
+// the other limits which aren't given are zero.
+func ParseGoCommand(goCommand string) UciSearchLimits {
+	limits := UciSearchLimits{WhiteTime: InfiniteTime, BlackTime: InfiniteTime}
+	commandFields := strings.Fields(goCommand)
+
+	for index, commandField := range commandFields {
+		value := ""
+		if index+1 < len(commandFields) {
+			value = commandFields[index+1]
+		}
+
+		switch commandField {
+		case "wtime":
+			limits.WhiteTime, _ = strconv.ParseInt(value, 10, 64)
+		case "btime":
+			limits.BlackTime, _ = strconv.ParseInt(value, 10, 64)
+		case "winc":
+			limits.WhiteIncrement, _ = strconv.ParseInt(value, 10, 64)
+		case "binc":
+			limits.BlackIncrement, _ = strconv.ParseInt(value, 10, 64)
+		case "movestogo":
+			limits.MovesToGo, _ = strconv.Atoi(value)
+		case "depth":
+			limits.Depth, _ = strconv.Atoi(value)
+		case "nodes":
+			limits.Nodes, _ = strconv.ParseUint(value, 10, 64)
+		case "movetime":
+			limits.MoveTime, _ = strconv.ParseInt(value, 10, 64)
+		case "infinite":
+			limits.Infinite = true
+		}
+	}
+
+	return limits
+}
+
+// String returns the go command with the limits, leaving out the clock times which aren't positive and the other
+// limits which are zero. Without any limit, the search is infinite.
+func (limits UciSearchLimits) String() string {
+	var sb strings.Builder
+	sb.WriteString("go")
+
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{"wtime", limits.WhiteTime},
+		{"btime", limits.BlackTime},
+		{"winc", limits.WhiteIncrement},
+		{"binc", limits.BlackIncrement},
+		{"movestogo", int64(limits.MovesToGo)},
+		{"depth", int64(limits.Depth)},
+		{"movetime", limits.MoveTime},
+	} {
+		if limit.value > 0 {
+			sb.WriteString(fmt.Sprintf(" %s %d", limit.name, limit.value))
+		}
+	}
+
+	if limits.Nodes > 0 {
+		sb.WriteString(fmt.Sprintf(" nodes %d", limits.Nodes))
+	}
+	if limits.Infinite || sb.Len() == len("go") {
+		sb.WriteString(" infinite")
+	}
+	return sb.String()
+}
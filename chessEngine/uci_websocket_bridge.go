@@ -0,0 +1,276 @@
+package chessEngine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUciBridgeAddress     = ":8081"
+	DefaultUciBridgePath        = "/uci"
+	DefaultUciBridgeConnections = 4
+	DefaultUciBridgeIdleTimeout = 5 * time.Minute
+	DefaultUciBridgeMaximumHash = 256
+)
+
+// uciBridgeFileOptions are the options reading or writing files on the server, which connections can only set
+// when the bridge allows it.
+var uciBridgeFileOptions = map[string]bool{
+	"Hash File":      true,
+	"SaveHash":       true,
+	"LoadHash":       true,
+	"Tablebase Path": true,
+	"SyzygyPath":     true,
+
+	DebugLogFileOption: true,
+}
+
+type UciBridgeSettings struct {
+	Address            string
+	Path               string
+	MaximumConnections int
+	IdleTimeout        time.Duration
+	AllowedOrigins     []string
+	AllowFileOptions   bool
+	MaximumHashMB      int
+}
+
+func DefaultUciBridgeSettings() UciBridgeSettings {
+	return UciBridgeSettings{
+		Address:            DefaultUciBridgeAddress,
+		Path:               DefaultUciBridgePath,
+		MaximumConnections: DefaultUciBridgeConnections,
+		IdleTimeout:        DefaultUciBridgeIdleTimeout,
+		MaximumHashMB:      DefaultUciBridgeMaximumHash,
+	}
+}
+
+// ParseUciBridgeSettings reads "<name> <value>" pairs, e.g. "address :9001 connections 8 idleTimeout 60", where
+// the idle timeout is in seconds, origins is a comma separated list and maxHash is the largest Hash option a
+// connection may set, in MB.
+func ParseUciBridgeSettings(command string) (UciBridgeSettings, error) {
+	settings := DefaultUciBridgeSettings()
+	commandFields := strings.Fields(command)
+
+	if len(commandFields)%2 != 0 {
+		return settings, errors.New("expected <name> <value> pairs")
+	}
+
+	for index := 0; index < len(commandFields); index += 2 {
+		name, value := commandFields[index], commandFields[index+1]
+
+		var err error
+		switch name {
+		case "address":
+			settings.Address = value
+		case "path":
+			settings.Path = value
+		case "connections":
+			settings.MaximumConnections, err = strconv.Atoi(value)
+		case "idleTimeout":
+			var seconds int
+			seconds, err = strconv.Atoi(value)
+			settings.IdleTimeout = time.Duration(seconds) * time.Second
+		case "origins":
+			settings.AllowedOrigins = strings.Split(value, ",")
+		case "fileOptions":
+			settings.AllowFileOptions, err = strconv.ParseBool(value)
+		case "maxHash":
+			settings.MaximumHashMB, err = strconv.Atoi(value)
+		default:
+			return settings, fmt.Errorf("unknown setting %s", name)
+		}
+
+		if err != nil {
+			return settings, fmt.Errorf("invalid value %s for %s", value, name)
+		}
+	}
+
+	if settings.MaximumConnections < 1 || settings.MaximumHashMB < 1 || settings.IdleTimeout < time.Second || !strings.HasPrefix(settings.Path, "/") {
+		return settings, errors.New("connections and maxHash must be positive, idleTimeout at least a second and path start with /")
+	}
+
+	return settings, nil
+}
+
+// UciBridge lets WebSocket clients, such as browser front ends, talk UCI to the engine. Each connection gets its
+// own UciInterface with a new game searcher and evaluator: text messages are passed to it as commands, one per
+// line, and each line it outputs is sent back as a text message.
+type UciBridge struct {
+	settings        UciBridgeSettings
+	newGameSearcher func() GameSearcher
+	newEvaluator    func() Evaluator
+	connections     chan struct{}
+}
+
+func NewUciBridge(settings UciBridgeSettings, newGameSearcher func() GameSearcher, newEvaluator func() Evaluator) (*UciBridge, error) {
+	if newGameSearcher == nil || newEvaluator == nil {
+		return nil, errors.New("expected functions creating the game searcher and the evaluator of each connection")
+	}
+
+	return &UciBridge{
+		settings:        settings,
+		newGameSearcher: newGameSearcher,
+		newEvaluator:    newEvaluator,
+		connections:     make(chan struct{}, settings.MaximumConnections),
+	}, nil
+}
+
+func (bridge *UciBridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(bridge.settings.Path, bridge.handleConnection)
+	return mux
+}
+
+func (bridge *UciBridge) ListenAndServe() error {
+	fmt.Printf("Bridging UCI over WebSocket on %s%s\n", bridge.settings.Address, bridge.settings.Path)
+	return http.ListenAndServe(bridge.settings.Address, bridge.Handler())
+}
+
+func (bridge *UciBridge) isAllowedOrigin(origin string) bool {
+	if len(bridge.settings.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, allowedOrigin := range bridge.settings.AllowedOrigins {
+		if strings.EqualFold(origin, allowedOrigin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (bridge *UciBridge) handleConnection(writer http.ResponseWriter, request *http.Request) {
+	if !bridge.isAllowedOrigin(request.Header.Get("Origin")) {
+		http.Error(writer, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	select {
+	case bridge.connections <- struct{}{}:
+		defer func() { <-bridge.connections }()
+	default:
+		http.Error(writer, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	connection, err := upgradeToWebSocket(writer, request, bridge.settings.IdleTimeout)
+	if err != nil {
+		return
+	}
+
+	bridge.serveUci(connection)
+}
+
+// webSocketLineWriter sends each complete line written to it as a text message. The UCI interface and the search
+// write to it concurrently.
+type webSocketLineWriter struct {
+	connection  *webSocketConnection
+	lock        sync.Mutex
+	pendingLine []byte
+}
+
+func (writer *webSocketLineWriter) Write(data []byte) (int, error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	writer.pendingLine = append(writer.pendingLine, data...)
+	for {
+		lineEnd := strings.IndexByte(string(writer.pendingLine), '\n')
+		if lineEnd < 0 {
+			return len(data), nil
+		}
+		if err := writer.connection.WriteText(strings.TrimRight(string(writer.pendingLine[:lineEnd]), "\r")); err != nil {
+			return 0, err
+		}
+		writer.pendingLine = writer.pendingLine[lineEnd+1:]
+	}
+}
+
+// serveUci runs a UCI interface for the connection until the client quits or the connection closes.
+func (bridge *UciBridge) serveUci(connection *webSocketConnection) {
+	gameSearcher, evaluator := bridge.newGameSearcher(), bridge.newEvaluator()
+	output := &webSocketLineWriter{connection: connection}
+	if infoOutputSearcher, ok := gameSearcher.(interface{ SetInfoOutput(io.Writer) }); ok {
+		infoOutputSearcher.SetInfoOutput(output)
+	}
+
+	commandReader, commandWriter := io.Pipe()
+	uciInterface := NewUciInterface(gameSearcher, evaluator, commandReader, output)
+
+	go bridge.forwardCommands(connection, commandWriter, output, uciInterface.getEngineOptions())
+
+	// The UCI loop starts with the uci command, as it does from the main menu.
+	commands := bufio.NewReader(commandReader)
+	for {
+		command, err := commands.ReadString('\n')
+		if err != nil {
+			connection.Close(WebSocketNormalClosure, "")
+			return
+		}
+		if strings.TrimSpace(command) == "uci" {
+			break
+		}
+	}
+
+	uciInterface.input = commands
+	uciInterface.Run()
+
+	commandReader.Close()
+	connection.Close(WebSocketNormalClosure, "")
+}
+
+// forwardCommands passes the lines of the messages of the client to the UCI interface, until the connection is
+// closed or becomes idle. Options which the bridge doesn't allow, and hash sizes above its maximum, are answered
+// with an info string instead.
+func (bridge *UciBridge) forwardCommands(connection *webSocketConnection, commandWriter *io.PipeWriter, output io.Writer, engineOptions map[string]EngineOption) {
+	defer commandWriter.Close()
+
+	for {
+		message, err := connection.ReadMessage()
+		if err != nil {
+			var protocolError webSocketError
+			var networkError net.Error
+			if errors.As(err, &protocolError) {
+				connection.Close(protocolError.statusCode, protocolError.message)
+			} else if errors.As(err, &networkError) && networkError.Timeout() {
+				connection.Close(WebSocketGoingAway, "idle timeout")
+			} else {
+				connection.Close(WebSocketGoingAway, "")
+			}
+			return
+		}
+
+		for _, line := range strings.Split(message, "\n") {
+			command := strings.TrimSpace(line)
+			if command == "" {
+				continue
+			}
+
+			if strings.HasPrefix(command, "setoption") {
+				optionName, optionValue := parseSetOptionCommand(strings.TrimPrefix(command, "setoption"))
+				optionName, _, _ = findEngineOption(engineOptions, optionName)
+				if uciBridgeFileOptions[optionName] && !bridge.settings.AllowFileOptions {
+					fmt.Fprintf(output, "info string option %s is disabled over the bridge\n", optionName)
+					continue
+				}
+				if hashMB, err := strconv.Atoi(optionValue); optionName == "Hash" && err == nil && hashMB > bridge.settings.MaximumHashMB {
+					fmt.Fprintf(output, "info string option Hash is limited to %d MB over the bridge\n", bridge.settings.MaximumHashMB)
+					continue
+				}
+			}
+
+			if _, err := io.WriteString(commandWriter, command+"\n"); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package chessEngine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webSocketTestClient is a minimal client side of a WebSocket connection, masking the frames it sends as RFC 6455
+// requires from clients.
+type webSocketTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, serverURL string, path string) *webSocketTestClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + conn.RemoteAddr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != computeWebSocketAccept(key) {
+		t.Fatalf("the upgrade was answered with %s", response.Status)
+	}
+	return &webSocketTestClient{conn: conn, reader: reader}
+}
+
+func (client *webSocketTestClient) writeText(t *testing.T, message string) {
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := append([]byte{0x80 | webSocketTextFrame, 0x80 | byte(len(message))}, mask[:]...)
+	for index := 0; index < len(message); index++ {
+		frame = append(frame, message[index]^mask[index%4])
+	}
+	if _, err := client.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (client *webSocketTestClient) readText(t *testing.T) string {
+	header := [2]byte{}
+	if _, err := io.ReadFull(client.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	payloadLength := uint64(header[1] & 0x7F)
+	switch payloadLength {
+	case 126:
+		extendedLength := [2]byte{}
+		if _, err := io.ReadFull(client.reader, extendedLength[:]); err != nil {
+			t.Fatal(err)
+		}
+		payloadLength = uint64(binary.BigEndian.Uint16(extendedLength[:]))
+	case 127:
+		t.Fatal("unexpected long frame")
+	}
+
+	payload := make([]byte, payloadLength)
+	if _, err := io.ReadFull(client.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	if opcode := header[0] & 0x0F; opcode != webSocketTextFrame {
+		t.Fatalf("expected a text frame, got opcode %d", opcode)
+	}
+	return string(payload)
+}
+
+// readUntil returns the messages received up to the expected one.
+func (client *webSocketTestClient) readUntil(t *testing.T, expectedMessage string) []string {
+	messages := []string{}
+	for {
+		message := client.readText(t)
+		if message == expectedMessage {
+			return messages
+		}
+		messages = append(messages, message)
+	}
+}
+
+// startTestUciBridge serves a bridge with the settings, and returns a client which sent the uci command.
+func startTestUciBridge(t *testing.T, settings UciBridgeSettings) *webSocketTestClient {
+	bridge, err := NewUciBridge(settings, func() GameSearcher { return NewDefaultSearcher() }, func() Evaluator { return &DefaultEvaluator{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(bridge.Handler())
+	t.Cleanup(server.Close)
+
+	client := dialWebSocket(t, server.URL, settings.Path)
+	client.writeText(t, "uci")
+	client.readUntil(t, "uciok")
+	return client
+}
+
+func TestUciBridgeRefusesFileOptions(t *testing.T) {
+	client := startTestUciBridge(t, DefaultUciBridgeSettings())
+
+	client.writeText(t, "setoption name Hash File value /tmp/x")
+	client.writeText(t, "isready")
+	messages := client.readUntil(t, "readyok")
+
+	expectedMessage := "info string option Hash File is disabled over the bridge"
+	if len(messages) != 1 || messages[0] != expectedMessage {
+		t.Errorf("setting the option was answered with %q, expected %q", messages, expectedMessage)
+	}
+
+	client.writeText(t, "quit")
+}
+
+func TestUciBridgeLimitsHash(t *testing.T) {
+	settings, err := ParseUciBridgeSettings("maxHash 8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := startTestUciBridge(t, settings)
+
+	client.writeText(t, "setoption name Hash value 32000")
+	client.writeText(t, "isready")
+	messages := client.readUntil(t, "readyok")
+
+	expectedMessage := "info string option Hash is limited to 8 MB over the bridge"
+	if len(messages) != 1 || messages[0] != expectedMessage {
+		t.Errorf("setting a large hash was answered with %q, expected %q", messages, expectedMessage)
+	}
+
+	client.writeText(t, "setoption name hash value 8")
+	client.writeText(t, "isready")
+	if messages := client.readUntil(t, "readyok"); len(messages) != 0 {
+		t.Errorf("setting the maximum hash was answered with %q", messages)
+	}
+
+	client.writeText(t, "quit")
+
+	if _, err := ParseUciBridgeSettings("maxHash 0"); err == nil {
+		t.Error("a maximum hash of 0 MB was accepted")
+	}
+}
@@ -0,0 +1,281 @@
+package chessEngine
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webSocketAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	webSocketContinuationFrame = 0x0
+	webSocketTextFrame         = 0x1
+	webSocketBinaryFrame       = 0x2
+	webSocketCloseFrame        = 0x8
+	webSocketPingFrame         = 0x9
+	webSocketPongFrame         = 0xA
+
+	WebSocketNormalClosure   = 1000
+	WebSocketGoingAway       = 1001
+	WebSocketProtocolError   = 1002
+	WebSocketUnsupportedData = 1003
+	WebSocketMessageTooBig   = 1009
+
+	MaximumWebSocketMessageSize = 64 * 1024
+	maximumControlFramePayload  = 125
+	webSocketWriteTimeout       = 10 * time.Second
+)
+
+var errWebSocketClosed = errors.New("the WebSocket connection was closed")
+
+// webSocketError closes the connection with a status code when reading a message fails.
+type webSocketError struct {
+	statusCode uint16
+	message    string
+}
+
+func (err webSocketError) Error() string {
+	return err.message
+}
+
+// webSocketConnection is the server side of a WebSocket connection (RFC 6455). Messages are read by a single
+// goroutine, while frames may be written from several.
+type webSocketConnection struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	idleTimeout time.Duration
+
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+func computeWebSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketAcceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeToWebSocket completes the opening handshake and takes over the connection of the request. If the request
+// isn't a valid handshake, it's answered with an error and the connection is left to the HTTP server.
+func upgradeToWebSocket(writer http.ResponseWriter, request *http.Request, idleTimeout time.Duration) (*webSocketConnection, error) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "only GET is allowed", http.StatusMethodNotAllowed)
+		return nil, errors.New("the handshake isn't a GET request")
+	}
+
+	if !headerContainsToken(request.Header, "Connection", "upgrade") || !headerContainsToken(request.Header, "Upgrade", "websocket") {
+		http.Error(writer, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("the request doesn't ask for a WebSocket upgrade")
+	}
+
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(writer, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if decodedKey, err := base64.StdEncoding.DecodeString(key); err != nil || len(decodedKey) != 16 {
+		http.Error(writer, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		http.Error(writer, "the connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("the response writer doesn't support hijacking")
+	}
+
+	conn, bufferedConnection, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + computeWebSocketAccept(key) + "\r\n\r\n"
+
+	conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	if _, err := bufferedConnection.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := bufferedConnection.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	connection := &webSocketConnection{conn: conn, reader: bufferedConnection.Reader, idleTimeout: idleTimeout}
+	connection.ExtendIdleTimeout()
+	return connection, nil
+}
+
+// ExtendIdleTimeout postpones closing the connection for being idle, which happens when neither side sends a
+// message within the idle timeout.
+func (connection *webSocketConnection) ExtendIdleTimeout() {
+	if connection.idleTimeout > 0 {
+		connection.conn.SetReadDeadline(time.Now().Add(connection.idleTimeout))
+	}
+}
+
+func (connection *webSocketConnection) readFrame() (bool, byte, []byte, error) {
+	header := [2]byte{}
+	if _, err := io.ReadFull(connection.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	final, opcode := header[0]&0x80 != 0, header[0]&0x0F
+	masked, payloadLength := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, webSocketError{WebSocketProtocolError, "no extensions were negotiated"}
+	}
+	if !masked {
+		return false, 0, nil, webSocketError{WebSocketProtocolError, "client frames must be masked"}
+	}
+
+	switch payloadLength {
+	case 126:
+		extendedLength := [2]byte{}
+		if _, err := io.ReadFull(connection.reader, extendedLength[:]); err != nil {
+			return false, 0, nil, err
+		}
+		payloadLength = uint64(binary.BigEndian.Uint16(extendedLength[:]))
+	case 127:
+		extendedLength := [8]byte{}
+		if _, err := io.ReadFull(connection.reader, extendedLength[:]); err != nil {
+			return false, 0, nil, err
+		}
+		payloadLength = binary.BigEndian.Uint64(extendedLength[:])
+	}
+
+	isControlFrame := opcode&0x8 != 0
+	if isControlFrame && (!final || payloadLength > maximumControlFramePayload) {
+		return false, 0, nil, webSocketError{WebSocketProtocolError, "control frames must be final and short"}
+	}
+	if payloadLength > MaximumWebSocketMessageSize {
+		return false, 0, nil, webSocketError{WebSocketMessageTooBig, "the message is too big"}
+	}
+
+	mask := [4]byte{}
+	if _, err := io.ReadFull(connection.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, payloadLength)
+	if _, err := io.ReadFull(connection.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+
+	return final, opcode, payload, nil
+}
+
+// ReadMessage returns the next text message, answering pings and putting fragmented messages together. It fails
+// with errWebSocketClosed once the client closes the connection.
+func (connection *webSocketConnection) ReadMessage() (string, error) {
+	message := []byte{}
+	fragmented := false
+
+	for {
+		final, opcode, payload, err := connection.readFrame()
+		if err != nil {
+			return "", err
+		}
+		connection.ExtendIdleTimeout()
+
+		switch opcode {
+		case webSocketPingFrame:
+			connection.writeFrame(webSocketPongFrame, payload)
+			continue
+		case webSocketPongFrame:
+			continue
+		case webSocketCloseFrame:
+			connection.Close(WebSocketNormalClosure, "")
+			return "", errWebSocketClosed
+		case webSocketBinaryFrame:
+			return "", webSocketError{WebSocketUnsupportedData, "only text messages are supported"}
+		case webSocketTextFrame:
+			if fragmented {
+				return "", webSocketError{WebSocketProtocolError, "expected a continuation frame"}
+			}
+		case webSocketContinuationFrame:
+			if !fragmented {
+				return "", webSocketError{WebSocketProtocolError, "unexpected continuation frame"}
+			}
+		default:
+			return "", webSocketError{WebSocketProtocolError, fmt.Sprintf("unknown opcode %d", opcode)}
+		}
+
+		if len(message)+len(payload) > MaximumWebSocketMessageSize {
+			return "", webSocketError{WebSocketMessageTooBig, "the message is too big"}
+		}
+		message = append(message, payload...)
+
+		if final {
+			return string(message), nil
+		}
+		fragmented = true
+	}
+}
+
+func (connection *webSocketConnection) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	connection.writeLock.Lock()
+	defer connection.writeLock.Unlock()
+
+	connection.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	_, err := connection.conn.Write(frame)
+	return err
+}
+
+func (connection *webSocketConnection) WriteText(message string) error {
+	connection.ExtendIdleTimeout()
+	return connection.writeFrame(webSocketTextFrame, []byte(message))
+}
+
+// Close sends a close frame with the status code and closes the connection. Only the first call has an effect.
+func (connection *webSocketConnection) Close(statusCode uint16, reason string) {
+	connection.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, statusCode)
+		payload = append(payload, reason[:min(len(reason), maximumControlFramePayload-2)]...)
+		connection.writeFrame(webSocketCloseFrame, payload)
+		connection.conn.Close()
+	})
+}
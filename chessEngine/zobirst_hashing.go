@@ -1,5 +1,10 @@
 package chessEngine
 
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
 const (
 	seedValue                  = 1
 	NoEnPassantOnAnyFile uint8 = 8
@@ -80,7 +85,29 @@ func (zobrist *zobrist) GenHash(position *Position) (hash uint64) {
 	return hash
 }
 
+func (zobrist *zobrist) GenPawnHash(position *Position) (hash uint64) {
+	for color := Black; color <= White; color++ {
+		pawns := position.PiecesBitBoard[color][Pawn]
+		for pawns != 0 {
+			square := pawns.PopMostSignificantBit()
+			hash ^= zobrist.GetPieceSquareRandomNumber(Piece{PieceType: Pawn, Color: color}, square)
+		}
+	}
+
+	return hash
+}
+
 func InitializeZobristHashing() {
 	ZobristSingleton = zobrist{}
 	ZobristSingleton.populateRandomNumbers()
 }
+
+// Fingerprint identifies the random numbers, so that hashes saved to files are only used with the same numbers.
+func (zobrist *zobrist) Fingerprint() uint64 {
+	fingerprint := fnv.New64a()
+	binary.Write(fingerprint, binary.LittleEndian, zobrist.pieceSquareRandomNumbers)
+	binary.Write(fingerprint, binary.LittleEndian, zobrist.enPassantFileRandomNumbers)
+	binary.Write(fingerprint, binary.LittleEndian, zobrist.castlingRightsRandomNumbers)
+	binary.Write(fingerprint, binary.LittleEndian, zobrist.sideToMoveRandomNumber)
+	return fingerprint.Sum64()
+}